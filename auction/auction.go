@@ -0,0 +1,116 @@
+// Package auction implements sealed-bid auctions using timelock encryption:
+// each bid is committed to and encrypted towards the round closing the
+// auction, so that no bid can be read before the auction closes, and every
+// bid can be opened once it does, without relying on the bidders to reveal
+// them.
+//
+// The commitment can be published ahead, such as on a ledger, while the
+// ciphertext is shared with the auctioneer, so that anyone can check that the
+// opened bid is the one committed to.
+package auction
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/drand/tlock"
+)
+
+// ErrCommitmentMismatch represents an error when an opened bid doesn't match
+// its commitment.
+var ErrCommitmentMismatch = errors.New("bid doesn't match its commitment")
+
+// nonceSize is the size of the random nonce hiding the value of a bid in its
+// commitment.
+const nonceSize = 32
+
+// Sealed is a bid sealed until the round closing the auction.
+type Sealed struct {
+	// Commitment is the SHA-256 digest of the nonce and the value of the bid.
+	Commitment []byte
+
+	// Ciphertext is the nonce and the value of the bid, timelock encrypted
+	// towards the round closing the auction.
+	Ciphertext []byte
+}
+
+// Opened is a bid opened once the auction closed, holding either its value or
+// the error preventing it from being opened.
+type Opened struct {
+	Value []byte
+	Err   error
+}
+
+// Auction seals and opens the bids of auctions closing at rounds of the
+// network.
+type Auction struct {
+	network tlock.Network
+}
+
+// New constructs an auction using the network of the chain the auctions
+// close on.
+func New(network tlock.Network) Auction {
+	return Auction{network: network}
+}
+
+// SealBid commits to the value and encrypts it towards the round closing the
+// auction.
+func (a Auction) SealBid(value []byte, roundNumber uint64) (Sealed, error) {
+	plaintext := make([]byte, nonceSize, nonceSize+len(value))
+	if _, err := rand.Read(plaintext); err != nil {
+		return Sealed{}, fmt.Errorf("generating nonce: %w", err)
+	}
+	plaintext = append(plaintext, value...)
+
+	var ciphertext bytes.Buffer
+	if err := tlock.New(a.network).Encrypt(&ciphertext, bytes.NewReader(plaintext), roundNumber); err != nil {
+		return Sealed{}, fmt.Errorf("encrypt: %w", err)
+	}
+
+	commitment := sha256.Sum256(plaintext)
+	return Sealed{
+		Commitment: commitment[:],
+		Ciphertext: ciphertext.Bytes(),
+	}, nil
+}
+
+// OpenBids decrypts the bids of the auction closed at the round, fetching and
+// verifying the signature of the round once, and checks them against their
+// commitments. It fails with tlock.ErrTooEarly if the round wasn't reached
+// yet. A bid which can't be opened, such as one sealed towards another round
+// failing with tlock.ErrSessionMismatch, or one not matching its commitment
+// failing with ErrCommitmentMismatch, doesn't prevent opening the others: its
+// error is reported in its Opened, at the same index.
+func (a Auction) OpenBids(roundNumber uint64, bids []Sealed) ([]Opened, error) {
+	session, err := tlock.New(a.network).NewDecryptSession(roundNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := make([]Opened, len(bids))
+	for i, bid := range bids {
+		value, err := open(session, bid)
+		opened[i] = Opened{Value: value, Err: err}
+	}
+
+	return opened, nil
+}
+
+// open decrypts the bid with the session and checks it against its
+// commitment.
+func open(session *tlock.DecryptSession, bid Sealed) ([]byte, error) {
+	var plaintext bytes.Buffer
+	if err := session.Decrypt(&plaintext, bytes.NewReader(bid.Ciphertext)); err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	commitment := sha256.Sum256(plaintext.Bytes())
+	if plaintext.Len() < nonceSize || !bytes.Equal(commitment[:], bid.Commitment) {
+		return nil, ErrCommitmentMismatch
+	}
+
+	return plaintext.Bytes()[nonceSize:], nil
+}
@@ -0,0 +1,68 @@
+package auction_test
+
+import (
+	"testing"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/auction"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+func TestSealOpenBids(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	roundNumber := uint64(1234)
+	a := auction.New(network)
+
+	var bids []auction.Sealed
+	for _, value := range []string{"100", "250", ""} {
+		bid, err := a.SealBid([]byte(value), roundNumber)
+		require.NoError(t, err)
+		bids = append(bids, bid)
+	}
+
+	// the same value is sealed under a different commitment.
+	bid, err := a.SealBid([]byte("100"), roundNumber)
+	require.NoError(t, err)
+	require.NotEqual(t, bids[0].Commitment, bid.Commitment)
+
+	// a bid committing to another value.
+	tampered := bids[1]
+	tampered.Commitment = bids[0].Commitment
+	bids = append(bids, tampered)
+
+	// a bid sealed towards another round.
+	late, err := a.SealBid([]byte("300"), roundNumber+1)
+	require.NoError(t, err)
+	bids = append(bids, late)
+
+	_, err = a.OpenBids(roundNumber, bids)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+	network.AddSignature(roundNumber, signature)
+
+	opened, err := a.OpenBids(roundNumber, bids)
+	require.NoError(t, err)
+	require.Len(t, opened, len(bids))
+
+	for i, value := range []string{"100", "250", ""} {
+		require.NoError(t, opened[i].Err)
+		require.Equal(t, value, string(opened[i].Value))
+	}
+	require.ErrorIs(t, opened[3].Err, auction.ErrCommitmentMismatch)
+	require.ErrorIs(t, opened[4].Err, tlock.ErrSessionMismatch)
+}
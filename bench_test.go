@@ -0,0 +1,110 @@
+package tlock_test
+
+import (
+	"testing"
+
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/encrypt/ibe"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/stretchr/testify/require"
+)
+
+// benchSchemes lists the schemes supported for timelock encryption.
+var benchSchemes = []func() *crypto.Scheme{
+	crypto.NewPedersenBLSUnchainedG1,
+	crypto.NewPedersenBLSUnchainedSwapped,
+	crypto.NewPedersenBLSUnchained,
+}
+
+func BenchmarkTimeLock(b *testing.B) {
+	fileKey := make([]byte, 16)
+
+	for _, newScheme := range benchSchemes {
+		scheme := newScheme()
+		publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+
+		b.Run(scheme.Name, func(b *testing.B) {
+			for range b.N {
+				if _, err := tlock.TimeLock(*scheme, publicKey, 1234, fileKey); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTimeUnlock(b *testing.B) {
+	fileKey := make([]byte, 16)
+
+	for _, newScheme := range benchSchemes {
+		scheme := newScheme()
+		secret := scheme.KeyGroup.Scalar().Pick(random.New())
+		publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+		beacon := chain.Beacon{Round: 1234}
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&beacon))
+		require.NoError(b, err)
+		beacon.Signature = signature
+
+		ciphertext, err := tlock.TimeLock(*scheme, publicKey, beacon.Round, fileKey)
+		require.NoError(b, err)
+
+		// the verification of the beacon and the decryption each need a
+		// pairing, the latter being all the best effort decryption needs.
+		b.Run(scheme.Name, func(b *testing.B) {
+			for range b.N {
+				if _, err := tlock.TimeUnlock(*scheme, publicKey, beacon, ciphertext); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(scheme.Name+"/best-effort", func(b *testing.B) {
+			data, err := tlock.CiphertextToBytes(*scheme, ciphertext)
+			require.NoError(b, err)
+
+			for range b.N {
+				if _, err := tlock.TimeUnlockBestEffort(signature, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTimeUnlockBatch(b *testing.B) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	beacon := chain.Beacon{Round: 1234}
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&beacon))
+	require.NoError(b, err)
+	beacon.Signature = signature
+
+	ciphertexts := make([]*ibe.Ciphertext, 16)
+	for i := range ciphertexts {
+		ciphertexts[i], err = tlock.TimeLock(*scheme, publicKey, beacon.Round, make([]byte, 16))
+		require.NoError(b, err)
+	}
+
+	b.Run("single", func(b *testing.B) {
+		for range b.N {
+			for _, ciphertext := range ciphertexts {
+				if _, err := tlock.TimeUnlock(*scheme, publicKey, beacon, ciphertext); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		for range b.N {
+			if _, err := tlock.TimeUnlockBatch(*scheme, publicKey, beacon, ciphertexts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+//go:build cgo
+
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//export tlock_encrypt
+func tlock_encrypt(network *C.char, chain *C.char, round C.uint64_t, in *C.uint8_t, inLen C.size_t, armored C.int, out **C.uint8_t, outLen *C.size_t, errMsg **C.char) C.int {
+	ciphertext, err := encrypt(goString(network), goString(chain), uint64(round), goBytes(in, inLen), armored != 0)
+	return result(ciphertext, err, out, outLen, errMsg)
+}
+
+//export tlock_decrypt
+func tlock_decrypt(network *C.char, in *C.uint8_t, inLen C.size_t, out **C.uint8_t, outLen *C.size_t, errMsg **C.char) C.int {
+	plaintext, err := decrypt(goString(network), goBytes(in, inLen))
+	return result(plaintext, err, out, outLen, errMsg)
+}
+
+//export tlock_inspect
+func tlock_inspect(in *C.uint8_t, inLen C.size_t, out **C.char, errMsg **C.char) C.int {
+	description, err := inspect(goBytes(in, inLen))
+	if err != nil {
+		setError(errMsg, err)
+		return C.int(status(err))
+	}
+
+	*out = C.CString(string(description))
+	return statusOK
+}
+
+//export tlock_free
+func tlock_free(p unsafe.Pointer) {
+	C.free(p)
+}
+
+// =============================================================================
+
+// goString returns the Go string of the C string, empty if NULL.
+func goString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+// goBytes returns a copy of the C buffer.
+func goBytes(p *C.uint8_t, n C.size_t) []byte {
+	if p == nil || n == 0 {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(p), C.int(n))
+}
+
+// result copies the data to a buffer allocated with malloc on success, or sets
+// the error message, and returns the status code of the error.
+func result(data []byte, err error, out **C.uint8_t, outLen *C.size_t, errMsg **C.char) C.int {
+	if err != nil {
+		setError(errMsg, err)
+		return C.int(status(err))
+	}
+
+	*out = (*C.uint8_t)(C.CBytes(data))
+	*outLen = C.size_t(len(data))
+	return statusOK
+}
+
+// setError sets the error message, allocated with malloc, if requested.
+func setError(errMsg **C.char, err error) {
+	if errMsg != nil {
+		*errMsg = C.CString(err.Error())
+	}
+}
@@ -0,0 +1,141 @@
+// Command libtlock is the tlock shared library, exporting the C functions
+// declared in tlock.h so that desktop applications (Electron through N-API,
+// Swift, C#...) can link the Go implementation instead of shipping tle. It is
+// built with cgo:
+//
+//	go build -buildmode=c-shared -o libtlock.so ./cmd/libtlock
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"filippo.io/age/armor"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/cmd/tle/commands"
+	"github.com/drand/tlock/networks/http"
+)
+
+// These are the status codes returned by the exported functions, as defined
+// in tlock.h.
+const (
+	statusOK       = 0
+	statusError    = 1
+	statusTooEarly = 2
+)
+
+// main is required by the c-shared build mode, but is never called.
+func main() {}
+
+// encrypt timelock encrypts the data towards the round of the chain, reading
+// its information from the relay unless it is a known chain.
+func encrypt(host string, chainHash string, roundNumber uint64, data []byte, armored bool) ([]byte, error) {
+	if host == "" {
+		host = commands.DefaultNetwork
+	}
+	if chainHash == "" {
+		chainHash = commands.DefaultChain
+	}
+
+	network, err := commands.EncryptNetwork(commands.Flags{Network: host, Chain: chainHash})
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if !armored {
+		if err := tlock.New(network).Encrypt(&out, bytes.NewReader(data), roundNumber); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	a := armor.NewWriter(&out)
+	if err := tlock.New(network).Encrypt(a, bytes.NewReader(data), roundNumber); err != nil {
+		return nil, err
+	}
+	if err := a.Close(); err != nil {
+		return nil, fmt.Errorf("close armor: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// decrypt decrypts the armored or binary ciphertext with the signature of its
+// round fetched from the relay, failing with tlock.ErrTooEarly before.
+func decrypt(host string, data []byte) ([]byte, error) {
+	if host == "" {
+		host = commands.DefaultNetwork
+	}
+
+	header, err := tlock.ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Stanzas) == 0 {
+		return nil, fmt.Errorf("%w: no tlock stanza", tlock.ErrInvalidHeader)
+	}
+
+	network, err := http.NewNetwork(host, header.Stanzas[0].ChainHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := tlock.New(network).Decrypt(&out, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// inspectedStanza is a stanza of the JSON description returned by inspect.
+type inspectedStanza struct {
+	Type      string `json:"type"`
+	Round     uint64 `json:"round"`
+	ChainHash string `json:"chain_hash"`
+	Chain     string `json:"chain,omitempty"`
+	Unlock    int64  `json:"unlock,omitempty"`
+}
+
+// inspect returns the JSON description of the header of the ciphertext, with
+// the name of the chains and the unix time of the rounds when they are known,
+// without any network access.
+func inspect(data []byte) ([]byte, error) {
+	header, err := tlock.ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	description := struct {
+		Armored bool              `json:"armored"`
+		Stanzas []inspectedStanza `json:"stanzas"`
+	}{
+		Armored: header.Armored,
+		Stanzas: make([]inspectedStanza, 0, len(header.Stanzas)),
+	}
+	for _, s := range header.Stanzas {
+		stanza := inspectedStanza{Type: s.Type, Round: s.Round, ChainHash: s.ChainHash}
+		if known, ok := tlock.LookupChain(s.ChainHash); ok {
+			stanza.Chain = known.Name
+			stanza.Unlock = known.TimeOf(s.Round).Unix()
+		}
+		description.Stanzas = append(description.Stanzas, stanza)
+	}
+
+	return json.Marshal(description)
+}
+
+// status returns the status code of the error.
+func status(err error) int {
+	switch {
+	case err == nil:
+		return statusOK
+	case errors.Is(err, tlock.ErrTooEarly):
+		return statusTooEarly
+	default:
+		return statusError
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/cmd/tle/commands"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	roundNumber := beacon.Current(time.Now()) + 1
+	ciphertext, err := encrypt(relay.URL, beacon.ChainHash(), roundNumber, []byte("very nice"), true)
+	require.NoError(t, err)
+
+	_, err = decrypt(relay.URL, ciphertext)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+	require.Equal(t, statusTooEarly, status(err))
+
+	beacon.WaitFor(roundNumber)
+	plaintext, err := decrypt(relay.URL, ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", string(plaintext))
+	require.Equal(t, statusOK, status(err))
+}
+
+func TestInspect(t *testing.T) {
+	// the known chains are encrypted to without any network access.
+	ciphertext, err := encrypt("http://127.0.0.1:1", commands.DefaultChain, 1000, []byte("very nice"), false)
+	require.NoError(t, err)
+
+	description, err := inspect(ciphertext)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"armored":false,"stanzas":[{"type":"tlock","round":1000,"chain_hash":"`+commands.DefaultChain+`","chain":"quicknet","unlock":1692806364}]}`, string(description))
+
+	_, err = inspect([]byte("very nice"))
+	require.ErrorIs(t, err, tlock.ErrInvalidHeader)
+	require.Equal(t, statusError, status(err))
+}
@@ -0,0 +1,64 @@
+/*
+ * tlock.h -- github.com/drand/tlock
+ *
+ * C interface of the tlock shared library, built with:
+ *
+ *	go build -buildmode=c-shared -o libtlock.so ./cmd/libtlock
+ *
+ * The functions return TLOCK_OK on success. On failure, they return
+ * TLOCK_ERR, or TLOCK_TOO_EARLY when decrypting before the round is reached,
+ * and set *err to the error message unless err is NULL. The outputs and
+ * error messages are allocated by the library and must be released with
+ * tlock_free.
+ */
+#ifndef TLOCK_H
+#define TLOCK_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define TLOCK_OK 0
+#define TLOCK_ERR 1
+#define TLOCK_TOO_EARLY 2
+
+/*
+ * tlock_encrypt timelock encrypts the in_len bytes of in towards the round of
+ * the chain, and sets *out to the ciphertext of *out_len bytes, armored if
+ * armor is not 0. A NULL network or chain selects the drand relay and the
+ * quicknet chain.
+ */
+int tlock_encrypt(const char *network, const char *chain, uint64_t round,
+                  const uint8_t *in, size_t in_len, int armor,
+                  uint8_t **out, size_t *out_len, char **err);
+
+/*
+ * tlock_decrypt decrypts the armored or binary ciphertext of in_len bytes,
+ * fetching the signature of its round from the network, and sets *out to
+ * the plaintext of *out_len bytes. A NULL network selects the drand relay.
+ */
+int tlock_decrypt(const char *network, const uint8_t *in, size_t in_len,
+                  uint8_t **out, size_t *out_len, char **err);
+
+/*
+ * tlock_inspect sets *out to the NUL terminated JSON description of the
+ * header of the ciphertext of in_len bytes, without any network access:
+ *
+ *	{"armored":false,"stanzas":[{"type":"tlock","round":1,
+ *	  "chain_hash":"...","chain":"quicknet","unlock":1692803367}]}
+ *
+ * chain and unlock are only present for the known chains.
+ */
+int tlock_inspect(const uint8_t *in, size_t in_len, char **out, char **err);
+
+/* tlock_free releases an output or error message of the library. */
+void tlock_free(void *p);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* TLOCK_H */
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnsafeArchive represents an error when an archive entry would be
+// extracted outside of the destination directory.
+var ErrUnsafeArchive = errors.New("archive entry outside of the destination directory")
+
+// ErrExtractNotEmpty represents an error when extracting into a directory
+// which already contains files.
+var ErrExtractNotEmpty = errors.New("the extraction directory isn't empty")
+
+// zstdMagic starts every zstd frame, allowing to detect compressed archives.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ArchiveReader returns a reader streaming a tar archive of the directory,
+// compressed using zstd if requested, without storing it. Regular files,
+// directories and symbolic links are archived, other special files are skipped.
+func ArchiveReader(dir string, compress bool) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(pw, dir, compress))
+	}()
+	return pr
+}
+
+// writeArchive writes the tar archive of the directory to the destination.
+func writeArchive(dst io.Writer, dir string, compress bool) error {
+	if compress {
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		if err := writeArchive(zw, dir, false); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+
+	tw := tar.NewWriter(dst)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() && info.Mode()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archiving %q: %w", dir, err)
+	}
+
+	return tw.Close()
+}
+
+// ExtractTo extracts the tar archive, zstd compressed or not, written by the
+// operation into the directory, which must be empty or absent. The operation
+// is stopped if the extraction fails.
+func ExtractTo(dir string, write func(dst io.Writer) error) error {
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case len(entries) != 0:
+		return fmt.Errorf("%w: %q", ErrExtractNotEmpty, dir)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	extractErr := extractArchive(pr, dir)
+	pr.CloseWithError(extractErr)
+
+	// the error of the operation explains the extraction errors it causes.
+	if err := <-done; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return err
+	}
+	return extractErr
+}
+
+// extractArchive extracts the tar archive into the directory, refusing any
+// entry which would end up outside of it.
+func extractArchive(src io.Reader, dir string) error {
+	br := bufio.NewReader(src)
+	if start, _ := br.Peek(len(zstdMagic)); bytes.Equal(start, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		src = zr
+	} else {
+		src = br
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("%w: %q", ErrUnsafeArchive, hdr.Name)
+		}
+		name := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+
+		// the links extracted before can lead the entry outside of the
+		// directory even though each of them points within it.
+		if err := checkParents(root, name); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrUnsafeArchive, hdr.Name, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, hdr.FileInfo().Mode().Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, name, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// links can only point within the directory, so that no later
+			// entry can be written outside of it through them.
+			target := path.Join(path.Dir(hdr.Name), hdr.Linkname)
+			if path.IsAbs(hdr.Linkname) || !filepath.IsLocal(filepath.FromSlash(target)) {
+				return fmt.Errorf("%w: %q links to %q", ErrUnsafeArchive, hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkParents fails if the parent directory of the named path, once its
+// symbolic links are resolved, isn't within the root, which is resolved. The
+// parent directories which don't exist yet are created within the deepest
+// existing one, which must then be within the root.
+func checkParents(root string, name string) error {
+	parent := filepath.Dir(name)
+	for {
+		resolved, err := filepath.EvalSymlinks(parent)
+		if err == nil {
+			rel, err := filepath.Rel(root, resolved)
+			if err != nil || !filepath.IsLocal(rel) {
+				return fmt.Errorf("%q resolves to %q", parent, resolved)
+			}
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		// a dangling link can't be created through.
+		if _, err := os.Lstat(parent); err == nil {
+			return fmt.Errorf("%q is a dangling link", parent)
+		}
+		parent = filepath.Dir(parent)
+	}
+}
+
+// extractFile writes the content of the archive entry to the new named file.
+func extractFile(src io.Reader, name string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/networks/registry"
+)
+
+// ErrChainInfoMismatch represents an error when the chain information doesn't
+// hash to the requested chain.
+var ErrChainInfoMismatch = errors.New("chain information doesn't match the chain")
+
+// LoadChainInfo reads the chain information, as served by the /info endpoint
+// of drand relays, from the named file, or from the http or https URL.
+func LoadChainInfo(name string) (*chain.Info, error) {
+	var b []byte
+	var err error
+	if isURL(name) {
+		b, err = fetchChainInfo(name)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading chain info: %w", err)
+	}
+
+	info, err := chain.InfoFromJSON(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decoding chain info %q: %w", name, err)
+	}
+
+	return info, nil
+}
+
+// IsChainInfo reports whether the chain, as given to -c/--chain, names a chain
+// information document, as an http or https URL, a .json file or any other
+// existing file, rather than a chain hash.
+func IsChainInfo(chain string) bool {
+	if _, err := hex.DecodeString(chain); err == nil {
+		return false
+	}
+	if isURL(chain) || strings.HasSuffix(chain, ".json") {
+		return true
+	}
+	_, err := os.Stat(chain)
+
+	return err == nil
+}
+
+// ChainNetwork returns the network of the relay for the chain of the flags.
+// When -c/--chain names a chain information document, the network is pinned to
+// it, so that the chain information served by the relay isn't trusted.
+func ChainNetwork(flags Flags) (*http.Network, error) {
+	if !IsChainInfo(flags.Chain) {
+		return http.NewNetwork(flags.Network, flags.Chain)
+	}
+
+	info, err := LoadChainInfo(flags.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.NewPinnedNetwork(flags.Network, info)
+}
+
+// EncryptNetwork returns the network to encrypt with. Encryption only needs
+// the chain information, so it is read from the --chain-info file, the
+// -c/--chain document, the registry or the cache when available, and is
+// otherwise fetched from the relay and cached. Compensating the clock skew
+// requires the relay though, only pinned to the -c/--chain document if any.
+func EncryptNetwork(flags Flags) (tlock.Network, error) {
+	info, err := localChainInfo(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	chainHash := flags.Chain
+	if info != nil {
+		chainHash = info.HashString()
+	}
+	if err := checkDeprecated(flags, chainHash); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info != nil && (!flags.CompensateSkew || flags.ChainInfo != ""):
+		return fixed.FromInfo(info, nil)
+	case info != nil && IsChainInfo(flags.Chain):
+		return http.NewPinnedNetwork(flags.Network, info)
+	}
+
+	network, err := http.NewNetwork(flags.Network, flags.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache := chainInfoCache(flags.Chain); cache != "" {
+		// failing to cache only means fetching the information again next time.
+		_ = cacheChainInfo(cache, network.Info())
+	}
+
+	return network, nil
+}
+
+// SignatureNetwork returns the network to decrypt with the signature given by
+// --signature or --signature-file, which only needs the chain information:
+// like for EncryptNetwork, it is read from the --chain-info file, the
+// -c/--chain document, the registry or the cache when available, and is
+// otherwise fetched from the relay.
+func SignatureNetwork(flags Flags) (tlock.Network, error) {
+	info, err := localChainInfo(flags)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		return fixed.FromInfo(info, nil)
+	}
+
+	return ChainNetwork(flags)
+}
+
+// localChainInfo returns the chain information of the flags available without
+// the relay, from the --chain-info file, the -c/--chain document, the registry
+// or the cache, or nil if none has it.
+func localChainInfo(flags Flags) (*chain.Info, error) {
+	switch {
+	case flags.ChainInfo != "":
+		info, err := LoadChainInfo(flags.ChainInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		// the chain is read from the file unless explicitly requested.
+		if flags.Chain != DefaultChain && flags.Chain != info.HashString() {
+			return nil, fmt.Errorf("%w: %s is the chain information of %s", ErrChainInfoMismatch, flags.ChainInfo, info.HashString())
+		}
+		return info, nil
+
+	case IsChainInfo(flags.Chain):
+		return LoadChainInfo(flags.Chain)
+	}
+
+	if c, ok := registry.Lookup(flags.Chain); ok {
+		return c.Info, nil
+	}
+
+	// the chain hash authenticates the cached information.
+	if cache := chainInfoCache(flags.Chain); cache != "" {
+		if info, err := LoadChainInfo(cache); err == nil && info.HashString() == flags.Chain {
+			return info, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isURL reports whether the name is an http or https URL.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// fetchChainInfo returns the chain information document at the URL, fetched
+// like the relays are.
+func fetchChainInfo(url string) ([]byte, error) {
+	client, err := http.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// checkDeprecated refuses to encrypt towards a chain deprecated by the
+// registry, unless allowed, naming the compatible chains of the relay.
+func checkDeprecated(flags Flags, chainHash string) error {
+	if c, ok := registry.Lookup(chainHash); ok && c.Deprecated && !flags.AllowDeprecated {
+		return http.NewChainError(flags.Network, chainHash, http.ErrDeprecatedChain)
+	}
+
+	return nil
+}
+
+// chainInfoCache returns the path of the cached chain information of the
+// chain, or the empty string if there is no cache directory.
+func chainInfoCache(chainHash string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "tlock", "chains", filepath.Base(chainHash)+".json")
+}
+
+// cacheChainInfo writes the chain information to the cache file.
+func cacheChainInfo(name string, info *chain.Info) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(name, func(f *os.File) error {
+		return info.ToJSON(f, nil)
+	})
+}
@@ -3,11 +3,17 @@
 package commands
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/drand/tlock/duration"
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -17,6 +23,14 @@ const (
 	DefaultNetwork = "https://api.drand.sh/"
 	// DefaultChain is set to the League of Entropy quicknet chainhash.
 	DefaultChain = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+	// DefaultPattern matches the files considered in an input directory.
+	DefaultPattern = "*.tle"
+	// DefaultHorizon is how far away the round to encrypt towards can be
+	// unless the encryption is forced.
+	DefaultHorizon = "100y"
+	// DefaultMaxSkew is how far the local clock can be from the time of the
+	// beacons for the health check to pass.
+	DefaultMaxSkew = "10s"
 )
 
 // =============================================================================
@@ -24,23 +38,252 @@ const (
 const usage = `tlock v1.3.0 -- github.com/drand/tlock
 
 Usage:
-	tle [--encrypt] (-r round)... [--armor] [-o OUTPUT] [INPUT]
-	tle --decrypt [-o OUTPUT] [INPUT]
-	tle --metadata
+	tle [--encrypt] ((-r round)... | (-D duration)...) [--armor] [--chain-info FILE] [--policy FILE] [--manifest FILE [--manifest-key KEY]] [--timestamp FILE --tsa URL] [--escrow URI] [--recipients-file FILE] [--hide-round FILE] [--allow-overlap] [--no-clobber] [-o OUTPUT] [INPUT]
+	tle --encrypt ((-r round)... | (-D duration)...) [--armor] [--chain-info FILE] [--policy FILE] --in-place [--shred] INPUT
+	tle --encrypt ((-r round)... | (-D duration)...) [--armor] [--policy FILE] --archive DIR [--zstd] [-o OUTPUT]
+	tle --encrypt ((-r round)... | (-D duration)...) --detached FILE [--escrow URI] [--recipients-file FILE] [--no-clobber] [-o OUTPUT] [INPUT]
+	tle --reencrypt ((-r round)... | (-D duration)...) [--armor] [--policy FILE] [--allow-overlap] [--no-clobber] [-o OUTPUT | --in-place] [INPUT]
+	tle --decrypt [(--signature SIGNATURE | --signature-file FILE) [--best-effort] [--chain-info FILE]] [--hide-round FILE | --guess-rounds FIRST-LAST] [--allow-trailing] [--allow-overlap] [--no-clobber] [-o OUTPUT] [INPUT]...
+	tle --decrypt --escrow URI [--allow-overlap] [--no-clobber] [-o OUTPUT] [INPUT]...
+	tle --decrypt --prove FILE [--allow-trailing] [--allow-overlap] [--no-clobber] [-o OUTPUT] [INPUT]
+	tle --decrypt [(--signature SIGNATURE | --signature-file FILE) [--best-effort] [--chain-info FILE]] [--allow-trailing] [--allow-overlap] [--no-clobber] --output-dir OUT [--output-template TEMPLATE] [--report FILE] (INPUT... | --files-from LIST)
+	tle --decrypt [--signature SIGNATURE] --extract DIR [INPUT]
+	tle --decrypt --detached FILE [(--signature SIGNATURE | --signature-file FILE)] [--no-clobber] [-o OUTPUT] [INPUT]
+	tle --metadata [-r round]
+	tle --status [--json] [INPUT]...
+	tle --status [--json] --input-dir DIR [--pattern PATTERN]... [--exclude PATTERN]... [--max-depth DEPTH] [--follow-symlinks]
+	tle --fetch-signature -r round
+	tle --derive-identity -r round [-o OUTPUT]
+	tle --check-proof FILE [INPUT]
+	tle --repair [-o OUTPUT] [INPUT]
+	tle --healthcheck [--max-skew DURATION]
+	tle --generate-vectors --output-dir OUT
+	tle cross-check (-n NETWORK)... INPUT
+	tle instructions [-n NETWORK] [-o OUTPUT] INPUT
+	tle deadman --interval INTERVAL --window WINDOW [--check-in-file FILE] [--once] INPUT
+	tle deadman --check-in [--check-in-file FILE] INPUT
+	tle tranches --parts N --first DURATION [--every INTERVAL] --output-dir OUT [-n NETWORK] [-c CHAIN] [--armor] [--horizon DURATION] [--force] INPUT
+	tle sweep --input-dir DIR --output-dir OUT [--output-template TEMPLATE] [--report FILE] --state STATE [--round-state FILE] [--pattern PATTERN]... [--exclude PATTERN]... [--max-depth DEPTH] [--interval INTERVAL] [--min-delay DELAY] [--max-rps RPS] [--once] [--allow-overlap] [--follow-symlinks | --preserve-links]
 
 Options:
-	-m, --metadata Displays the metadata of drand network in yaml format.
+	-m, --metadata Displays the metadata of drand network in yaml format, and when the round is reached if given.
+	--fetch-signature Displays the hex encoded signature of a past round and whether it verifies.
+	--derive-identity Displays the age identity derived from the signature of a past round, and its recipient.
+	--check-proof  Verifies the proof of decryption in FILE, without network access, and that it was made for INPUT if given.
+	--repair       Reports the damaged parts of INPUT, such as a truncated stanza or body chunk, and writes the header holding its intact stanzas to OUTPUT, see below.
+	--healthcheck  Checks that the relay serves the chain, that its scheme can be used, and that the local clock is within --max-skew of its beacons.
+	--max-skew     How far the local clock can be from the time of the beacons for --healthcheck to pass, or before warning when encrypting with --duration, defaults to 10s.
+	--generate-vectors Writes the test vectors of every scheme supported by tlock into the directory OUT, without network access: a ciphertext file per vector and the manifest.json describing them, for other implementations to check their conformance.
+	-s, --status   Displays the round and unlock time of the inputs, and whether they can be decrypted.
+	--json         Displays the status in json format.
+	--input-dir    Displays the status of every file in the directory DIR and its subdirectories.
+	--pattern      Only considers the files of DIR whose name matches PATTERN, defaults to "*.tle". Can be repeated to match any of them.
+	--exclude      Skips the files and directories of DIR whose name matches PATTERN. Can be repeated.
+	--max-depth    Only walks DEPTH levels of directories, 1 only considering the files of DIR itself. Defaults to the whole tree.
+	--follow-symlinks Walks the files and directories the symbolic links of DIR point to.
 	-e, --encrypt  Encrypt the input to the output. Default if omitted.
 	-d, --decrypt  Decrypt the input to the output.
+	--reencrypt    Decrypt the input and encrypt it again towards another round, without storing the plaintext.
 	-n, --network  The drand API endpoint to use.
-	-c, --chain    The chain to use. Can use either beacon ID name or beacon hash. Use beacon hash in order to ensure public key integrity.
-	-r, --round    The specific round to use to encrypt the message. Cannot be used with --duration.
-	-f, --force    Forces to encrypt against past rounds.
-	-D, --duration How long to wait before the message can be decrypted.
+	-c, --chain    The chain to use. Can use either beacon ID name or beacon hash. Use beacon hash in order to ensure public key integrity. Can also be the path or http(s) URL of a chain information document, which the relay is then pinned to.
+	--max-rps      Limits the requests to the relay to RPS per second on average, retrying the rate limited ones after their Retry-After delay.
+	-r, --round    The specific round to use to encrypt the message, to fetch the signature of, to derive the identity of, or to display the metadata of. Cannot be used with --duration. Can be repeated when encrypting, see below.
+	-f, --force    Forces to encrypt against past rounds, or rounds beyond the horizon.
+	--horizon      How far away the round to encrypt towards can be without --force, defaults to 100y.
+	--allow-deprecated Allows encrypting towards the chains deprecated by the registry, such as fastnet, which are otherwise refused with the compatible chains of the relay to use instead.
+	-D, --duration How long to wait before the message can be decrypted. Can be repeated when encrypting, see below.
+	--align        Encrypts towards the first round at or after the next hour, day or midnight UTC following --duration, one of hour, day or midnight-utc.
+	--compensate-skew Computes the round of --duration from the time of the beacons rather than the local clock, when it's further than --max-skew.
 	-o, --output   Write the result to the file at path OUTPUT.
+	--output-dir   Decrypts each INPUT into the directory OUT, under its name without the .tle extension, or writes the vectors of --generate-vectors into it.
+	--output-template Names the decryption of each INPUT in OUT after the Go TEMPLATE, see below.
+	--report       Writes the report of the decryption of each INPUT into OUT to FILE, as csv if it ends with .csv or json otherwise.
+	--files-from   Decrypts into OUT the NUL-delimited INPUT paths read from LIST, "-" being the standard input.
 	-a, --armor    Encrypt to a PEM encoded format.
-
-If the OUTPUT exists, it will be overwritten.
+	--chain-info   Encrypt, or decrypt with --signature or --signature-file, using the chain information in FILE, as served on the /info endpoint of relays, without network access.
+	--policy       Enforces the rules of the yaml FILE on the encryption, see below.
+	--manifest     Writes the json manifest of the encryption to FILE, see below.
+	--manifest-key Signs the manifest with the ssh private KEY, writing the signature to FILE.sig.
+	--timestamp    Writes the RFC 3161 timestamp of the ciphertext obtained from the time stamp authority at URL to FILE.
+	--tsa          The URL of the time stamp authority, e.g. https://freetsa.org/tsr.
+	--prove        Writes the json proof of the beacon INPUT was decrypted with to FILE, see below.
+	--escrow       Also wraps the file key with the key management service key at URI when encrypting, or decrypts with it regardless of the round, see below.
+	--recipients-file Also encrypts to the age recipients listed in FILE, which can decrypt regardless of the round, see below.
+	--signature    The hex encoded signature of the round to decrypt, avoids fetching it from the network.
+	--signature-file Reads the signature of the round to decrypt from FILE, either hex or base64 encoded, or a beacon in json format as output by drand.
+	--best-effort  Decrypt with the signature only, inferring the scheme without any chain information.
+	--allow-trailing Ignores any data following an armored INPUT instead of failing.
+	--no-clobber   Fails instead of overwriting an existing OUTPUT.
+	--in-place     Replaces INPUT with its encryption or re-encryption, keeping its permissions.
+	--shred        Overwrites the content of INPUT with zeros before replacing it.
+	--archive      Encrypts a tar archive of the directory DIR instead of INPUT.
+	--zstd         Compresses the archive using zstd.
+	--extract      Extracts the decrypted archive into the directory DIR, which must be empty or absent.
+	--detached     Writes the header of the ciphertext to FILE when encrypting, apart from its payload, or reads it from FILE when decrypting, see below.
+	--hide-round   Hides the rounds of the ciphertext with the passphrase read from FILE when encrypting, or reveals them with it when decrypting, see below.
+	--guess-rounds Decrypts a ciphertext whose rounds are hidden by trying each of the rounds from FIRST to LAST, see below.
+	--allow-overlap  Allows OUTPUT to be INPUT, which replaces INPUT, or OUT to overlap DIR.
+
+OUTPUT is only written once the operation succeeded, replacing any existing
+file unless it is INPUT or --no-clobber is given.
+
+When -r/--round or -D/--duration is repeated, the file key is encrypted
+towards each of the rounds: the output can be decrypted once the earliest one
+is reached, and remains decryptable with the signature of any of the later
+ones, e.g. should the signature of the earliest round be unavailable:
+    $ tle -D 30d -D 1y -o secret.tle secret
+--manifest and --timestamp require a single round.
+
+With --detached, the header of the ciphertext, which holds its rounds and wrapped
+file keys in a few hundred bytes, is written to FILE, and only the payload, the
+bulk of the encrypted data, to OUTPUT. The payload can then live in object
+storage while the small header is distributed widely. Both are required to
+decrypt:
+    $ tle -D 30d --detached backup.tle.header -o backup.tle.payload backup.tar
+    $ tle -d --detached backup.tle.header -o backup.tar backup.tle.payload
+
+With --hide-round, the rounds are sealed in the header with the passphrase
+read from FILE, so that holding the ciphertext doesn't disclose when it
+unlocks. Decrypting requires the passphrase, or guessing the rounds once they
+are reached, each guess fetching the signature of its round:
+    $ tle -D 30d --hide-round pass.txt -o secret.tle secret
+    $ tle -d --hide-round pass.txt -o secret secret.tle
+    $ tle -d --guess-rounds 12000000-12100000 -o secret secret.tle
+Anyone can find the rounds by guessing once they are reached, so only the
+unlock time of the ciphertexts which can't be decrypted yet remains hidden.
+
+With --repair, a damaged INPUT is parsed past its damaged parts, which are
+reported on the standard error with the armor line, stanza or body chunk they
+are in, along with whether a stanza holding the file key is intact. The header
+salvaged to OUTPUT tells when INPUT unlocks, even if its payload is lost:
+    $ tle --repair -o damaged.header damaged.tle
+    $ tle --status damaged.header
+If stanzas or the MAC of the header are damaged, the salvaged header can't be
+used to decrypt.
+
+Several INPUT are decrypted in sequence and concatenated to OUTPUT, stopping
+at the first one which can't be decrypted.
+The headers of all INPUT are read first, so that the
+signature of each round is only fetched once however many INPUT share it.
+
+With --files-from, such as with the output of find -print0, the result of each
+INPUT is written to the standard output as a line of json holding the input,
+and either its output or the error which prevented its decryption, e.g.:
+    $ find . -name '*.tle' -print0 | tle -d --output-dir OUT --files-from -
+    {"input":"./a.tle","output":"OUT/a"}
+
+With --report, the status, output, duration, size and error of each INPUT are
+written to FILE once all of them were processed, a failure not preventing the
+decryption of the next INPUT, and the command exits with 1 if any failed. The
+sweep command writes the report of the files processed by each sweep.
+
+With --output-template, the decryption of each INPUT is named in OUT after
+TEMPLATE, using the fields .Dir, .Base and .Name (without the .tle extension)
+of INPUT, and the .Round, .ChainHash and .Unlock time of the stanza with the
+earliest round, e.g.:
+    $ tle -d --output-dir OUT --output-template '{{.Name}}.{{.Unlock.Format "2006-01-02"}}' a.tle
+
+Shredding is best effort only: copy-on-write and journaling filesystems,
+snapshots, backups and the wear leveling of SSDs can keep copies of INPUT.
+
+Encryption towards the chains of the embedded registry, quicknet, quicknet-t
+and the deprecated fastnet, doesn't require network access. For other chains,
+it caches the chain information of the relay in the user cache directory, so
+that further encryptions towards the same chain don't require network access.
+
+A policy FILE lists rules applying to the inputs matching their paths, or to
+every input if they have none, which can require a chain, an armored output,
+an escrow of the file key with --escrow, and a minimum and maximum duration
+until the round unlocks:
+    rules:
+      - name: finance
+        paths: ["finance/*", "*.xlsx"]
+        chain: 52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971
+        min_duration: 1d
+        max_duration: 1y
+        armor: true
+        escrow: awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow
+The path patterns without a separator match the base name of INPUT, and the
+directory of --archive is matched as INPUT. The policy can also be set for
+every encryption using the TLE_POLICY environment variable.
+
+A manifest records the SHA-256 of the plaintext and of the ciphertext, the
+round, the chain hash and the time of the encryption, allowing to prove what
+was escrowed without decrypting it. Its signature can be verified using:
+    $ ssh-keygen -Y verify -f allowed_signers -I IDENTITY -n tlock-manifest -s FILE.sig < FILE
+
+A timestamp proves that the ciphertext existed, and thus that its plaintext was
+locked, at the time attested by the time stamp authority. It can be verified
+using the certificates of the authority:
+    $ openssl ts -verify -in FILE -data OUTPUT -CAfile cacert.pem -untrusted tsa.crt
+
+A proof records the round and signature INPUT was decrypted with, along with
+the chain information, public key and scheme they verify against, as evidence
+that the decryption only used a validly signed beacon. It can be verified by
+anyone, without network access, using:
+    $ tle --check-proof FILE INPUT
+
+An escrow URI is either awskms://ARN, using the AWS_ACCESS_KEY_ID,
+AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables,
+gcpkms://projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY,
+using the access token in the GOOGLE_OAUTH_ACCESS_TOKEN environment variable,
+or vault://MOUNT/keys/KEY for a key of the Vault transit engine mounted at
+MOUNT, using the VAULT_ADDR, VAULT_NAMESPACE and VAULT_TOKEN environment
+variables, or VAULT_ROLE_ID and VAULT_SECRET_ID to log in with an AppRole
+mounted at VAULT_APPROLE_MOUNT, approle by default.
+It provides a break-glass path to decrypt before the round, controlled by the
+access policies of the key:
+    $ tle -d --escrow awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow INPUT
+
+A recipients file lists age1 X25519 recipients, one per line, e.g. of auditors
+who must be able to decrypt right away while everyone else waits for the round. The tlock
+stanza always comes first in the header, followed by the escrow stanza if any,
+then by the stanzas of the recipients in the order of the file. The recipients
+decrypt with age itself, which skips the tlock stanza:
+    $ age -d -i auditor.key -o OUTPUT INPUT
+
+Re-encryption requires the round of INPUT to be reached on CHAIN, and allows
+to postpone or advance the round of a ciphertext, e.g. to keep it locked for
+a while longer each time, as long as it is re-encrypted in time.
+
+The cross-check command fetches the round INPUT was encrypted towards from
+every NETWORK, verifies the signatures against the chain of INPUT and reports
+whether all the relays agree, before trusting them for decryption.
+
+The instructions command writes human readable instructions on how to decrypt
+INPUT, with and without network access, and estimates when it unlocks.
+
+The sweep command runs until interrupted, checking every INTERVAL (defaults to
+30s) for files of DIR selected as with --status whose round was reached, to
+decrypt them into OUT. The decrypted files are recorded in the STATE file so that a sweep
+can be resumed at any time, and relay requests for a same chain are spaced by
+at least DELAY (defaults to 1s). With --round-state, the highest round served
+by the relay for each chain is recorded in FILE, and the relay going back below
+it fails the decryptions. With --preserve-links, the symbolic links of
+DIR to files of DIR are recreated in OUT towards the decrypted files.
+
+Only the regular files of DIR are considered: symbolic links are skipped unless
+followed or preserved, sockets, devices and named pipes are always skipped, and
+hard links are decrypted as distinct files.
+
+The deadman command keeps INPUT locked as a dead man's switch: each time its
+round is reached, INPUT is re-encrypted in place for another INTERVAL if a
+check-in was recorded using --check-in during the WINDOW preceding the round.
+Otherwise INPUT is left decryptable and the command exits. Check-ins are
+recorded in FILE, which defaults to INPUT.checkin. Since every version of
+INPUT can be decrypted once its own round is reached, only the latest one must
+ever be shared. INTERVAL and WINDOW follow the format of DURATION.
+
+The tranches command splits INPUT into N parts of equal size for a progressive
+disclosure: the first part unlocks after the --first DURATION, and each next
+one INTERVAL after the previous one. The parts are encrypted into OUT, which
+must be empty or absent, as part-1.tle to part-N.tle, numbered to sort in
+order, along with index.json, which lists the round, unlock time, offset and
+size of each part. The parts unlocked so far are decrypted with --output-dir,
+which stops at the first part still locked, and the plaintext of INPUT is the
+concatenation of all the parts:
+    $ tle tranches --parts 4 --first 7d --every 7d --output-dir episodes course.mp4
+    $ tle -d --output-dir plain episodes/part-*.tle
 
 NETWORK defaults to the drand mainnet endpoint https://api.drand.sh/.
 
@@ -52,11 +295,14 @@ https://pl-us.testnet.drand.sh/
 and its unchained network on G2 with chainhash 7672797f548f3f4748ac4bf3352fc6c6b6468c9ad40ad456a397545c6e2df5bf
 Note that if you encrypted something prior to March 2023, this was the only available network and used to be the default.
 
-DURATION, when specified, expects a number followed by one of these units:
-"ns", "us" (or "µs"), "ms", "s", "m", "h", "d", "M", "y".
+DURATION, when specified, expects one or more groups of a number directly
+followed by one of these units, each used at most once, which are added up:
+"s" (seconds), "m" (minutes), "h" (hours), "d" (days), "w" (weeks), "M"
+(months) and "y" (years). Days, weeks, months and years follow the calendar.
 
 Example:
     $ tle -D 10d -o encrypted_file data_to_encrypt
+    $ tle -D 1y2M3d -o encrypted_file data_to_encrypt
 
 After the specified duration:
     $ tle -d -o decrypted_file.txt encrypted_file`
@@ -70,16 +316,79 @@ func PrintUsage(log *log.Logger) {
 
 // Flags represent the values from the command line.
 type Flags struct {
-	Encrypt  bool
-	Decrypt  bool
-	Force    bool
-	Network  string
-	Chain    string
-	Round    uint64
-	Duration string
-	Output   string
-	Armor    bool
-	Metadata bool
+	Encrypt   bool
+	Decrypt   bool
+	ReEncrypt bool
+	Force     bool
+	Network   string
+	Chain     string
+	MaxRPS    float64
+	Round     uint64
+	Duration  string
+	Horizon   string
+	Align     string
+	Output    string
+	OutputDir string
+	FilesFrom string
+	Armor     bool
+	Metadata  bool
+
+	OutputTemplate string
+	Report         string
+
+	ChainInfo    string
+	Policy       string
+	Manifest     string
+	ManifestKey  string
+	Timestamp    string
+	TSA          string
+	Escrow       string
+	AllowOverlap bool
+	NoClobber    bool
+	InPlace      bool
+	Shred        bool
+
+	RecipientsFile  string
+	AllowDeprecated bool
+
+	Detached string
+
+	HideRound   string
+	GuessRounds string
+
+	// Rounds and Durations hold all the values of the repeated round and
+	// duration flags, Round and Duration holding the first one.
+	Rounds    []uint64
+	Durations []string
+
+	Archive string
+	Zstd    bool
+	Extract string
+
+	FetchSignature bool
+	DeriveIdentity bool
+	Prove          string
+	CheckProof     string
+	Signature      string
+	SignatureFile  string
+	BestEffort     bool
+	AllowTrailing  bool
+
+	Healthcheck    bool
+	MaxSkew        string
+	CompensateSkew bool
+
+	GenerateVectors bool
+	Repair          bool
+
+	Status   bool
+	JSON     bool
+	InputDir string
+	Pattern  []string
+	Exclude  []string
+	MaxDepth int
+
+	FollowSymlinks bool
 }
 
 // Parse will parse the environment variables and command line flags. The command
@@ -88,6 +397,7 @@ func Parse() (Flags, error) {
 	f := Flags{
 		Network: DefaultNetwork,
 		Chain:   DefaultChain,
+		Pattern: []string{DefaultPattern},
 	}
 
 	err := envconfig.Process("tle", &f)
@@ -114,6 +424,8 @@ func parseCmdline(f *Flags) {
 	flag.BoolVar(&f.Decrypt, "d", f.Decrypt, "decrypt the input to the output")
 	flag.BoolVar(&f.Decrypt, "decrypt", f.Decrypt, "decrypt the input to the output")
 
+	flag.BoolVar(&f.ReEncrypt, "reencrypt", f.ReEncrypt, "decrypt the input and encrypt it towards another round")
+
 	flag.BoolVar(&f.Force, "f", f.Force, "Forces to encrypt against past rounds")
 	flag.BoolVar(&f.Force, "force", f.Force, "Forces to encrypt against past rounds.")
 
@@ -123,48 +435,409 @@ func parseCmdline(f *Flags) {
 	flag.StringVar(&f.Chain, "c", f.Chain, "chain to use")
 	flag.StringVar(&f.Chain, "chain", f.Chain, "chain to use")
 
-	flag.Uint64Var(&f.Round, "r", f.Round, "the specific round to use; cannot be used with --duration")
-	flag.Uint64Var(&f.Round, "round", f.Round, "the specific round to use; cannot be used with --duration")
+	// the rounds and durations of the command line replace the ones of the
+	// environment.
+	var rounds roundsFlag
+	flag.Var(&rounds, "r", "the specific round to use; cannot be used with --duration")
+	flag.Var(&rounds, "round", "the specific round to use; cannot be used with --duration")
+
+	var durations stringsFlag
+	flag.Var(&durations, "D", "how long to wait before being able to decrypt")
+	flag.Var(&durations, "duration", "how long to wait before being able to decrypt")
 
-	flag.StringVar(&f.Duration, "D", f.Duration, "how long to wait before being able to decrypt")
-	flag.StringVar(&f.Duration, "duration", f.Duration, "how long to wait before being able to decrypt")
+	flag.Float64Var(&f.MaxRPS, "max-rps", f.MaxRPS, "the maximum number of requests per second to the relay")
+
+	flag.StringVar(&f.Horizon, "horizon", f.Horizon, "how far away the round to encrypt towards can be")
+	flag.BoolVar(&f.AllowDeprecated, "allow-deprecated", f.AllowDeprecated, "allow encrypting towards deprecated chains")
+
+	flag.StringVar(&f.Align, "align", f.Align, "align the round of the duration to the next hour, day or midnight-utc")
 
 	flag.StringVar(&f.Output, "o", f.Output, "the path to the output file")
 	flag.StringVar(&f.Output, "output", f.Output, "the path to the output file")
 
+	flag.StringVar(&f.OutputDir, "output-dir", f.OutputDir, "the directory to decrypt each input into")
+
+	flag.StringVar(&f.Report, "report", f.Report, "the path to write the json or csv report of the decryptions into the output directory to")
+
+	flag.StringVar(&f.OutputTemplate, "output-template", f.OutputTemplate, "the template of the paths in the output directory")
+
+	flag.StringVar(&f.FilesFrom, "files-from", f.FilesFrom, "the path to the NUL-delimited list of inputs to decrypt")
+
 	flag.BoolVar(&f.Armor, "a", f.Armor, "encrypt to a PEM encoded format")
 	flag.BoolVar(&f.Armor, "armor", f.Armor, "encrypt to a PEM encoded format")
 
+	flag.StringVar(&f.ChainInfo, "chain-info", f.ChainInfo, "the path to the chain information to encrypt with")
+
+	flag.StringVar(&f.Policy, "policy", f.Policy, "the path to the policy enforced on encryptions")
+
+	flag.StringVar(&f.Manifest, "manifest", f.Manifest, "the path to write the manifest of the encryption to")
+	flag.StringVar(&f.ManifestKey, "manifest-key", f.ManifestKey, "the path to the ssh private key signing the manifest")
+
+	flag.StringVar(&f.Timestamp, "timestamp", f.Timestamp, "the path to write the timestamp of the ciphertext to")
+	flag.StringVar(&f.TSA, "tsa", f.TSA, "the URL of the time stamp authority")
+
+	flag.StringVar(&f.Escrow, "escrow", f.Escrow, "the URI of the key management service key escrowing the file key")
+	flag.StringVar(&f.RecipientsFile, "recipients-file", f.RecipientsFile, "the path to the age recipients able to decrypt regardless of the round")
+
 	flag.BoolVar(&f.Metadata, "m", f.Metadata, "get metadata about the drand network")
 	flag.BoolVar(&f.Metadata, "metadata", f.Metadata, "get metadata about the drand network")
 
+	flag.BoolVar(&f.FetchSignature, "fetch-signature", f.FetchSignature, "display the signature of a past round")
+
+	flag.BoolVar(&f.DeriveIdentity, "derive-identity", f.DeriveIdentity, "display the age identity derived from the signature of a past round")
+
+	flag.StringVar(&f.Prove, "prove", f.Prove, "the path to write the proof of the beacon the input was decrypted with to")
+
+	flag.StringVar(&f.CheckProof, "check-proof", f.CheckProof, "the path to the proof of decryption to verify")
+
+	flag.BoolVar(&f.Healthcheck, "healthcheck", f.Healthcheck, "check the relay, the chain and the local clock")
+
+	flag.BoolVar(&f.GenerateVectors, "generate-vectors", f.GenerateVectors, "write the test vectors of every supported scheme")
+
+	flag.BoolVar(&f.Repair, "repair", f.Repair, "report the damaged parts of the input and salvage its header")
+
+	flag.StringVar(&f.MaxSkew, "max-skew", f.MaxSkew, "how far the local clock can be from the time of the beacons")
+
+	flag.BoolVar(&f.CompensateSkew, "compensate-skew", f.CompensateSkew, "compute the round of the duration from the time of the beacons")
+
+	flag.BoolVar(&f.Status, "s", f.Status, "display when the inputs can be decrypted")
+	flag.BoolVar(&f.Status, "status", f.Status, "display when the inputs can be decrypted")
+
+	flag.BoolVar(&f.JSON, "json", f.JSON, "display the status in json format")
+
+	flag.StringVar(&f.InputDir, "input-dir", f.InputDir, "the directory of the files to display the status of")
+
+	// the patterns of the command line replace the default ones.
+	var patterns stringsFlag
+	flag.Var(&patterns, "pattern", "a pattern of the file names in the input directory")
+	flag.Var((*stringsFlag)(&f.Exclude), "exclude", "a pattern of the file and directory names to skip")
+	flag.IntVar(&f.MaxDepth, "max-depth", f.MaxDepth, "how many levels of directories to walk")
+
+	flag.BoolVar(&f.FollowSymlinks, "follow-symlinks", f.FollowSymlinks, "walk the targets of the symbolic links of the input directory")
+
+	flag.StringVar(&f.Signature, "signature", f.Signature, "the hex encoded signature of the round to decrypt")
+
+	flag.StringVar(&f.SignatureFile, "signature-file", f.SignatureFile, "the path to the signature of the round to decrypt")
+
+	flag.BoolVar(&f.BestEffort, "best-effort", f.BestEffort, "decrypt with the signature only, without chain information")
+
+	flag.BoolVar(&f.AllowTrailing, "allow-trailing", f.AllowTrailing, "ignore any data following an armored input")
+
+	flag.BoolVar(&f.AllowOverlap, "allow-overlap", f.AllowOverlap, "allow the output to be the input")
+
+	flag.BoolVar(&f.NoClobber, "no-clobber", f.NoClobber, "never overwrite an existing output file")
+
+	flag.BoolVar(&f.InPlace, "in-place", f.InPlace, "replace the input with its encryption")
+
+	flag.BoolVar(&f.Shred, "shred", f.Shred, "overwrite the input before replacing it")
+
+	flag.StringVar(&f.Detached, "detached", f.Detached, "the path to the detached header of the ciphertext")
+
+	flag.StringVar(&f.HideRound, "hide-round", f.HideRound, "the path to the passphrase hiding the rounds of the ciphertext")
+
+	flag.StringVar(&f.GuessRounds, "guess-rounds", f.GuessRounds, "the FIRST-LAST rounds to guess when the rounds of the ciphertext are hidden")
+
+	flag.StringVar(&f.Archive, "archive", f.Archive, "the directory to encrypt as a tar archive")
+
+	flag.BoolVar(&f.Zstd, "zstd", f.Zstd, "compress the archive using zstd")
+
+	flag.StringVar(&f.Extract, "extract", f.Extract, "the directory to extract the decrypted archive into")
+
 	flag.Parse()
+
+	if len(patterns) != 0 {
+		f.Pattern = patterns
+	}
+	if len(rounds) != 0 {
+		f.Rounds = rounds
+	}
+	if len(f.Rounds) != 0 {
+		f.Round = f.Rounds[0]
+	}
+	if len(durations) != 0 {
+		f.Durations = durations
+	}
+	if len(f.Durations) != 0 {
+		f.Duration = f.Durations[0]
+	}
 }
 
 // validateFlags performs a sanity check of the provided flag information.
 func validateFlags(f *Flags) error {
-	// only one of the three f.Metadata, f.Decrypt or f.Encrypt must be true
+	// only one of f.Metadata, f.FetchSignature, f.DeriveIdentity, f.CheckProof, f.Healthcheck, f.GenerateVectors, f.Repair, f.Status, f.Decrypt or f.Encrypt must be set
 	count := 0
 	if f.Metadata {
 		count++
 	}
+	if f.Status {
+		count++
+	}
+	if f.FetchSignature {
+		count++
+	}
+	if f.DeriveIdentity {
+		count++
+	}
+	if f.CheckProof != "" {
+		count++
+	}
+	if f.Healthcheck {
+		count++
+	}
+	if f.GenerateVectors {
+		count++
+	}
+	if f.Repair {
+		count++
+	}
 	if f.Encrypt {
 		count++
 	}
 	if f.Decrypt {
 		count++
 	}
+	if f.ReEncrypt {
+		count++
+	}
 	if count != 1 {
-		return fmt.Errorf("only one of -m/--metadata, -d/--decrypt or -e/--encrypt must be passed")
+		return fmt.Errorf("only one of -m/--metadata, --fetch-signature, --derive-identity, --check-proof, --healthcheck, --generate-vectors, --repair, -s/--status, -d/--decrypt, -e/--encrypt or --reencrypt must be passed")
+	}
+	if f.JSON && !f.Status {
+		return fmt.Errorf("--json can only be used with -s/--status")
+	}
+	if f.InputDir != "" && !f.Status {
+		return fmt.Errorf("--input-dir can only be used with -s/--status")
+	}
+	if (len(f.Exclude) != 0 || f.MaxDepth != 0) && f.InputDir == "" {
+		return fmt.Errorf("--exclude and --max-depth can only be used with --input-dir")
+	}
+	if f.FollowSymlinks && f.InputDir == "" {
+		return fmt.Errorf("--follow-symlinks can only be used with --input-dir")
+	}
+	if f.Signature != "" && !f.Decrypt {
+		return fmt.Errorf("--signature can only be used with -d/--decrypt")
+	}
+	if f.SignatureFile != "" && !f.Decrypt {
+		return fmt.Errorf("--signature-file can only be used with -d/--decrypt")
+	}
+	if f.Signature != "" && f.SignatureFile != "" {
+		return fmt.Errorf("--signature can't be used with --signature-file")
+	}
+	if f.BestEffort && f.Signature == "" && f.SignatureFile == "" {
+		return fmt.Errorf("--best-effort requires --signature or --signature-file")
+	}
+	if (len(f.Rounds) > 1 || len(f.Durations) > 1) && (!f.Encrypt && !f.ReEncrypt || f.Manifest != "" || f.Timestamp != "") {
+		return fmt.Errorf("several -r/--round or -D/--duration can only be used with -e/--encrypt or --reencrypt, without --manifest or --timestamp")
+	}
+	if f.ChainInfo != "" && !f.Encrypt && (!f.Decrypt || f.Signature == "" && f.SignatureFile == "") {
+		return fmt.Errorf("--chain-info can only be used with -e/--encrypt, or -d/--decrypt with --signature or --signature-file")
+	}
+	if f.ChainInfo != "" && IsChainInfo(f.Chain) {
+		return fmt.Errorf("--chain-info can't be used with a chain information document as -c/--chain")
+	}
+	if f.Policy != "" && !f.Encrypt && !f.ReEncrypt {
+		return fmt.Errorf("--policy can only be used with -e/--encrypt or --reencrypt")
+	}
+	if f.Horizon != "" && !f.Encrypt && !f.ReEncrypt {
+		return fmt.Errorf("--horizon can only be used with -e/--encrypt or --reencrypt")
+	}
+	if f.AllowDeprecated && !f.Encrypt && !f.ReEncrypt {
+		return fmt.Errorf("--allow-deprecated can only be used with -e/--encrypt or --reencrypt")
+	}
+	if f.Horizon != "" {
+		if _, err := duration.Parse(time.Now(), f.Horizon); err != nil {
+			return fmt.Errorf("--horizon: %w", err)
+		}
+	}
+	if f.MaxSkew != "" && !f.Healthcheck && f.Duration == "" {
+		return fmt.Errorf("--max-skew can only be used with --healthcheck or -D/--duration")
+	}
+	if f.MaxRPS < 0 {
+		return fmt.Errorf("--max-rps can't be negative")
+	}
+	if f.Align != "" && f.Duration == "" {
+		return fmt.Errorf("--align can only be used with -D/--duration")
+	}
+	if f.Align != "" && !slices.Contains(Alignments, f.Align) {
+		return fmt.Errorf("--align must be one of %s", strings.Join(Alignments, ", "))
+	}
+	if f.CompensateSkew && f.Duration == "" {
+		return fmt.Errorf("--compensate-skew can only be used with -D/--duration")
+	}
+	if f.MaxSkew != "" {
+		if _, err := duration.Parse(time.Now(), f.MaxSkew); err != nil {
+			return fmt.Errorf("--max-skew: %w", err)
+		}
+	}
+	if f.Manifest != "" && !f.Encrypt {
+		return fmt.Errorf("--manifest can only be used with -e/--encrypt")
+	}
+	if f.ManifestKey != "" && f.Manifest == "" {
+		return fmt.Errorf("--manifest-key requires --manifest")
+	}
+	if f.Timestamp != "" && (!f.Encrypt || f.TSA == "") {
+		return fmt.Errorf("--timestamp can only be used with -e/--encrypt and requires --tsa")
+	}
+	if f.TSA != "" && f.Timestamp == "" {
+		return fmt.Errorf("--tsa requires --timestamp")
+	}
+	if f.Escrow != "" && !f.Encrypt && !f.Decrypt {
+		return fmt.Errorf("--escrow can only be used with -e/--encrypt or -d/--decrypt")
+	}
+	if f.Escrow != "" && (f.Signature != "" || f.SignatureFile != "" || f.AllowTrailing) {
+		return fmt.Errorf("--escrow can't be used with --signature, --signature-file or --allow-trailing")
+	}
+	if f.RecipientsFile != "" && (!f.Encrypt || f.InPlace || f.Archive != "") {
+		return fmt.Errorf("--recipients-file can only be used with -e/--encrypt, without --in-place or --archive")
+	}
+	if f.Detached != "" && (!f.Encrypt && !f.Decrypt || f.Armor || f.InPlace || f.Manifest != "" || f.Timestamp != "") {
+		return fmt.Errorf("--detached can only be used with -e/--encrypt or -d/--decrypt, without -a/--armor, --in-place, --manifest or --timestamp")
+	}
+	if f.Detached != "" && (f.OutputDir != "" || flag.NArg() > 1) {
+		return fmt.Errorf("--detached can only be used on a single INPUT")
+	}
+	if f.HideRound != "" && (!f.Encrypt && !f.Decrypt || f.Manifest != "" || f.BestEffort || f.Prove != "") {
+		return fmt.Errorf("--hide-round can only be used with -e/--encrypt or -d/--decrypt, without --manifest, --best-effort or --prove")
+	}
+	if f.GuessRounds != "" && (!f.Decrypt || f.HideRound != "" || f.BestEffort || f.Escrow != "" || f.Prove != "") {
+		return fmt.Errorf("--guess-rounds can only be used with -d/--decrypt, without --hide-round, --best-effort, --escrow or --prove")
+	}
+	if f.GuessRounds != "" {
+		if _, _, err := ParseRoundRange(f.GuessRounds); err != nil {
+			return fmt.Errorf("--guess-rounds: %w", err)
+		}
+	}
+	if f.Prove != "" && (!f.Decrypt || f.Signature != "" || f.SignatureFile != "" || f.Escrow != "") {
+		return fmt.Errorf("--prove can only be used with -d/--decrypt, without --signature, --signature-file or --escrow")
+	}
+	if f.Prove != "" && (f.OutputDir != "" || flag.NArg() > 1) {
+		return fmt.Errorf("--prove can only be used on a single INPUT")
+	}
+	if f.InPlace && !f.Encrypt && !f.ReEncrypt {
+		return fmt.Errorf("--in-place can only be used with -e/--encrypt or --reencrypt")
+	}
+	if f.InPlace && (f.Output != "" || f.NoClobber) {
+		return fmt.Errorf("--in-place can't be used with -o/--output or --no-clobber")
+	}
+	if f.InPlace && (flag.NArg() != 1 || flag.Arg(0) == "-") {
+		return fmt.Errorf("--in-place requires a single INPUT file")
+	}
+	if f.Shred && !f.InPlace {
+		return fmt.Errorf("--shred requires --in-place")
+	}
+	if f.Archive != "" && (!f.Encrypt || f.InPlace || flag.NArg() != 0) {
+		return fmt.Errorf("--archive can only be used with -e/--encrypt, without INPUT")
+	}
+	if f.Zstd && f.Archive == "" {
+		return fmt.Errorf("--zstd requires --archive")
+	}
+	if f.Extract != "" && (!f.Decrypt || f.Output != "" || flag.NArg() > 1) {
+		return fmt.Errorf("--extract can only be used with -d/--decrypt, without -o/--output, on a single INPUT")
+	}
+	if flag.NArg() > 1 && !f.Decrypt && !f.Status {
+		return fmt.Errorf("several INPUT can only be used with -d/--decrypt or -s/--status")
+	}
+	if f.OutputDir != "" && (!f.Decrypt && !f.GenerateVectors || f.Output != "" || f.Extract != "") {
+		return fmt.Errorf("--output-dir can only be used with -d/--decrypt or --generate-vectors, without -o/--output or --extract")
+	}
+	if f.Report != "" && f.OutputDir == "" {
+		return fmt.Errorf("--report requires --output-dir")
+	}
+	if f.OutputTemplate != "" && f.OutputDir == "" {
+		return fmt.Errorf("--output-template requires --output-dir")
+	}
+	if f.OutputTemplate != "" {
+		if _, err := ParseOutputTemplate(f.OutputTemplate); err != nil {
+			return fmt.Errorf("--output-template: %w", err)
+		}
+	}
+	if f.FilesFrom != "" && (f.OutputDir == "" || flag.NArg() != 0) {
+		return fmt.Errorf("--files-from requires --output-dir, without INPUT")
+	}
+	if f.OutputDir != "" && f.FilesFrom == "" && !f.GenerateVectors && (flag.NArg() == 0 || slices.Contains(flag.Args(), "-")) {
+		return fmt.Errorf("--output-dir requires INPUT files")
+	}
+	if f.AllowOverlap && !f.Encrypt && !f.Decrypt && !f.ReEncrypt {
+		return fmt.Errorf("--allow-overlap can only be used with -e/--encrypt, -d/--decrypt or --reencrypt")
+	}
+	if f.AllowTrailing && !f.Decrypt {
+		return fmt.Errorf("--allow-trailing can only be used with -d/--decrypt")
+	}
+	if f.AllowTrailing && f.BestEffort {
+		return fmt.Errorf("--allow-trailing can't be used with --best-effort")
 	}
 	switch {
 	case f.Metadata:
+		if f.Duration != "" {
+			return fmt.Errorf("-D/--duration can't be used with -m/--metadata")
+		}
 		if f.Chain == "" {
 			return fmt.Errorf("-c/--chain can't be the empty string")
 		}
 		if f.Network == "" {
 			return fmt.Errorf("-n/--network can't be the empty string")
 		}
+	case f.Status:
+		if f.Duration != "" || f.Round != 0 {
+			return fmt.Errorf("-D/--duration and -r/--round can't be used with -s/--status")
+		}
+		if f.Armor {
+			return fmt.Errorf("-a/--armor can't be used with -s/--status")
+		}
+		if f.InputDir != "" && flag.NArg() > 0 {
+			return fmt.Errorf("--input-dir can't be used with INPUT")
+		}
+		if err := f.Selection().Validate(); err != nil {
+			return fmt.Errorf("--pattern, --exclude or --max-depth: %w", err)
+		}
+	case f.FetchSignature:
+		if f.Round == 0 {
+			return fmt.Errorf("-r/--round must be specified with --fetch-signature")
+		}
+		if f.Duration != "" {
+			return fmt.Errorf("-D/--duration can't be used with --fetch-signature")
+		}
+		if f.Armor {
+			return fmt.Errorf("-a/--armor can't be used with --fetch-signature")
+		}
+	case f.DeriveIdentity:
+		if f.Round == 0 {
+			return fmt.Errorf("-r/--round must be specified with --derive-identity")
+		}
+		if f.Duration != "" {
+			return fmt.Errorf("-D/--duration can't be used with --derive-identity")
+		}
+		if f.Armor {
+			return fmt.Errorf("-a/--armor can't be used with --derive-identity")
+		}
+	case f.Healthcheck:
+		if f.Duration != "" || f.Round != 0 {
+			return fmt.Errorf("-D/--duration and -r/--round can't be used with --healthcheck")
+		}
+		if f.Armor || f.Output != "" {
+			return fmt.Errorf("-a/--armor and -o/--output can't be used with --healthcheck")
+		}
+	case f.GenerateVectors:
+		if f.OutputDir == "" || flag.NArg() != 0 {
+			return fmt.Errorf("--generate-vectors requires --output-dir, without INPUT")
+		}
+		if f.Duration != "" || f.Round != 0 || f.Armor {
+			return fmt.Errorf("-D/--duration, -r/--round and -a/--armor can't be used with --generate-vectors")
+		}
+		if f.Report != "" || f.OutputTemplate != "" || f.FilesFrom != "" {
+			return fmt.Errorf("--report, --output-template and --files-from can't be used with --generate-vectors")
+		}
+	case f.Repair:
+		if f.Duration != "" || f.Round != 0 || f.Armor {
+			return fmt.Errorf("-D/--duration, -r/--round and -a/--armor can't be used with --repair")
+		}
+	case f.CheckProof != "":
+		if f.Duration != "" || f.Round != 0 {
+			return fmt.Errorf("-D/--duration and -r/--round can't be used with --check-proof")
+		}
+		if f.Armor || f.Output != "" {
+			return fmt.Errorf("-a/--armor and -o/--output can't be used with --check-proof")
+		}
 	case f.Decrypt:
 		if f.Duration != "" {
 			return fmt.Errorf("-D/--duration can't be used with -d/--decrypt")
@@ -203,3 +876,66 @@ func validateFlags(f *Flags) error {
 
 	return nil
 }
+
+// Selection returns the selection of the files of the input directory.
+func (f Flags) Selection() Selection {
+	links := SkipLinks
+	if f.FollowSymlinks {
+		links = FollowLinks
+	}
+
+	return Selection{Patterns: f.Pattern, Exclude: f.Exclude, MaxDepth: f.MaxDepth, Links: links}
+}
+
+// =============================================================================
+
+// stringsFlag implements the flag.Value interface for flags which can be
+// repeated on the command line.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// roundsFlag implements the flag.Value interface for the round flag, which
+// can be repeated on the command line.
+type roundsFlag []uint64
+
+func (r *roundsFlag) String() string {
+	rounds := make([]string, 0, len(*r))
+	for _, round := range *r {
+		rounds = append(rounds, strconv.FormatUint(round, 10))
+	}
+	return strings.Join(rounds, ",")
+}
+
+func (r *roundsFlag) Set(value string) error {
+	round, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return errors.New("parse error")
+	}
+	*r = append(*r, round)
+	return nil
+}
+
+// parseArgs parses the flags of the flag set and returns the positional
+// arguments, which may appear before, between or after the flags.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -1,127 +1,48 @@
 package commands
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"filippo.io/age"
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/escrow/gcpkms"
+	"github.com/drand/tlock/interop"
+	"github.com/drand/tlock/networks/fixed"
+	dhttp "github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/testsupport"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/crypto/ssh"
 )
 
-func TestParseDuration(t *testing.T) {
-	type test struct {
-		name     string
-		duration string
-		date     time.Time
-		expected time.Duration
-		err      error
-	}
-
-	tests := []test{
-		{
-			name:     "seconds are parsed correctly",
-			duration: "1s",
-			date:     time.Now(),
-			expected: 1 * time.Second,
-		},
-		{
-			name:     "hours are parsed correctly",
-			duration: "1h",
-			date:     time.Now(),
-			expected: 1 * time.Hour,
-		},
-		{
-			name:     "days are parsed correctly",
-			duration: "1d",
-			date:     time.Now(),
-			expected: 24 * time.Hour,
-		},
-		{
-			name:     "months are parsed correctly",
-			duration: "1M",
-			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
-			expected: 31 * 24 * time.Hour,
-		},
-		{
-			name:     "years are parsed correctly",
-			duration: "1y",
-			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
-			expected: 365 * 24 * time.Hour,
-		},
-		{
-			name:     "a mix of timespans parse successfully",
-			duration: "1y1M1s",
-			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
-			expected: 365*24*time.Hour + 31*24*time.Hour + 1*time.Second,
-		},
-		{
-			name:     "a mix of timespans in a funny order parse successfully",
-			duration: "2s1y1M",
-			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
-			expected: 365*24*time.Hour + 31*24*time.Hour + 2*time.Second,
-		},
-		{
-			name:     "times with multiple digits parse successfully",
-			duration: "203m",
-			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
-			expected: 203 * time.Minute,
-		},
-		{
-			name:     "parsing an invalid timespan character fails",
-			duration: "1C",
-			date:     time.Now(),
-			err:      ErrInvalidDurationFormat,
-		},
-		{
-			name:     "missing multipliers fails",
-			duration: "DM",
-			date:     time.Now(),
-			err:      ErrInvalidDurationFormat,
-		},
-		{
-			name:     "0 values are in the middle are allowed",
-			duration: "4y0M1m",
-			date:     time.Now(),
-			// note that this will fail in 2096-2099 since 2100 is not a leap year
-			expected: (4*365+1)*24*time.Hour + 1*time.Minute,
-		},
-		{
-			name:     "total of 0 should also be fine",
-			duration: "0s",
-			date:     time.Now(),
-			expected: 0 * time.Second,
-		},
-		{
-			name:     "if characters are repeated, an error is returned",
-			duration: "3s2s1d1s",
-			date:     time.Now(),
-			err:      ErrDuplicateDuration,
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			seconds, err := parseDurationsAsSeconds(tc.date, tc.duration)
-			if tc.err == nil && err != nil {
-				t.Fatalf("unexpected parse error: %s", err)
-			}
-
-			if tc.err != nil && tc.err != err {
-				t.Fatalf("expecting parsing error '%s'; got %v", ErrInvalidDurationFormat, err)
-			}
-
-			expected := tc.date.Add(tc.expected)
-			result := tc.date.Add(seconds)
-
-			if !result.Equal(tc.date.Add(tc.expected)) {
-				t.Fatalf("expecting end time %s; got %s", expected, result)
-			}
-
-		})
-	}
-}
-
 func TestEncryptionWithDurationOverflow(t *testing.T) {
 	flags := Flags{
 		Encrypt:  true,
@@ -148,3 +69,1743 @@ func TestEncryptionWithDurationOverflowUsingOtherUnits(t *testing.T) {
 	err := Encrypt(flags, os.Stdout, bytes.NewBufferString("very nice"), nil)
 	require.ErrorIs(t, err, ErrInvalidDurationValue)
 }
+
+func TestEncryptRound(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+	now := time.Now()
+
+	_, err = encryptRound(Flags{Round: 1}, network, now)
+	require.ErrorIs(t, err, ErrRoundInPast)
+
+	roundNumber, err := encryptRound(Flags{Round: 1, Force: true}, network, now)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), roundNumber)
+
+	_, err = encryptRound(Flags{Duration: "101y"}, network, now)
+	require.ErrorIs(t, err, ErrBeyondHorizon)
+
+	_, err = encryptRound(Flags{Duration: "2d", Horizon: "1d"}, network, now)
+	require.ErrorIs(t, err, ErrBeyondHorizon)
+
+	_, err = encryptRound(Flags{Duration: "2d", Horizon: "1d", Force: true}, network, now)
+	require.NoError(t, err)
+
+	_, err = encryptRound(Flags{Round: math.MaxUint64}, network, now)
+	require.ErrorIs(t, err, ErrRoundOverflow)
+
+	_, err = encryptRound(Flags{Round: math.MaxUint64, Force: true}, network, now)
+	require.ErrorIs(t, err, ErrRoundOverflow)
+}
+
+func TestEncryptRounds(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+
+	var ciphertext bytes.Buffer
+	flags := Flags{Encrypt: true, Duration: "1y", Durations: []string{"1y", "30d"}}
+	require.NoError(t, Encrypt(flags, &ciphertext, strings.NewReader("twice"), network))
+
+	// the stanzas are sorted from the earliest round.
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, header.Stanzas, 2)
+	require.Less(t, header.Stanzas[0].Round, header.Stanzas[1].Round)
+	require.Equal(t, network.Current(time.Now().AddDate(0, 0, 30)), header.Stanzas[0].Round)
+
+	// every round is checked against the horizon.
+	flags = Flags{Encrypt: true, Duration: "1d", Durations: []string{"1d", "2d"}, Horizon: "1d"}
+	require.ErrorIs(t, Encrypt(flags, io.Discard, strings.NewReader("twice"), network), ErrBeyondHorizon)
+}
+
+func TestEncryptRecipientsFile(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+
+	auditor, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	name := filepath.Join(t.TempDir(), "auditors.txt")
+	content := "# auditors\n" + auditor.Recipient().String() + "\n\n" + other.Recipient().String() + "\n"
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+
+	var ciphertext bytes.Buffer
+	flags := Flags{Encrypt: true, Duration: "1d", RecipientsFile: name}
+	require.NoError(t, Encrypt(flags, &ciphertext, strings.NewReader("audited"), network))
+
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, header.Stanzas, 1)
+
+	for _, identity := range []age.Identity{auditor, other} {
+		r, err := age.Decrypt(bytes.NewReader(ciphertext.Bytes()), identity)
+		require.NoError(t, err)
+		plaintext, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "audited", string(plaintext))
+	}
+
+	require.NoError(t, os.WriteFile(name, []byte("# nobody\n"), 0o600))
+	require.Error(t, Encrypt(flags, io.Discard, strings.NewReader("audited"), network))
+
+	require.NoError(t, os.WriteFile(name, []byte("age1invalid\n"), 0o600))
+	require.Error(t, Encrypt(flags, io.Discard, strings.NewReader("audited"), network))
+}
+
+func TestAlignTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	tests := []struct {
+		t     time.Time
+		align string
+		want  time.Time
+	}{
+		{time.Date(2024, 3, 1, 10, 20, 0, 0, time.UTC), AlignHour, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), AlignHour, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 12, 31, 23, 0, 1, 0, time.UTC), AlignDay, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 0, 30, 0, 0, paris), AlignDay, time.Date(2024, 3, 2, 0, 0, 0, 0, paris)},
+		{time.Date(2024, 3, 1, 0, 30, 0, 0, paris), AlignMidnightUTC, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 3, 1, 1, 30, 0, 0, paris), AlignMidnightUTC, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := alignTime(test.t, test.align)
+		require.NoError(t, err)
+		require.True(t, test.want.Equal(got), "%s aligned to %s: got %s, want %s", test.t, test.align, got, test.want)
+	}
+
+	_, err = alignTime(time.Now(), "week")
+	require.Error(t, err)
+}
+
+func TestEncryptRoundAligned(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 7*time.Second, time.Now().Add(-time.Hour).Unix()+1, nil)
+	require.NoError(t, err)
+	now := time.Now()
+
+	roundNumber, err := encryptRound(Flags{Duration: "2h", Align: AlignMidnightUTC}, network, now)
+	require.NoError(t, err)
+	boundary, err := alignTime(now.Add(2*time.Hour), AlignMidnightUTC)
+	require.NoError(t, err)
+	require.False(t, network.TimeOf(roundNumber).Before(boundary))
+	require.True(t, network.TimeOf(roundNumber-1).Before(boundary))
+}
+
+func TestInstructions(t *testing.T) {
+	in, err := os.Open("../../../testdata/lorem-tle-testnet-quicknet-t-2024-01-17-15-28.tle")
+	require.NoError(t, err)
+	defer in.Close()
+
+	flags := InstructionsFlags{
+		// an unreachable network must not prevent writing the instructions.
+		Network: "http://127.0.0.1:1",
+		Input:   "testdata/lorem.tle",
+	}
+
+	var out bytes.Buffer
+	err = Instructions(flags, &out, in)
+	require.NoError(t, err)
+
+	require.Contains(t, out.String(), "HOW TO DECRYPT lorem.tle")
+	require.Contains(t, out.String(), "Round:       5423142")
+	require.Contains(t, out.String(), "-c cc9c398442737cbd141526600919edd69f1d6f9b4adb67e4d912fbc64341a9a5")
+	require.Contains(t, out.String(), "Unlocks at:  unknown")
+}
+
+func TestStatusFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.tle", "b.txt", "sub/c.tle", "sub/deeper/d.tle"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+	}
+
+	names, err := StatusFiles(dir, Selection{Patterns: []string{DefaultPattern}, Links: SkipLinks})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.tle"),
+		filepath.Join(dir, "sub/c.tle"),
+		filepath.Join(dir, "sub/deeper/d.tle"),
+	}, names)
+
+	names, err = StatusFiles(dir, Selection{Patterns: []string{"*.txt"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "b.txt")}, names)
+
+	names, err = StatusFiles(dir, Selection{Patterns: []string{"*.txt", "*.tle"}, Exclude: []string{"c*", "deeper"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a.tle"), filepath.Join(dir, "b.txt")}, names)
+
+	names, err = StatusFiles(dir, Selection{Patterns: []string{DefaultPattern}, MaxDepth: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a.tle"), filepath.Join(dir, "sub/c.tle")}, names)
+
+	require.Error(t, Selection{Exclude: []string{"["}}.Validate())
+	require.Error(t, Selection{MaxDepth: -1}.Validate())
+}
+
+func TestStatus(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	// the relay doesn't serve the default chain.
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	unknown, err := fixed.NewNetwork(DefaultChain, scheme.KeyGroup.Point().Pick(random.New()), scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+
+	pending := network.Current(time.Now()) + 1000
+	tests := map[string]struct {
+		network     tlock.Network
+		round       uint64
+		decryptable bool
+		err         string
+		text        string
+	}{
+		"pending":       {network: network, round: pending, text: "in "},
+		"unlocked":      {network: network, round: 1, decryptable: true, text: "yes"},
+		"unknown chain": {network: unknown, round: 1, err: "unknown chain " + DefaultChain, text: "error: unknown chain"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cipherData bytes.Buffer
+			require.NoError(t, tlock.New(test.network).Encrypt(&cipherData, strings.NewReader("very nice"), test.round))
+
+			var text bytes.Buffer
+			flags := Flags{Network: relay.URL}
+			require.NoError(t, Status(flags, &text, bytes.NewReader(cipherData.Bytes()), []string{"-"}, network))
+			require.Contains(t, text.String(), test.text)
+
+			var out bytes.Buffer
+			flags.JSON = true
+			require.NoError(t, Status(flags, &out, &cipherData, []string{"-"}, network))
+
+			var statuses []FileStatus
+			require.NoError(t, json.Unmarshal(out.Bytes(), &statuses))
+			require.Len(t, statuses, 1)
+			status := statuses[0]
+			require.Equal(t, "-", status.File)
+			require.Equal(t, test.round, status.Round)
+			require.Equal(t, test.network.ChainHash(), status.ChainHash)
+			require.Equal(t, test.decryptable, status.Decryptable)
+			if test.err != "" {
+				require.Contains(t, status.Error, test.err)
+				return
+			}
+			require.Empty(t, status.Error)
+			require.Equal(t, network.TimeOf(test.round).Unix(), status.UnlockTime.Unix())
+		})
+	}
+}
+
+func TestSortStatuses(t *testing.T) {
+	now := time.Now()
+	statuses := []FileStatus{
+		{File: "late", UnlockTime: now.Add(time.Hour)},
+		{File: "broken", Error: "invalid age header"},
+		{File: "early", UnlockTime: now.Add(-time.Hour), Decryptable: true},
+	}
+
+	sortStatuses(statuses)
+
+	require.Equal(t, "early", statuses[0].File)
+	require.Equal(t, "late", statuses[1].File)
+	require.Equal(t, "broken", statuses[2].File)
+}
+
+func TestSweepState(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sweep.json")
+
+	state, err := loadSweepState(name)
+	require.NoError(t, err)
+	require.Empty(t, state.Decrypted)
+
+	state.Decrypted["vault/a.tle"] = sweepEntry{Output: "out/a", Round: 1234, ChainHash: DefaultChain}
+	require.NoError(t, saveSweepState(name, state))
+
+	loaded, err := loadSweepState(name)
+	require.NoError(t, err)
+	require.Equal(t, state.Decrypted["vault/a.tle"].Round, loaded.Decrypted["vault/a.tle"].Round)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+
+	err := writeFileAtomic(name, func(f *os.File) error {
+		_, _ = f.WriteString("partial")
+		return errors.New("failure")
+	})
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	err = writeFileAtomic(name, func(f *os.File) error {
+		_, err := f.WriteString("complete")
+		return err
+	})
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "complete", string(b))
+}
+
+func TestEncryptNetwork(t *testing.T) {
+	const chainInfo = "../../../testdata/quicknet-info.json"
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	flags := Flags{
+		Encrypt:   true,
+		Network:   "http://127.0.0.1:1",
+		Chain:     DefaultChain,
+		Round:     1,
+		Force:     true,
+		ChainInfo: chainInfo,
+	}
+
+	network, err := EncryptNetwork(flags)
+	require.NoError(t, err)
+	require.Equal(t, DefaultChain, network.ChainHash())
+
+	var out bytes.Buffer
+	err = Encrypt(flags, &out, bytes.NewBufferString("very nice"), network)
+	require.NoError(t, err)
+	require.NotEmpty(t, out.Bytes())
+
+	flags.Chain = "dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493"
+	_, err = EncryptNetwork(flags)
+	require.ErrorIs(t, err, ErrChainInfoMismatch)
+
+	// the chains of the registry don't need the relay, unless compensating
+	// the clock skew.
+	flags.Chain = DefaultChain
+	flags.ChainInfo = ""
+	network, err = EncryptNetwork(flags)
+	require.NoError(t, err)
+	require.Equal(t, DefaultChain, network.ChainHash())
+
+	flags.CompensateSkew = true
+	_, err = EncryptNetwork(flags)
+	require.Error(t, err)
+	flags.CompensateSkew = false
+
+	// deprecated chains are refused unless allowed.
+	const fastnet = "dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493"
+	flags.Chain = fastnet
+	_, err = EncryptNetwork(flags)
+	require.ErrorIs(t, err, dhttp.ErrDeprecatedChain)
+
+	flags.AllowDeprecated = true
+	network, err = EncryptNetwork(flags)
+	require.NoError(t, err)
+	require.Equal(t, fastnet, network.ChainHash())
+	flags.AllowDeprecated = false
+
+	// without chain information nor cache, the unreachable relay is needed.
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	flags.Chain = beacon.ChainHash()
+	_, err = EncryptNetwork(flags)
+	require.Error(t, err)
+
+	b, err := beacon.MarshalInfo()
+	require.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "info.json")
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+	info, err := LoadChainInfo(name)
+	require.NoError(t, err)
+	require.NoError(t, cacheChainInfo(chainInfoCache(beacon.ChainHash()), info))
+
+	network, err = EncryptNetwork(flags)
+	require.NoError(t, err)
+	require.Equal(t, beacon.ChainHash(), network.ChainHash())
+}
+
+func TestChainInfoAsChain(t *testing.T) {
+	const chainInfo = "../../../testdata/quicknet-info.json"
+
+	b, err := os.ReadFile(chainInfo)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	require.True(t, IsChainInfo(chainInfo))
+	require.True(t, IsChainInfo(server.URL+"/info"))
+	require.True(t, IsChainInfo("./missing.json"))
+	require.False(t, IsChainInfo(DefaultChain))
+
+	flags := Flags{
+		Encrypt: true,
+		Network: "http://127.0.0.1:1",
+		Round:   1,
+		Force:   true,
+	}
+
+	// encryption doesn't contact the relay, whether the document is a file or
+	// a URL.
+	for _, source := range []string{chainInfo, server.URL + "/info"} {
+		flags.Chain = source
+		network, err := EncryptNetwork(flags)
+		require.NoError(t, err)
+		require.Equal(t, DefaultChain, network.ChainHash())
+
+		var out bytes.Buffer
+		require.NoError(t, Encrypt(flags, &out, bytes.NewBufferString("very nice"), network))
+		require.NotEmpty(t, out.Bytes())
+	}
+
+	// the network of the relay is pinned to the document.
+	flags.Chain = chainInfo
+	network, err := ChainNetwork(flags)
+	require.NoError(t, err)
+	require.Equal(t, DefaultChain, network.ChainHash())
+
+	// ciphertexts of other chains aren't decrypted with the chain information
+	// of the relay.
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	var ciphertext bytes.Buffer
+	require.NoError(t, tlock.New(beacon).Encrypt(&ciphertext, bytes.NewBufferString("very nice"), 1))
+	err = Decrypt(Flags{Decrypt: true, Chain: chainInfo}, io.Discard, &ciphertext, network)
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+
+	flags.Chain = "./missing.json"
+	_, err = EncryptNetwork(flags)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCheckSameFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(name, []byte("data"), 0600))
+
+	require.ErrorIs(t, CheckSameFile(name, name), ErrSameFile)
+	require.ErrorIs(t, CheckSameFile(name, filepath.Join(dir, ".", "file")), ErrSameFile)
+
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(name, link))
+	require.ErrorIs(t, CheckSameFile(name, link), ErrSameFile)
+
+	require.NoError(t, CheckSameFile(name, filepath.Join(dir, "other")))
+	require.NoError(t, CheckSameFile("-", name))
+	require.NoError(t, CheckSameFile(name, "-"))
+}
+
+func TestCheckOverlap(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	require.NoError(t, os.Mkdir(in, 0700))
+
+	require.ErrorIs(t, CheckOverlap(in, in), ErrOverlappingDirs)
+	require.ErrorIs(t, CheckOverlap(in, filepath.Join(in, "out")), ErrOverlappingDirs)
+	require.ErrorIs(t, CheckOverlap(in, dir), ErrOverlappingDirs)
+
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(in, link))
+	require.ErrorIs(t, CheckOverlap(in, filepath.Join(link, "missing", "out")), ErrOverlappingDirs)
+
+	require.NoError(t, CheckOverlap(in, filepath.Join(dir, "out")))
+	require.NoError(t, CheckOverlap(in, filepath.Join(dir, "in-out")))
+}
+
+func TestSweepOverlap(t *testing.T) {
+	dir := t.TempDir()
+
+	flags := SweepFlags{
+		InputDir:  dir,
+		OutputDir: filepath.Join(dir, "out"),
+		State:     filepath.Join(t.TempDir(), "state.json"),
+		Pattern:   []string{DefaultPattern},
+		Once:      true,
+	}
+
+	err := Sweep(context.Background(), flags, log.New(io.Discard, "", 0))
+	require.ErrorIs(t, err, ErrOverlappingDirs)
+
+	flags.AllowOverlap = true
+	err = Sweep(context.Background(), flags, log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+}
+
+func TestSweepEarliestRound(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	// the file is decrypted once its earliest round is reached, whatever the
+	// order of its stanzas.
+	in, out := t.TempDir(), t.TempDir()
+	f, err := os.Create(filepath.Join(in, "a.tle"))
+	require.NoError(t, err)
+	later := network.Current(time.Now()) + 1000
+	w, err := age.Encrypt(f, tlock.NewRecipient(network, later), tlock.NewRecipient(network, 1))
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "very nice")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	flags := SweepFlags{
+		Network:   relay.URL,
+		InputDir:  in,
+		OutputDir: out,
+		State:     filepath.Join(t.TempDir(), "state.json"),
+		Pattern:   []string{DefaultPattern},
+		Once:      true,
+	}
+	require.NoError(t, Sweep(context.Background(), flags, log.New(io.Discard, "", 0)))
+
+	b, err := os.ReadFile(filepath.Join(out, "a"))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", string(b))
+}
+
+func TestSweepLink(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(in, "a.tle"), nil, 0600))
+	require.NoError(t, os.Symlink("a.tle", filepath.Join(in, "link.tle")))
+
+	s := sweeper{
+		flags: SweepFlags{InputDir: in, OutputDir: out, PreserveLinks: true},
+		state: sweepState{Decrypted: make(map[string]sweepEntry)},
+	}
+
+	_, err := s.link(filepath.Join(in, "link.tle"))
+	require.ErrorIs(t, err, errLinkPending)
+
+	require.NoError(t, os.WriteFile(filepath.Join(out, "a"), []byte("plain"), 0600))
+	s.state.Decrypted[filepath.Join(in, "a.tle")] = sweepEntry{Output: filepath.Join(out, "a"), Round: 1}
+
+	for range 2 {
+		entry, err := s.link(filepath.Join(in, "link.tle"))
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(out, "link"), entry.Output)
+		require.Equal(t, uint64(1), entry.Round)
+
+		target, err := os.Readlink(filepath.Join(out, "link"))
+		require.NoError(t, err)
+		require.Equal(t, "a", target)
+	}
+
+	outside := filepath.Join(t.TempDir(), "b.tle")
+	require.NoError(t, os.WriteFile(outside, nil, 0600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(in, "outside.tle")))
+	_, err = s.link(filepath.Join(in, "outside.tle"))
+	require.Error(t, err)
+}
+
+func TestReadSignature(t *testing.T) {
+	sig := bytes.Repeat([]byte{0xab, 0x01, 0x7f}, 16)
+	hexSig := hex.EncodeToString(sig)
+
+	tests := map[string]string{
+		"hex":             hexSig + "\n",
+		"base64":          base64.StdEncoding.EncodeToString(sig),
+		"drand json":      `{"round":1234,"randomness":"00","signature":"` + hexSig + `"}`,
+		"relay json":      `{"round": 1234, "signature": "` + hexSig + `"}` + "\n",
+		"fetch-signature": "chain_hash: 52db9ba7\nround: 1234\nsignature: " + hexSig + "\nverified: true\n",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadSignature(strings.NewReader(input))
+			require.NoError(t, err)
+			require.Equal(t, sig, got)
+		})
+	}
+
+	for _, input := range []string{"", "deadbeef", `{"round":1234}`, "not a signature"} {
+		_, err := ReadSignature(strings.NewReader(input))
+		require.ErrorIs(t, err, ErrUnknownSignatureFormat, input)
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out")
+
+	failure := errors.New("failure")
+	err := WriteOutput(name, false, func(dst io.Writer) error {
+		_, _ = io.WriteString(dst, "partial")
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+	_, err = os.Stat(name)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	write := func(content string) func(dst io.Writer) error {
+		return func(dst io.Writer) error {
+			_, err := io.WriteString(dst, content)
+			return err
+		}
+	}
+
+	require.NoError(t, WriteOutput(name, true, write("first")))
+	require.ErrorIs(t, WriteOutput(name, true, write("second")), ErrOutputExists)
+	require.NoError(t, WriteOutput(name, false, write("third")))
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "third", string(b))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestReplaceInPlace(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(name, []byte("plaintext"), 0640))
+
+	failure := errors.New("failure")
+	err := ReplaceInPlace(name, true, func(dst io.Writer) error {
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "plaintext", string(b))
+
+	// a hard link keeps track of the original content.
+	original := filepath.Join(dir, "original")
+	require.NoError(t, os.Link(name, original))
+
+	err = ReplaceInPlace(name, true, func(dst io.Writer) error {
+		_, err := io.WriteString(dst, "ciphertext")
+		return err
+	})
+	require.NoError(t, err)
+
+	b, err = os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "ciphertext", string(b))
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	b, err = os.ReadFile(original)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, len("plaintext")), b)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deeper/c.txt": "c"}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	require.NoError(t, os.Symlink("b.txt", filepath.Join(dir, "sub", "link.txt")))
+
+	for _, compress := range []bool{false, true} {
+		archive, err := io.ReadAll(ArchiveReader(dir, compress))
+		require.NoError(t, err)
+		require.Equal(t, compress, bytes.HasPrefix(archive, zstdMagic))
+
+		out := filepath.Join(t.TempDir(), "out")
+		err = ExtractTo(out, func(dst io.Writer) error {
+			_, err := dst.Write(archive)
+			return err
+		})
+		require.NoError(t, err)
+
+		for name, content := range files {
+			b, err := os.ReadFile(filepath.Join(out, name))
+			require.NoError(t, err)
+			require.Equal(t, content, string(b))
+		}
+		target, err := os.Readlink(filepath.Join(out, "sub", "link.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "b.txt", target)
+
+		err = ExtractTo(out, func(dst io.Writer) error { return nil })
+		require.ErrorIs(t, err, ErrExtractNotEmpty)
+	}
+
+	failure := errors.New("failure")
+	err := ExtractTo(filepath.Join(t.TempDir(), "out"), func(dst io.Writer) error {
+		return failure
+	})
+	require.ErrorIs(t, err, failure)
+}
+
+func TestExtractUnsafeArchive(t *testing.T) {
+	entries := []*tar.Header{
+		{Name: "../escape.txt", Typeflag: tar.TypeReg},
+		{Name: "/absolute.txt", Typeflag: tar.TypeReg},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+	}
+
+	for _, hdr := range entries {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		require.NoError(t, tw.WriteHeader(hdr))
+		require.NoError(t, tw.Close())
+
+		err := ExtractTo(filepath.Join(t.TempDir(), "out"), func(dst io.Writer) error {
+			_, err := dst.Write(archive.Bytes())
+			return err
+		})
+		require.ErrorIs(t, err, ErrUnsafeArchive, hdr.Name)
+	}
+
+	// each link points within the directory, but chained they lead out of it.
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, hdr := range []*tar.Header{
+		{Name: "d/", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "d/l2", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "d/l1", Typeflag: tar.TypeSymlink, Linkname: "l2/.."},
+		{Name: "d/l1/evil", Typeflag: tar.TypeReg, Mode: 0600, Size: 4},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Size != 0 {
+			_, err := tw.Write([]byte("evil"))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+
+	parent := t.TempDir()
+	err := ExtractTo(filepath.Join(parent, "out"), func(dst io.Writer) error {
+		_, err := dst.Write(archive.Bytes())
+		return err
+	})
+	require.ErrorIs(t, err, ErrUnsafeArchive)
+	require.NoFileExists(t, filepath.Join(parent, "evil"))
+}
+
+func TestPolicy(t *testing.T) {
+	info, err := LoadChainInfo("../../../testdata/quicknet-info.json")
+	require.NoError(t, err)
+	network, err := fixed.FromInfo(info, nil)
+	require.NoError(t, err)
+
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	err = os.WriteFile(name, []byte(`rules:
+  - name: finance
+    paths: ["finance/*", "*.xlsx"]
+    min_duration: 1d
+    max_duration: 1y
+    armor: true
+  - chain: dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493
+    paths: ["legacy/*"]
+  - name: hr
+    paths: ["hr/*"]
+    escrow: awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow
+`), 0600)
+	require.NoError(t, err)
+
+	policy, err := LoadPolicy(name)
+	require.NoError(t, err)
+
+	now := time.Now()
+	week := network.Current(now.Add(7 * 24 * time.Hour))
+	hour := network.Current(now.Add(time.Hour))
+
+	const escrow = "awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow"
+	tests := []struct {
+		input  string
+		armor  bool
+		escrow string
+		round  uint64
+		err    string
+	}{
+		{input: "finance/q3.csv", armor: true, round: week},
+		{input: "finance/q3.csv", armor: false, round: week, err: `rule #1 (finance) requires -a/--armor`},
+		{input: "reports/q3.xlsx", armor: true, round: hour, err: `rule #1 (finance) requires a duration of at least 1d`},
+		{input: "q3.xlsx", armor: true, round: network.Current(now.AddDate(2, 0, 0)), err: `rule #1 (finance) requires a duration of at most 1y`},
+		{input: "legacy/old.txt", round: hour, err: `rule #2 requires the chain`},
+		{input: "hr/salaries.csv", round: hour, err: `rule #3 (hr) requires --escrow ` + escrow},
+		{input: "hr/salaries.csv", escrow: "awskms://arn:aws:kms:us-east-1:111122223333:alias/other", round: hour, err: `rule #3 (hr) requires --escrow`},
+		{input: "hr/salaries.csv", escrow: escrow, round: hour},
+		{input: "notes.txt", round: hour},
+		{input: "", round: hour},
+	}
+	for _, test := range tests {
+		err := policy.Check(test.input, Flags{Armor: test.armor, Escrow: test.escrow}, network, test.round, now)
+		if test.err == "" {
+			require.NoError(t, err, test.input)
+			continue
+		}
+		require.ErrorIs(t, err, ErrPolicyViolation, test.input)
+		require.ErrorContains(t, err, test.err, test.input)
+	}
+
+	// misspelled rules are rejected instead of being ignored.
+	err = os.WriteFile(name, []byte("rules:\n  - paths: [\"*\"]\n    armour: true\n"), 0600)
+	require.NoError(t, err)
+	_, err = LoadPolicy(name)
+	require.Error(t, err)
+
+	err = os.WriteFile(name, []byte("rules:\n  - min_duration: 1x\n"), 0600)
+	require.NoError(t, err)
+	_, err = LoadPolicy(name)
+	require.ErrorContains(t, err, "rule #1")
+}
+
+func TestResolveRounds(t *testing.T) {
+	info, err := LoadChainInfo("../../../testdata/quicknet-info.json")
+	require.NoError(t, err)
+	network, err := fixed.FromInfo(info, nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	flags, err := ResolveRounds(Flags{Durations: []string{"1d", "1w"}}, network, now)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{network.Current(now.Add(24 * time.Hour)), network.Current(now.Add(7 * 24 * time.Hour))}, flags.Rounds)
+	require.Empty(t, flags.Durations)
+
+	// the rounds don't move once resolved, whenever they are computed.
+	later := now.Add(time.Hour)
+	roundNumbers, err := encryptRounds(flags, network, later)
+	require.NoError(t, err)
+	require.Equal(t, flags.Rounds, roundNumbers)
+
+	flags, err = ResolveRounds(Flags{Duration: "1d", Align: AlignMidnightUTC}, network, now)
+	require.NoError(t, err)
+	require.NotZero(t, flags.Round)
+	require.Empty(t, flags.Duration)
+	roundNumber, err := encryptRound(flags, network, later)
+	require.NoError(t, err)
+	require.Equal(t, flags.Round, roundNumber)
+}
+
+func TestReEncrypt(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1}))
+	require.NoError(t, err)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+	network.AddSignature(1, signature)
+
+	var ciphertext bytes.Buffer
+	err = Encrypt(Flags{Round: 1, Force: true}, &ciphertext, bytes.NewBufferString("very nice"), network)
+	require.NoError(t, err)
+
+	var reencrypted bytes.Buffer
+	err = ReEncrypt(Flags{Duration: "1d", Armor: true}, &reencrypted, &ciphertext, network)
+	require.NoError(t, err)
+
+	header, err := tlock.ReadHeader(bytes.NewReader(reencrypted.Bytes()))
+	require.NoError(t, err)
+	require.True(t, header.Armored)
+	require.Equal(t, network.Current(time.Now().Add(24*time.Hour)), header.Stanzas[0].Round)
+
+	// the re-encrypted round isn't reached yet.
+	err = ReEncrypt(Flags{Round: 2}, io.Discard, &reencrypted, network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+}
+
+func TestTranches(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+
+	input := filepath.Join(t.TempDir(), "course")
+	require.NoError(t, os.WriteFile(input, []byte("abcdefgh"), 0o600))
+	dir := filepath.Join(t.TempDir(), "episodes")
+	now := time.Now()
+
+	flags := TranchesFlags{Parts: 3, First: "1d", Every: "1d", OutputDir: dir, Input: input}
+	index, err := Tranches(flags, network, now)
+	require.NoError(t, err)
+	require.Equal(t, DefaultChain, index.ChainHash)
+	require.Equal(t, int64(8), index.Size)
+	require.Len(t, index.Tranches, 3)
+	require.Equal(t, network.Current(now.Add(24*time.Hour)), index.Tranches[0].Round)
+	require.Equal(t, network.Current(now.Add(72*time.Hour)), index.Tranches[2].Round)
+
+	var written TranchesIndex
+	b, err := os.ReadFile(filepath.Join(dir, TranchesIndexName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &written))
+	require.Equal(t, index.Tranches, written.Tranches)
+
+	// the parts decrypt to the input once all their rounds are reached.
+	var plaintext bytes.Buffer
+	for i, tranche := range index.Tranches {
+		require.Equal(t, fmt.Sprintf("part-%d.tle", i+1), tranche.File)
+
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: tranche.Round}))
+		require.NoError(t, err)
+		network.AddSignature(tranche.Round, signature)
+
+		f, err := os.Open(filepath.Join(dir, tranche.File))
+		require.NoError(t, err)
+		require.NoError(t, tlock.New(network).Decrypt(&plaintext, f))
+		require.NoError(t, f.Close())
+	}
+	require.Equal(t, "abcdefgh", plaintext.String())
+
+	_, err = Tranches(flags, network, now)
+	require.ErrorIs(t, err, ErrTranchesNotEmpty)
+
+	flags = TranchesFlags{Parts: 3, First: "1d", Every: "1s", OutputDir: t.TempDir(), Input: input}
+	_, err = Tranches(flags, network, now)
+	require.ErrorIs(t, err, ErrTranchesTooClose)
+
+	flags = TranchesFlags{Parts: 3, First: "1d", Every: "1d", Horizon: "2d", OutputDir: t.TempDir(), Input: input}
+	_, err = Tranches(flags, network, now)
+	require.ErrorIs(t, err, ErrBeyondHorizon)
+}
+
+func TestEncryptWithManifest(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+
+	var ciphertext bytes.Buffer
+	manifest, err := EncryptWithManifest(Flags{Duration: "1d", Armor: true}, &ciphertext, bytes.NewBufferString("very nice"), network)
+	require.NoError(t, err)
+
+	plaintextSum, ciphertextSum := sha256.Sum256([]byte("very nice")), sha256.Sum256(ciphertext.Bytes())
+	require.Equal(t, hex.EncodeToString(plaintextSum[:]), manifest.PlaintextSHA256)
+	require.Equal(t, hex.EncodeToString(ciphertextSum[:]), manifest.CiphertextSHA256)
+	require.Equal(t, DefaultChain, manifest.ChainHash)
+
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, header.Stanzas[0].Round, manifest.Round)
+
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	name := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, WriteManifest(name, manifest, keyFile))
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	var written Manifest
+	require.NoError(t, json.Unmarshal(b, &written))
+	require.Equal(t, manifest, written)
+
+	// the signature is verified as ssh-keygen -Y verify does.
+	sigFile, err := os.ReadFile(name + ".sig")
+	require.NoError(t, err)
+	sigBlock, _ := pem.Decode(sigFile)
+	require.Equal(t, "SSH SIGNATURE", sigBlock.Type)
+	require.True(t, bytes.HasPrefix(sigBlock.Bytes, []byte("SSHSIG")))
+
+	var sig struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	require.NoError(t, ssh.Unmarshal(sigBlock.Bytes[6:], &sig))
+	require.Equal(t, manifestNamespace, sig.Namespace)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	require.Equal(t, signer.PublicKey().Marshal(), []byte(sig.PublicKey))
+
+	var signature ssh.Signature
+	require.NoError(t, ssh.Unmarshal([]byte(sig.Signature), &signature))
+
+	digest := sha512.Sum512(b)
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{manifestNamespace, "", "sha512", string(digest[:])})...)
+	require.NoError(t, signer.PublicKey().Verify(signed, &signature))
+
+	signed[len(signed)-1] ^= 1
+	require.Error(t, signer.PublicKey().Verify(signed, &signature))
+}
+
+func TestOutputTemplate(t *testing.T) {
+	stanza := tlock.Stanza{Type: tlock.StanzaType, Round: 1234, ChainHash: DefaultChain}
+	unlock := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	fields, err := newOutputName(filepath.Join("in", "reports", "q1.tle.tle"), "in", stanza, unlock)
+	require.NoError(t, err)
+	require.Equal(t, OutputName{
+		Dir:       "reports",
+		Base:      "q1.tle.tle",
+		Name:      "q1.tle",
+		Round:     1234,
+		ChainHash: DefaultChain,
+		Unlock:    unlock,
+	}, fields)
+
+	tmpl, err := ParseOutputTemplate(`{{.Dir}}/{{.Name}}.{{.Round}}.{{.Unlock.Format "2006-01-02"}}`)
+	require.NoError(t, err)
+	output, err := templateOutput(tmpl, "out", fields)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("out", "reports", "q1.tle.1234.2025-01-02"), output)
+
+	for _, text := range []string{"../{{.Name}}", "/tmp/{{.Name}}", "{{.Missing}}", ""} {
+		tmpl, err := ParseOutputTemplate(text)
+		require.NoError(t, err)
+		_, err = templateOutput(tmpl, "out", fields)
+		require.Error(t, err, text)
+	}
+
+	_, err = ParseOutputTemplate("{{.Name")
+	require.Error(t, err)
+}
+
+// withoutDuration returns the report of the file without its duration, which
+// can't be predicted.
+func withoutDuration(file FileReport) FileReport {
+	file.DurationMS = 0
+	return file
+}
+
+func TestWriteReport(t *testing.T) {
+	report := BatchReport{}
+	report.add(FileReport{Input: "a.tle", Output: "out/a", Status: StatusDecrypted, DurationMS: 12, Bytes: 34})
+	report.add(FileReport{Input: "b,c.tle", Status: StatusFailed, Error: "too early"})
+	require.Equal(t, 1, report.Decrypted)
+	require.Equal(t, 1, report.Failed)
+	require.ErrorIs(t, reportError(report), ErrFilesFailed)
+
+	dir := t.TempDir()
+	require.NoError(t, WriteReport(filepath.Join(dir, "report.csv"), report))
+	b, err := os.ReadFile(filepath.Join(dir, "report.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "input,output,status,duration_ms,bytes,error\na.tle,out/a,decrypted,12,34,\n\"b,c.tle\",,failed,0,0,too early\n", string(b))
+
+	require.NoError(t, WriteReport(filepath.Join(dir, "report.json"), report))
+	b, err = os.ReadFile(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	var decoded BatchReport
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, report, decoded)
+}
+
+func TestDecryptSignatureOffline(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	signature, err := beacon.Signature(1)
+	require.NoError(t, err)
+
+	var ciphertext bytes.Buffer
+	require.NoError(t, Encrypt(Flags{Round: 1, Force: true}, &ciphertext, strings.NewReader("very nice"), beacon))
+
+	b, err := beacon.MarshalInfo()
+	require.NoError(t, err)
+	name := filepath.Join(t.TempDir(), "info.json")
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+
+	// the relay is unreachable, the chain information is found locally.
+	flags := Flags{Decrypt: true, Network: "http://127.0.0.1:1", Chain: beacon.ChainHash(), Signature: hex.EncodeToString(signature)}
+	for _, f := range []Flags{
+		{ChainInfo: name, Chain: beacon.ChainHash()},
+		{Chain: name},
+	} {
+		flags.ChainInfo, flags.Chain = f.ChainInfo, f.Chain
+		var plaintext bytes.Buffer
+		require.NoError(t, Decrypt(flags, &plaintext, bytes.NewReader(ciphertext.Bytes()), nil))
+		require.Equal(t, "very nice", plaintext.String())
+	}
+
+	flags.ChainInfo, flags.Chain = "", beacon.ChainHash()
+	require.Error(t, Decrypt(flags, io.Discard, bytes.NewReader(ciphertext.Bytes()), nil))
+
+	info, err := LoadChainInfo(name)
+	require.NoError(t, err)
+	require.NoError(t, cacheChainInfo(chainInfoCache(beacon.ChainHash()), info))
+	var plaintext bytes.Buffer
+	require.NoError(t, Decrypt(flags, &plaintext, bytes.NewReader(ciphertext.Bytes()), nil))
+	require.Equal(t, "very nice", plaintext.String())
+}
+
+func TestDecryptFiles(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1}))
+	require.NoError(t, err)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a.tle"), filepath.Join(dir, "b.tle")}
+	for i, name := range names {
+		var ciphertext bytes.Buffer
+		err := Encrypt(Flags{Round: 1, Force: true}, &ciphertext, strings.NewReader(string(rune('a'+i))), network)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(name, ciphertext.Bytes(), 0600))
+	}
+
+	// best effort decryption doesn't need the network.
+	flags := Flags{Decrypt: true, Signature: hex.EncodeToString(signature), BestEffort: true}
+
+	var plaintext bytes.Buffer
+	require.NoError(t, DecryptFiles(flags, LocalStorage{}, &plaintext, names, nil))
+	require.Equal(t, "ab", plaintext.String())
+
+	out := filepath.Join(dir, "out")
+	require.NoError(t, DecryptToDir(flags, LocalStorage{}, out, names, nil))
+	for i, name := range []string{"a", "b"} {
+		b, err := os.ReadFile(filepath.Join(out, name))
+		require.NoError(t, err)
+		require.Equal(t, string(rune('a'+i)), string(b))
+	}
+
+	err = DecryptFiles(flags, LocalStorage{}, io.Discard, append(names, filepath.Join(dir, "missing.tle")), nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = DecryptToDir(flags, LocalStorage{}, out, []string{names[0], filepath.Join(t.TempDir(), "a.tle")}, nil)
+	require.ErrorContains(t, err, "would both be decrypted")
+
+	flags.OutputTemplate = "{{.Name}}/{{.Round}}-{{.Base}}"
+	templated := filepath.Join(dir, "templated")
+	require.NoError(t, DecryptToDir(flags, LocalStorage{}, templated, names, nil))
+	for i, name := range []string{"a", "b"} {
+		b, err := os.ReadFile(filepath.Join(templated, name, "1-"+name+".tle"))
+		require.NoError(t, err)
+		require.Equal(t, string(rune('a'+i)), string(b))
+	}
+	flags.OutputTemplate = "{{.ChainHash}}"
+	err = DecryptToDir(flags, LocalStorage{}, templated, names, nil)
+	require.ErrorContains(t, err, "would both be decrypted")
+
+	// the files of several rounds are named after the earliest one.
+	rounds := filepath.Join(dir, "rounds.tle")
+	f, err := os.Create(rounds)
+	require.NoError(t, err)
+	w, err := age.Encrypt(f, tlock.NewRecipient(network, 5000), tlock.NewRecipient(network, 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	flags.OutputTemplate = "{{.Name}}-{{.Round}}"
+	output, err := templateDirOutput(flags, LocalStorage{}, templated, rounds, nil)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(templated, "rounds-100"), output)
+	flags.OutputTemplate = ""
+
+	flags.Report = filepath.Join(dir, "report.json")
+	reported := filepath.Join(dir, "reported")
+	err = DecryptToDir(flags, LocalStorage{}, reported, append(names, filepath.Join(dir, "missing.tle")), nil)
+	require.ErrorIs(t, err, ErrFilesFailed)
+	b, err := os.ReadFile(flags.Report)
+	require.NoError(t, err)
+	var report BatchReport
+	require.NoError(t, json.Unmarshal(b, &report))
+	require.Equal(t, 2, report.Decrypted)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, FileReport{Input: names[0], Output: filepath.Join(reported, "a"), Status: StatusDecrypted, Bytes: 1}, withoutDuration(report.Files[0]))
+	require.Equal(t, StatusFailed, report.Files[2].Status)
+	require.NotEmpty(t, report.Files[2].Error)
+	flags.Report = ""
+
+	// an input without the .tle extension can't be decrypted onto itself.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c"), nil, 0600))
+	err = DecryptToDir(flags, LocalStorage{}, dir, []string{filepath.Join(dir, "c")}, nil)
+	require.ErrorIs(t, err, ErrSameFile)
+}
+
+func TestDecryptFilesFrom(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1}))
+	require.NoError(t, err)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	var ciphertext bytes.Buffer
+	err = Encrypt(Flags{Round: 1, Force: true}, &ciphertext, strings.NewReader("very nice"), network)
+	require.NoError(t, err)
+	name := filepath.Join(dir, "a b.tle")
+	require.NoError(t, os.WriteFile(name, ciphertext.Bytes(), 0600))
+
+	flags := Flags{Decrypt: true, Signature: hex.EncodeToString(signature), BestEffort: true}
+	out := filepath.Join(dir, "out")
+	missing := filepath.Join(dir, "missing.tle")
+	list := strings.NewReader(name + "\x00" + missing + "\x00\x00" + name)
+
+	var results bytes.Buffer
+	err = DecryptFilesFrom(flags, LocalStorage{}, out, &results, list, nil)
+	require.ErrorIs(t, err, ErrFilesFailed)
+	require.ErrorContains(t, err, "2 of 3")
+
+	var decoded []FileResult
+	dec := json.NewDecoder(&results)
+	for dec.More() {
+		var result FileResult
+		require.NoError(t, dec.Decode(&result))
+		decoded = append(decoded, result)
+	}
+	require.Len(t, decoded, 3)
+	require.Equal(t, FileResult{Input: name, Output: filepath.Join(out, "a b")}, decoded[0])
+	require.Equal(t, missing, decoded[1].Input)
+	require.NotEmpty(t, decoded[1].Error)
+	require.Contains(t, decoded[2].Error, "would both be decrypted")
+
+	b, err := os.ReadFile(filepath.Join(out, "a b"))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", string(b))
+}
+
+// memStorage is a Storage keeping the files in memory.
+type memStorage map[string][]byte
+
+func (m memStorage) Open(name string) (io.ReadCloser, error) {
+	b, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memStorage) Create(name string, noClobber bool, write func(dst io.Writer) error) error {
+	if _, exists := m[name]; exists && noClobber {
+		return ErrOutputExists
+	}
+	var b bytes.Buffer
+	if err := write(&b); err != nil {
+		return err
+	}
+	m[name] = b.Bytes()
+	return nil
+}
+
+func (m memStorage) Walk(dir string, sel Selection) ([]string, error) {
+	var names []string
+	for name := range m {
+		if match, _ := sel.Match(filepath.Base(name)); match && within(name, dir) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func TestDecryptStorage(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1}))
+	require.NoError(t, err)
+	network, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Unix(), nil)
+	require.NoError(t, err)
+
+	storage := memStorage{}
+	for _, name := range []string{"vault/a.tle", "vault/sub/b.tle", "vault/c.txt"} {
+		err := storage.Create(name, false, func(dst io.Writer) error {
+			return Encrypt(Flags{Round: 1, Force: true}, dst, strings.NewReader(name), network)
+		})
+		require.NoError(t, err)
+	}
+
+	names, err := storage.Walk("vault", Selection{Patterns: []string{DefaultPattern}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"vault/a.tle", "vault/sub/b.tle"}, names)
+
+	// best effort decryption doesn't need the network.
+	flags := Flags{Decrypt: true, Signature: hex.EncodeToString(signature), BestEffort: true, NoClobber: true}
+	require.NoError(t, DecryptToDir(flags, storage, "out", names, nil))
+	require.Equal(t, "vault/a.tle", string(storage["out/a"]))
+	require.Equal(t, "vault/sub/b.tle", string(storage["out/b"]))
+
+	var results bytes.Buffer
+	err = DecryptFilesFrom(flags, storage, "out", &results, strings.NewReader("vault/a.tle\x00vault/c.txt"), nil)
+	require.ErrorIs(t, err, ErrFilesFailed)
+	require.Contains(t, results.String(), ErrOutputExists.Error())
+	require.Equal(t, "vault/c.txt", string(storage["out/c.txt"]))
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	genTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	status, tamper := 0, false
+
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req timestampRequest
+		_, err = asn1.Unmarshal(body, &req)
+		require.NoError(t, err)
+		require.Equal(t, "application/timestamp-query", r.Header.Get("Content-Type"))
+
+		hashed := req.MessageImprint.HashedMessage
+		if tamper {
+			hashed = make([]byte, len(hashed))
+		}
+
+		// an unsigned token is enough for the response to be parsed.
+		var b cryptobyte.Builder
+		b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1Int64(int64(status))
+			})
+			b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(oidSignedData)
+				b.AddASN1(cryptobyte_asn1.Tag(0).ContextSpecific().Constructed(), func(b *cryptobyte.Builder) {
+					b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1Int64(3)
+						b.AddASN1(cryptobyte_asn1.SET, func(b *cryptobyte.Builder) {})
+						b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+							b.AddASN1ObjectIdentifier(oidTSTInfo)
+							b.AddASN1(cryptobyte_asn1.Tag(0).ContextSpecific().Constructed(), func(b *cryptobyte.Builder) {
+								b.AddASN1(cryptobyte_asn1.OCTET_STRING, func(b *cryptobyte.Builder) {
+									b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+										b.AddASN1Int64(1)
+										b.AddASN1ObjectIdentifier(asn1.ObjectIdentifier{1, 2, 3, 4})
+										b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+											b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+												b.AddASN1ObjectIdentifier(oidSHA256)
+											})
+											b.AddASN1OctetString(hashed)
+										})
+										b.AddASN1Int64(42)
+										b.AddASN1GeneralizedTime(genTime)
+										b.AddASN1BigInt(req.Nonce)
+									})
+								})
+							})
+						})
+					})
+				})
+			})
+		})
+		_, _ = w.Write(b.BytesOrPanic())
+	}))
+	defer tsa.Close()
+
+	digest := sha256.Sum256([]byte("ciphertext"))
+	response, attested, err := RequestTimestamp(context.Background(), tsa.URL, digest[:])
+	require.NoError(t, err)
+	require.NotEmpty(t, response)
+	require.Equal(t, genTime, attested)
+
+	name := filepath.Join(t.TempDir(), "ciphertext.tsr")
+	err = WriteTimestamp(context.Background(), name, tsa.URL, Manifest{CiphertextSHA256: hex.EncodeToString(digest[:])})
+	require.NoError(t, err)
+	require.FileExists(t, name)
+
+	tamper = true
+	_, _, err = RequestTimestamp(context.Background(), tsa.URL, digest[:])
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+
+	status = 2
+	_, _, err = RequestTimestamp(context.Background(), tsa.URL, digest[:])
+	require.ErrorIs(t, err, ErrTimestampRejected)
+}
+
+func TestEscrowKeyWrapper(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+
+	wrapper, err := EscrowKeyWrapper("awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow")
+	require.NoError(t, err)
+	require.Equal(t, "arn:aws:kms:us-east-1:111122223333:alias/escrow", wrapper.KeyID())
+
+	wrapper, err = EscrowKeyWrapper("gcpkms://projects/tlock/locations/global/keyRings/escrow/cryptoKeys/break-glass")
+	require.NoError(t, err)
+	require.Equal(t, "projects/tlock/locations/global/keyRings/escrow/cryptoKeys/break-glass", wrapper.KeyID())
+
+	t.Setenv("VAULT_ADDR", "https://vault.example.com:8200")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	wrapper, err = EscrowKeyWrapper("vault://transit/keys/tlock")
+	require.NoError(t, err)
+	require.Equal(t, "transit/keys/tlock", wrapper.KeyID())
+
+	_, err = EscrowKeyWrapper("azurekv://escrow")
+	require.ErrorIs(t, err, ErrUnknownEscrow)
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	_, err = EscrowKeyWrapper("gcpkms://projects/tlock/locations/global/keyRings/escrow/cryptoKeys/break-glass")
+	require.ErrorIs(t, err, gcpkms.ErrMissingToken)
+}
+
+func TestEncryptDecryptRelay(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	var ciphertext bytes.Buffer
+	err = Encrypt(Flags{Encrypt: true, Duration: "2s", Armor: true}, &ciphertext, strings.NewReader("very nice"), network)
+	require.NoError(t, err)
+
+	var plaintext bytes.Buffer
+	err = Decrypt(Flags{Decrypt: true}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext.Bytes()))
+	require.NoError(t, err)
+	beacon.WaitFor(header.Stanzas[0].Round)
+
+	err = Decrypt(Flags{Decrypt: true}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plaintext.String())
+}
+
+func TestHideRound(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	passphrase := filepath.Join(t.TempDir(), "pass.txt")
+	require.NoError(t, os.WriteFile(passphrase, []byte("very secret\n"), 0600))
+
+	roundNumber := beacon.Current(time.Now()) + 2
+	var ciphertext bytes.Buffer
+	err = Encrypt(Flags{Encrypt: true, Round: roundNumber, HideRound: passphrase}, &ciphertext, strings.NewReader("very nice"), network)
+	require.NoError(t, err)
+
+	var plaintext bytes.Buffer
+	err = Decrypt(Flags{Decrypt: true}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.ErrorIs(t, err, tlock.ErrHiddenRound)
+
+	beacon.WaitFor(roundNumber)
+	err = Decrypt(Flags{Decrypt: true, HideRound: passphrase}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plaintext.String())
+
+	plaintext.Reset()
+	guess := fmt.Sprintf("1-%d", roundNumber+5)
+	err = Decrypt(Flags{Decrypt: true, GuessRounds: guess}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plaintext.String())
+
+	require.NoError(t, os.WriteFile(passphrase, nil, 0600))
+	err = Encrypt(Flags{Encrypt: true, Round: roundNumber, HideRound: passphrase}, &ciphertext, strings.NewReader("very nice"), network)
+	require.ErrorIs(t, err, ErrEmptyPassphrase)
+}
+
+func TestParseRoundRange(t *testing.T) {
+	first, last, err := ParseRoundRange("1000-2000")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), first)
+	require.Equal(t, uint64(2000), last)
+
+	for _, s := range []string{"", "1000", "0-10", "10-5", "a-b", "-10", "1-2-3", "1-18446744073709551615"} {
+		_, _, err := ParseRoundRange(s)
+		require.ErrorIs(t, err, ErrInvalidRoundRange, s)
+	}
+}
+
+func TestDecryptToDirPinsSignatures(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	handler := testsupport.Handler(beacon)
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/public/") && !strings.HasSuffix(r.URL.Path, "/latest") {
+			fetches.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	roundNumber := beacon.Current(time.Now())
+	var names []string
+	for i, round := range []uint64{roundNumber, roundNumber, roundNumber + 1000} {
+		var ciphertext bytes.Buffer
+		require.NoError(t, Encrypt(Flags{Round: round}, &ciphertext, strings.NewReader("very nice"), network))
+		name := filepath.Join(dir, fmt.Sprintf("%d.tle", i))
+		require.NoError(t, os.WriteFile(name, ciphertext.Bytes(), 0600))
+		names = append(names, name)
+	}
+
+	// the files of several rounds are pinned to their earliest one.
+	rounds := filepath.Join(dir, "rounds.tle")
+	f, err := os.Create(rounds)
+	require.NoError(t, err)
+	w, err := age.Encrypt(f, tlock.NewRecipient(network, roundNumber+1000), tlock.NewRecipient(network, roundNumber))
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "very nice")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	pinned := pinSignatures(Flags{Decrypt: true}, LocalStorage{}, append(names, rounds), network)
+	require.Len(t, pinned, 3)
+	require.Equal(t, pinned[names[0]], pinned[names[1]])
+	require.Equal(t, pinned[names[0]], pinned[rounds])
+	require.Equal(t, int32(1), fetches.Load())
+
+	out := filepath.Join(dir, "out")
+	err = DecryptToDir(Flags{Decrypt: true}, LocalStorage{}, out, []string{names[0], names[1], rounds}, network)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), fetches.Load())
+	for _, name := range []string{"0", "1", "rounds"} {
+		b, err := os.ReadFile(filepath.Join(out, name))
+		require.NoError(t, err)
+		require.Equal(t, "very nice", string(b))
+	}
+
+	// the files of rounds which weren't reached are decrypted as usual.
+	err = DecryptToDir(Flags{Decrypt: true}, LocalStorage{}, out, names[2:], network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+}
+
+func TestDecryptWithProof(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	var ciphertext bytes.Buffer
+	err = Encrypt(Flags{Encrypt: true, Round: 1, Force: true}, &ciphertext, strings.NewReader("very nice"), network)
+	require.NoError(t, err)
+
+	var plaintext bytes.Buffer
+	proof, err := DecryptWithProof(Flags{Decrypt: true}, &plaintext, bytes.NewReader(ciphertext.Bytes()), network)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plaintext.String())
+	require.Equal(t, beacon.ChainHash(), proof.ChainHash)
+	require.Equal(t, uint64(1), proof.Round)
+	require.True(t, proof.Verified)
+
+	sig, err := beacon.Signature(1)
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(sig), proof.Signature)
+
+	sum := sha256.Sum256(ciphertext.Bytes())
+	require.Equal(t, hex.EncodeToString(sum[:]), proof.CiphertextSHA256)
+
+	name := filepath.Join(t.TempDir(), "proof.json")
+	require.NoError(t, WriteProof(name, proof))
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, CheckProof(&out, bytes.NewReader(b), nil))
+	require.Contains(t, out.String(), "Proof verified: round 1 of chain "+beacon.ChainHash())
+	require.NoError(t, CheckProof(io.Discard, bytes.NewReader(b), bytes.NewReader(ciphertext.Bytes())))
+
+	err = CheckProof(io.Discard, bytes.NewReader(b), strings.NewReader("another ciphertext"))
+	require.ErrorIs(t, err, ErrInvalidProof)
+
+	tampered := proof
+	other, err := beacon.Sign(2)
+	require.NoError(t, err)
+	tampered.Signature = hex.EncodeToString(other)
+	b, err = json.Marshal(tampered)
+	require.NoError(t, err)
+	err = CheckProof(io.Discard, bytes.NewReader(b), nil)
+	require.ErrorIs(t, err, ErrInvalidProof)
+
+	tampered = proof
+	tampered.ChainHash = DefaultChain
+	b, err = json.Marshal(tampered)
+	require.NoError(t, err)
+	err = CheckProof(io.Discard, bytes.NewReader(b), nil)
+	require.ErrorIs(t, err, ErrInvalidProof)
+}
+
+func TestDeriveIdentity(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	roundNumber := network.Current(time.Now()) + 2
+	err = DeriveIdentity(Flags{DeriveIdentity: true, Round: roundNumber}, io.Discard, network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	beacon.WaitFor(roundNumber)
+	var out bytes.Buffer
+	err = DeriveIdentity(Flags{DeriveIdentity: true, Round: roundNumber}, &out, network)
+	require.NoError(t, err)
+
+	identities, err := age.ParseIdentities(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+
+	sig, err := beacon.Signature(roundNumber)
+	require.NoError(t, err)
+	identity, err := tlock.DeriveKeypair(beacon.ChainHash(), roundNumber, sig)
+	require.NoError(t, err)
+	require.Equal(t, identity.String(), identities[0].(*age.X25519Identity).String())
+	require.Contains(t, out.String(), "# public key: "+identity.Recipient().String())
+}
+
+func TestHealthcheck(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	var out, logs bytes.Buffer
+	flags := Flags{Healthcheck: true, Network: relay.URL, Chain: beacon.ChainHash()}
+	require.NoError(t, Healthcheck(flags, &out, log.New(&logs, "", 0)))
+	require.Contains(t, out.String(), beacon.ChainHash())
+	require.Contains(t, out.String(), beacon.Scheme().Name)
+
+	flags.MaxSkew = "1y"
+	require.NoError(t, Healthcheck(flags, io.Discard, log.New(io.Discard, "", 0)))
+
+	flags.Chain = strings.Repeat("00", 32)
+	err = Healthcheck(flags, io.Discard, log.New(io.Discard, "", 0))
+	require.ErrorIs(t, err, ErrUnhealthy)
+
+	relay.Close()
+	flags.Chain = beacon.ChainHash()
+	err = Healthcheck(flags, io.Discard, log.New(io.Discard, "", 0))
+	require.ErrorIs(t, err, ErrUnhealthy)
+}
+
+func TestGenerateVectors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "vectors")
+	require.NoError(t, GenerateVectors(dir))
+
+	f, err := os.Open(filepath.Join(dir, VectorsManifest))
+	require.NoError(t, err)
+	defer f.Close()
+	file, err := interop.ReadFile(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, file.Vectors)
+
+	for _, vector := range file.Vectors {
+		ciphertext, err := os.ReadFile(filepath.Join(dir, vector.File))
+		require.NoError(t, err)
+
+		header, err := tlock.ReadHeader(bytes.NewReader(ciphertext))
+		require.NoError(t, err)
+		require.Equal(t, vector.Armored, header.Armored)
+		require.Len(t, header.Stanzas, len(vector.Stanzas))
+		require.NoError(t, vector.CheckDecrypt(), vector.Name)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(DefaultChain, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).Encrypt(&cipherData, strings.NewReader("hello world"), 1234))
+	end := bytes.Index(cipherData.Bytes(), []byte("\n---"))
+
+	// the payload and MAC of the ciphertext are lost.
+	var header, logs bytes.Buffer
+	err = Repair(&header, bytes.NewReader(cipherData.Bytes()[:end+1]), log.New(&logs, "", 0))
+	require.NoError(t, err)
+	require.Contains(t, logs.String(), "damaged header")
+	require.Contains(t, logs.String(), "the file key is intact")
+
+	h, err := tlock.ReadHeader(&header)
+	require.NoError(t, err)
+	require.Equal(t, []tlock.Stanza{{Type: tlock.StanzaType, Round: 1234, ChainHash: DefaultChain}}, h.Stanzas)
+
+	err = Repair(io.Discard, strings.NewReader("garbage"), log.New(&logs, "", 0))
+	require.ErrorIs(t, err, tlock.ErrInvalidHeader)
+}
+
+// skewedClock is a network whose beacons are skewed from the local clock.
+type skewedClock struct {
+	tlock.Network
+	skew time.Duration
+}
+
+func (n skewedClock) ClockSkew(time.Time) (time.Duration, error) {
+	return n.skew, nil
+}
+
+func TestCompensateSkew(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Mul(scheme.KeyGroup.Scalar().Pick(random.New()), nil)
+	fixedNetwork, err := fixed.NewNetwork(DefaultChain, publicKey, scheme, 3*time.Second, time.Now().Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+	network := skewedClock{Network: fixedNetwork, skew: 5 * time.Minute}
+	now := time.Now()
+
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+
+	// the offline networks and the rounds aren't affected.
+	got, err := CompensateSkew(Flags{Duration: "1h", CompensateSkew: true}, fixedNetwork, logger)
+	require.NoError(t, err)
+	require.Equal(t, tlock.Network(fixedNetwork), got)
+	got, err = CompensateSkew(Flags{Round: 1, CompensateSkew: true}, network, logger)
+	require.NoError(t, err)
+	require.Equal(t, tlock.Network(network), got)
+	got, err = CompensateSkew(Flags{Duration: "1h", MaxSkew: "10m", CompensateSkew: true}, network, logger)
+	require.NoError(t, err)
+	require.Equal(t, tlock.Network(network), got)
+	require.Empty(t, logs.String())
+
+	// a skew beyond the maximum is only logged without compensation.
+	got, err = CompensateSkew(Flags{Duration: "1h"}, network, logger)
+	require.NoError(t, err)
+	require.Equal(t, tlock.Network(network), got)
+	require.Contains(t, logs.String(), "5m0s ahead of the beacons")
+
+	got, err = CompensateSkew(Flags{Duration: "1h", CompensateSkew: true}, network, logger)
+	require.NoError(t, err)
+	roundNumber, err := encryptRound(Flags{Duration: "1h"}, got, now)
+	require.NoError(t, err)
+	require.Equal(t, fixedNetwork.Current(now.Add(time.Hour-5*time.Minute)), roundNumber)
+	require.Equal(t, fixedNetwork.TimeOf(roundNumber).Add(5*time.Minute), got.TimeOf(roundNumber))
+}
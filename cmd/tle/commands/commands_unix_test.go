@@ -0,0 +1,44 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusFilesLinks(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.tle"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "b.tle"), nil, 0600))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "a.tle"), filepath.Join(dir, "link.tle")))
+	require.NoError(t, os.Symlink(other, filepath.Join(dir, "other")))
+	require.NoError(t, os.Symlink(dir, filepath.Join(dir, "loop")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing.tle"), filepath.Join(dir, "dangling.tle")))
+	require.NoError(t, syscall.Mkfifo(filepath.Join(dir, "fifo.tle"), 0600))
+
+	names, err := StatusFiles(dir, Selection{Patterns: []string{DefaultPattern}, Links: SkipLinks})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a.tle")}, names)
+
+	names, err = StatusFiles(dir, Selection{Patterns: []string{DefaultPattern}, Links: FollowLinks})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.tle"),
+		filepath.Join(dir, "link.tle"),
+		filepath.Join(dir, "other", "b.tle"),
+	}, names)
+
+	names, err = StatusFiles(dir, Selection{Patterns: []string{DefaultPattern}, Links: PreserveLinks})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.tle"),
+		filepath.Join(dir, "dangling.tle"),
+		filepath.Join(dir, "link.tle"),
+	}, names)
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+var ErrRelaysDisagree = errors.New("the relays did not all return the same valid signature")
+
+// CrossCheckFlags represent the values from the command line of the
+// cross-check command.
+type CrossCheckFlags struct {
+	Networks []string
+	Input    string
+}
+
+// ParseCrossCheck will parse the command line arguments of the cross-check
+// command. Validation takes place.
+func ParseCrossCheck(args []string) (CrossCheckFlags, error) {
+	var f CrossCheckFlags
+
+	fs := flag.NewFlagSet("cross-check", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	fs.Var((*stringsFlag)(&f.Networks), "n", "a drand API endpoint to compare")
+	fs.Var((*stringsFlag)(&f.Networks), "network", "a drand API endpoint to compare")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return CrossCheckFlags{}, err
+	}
+
+	if len(positional) != 1 {
+		return CrossCheckFlags{}, fmt.Errorf("cross-check expects exactly one INPUT")
+	}
+	f.Input = positional[0]
+
+	if len(f.Networks) < 2 {
+		return CrossCheckFlags{}, fmt.Errorf("cross-check needs at least two -n/--network to compare")
+	}
+
+	return f, nil
+}
+
+// CrossCheck fetches the round the source was encrypted towards from every
+// relay, verifies the beacons against the chain information pinned by the
+// chainhash of the ciphertext and reports whether they all agree.
+func CrossCheck(dst io.Writer, src io.Reader, relays []string) error {
+	header, err := tlock.ReadHeader(src)
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	agree := true
+	for _, stanza := range header.Stanzas {
+		fmt.Fprintf(dst, "round %d on chain %s:\n", stanza.Round, stanza.ChainHash)
+
+		var reference []byte
+		for _, relay := range relays {
+			sig, err := fetchVerifiedSignature(relay, stanza)
+			if err != nil {
+				agree = false
+				fmt.Fprintf(dst, "\t%s: %v\n", relay, err)
+				continue
+			}
+
+			fmt.Fprintf(dst, "\t%s: verified signature %x\n", relay, sig)
+			if reference == nil {
+				reference = sig
+			} else if !bytes.Equal(reference, sig) {
+				agree = false
+			}
+		}
+	}
+
+	if !agree {
+		return ErrRelaysDisagree
+	}
+
+	fmt.Fprintln(dst, "all relays agree")
+	return nil
+}
+
+// fetchVerifiedSignature retrieves the signature of the stanza round from the
+// relay and verifies it. The client refuses relays advertising chain
+// information which doesn't match the chainhash.
+func fetchVerifiedSignature(relay string, stanza tlock.Stanza) ([]byte, error) {
+	network, err := http.NewNetwork(relay, stanza.ChainHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if current := network.Current(time.Now()); stanza.Round > current {
+		return nil, fmt.Errorf("%w: expected round %d > %d current round", tlock.ErrTooEarly, stanza.Round, current)
+	}
+
+	sig, err := network.Signature(stanza.Round)
+	if err != nil {
+		return nil, fmt.Errorf("fetching signature: %w", err)
+	}
+
+	scheme := network.Scheme()
+	if err := scheme.VerifyBeacon(&chain.Beacon{Round: stanza.Round, Signature: sig}, network.PublicKey()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return sig, nil
+}
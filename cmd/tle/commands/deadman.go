@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/deadman"
+	"github.com/drand/tlock/duration"
+	"github.com/drand/tlock/networks/http"
+)
+
+// DeadmanFlags represent the values from the command line of the deadman
+// command.
+type DeadmanFlags struct {
+	Network     string
+	Interval    string
+	Window      string
+	CheckInFile string
+	CheckIn     bool
+	Once        bool
+	Input       string
+}
+
+// ParseDeadman will parse the command line arguments of the deadman command.
+// Validation takes place.
+func ParseDeadman(args []string) (DeadmanFlags, error) {
+	f := DeadmanFlags{
+		Network: DefaultNetwork,
+	}
+
+	fs := flag.NewFlagSet("deadman", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	fs.StringVar(&f.Network, "n", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Network, "network", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Interval, "interval", f.Interval, "how long the input is locked after each refresh")
+	fs.StringVar(&f.Window, "window", f.Window, "how long before the round of the input a check-in is required")
+	fs.StringVar(&f.CheckInFile, "check-in-file", f.CheckInFile, "the path to the file recording the check-ins")
+	fs.BoolVar(&f.CheckIn, "check-in", f.CheckIn, "record a check-in and exit")
+	fs.BoolVar(&f.Once, "once", f.Once, "refresh only once instead of running continuously")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return DeadmanFlags{}, err
+	}
+	if len(positional) != 1 {
+		return DeadmanFlags{}, fmt.Errorf("deadman expects a single INPUT")
+	}
+	f.Input = positional[0]
+	if f.CheckInFile == "" {
+		f.CheckInFile = f.Input + ".checkin"
+	}
+
+	if f.CheckIn {
+		if f.Interval != "" || f.Window != "" || f.Once {
+			return DeadmanFlags{}, fmt.Errorf("--check-in can't be used with --interval, --window or --once")
+		}
+		return f, nil
+	}
+
+	if f.Interval == "" || f.Window == "" {
+		return DeadmanFlags{}, fmt.Errorf("--interval and --window must be specified")
+	}
+	now := time.Now()
+	if _, err := duration.Parse(now, f.Interval); err != nil {
+		return DeadmanFlags{}, fmt.Errorf("--interval: %w", err)
+	}
+	if _, err := duration.Parse(now, f.Window); err != nil {
+		return DeadmanFlags{}, fmt.Errorf("--window: %w", err)
+	}
+
+	return f, nil
+}
+
+// Deadman records a check-in, or keeps the input locked as long as check-ins
+// are recorded, until the context is done.
+func Deadman(ctx context.Context, flags DeadmanFlags, log *log.Logger) error {
+	if flags.CheckIn {
+		return deadman.CheckIn(flags.CheckInFile)
+	}
+
+	f, err := os.Open(flags.Input)
+	if err != nil {
+		return fmt.Errorf("failed to open input file %q: %v", flags.Input, err)
+	}
+	header, err := tlock.ReadHeader(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	network, err := http.NewNetwork(flags.Network, header.Stanzas[0].ChainHash)
+	if err != nil {
+		return err
+	}
+
+	s := deadman.Switch{
+		Name:     flags.Input,
+		CheckIn:  flags.CheckInFile,
+		Interval: flags.Interval,
+		Window:   flags.Window,
+		Network:  network,
+	}
+
+	if !flags.Once {
+		return s.Run(ctx, log)
+	}
+
+	next, err := s.Refresh(time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("deadman: %s is locked until %s", flags.Input, next.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,406 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/escrow"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/drand/tlock/networks/http"
+)
+
+// ErrFilesFailed represents an error when some of the listed files couldn't be
+// decrypted.
+var ErrFilesFailed = errors.New("some files couldn't be decrypted")
+
+// Decrypt performs the decryption operation. When a signature was provided,
+// directly or in a file, it is used instead of fetching the round signature
+// from the network. Data following an armored input is rejected unless
+// AllowTrailing is set. When an escrow was provided, the escrowed file key is
+// used regardless of the round.
+func Decrypt(flags Flags, dst io.Writer, src io.Reader, network *http.Network) error {
+	if flags.Escrow != "" {
+		wrapper, err := EscrowKeyWrapper(flags.Escrow)
+		if err != nil {
+			return err
+		}
+		return escrow.Decrypt(dst, src, wrapper)
+	}
+
+	if flags.Signature == "" && flags.SignatureFile == "" {
+		t, err := withHiddenRound(flags, decryptTlock(network))
+		if err != nil {
+			return err
+		}
+		return withTrailing(flags, t).Decrypt(dst, src)
+	}
+
+	sig, err := decryptSignature(flags)
+	if err != nil {
+		return err
+	}
+
+	if flags.BestEffort {
+		return tlock.DecryptBestEffort(dst, src, sig)
+	}
+
+	// without network, the chain information is found like for encryptions.
+	var chainNetwork tlock.Network = network
+	if network == nil {
+		if chainNetwork, err = SignatureNetwork(flags); err != nil {
+			return err
+		}
+	}
+
+	scheme := chainNetwork.Scheme()
+	offline, err := fixed.NewNetwork(chainNetwork.ChainHash(), chainNetwork.PublicKey(), &scheme, chainNetwork.Period(), chainNetwork.GenesisTime(), sig)
+	if err != nil {
+		return fmt.Errorf("pinning signature: %w", err)
+	}
+
+	// a pinned signature is only valid on its own chain, so we never switch chainhash.
+	t, err := withHiddenRound(flags, tlock.New(offline).Strict())
+	if err != nil {
+		return err
+	}
+	return withTrailing(flags, t).Decrypt(dst, src)
+}
+
+// decryptTlock returns the tlock decrypting with the network, which decides
+// the chains it switches to.
+func decryptTlock(network *http.Network) tlock.Tlock {
+	return tlock.New(network).WithChainSwitcher(switchOnClone(network))
+}
+
+// switchOnClone switches to the chain hash of ciphertexts of another chain on a
+// clone of the network, so that decrypting several files doesn't leave the
+// network switched to the chain of one of them.
+func switchOnClone(network *http.Network) tlock.ChainSwitcher {
+	return func(chainHash string) (tlock.Network, error) {
+		clone := network.Clone()
+		if err := clone.SwitchChainHash(chainHash); err != nil {
+			return nil, err
+		}
+		return clone, nil
+	}
+}
+
+// withTrailing applies the --allow-trailing flag to the tlock.
+func withTrailing(flags Flags, t tlock.Tlock) tlock.Tlock {
+	if flags.AllowTrailing {
+		return t.AllowTrailing()
+	}
+	return t
+}
+
+// DecryptFiles decrypts the named files of the storage in sequence to dst, "-"
+// being the standard input.
+func DecryptFiles(flags Flags, storage Storage, dst io.Writer, names []string, network *http.Network) error {
+	pinned := pinSignatures(flags, storage, names, network)
+	for _, name := range names {
+		if err := decryptFile(flags, storage, dst, name, network, pinned); err != nil {
+			return fmt.Errorf("decrypting %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DecryptToDir decrypts each of the named files of the storage into the
+// directory, under its base name without the .tle extension. With a report,
+// a failure doesn't prevent decrypting the next files, but makes it fail with
+// ErrFilesFailed once the report is written.
+func DecryptToDir(flags Flags, storage Storage, dir string, names []string, network *http.Network) error {
+	if flags.Report != "" {
+		report := decryptEach(flags, storage, dir, names, network, nil)
+		if err := WriteReport(flags.Report, report); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+		return reportError(report)
+	}
+
+	outputs := make([]string, len(names))
+	inputs := make(map[string]string, len(names))
+	for i, name := range names {
+		output, err := dirOutput(flags, storage, dir, name, inputs, network)
+		if err != nil {
+			return err
+		}
+		outputs[i] = output
+	}
+
+	pinned := pinSignatures(flags, storage, names, network)
+	for i, name := range names {
+		err := storage.Create(outputs[i], flags.NoClobber, func(dst io.Writer) error {
+			return decryptFile(flags, storage, dst, name, network, pinned)
+		})
+		if err != nil {
+			return fmt.Errorf("decrypting %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// FileResult describes the decryption of a file listed by --files-from.
+type FileResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DecryptFilesFrom decrypts each of the NUL-delimited file paths read from
+// list into the directory, like DecryptToDir, writing the result of each file
+// as a json line to results. A failure doesn't prevent decrypting the next
+// files, but makes it fail with ErrFilesFailed once the list is exhausted and
+// the report, if any, is written. The whole list is read before decrypting
+// any file.
+func DecryptFilesFrom(flags Flags, storage Storage, dir string, results io.Writer, list io.Reader, network *http.Network) error {
+	scanner := bufio.NewScanner(list)
+	scanner.Split(scanNUL)
+	var names []string
+	for scanner.Scan() {
+		if name := scanner.Text(); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading files list: %w", err)
+	}
+
+	enc := json.NewEncoder(results)
+	var writeErr error
+	report := decryptEach(flags, storage, dir, names, network, func(file FileReport) bool {
+		writeErr = enc.Encode(FileResult{Input: file.Input, Output: file.Output, Error: file.Error})
+		return writeErr == nil
+	})
+	if writeErr != nil {
+		return fmt.Errorf("error writing result: %w", writeErr)
+	}
+
+	if flags.Report != "" {
+		if err := WriteReport(flags.Report, report); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	}
+
+	return reportError(report)
+}
+
+// decryptEach decrypts each of the named files of the storage into the
+// directory, regardless of the failures of the previous files, and returns
+// the report of all of them. If given, done is called with the report of each
+// file once it's processed, and stops the decryptions by returning false.
+func decryptEach(flags Flags, storage Storage, dir string, names []string, network *http.Network, done func(FileReport) bool) BatchReport {
+	pinned := pinSignatures(flags, storage, names, network)
+	inputs := make(map[string]string)
+
+	var report BatchReport
+	for _, name := range names {
+		start := time.Now()
+		var n int64
+
+		output, err := dirOutput(flags, storage, dir, name, inputs, network)
+		if err == nil && name == "-" {
+			err = fmt.Errorf("the standard input can't be listed")
+		}
+		if err == nil {
+			err = storage.Create(output, flags.NoClobber, func(dst io.Writer) error {
+				counter := &countingWriter{w: dst}
+				defer func() { n = counter.n }()
+				return decryptFile(flags, storage, counter, name, network, pinned)
+			})
+		}
+
+		file := fileReport(name, output, start, n, err)
+		report.add(file)
+		if done != nil && !done(file) {
+			break
+		}
+	}
+
+	return report
+}
+
+// dirOutput returns the path of the decryption of the named file into the
+// directory, given by the output template if any, failing if another input,
+// recorded in inputs, already uses it. Links can only be resolved on the local
+// file system.
+func dirOutput(flags Flags, storage Storage, dir string, name string, inputs map[string]string, network *http.Network) (string, error) {
+	output := filepath.Join(dir, strings.TrimSuffix(filepath.Base(name), ".tle"))
+	if flags.OutputTemplate != "" {
+		var err error
+		if output, err = templateDirOutput(flags, storage, dir, name, network); err != nil {
+			return "", err
+		}
+	}
+	if input, exists := inputs[output]; exists {
+		return "", fmt.Errorf("%q and %q would both be decrypted to %q", input, name, output)
+	}
+	if _, local := storage.(LocalStorage); local && !flags.AllowOverlap {
+		if err := CheckSameFile(name, output); err != nil {
+			return "", err
+		}
+	}
+	inputs[output] = name
+
+	return output, nil
+}
+
+// templateDirOutput returns the path of the decryption of the named file into
+// the directory given by the output template, reading the header of the file.
+func templateDirOutput(flags Flags, storage Storage, dir string, name string, network *http.Network) (string, error) {
+	if name == "-" {
+		return "", fmt.Errorf("the standard input can't be named by the output template")
+	}
+
+	tmpl, err := ParseOutputTemplate(flags.OutputTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := readHeader(storage, name)
+	if err != nil {
+		return "", err
+	}
+
+	stanza := header.Earliest()
+	unlock, err := unlockTime(network, stanza)
+	if err != nil {
+		return "", err
+	}
+	fields, err := newOutputName(name, "", stanza, unlock)
+	if err != nil {
+		return "", err
+	}
+
+	return templateOutput(tmpl, dir, fields)
+}
+
+// scanNUL is a bufio.SplitFunc returning the NUL-delimited tokens, like the
+// output of find -print0.
+func scanNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// decryptFile decrypts the named file of the storage to dst, "-" being the
+// standard input, using the network pinning the signature of its round if any.
+func decryptFile(flags Flags, storage Storage, dst io.Writer, name string, network *http.Network, pinned map[string]tlock.Network) error {
+	if name == "-" {
+		return Decrypt(flags, dst, os.Stdin, network)
+	}
+
+	f, err := storage.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if offline, ok := pinned[name]; ok {
+		return withTrailing(flags, tlock.New(offline).Strict()).Decrypt(dst, f)
+	}
+
+	return Decrypt(flags, dst, f, network)
+}
+
+// pinnedRound identifies a round of a chain.
+type pinnedRound struct {
+	chainHash string
+	round     uint64
+}
+
+// pinSignatures inspects the header of each of the named files, and fetches the
+// signature of the earliest round of each file only once per chain, returning
+// by file name the fixed networks pinning them. Files which can't be inspected
+// aren't pinned, and neither are the ones of chains the decryption wouldn't
+// switch to nor the ones of rounds whose signature couldn't be fetched: they
+// are decrypted as usual, which reports their errors.
+func pinSignatures(flags Flags, storage Storage, names []string, network *http.Network) map[string]tlock.Network {
+	pinned := make(map[string]tlock.Network)
+	if network == nil || flags.Escrow != "" || flags.Signature != "" || flags.SignatureFile != "" {
+		return pinned
+	}
+
+	groups := make(map[pinnedRound][]string)
+	var order []pinnedRound
+	for _, name := range names {
+		if name == "-" {
+			continue
+		}
+		header, err := readHeader(storage, name)
+		if err != nil {
+			continue
+		}
+
+		stanza := header.Earliest()
+		key := pinnedRound{chainHash: stanza.ChainHash, round: stanza.Round}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], name)
+	}
+
+	networks := map[string]*http.Network{network.ChainHash(): network}
+	trust := decryptTlock(network)
+	now := time.Now()
+	for _, key := range order {
+		chainNetwork, ok := networks[key.chainHash]
+		if !ok {
+			if !trust.Trusts(key.chainHash) {
+				continue
+			}
+			chainNetwork = network.Clone()
+			if err := chainNetwork.SwitchChainHash(key.chainHash); err != nil {
+				continue
+			}
+			networks[key.chainHash] = chainNetwork
+		}
+		if key.round > chainNetwork.Current(now) {
+			continue
+		}
+
+		sig, err := chainNetwork.Signature(key.round)
+		if err != nil {
+			continue
+		}
+		scheme := chainNetwork.Scheme()
+		offline, err := fixed.NewNetwork(key.chainHash, chainNetwork.PublicKey(), &scheme, chainNetwork.Period(), chainNetwork.GenesisTime(), nil)
+		if err != nil {
+			continue
+		}
+		// the later rounds of the files aren't given the signature.
+		offline.AddSignature(key.round, sig)
+
+		for _, name := range groups[key] {
+			pinned[name] = offline
+		}
+	}
+
+	return pinned
+}
+
+// readHeader reads the header of the named file of the storage.
+func readHeader(storage Storage, name string) (tlock.Header, error) {
+	f, err := storage.Open(name)
+	if err != nil {
+		return tlock.Header{}, err
+	}
+	defer f.Close()
+
+	return tlock.ReadHeader(f)
+}
@@ -4,23 +4,70 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"regexp"
-	"strconv"
 	"time"
 
 	"filippo.io/age/armor"
+	chain "github.com/drand/drand/v2/common"
 	"github.com/drand/tlock"
-	"github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/duration"
+	"github.com/drand/tlock/escrow"
 )
 
-var ErrInvalidDurationFormat = errors.New("unsupported duration type or malformed duration - note: drand can only support as short as seconds")
-var ErrInvalidDurationValue = errors.New("the duration you entered is either in the past or was too large and would cause an overflow")
+// These errors are kept for compatibility, durations being parsed by the
+// duration package.
+var (
+	ErrInvalidDurationFormat = duration.ErrInvalidFormat
+	ErrInvalidDurationValue  = duration.ErrInvalidValue
+	ErrDuplicateDuration     = duration.ErrDuplicateUnit
+)
+
+// ErrRoundInPast represents an error when encrypting towards a past round
+// without forcing it.
+var ErrRoundInPast = errors.New("the round is in the past")
+
+// ErrBeyondHorizon represents an error when encrypting towards a round further
+// away than the horizon without forcing it.
+var ErrBeyondHorizon = errors.New("the round is further away than the horizon")
+
+// ErrRoundOverflow represents an error when the time of a round can't be
+// represented.
+var ErrRoundOverflow = errors.New("the time of the round overflows")
+
+// These alignments round the decryption time of a duration up to a boundary.
+const (
+	// AlignHour aligns to the start of the next hour, in local time.
+	AlignHour = "hour"
+	// AlignDay aligns to the next midnight, in local time.
+	AlignDay = "day"
+	// AlignMidnightUTC aligns to the next midnight UTC.
+	AlignMidnightUTC = "midnight-utc"
+)
+
+// Alignments lists the alignments accepted by the align flag.
+var Alignments = []string{AlignHour, AlignDay, AlignMidnightUTC}
 
 // Encrypt performs the encryption operation. This requires the implementation
 // of an encoder for reading/writing to disk, a network for making calls to the
 // drand network, and an encrypter for encrypting/decrypting the data.
-func Encrypt(flags Flags, dst io.Writer, src io.Reader, network *http.Network) error {
-	tlock := tlock.New(network)
+func Encrypt(flags Flags, dst io.Writer, src io.Reader, network tlock.Network) error {
+	t, err := withHiddenRound(flags, tlock.New(network))
+	if err != nil {
+		return err
+	}
+	if flags.Escrow != "" {
+		wrapper, err := EscrowKeyWrapper(flags.Escrow)
+		if err != nil {
+			return err
+		}
+		t = t.WithRecipients(escrow.NewRecipient(wrapper))
+	}
+	if flags.RecipientsFile != "" {
+		recipients, err := ReadRecipientsFile(flags.RecipientsFile)
+		if err != nil {
+			return err
+		}
+		t = t.WithRecipients(recipients...)
+	}
 
 	if flags.Armor {
 		a := armor.NewWriter(dst)
@@ -32,91 +79,182 @@ func Encrypt(flags Flags, dst io.Writer, src io.Reader, network *http.Network) e
 		dst = a
 	}
 
+	roundNumbers, err := encryptRounds(flags, network, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return t.EncryptRounds(dst, src, roundNumbers...)
+}
+
+// ReEncrypt performs the re-encryption operation: the input, whose round must
+// have been reached on the chain, is decrypted and encrypted towards the round
+// given by the round or duration flags, without storing the plaintext.
+func ReEncrypt(flags Flags, dst io.Writer, src io.Reader, network tlock.Network) error {
+	if err := checkDeprecated(flags, network.ChainHash()); err != nil {
+		return err
+	}
+
+	roundNumbers, err := encryptRounds(flags, network, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if flags.Armor {
+		a := armor.NewWriter(dst)
+		defer func() {
+			if err := a.Close(); err != nil {
+				fmt.Printf("Error while closing: %v", err)
+			}
+		}()
+		dst = a
+	}
+
+	// the input must be of the chain the round was computed for.
+	return tlock.New(network).Strict().ReEncryptRounds(dst, src, roundNumbers...)
+}
+
+// ResolveRounds returns the flags with the rounds to encrypt towards at the
+// given time in place of their round and duration flags, so that the rounds
+// computed from durations don't change between the operations of an
+// encryption, such as checking the policy and encrypting.
+func ResolveRounds(flags Flags, network tlock.Network, now time.Time) (Flags, error) {
+	roundNumbers, err := encryptRounds(flags, network, now)
+	if err != nil {
+		return Flags{}, err
+	}
+
+	flags.Round, flags.Rounds = roundNumbers[0], nil
+	if len(roundNumbers) > 1 {
+		flags.Round, flags.Rounds = 0, roundNumbers
+	}
+	flags.Duration, flags.Durations, flags.Align = "", nil, ""
+
+	return flags, nil
+}
+
+// encryptRounds returns the rounds to encrypt towards, one for each of the
+// repeated round or duration flags, checked like encryptRound.
+func encryptRounds(flags Flags, network tlock.Network, start time.Time) ([]uint64, error) {
+	rounds, durations := flags.Rounds, flags.Durations
+	if len(rounds) == 0 && flags.Round != 0 {
+		rounds = []uint64{flags.Round}
+	}
+	if len(durations) == 0 && flags.Duration != "" {
+		durations = []string{flags.Duration}
+	}
+	if len(rounds) == 0 && len(durations) == 0 {
+		roundNumber, err := encryptRound(flags, network, start)
+		return []uint64{roundNumber}, err
+	}
+
+	var roundNumbers []uint64
+	for _, round := range rounds {
+		flags.Round, flags.Duration = round, ""
+		roundNumber, err := encryptRound(flags, network, start)
+		if err != nil {
+			return nil, err
+		}
+		roundNumbers = append(roundNumbers, roundNumber)
+	}
+	for _, d := range durations {
+		flags.Round, flags.Duration = 0, d
+		roundNumber, err := encryptRound(flags, network, start)
+		if err != nil {
+			return nil, err
+		}
+		roundNumbers = append(roundNumbers, roundNumber)
+	}
+
+	return roundNumbers, nil
+}
+
+// encryptRound returns the round to encrypt towards, given by the round or the
+// duration flag, checking it is neither in the past nor beyond the horizon
+// unless forced.
+func encryptRound(flags Flags, network tlock.Network, start time.Time) (uint64, error) {
+	var roundNumber uint64
 	switch {
 	case flags.Round != 0:
-		lastestAvailableRound := network.RoundNumber(time.Now())
+		lastestAvailableRound := network.Current(start)
 		if !flags.Force && flags.Round < lastestAvailableRound {
-			return fmt.Errorf("round %d is in the past", flags.Round)
+			return 0, fmt.Errorf("%w: round %d", ErrRoundInPast, flags.Round)
 		}
-
-		return tlock.Encrypt(dst, src, flags.Round)
+		roundNumber = flags.Round
 
 	case flags.Duration != "":
-		start := time.Now()
-		totalDuration, err := parseDurationsAsSeconds(start, flags.Duration)
+		totalDuration, err := duration.Parse(start, flags.Duration)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		decryptionTime := start.Add(totalDuration)
 		if decryptionTime.Before(start) || decryptionTime.Equal(start) {
-			return ErrInvalidDurationValue
+			return 0, ErrInvalidDurationValue
+		}
+		roundNumber = network.Current(decryptionTime)
+
+		if flags.Align != "" {
+			boundary, err := alignTime(decryptionTime, flags.Align)
+			if err != nil {
+				return 0, err
+			}
+			// the round produced at the boundary, or the first one after it.
+			roundNumber = network.Current(boundary)
+			if network.TimeOf(roundNumber).Before(boundary) {
+				roundNumber++
+			}
 		}
 
-		roundNumber := network.RoundNumber(decryptionTime)
-		return tlock.Encrypt(dst, src, roundNumber)
 	default:
-		return errors.New("you must provide either duration or a round flag to encrypt")
+		return 0, errors.New("you must provide either duration or a round flag to encrypt")
 	}
-}
 
-var ErrDuplicateDuration = errors.New("you cannot use the same duration unit specifier twice in one duration")
+	unlockTime := network.TimeOf(roundNumber)
+	if unlockTime.Unix() >= chain.TimeOfRoundErrorValue {
+		return 0, fmt.Errorf("%w: round %d", ErrRoundOverflow, roundNumber)
+	}
 
-func parseDurationsAsSeconds(start time.Time, input string) (time.Duration, error) {
-	timeUnits := "smhMdwy"
+	if flags.Force {
+		return roundNumber, nil
+	}
 
-	// first we check that there are no extra characters or malformed groups
-	valid, err := regexp.Compile(fmt.Sprintf("^([0-9]+[%s]{1})+$", timeUnits))
+	horizon := flags.Horizon
+	if horizon == "" {
+		horizon = DefaultHorizon
+	}
+	limit, err := duration.Parse(start, horizon)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("horizon: %w", err)
 	}
-	if len(valid.FindAll([]byte(input), -1)) != 1 {
-		return 0, ErrInvalidDurationFormat
+	if unlockTime.Sub(start) > limit {
+		return 0, fmt.Errorf("%w of %s: round %d unlocks on %s", ErrBeyondHorizon, horizon, roundNumber, unlockTime.UTC().Format(time.RFC1123))
 	}
 
-	// then we iterate through each duration unit and combine them into one
-	totalDuration := time.Duration(0)
-	for _, timeUnit := range timeUnits {
-		r, err := regexp.Compile(fmt.Sprintf("[0-9]+%c", timeUnit))
-		if err != nil {
-			return 0, err
-		}
-		matches := r.FindAll([]byte(input), -1)
-		if len(matches) > 1 {
-			return 0, ErrDuplicateDuration
+	return roundNumber, nil
+}
+
+// alignTime rounds the time up to the boundary of the alignment, a time
+// already on a boundary being kept.
+func alignTime(t time.Time, align string) (time.Time, error) {
+	var boundary time.Time
+	switch align {
+	case AlignHour:
+		boundary = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		if boundary.Before(t) {
+			boundary = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
 		}
-		if len(matches) == 0 {
-			continue
+	case AlignDay, AlignMidnightUTC:
+		if align == AlignMidnightUTC {
+			t = t.UTC()
 		}
-
-		match := matches[0]
-		durationLength, err := strconv.Atoi(string(match[0 : len(match)-1]))
-		if err != nil {
-			return 0, err
+		boundary = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		if boundary.Before(t) {
+			boundary = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
 		}
-
-		totalDuration += durationFrom(start, durationLength, timeUnit)
+	default:
+		return time.Time{}, fmt.Errorf("unknown alignment %q", align)
 	}
 
-	return totalDuration, nil
-}
-
-func durationFrom(start time.Time, value int, duration rune) time.Duration {
-	switch duration {
-	case 's':
-		return time.Duration(value) * time.Second
-	case 'm':
-		return time.Duration(value) * time.Minute
-	case 'h':
-		return time.Duration(value) * time.Hour
-	case 'd':
-		return start.AddDate(0, 0, value).Sub(start)
-	case 'w':
-		return start.AddDate(0, 0, value*7).Sub(start)
-	case 'M':
-		return start.AddDate(0, value, 0).Sub(start)
-	case 'y':
-		return start.AddDate(value, 0, 0).Sub(start)
-	}
-	return 0
+	return boundary, nil
 }
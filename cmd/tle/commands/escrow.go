@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/drand/tlock/escrow"
+	"github.com/drand/tlock/escrow/awskms"
+	"github.com/drand/tlock/escrow/gcpkms"
+	"github.com/drand/tlock/escrow/vault"
+)
+
+// ErrUnknownEscrow represents an error when the scheme of an escrow URI isn't
+// supported.
+var ErrUnknownEscrow = errors.New("unknown escrow scheme")
+
+// EscrowKeyWrapper returns the key wrapper of the escrow URI, either
+// awskms://ARN, gcpkms://NAME or vault://MOUNT/keys/KEY, whose credentials are
+// read from the environment.
+func EscrowKeyWrapper(uri string) (escrow.KeyWrapper, error) {
+	scheme, key, _ := strings.Cut(uri, "://")
+	switch scheme {
+	case "awskms":
+		credentials, err := awskms.CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return awskms.New(key, credentials)
+
+	case "gcpkms":
+		token, err := gcpkms.TokenFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return gcpkms.New(key, token)
+
+	case "vault":
+		config, err := vault.ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return vault.New(key, config)
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownEscrow, uri)
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +19,7 @@ func Test(t *testing.T) {
 	tests := []struct {
 		name        string
 		flags       []KV
+		args        []string
 		shouldError bool
 	}{
 		{
@@ -174,49 +176,1603 @@ func Test(t *testing.T) {
 			},
 			shouldError: false,
 		},
+		{
+			name: "passing metadata flag with round",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1234",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing metadata flag with duration fails",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+			},
+			shouldError: true,
+		},
 		{
 			name: "passing metadata flag along with encrypt",
 			flags: []KV{
 				{
-					key:   "TLE_METADATA",
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing metadata flag along with decrypt",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing metadata flag along with decrypt and encrypt",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing fetch-signature flag with round",
+			flags: []KV{
+				{
+					key:   "TLE_FETCHSIGNATURE",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing fetch-signature flag without round fails",
+			flags: []KV{
+				{
+					key:   "TLE_FETCHSIGNATURE",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing fetch-signature flag along with decrypt",
+			flags: []KV{
+				{
+					key:   "TLE_FETCHSIGNATURE",
+					value: "true",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing derive-identity flag with round",
+			flags: []KV{
+				{
+					key:   "TLE_DERIVEIDENTITY",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing derive-identity flag without round fails",
+			flags: []KV{
+				{
+					key:   "TLE_DERIVEIDENTITY",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing derive-identity flag along with fetch-signature",
+			flags: []KV{
+				{
+					key:   "TLE_DERIVEIDENTITY",
+					value: "true",
+				},
+				{
+					key:   "TLE_FETCHSIGNATURE",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing healthcheck flag with max-skew",
+			flags: []KV{
+				{
+					key:   "TLE_HEALTHCHECK",
+					value: "true",
+				},
+				{
+					key:   "TLE_MAXSKEW",
+					value: "1m",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing compensate-skew flag with duration",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_MAXSKEW",
+					value: "1m",
+				},
+				{
+					key:   "TLE_COMPENSATESKEW",
+					value: "true",
+				},
+				{
+					key:   "TLE_ALIGN",
+					value: "midnight-utc",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing status flag with patterns",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_INPUTDIR",
+					value: "vault",
+				},
+				{
+					key:   "TLE_PATTERN",
+					value: "*.json,*.txt",
+				},
+				{
+					key:   "TLE_EXCLUDE",
+					value: "*_backup*",
+				},
+				{
+					key:   "TLE_MAXDEPTH",
+					value: "2",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing allow-deprecated flag with encrypt",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_ALLOWDEPRECATED",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing allow-deprecated flag with decrypt fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ALLOWDEPRECATED",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing max-rps flag",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_MAXRPS",
+					value: "2.5",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing negative max-rps flag fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_MAXRPS",
+					value: "-1",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing exclude flag without input-dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_EXCLUDE",
+					value: "*_backup*",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing report flag without output-dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_REPORT",
+					value: "report.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing output-template flag without output-dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTTEMPLATE",
+					value: "{{.Name}}",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing align flag with round fails",
+			flags: []KV{
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_ALIGN",
+					value: "day",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing unknown align flag fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_ALIGN",
+					value: "week",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing compensate-skew flag without duration fails",
+			flags: []KV{
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_COMPENSATESKEW",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing healthcheck flag with round fails",
+			flags: []KV{
+				{
+					key:   "TLE_HEALTHCHECK",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing generate-vectors flag with output-dir",
+			flags: []KV{
+				{
+					key:   "TLE_GENERATEVECTORS",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "vectors",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing generate-vectors flag without output-dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_GENERATEVECTORS",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing generate-vectors flag with round fails",
+			flags: []KV{
+				{
+					key:   "TLE_GENERATEVECTORS",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "vectors",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing repair flag with output",
+			flags: []KV{
+				{
+					key:   "TLE_REPAIR",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUT",
+					value: "damaged.header",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing repair flag with armor fails",
+			flags: []KV{
+				{
+					key:   "TLE_REPAIR",
+					value: "true",
+				},
+				{
+					key:   "TLE_ARMOR",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing repair flag with status fails",
+			flags: []KV{
+				{
+					key:   "TLE_REPAIR",
+					value: "true",
+				},
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing generate-vectors flag with decrypt fails",
+			flags: []KV{
+				{
+					key:   "TLE_GENERATEVECTORS",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "vectors",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing max-skew flag without healthcheck fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_MAXSKEW",
+					value: "1m",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with signature passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "deadbeef",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with signature fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "deadbeef",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with best effort and signature passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "deadbeef",
+				},
+				{
+					key:   "TLE_BESTEFFORT",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with signature and signature file fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "deadbeef",
+				},
+				{
+					key:   "TLE_SIGNATUREFILE",
+					value: "beacon.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with best effort and signature file passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_SIGNATUREFILE",
+					value: "beacon.json",
+				},
+				{
+					key:   "TLE_BESTEFFORT",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with best effort without signature fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_BESTEFFORT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with chain info passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_CHAININFO",
+					value: "info.json",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with a chain information document as chain passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_CHAIN",
+					value: "https://example.com/info.json",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with chain info and a chain information document as chain fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_CHAININFO",
+					value: "info.json",
+				},
+				{
+					key:   "TLE_CHAIN",
+					value: "./quicknet-info.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing reencrypt with round passes",
+			flags: []KV{
+				{
+					key:   "TLE_REENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing reencrypt without duration or round fails",
+			flags: []KV{
+				{
+					key:   "TLE_REENCRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing reencrypt with decrypt fails",
+			flags: []KV{
+				{
+					key:   "TLE_REENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with policy passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_POLICY",
+					value: "policy.yaml",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with policy fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_POLICY",
+					value: "policy.yaml",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with horizon passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1y",
+				},
+				{
+					key:   "TLE_HORIZON",
+					value: "10y",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with malformed horizon fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1y",
+				},
+				{
+					key:   "TLE_HORIZON",
+					value: "10 years",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with horizon fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_HORIZON",
+					value: "10y",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with signed manifest passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_MANIFEST",
+					value: "manifest.json",
+				},
+				{
+					key:   "TLE_MANIFESTKEY",
+					value: "id_ed25519",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with timestamp passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_TIMESTAMP",
+					value: "ciphertext.tsr",
+				},
+				{
+					key:   "TLE_TSA",
+					value: "https://freetsa.org/tsr",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with timestamp without tsa fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_TIMESTAMP",
+					value: "ciphertext.tsr",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with escrow passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ESCROW",
+					value: "awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with escrow and signature fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ESCROW",
+					value: "awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "abcd",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with recipients file passes",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_RECIPIENTSFILE",
+					value: "auditors.txt",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with recipients file fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_RECIPIENTSFILE",
+					value: "auditors.txt",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing metadata with escrow fails",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_ESCROW",
+					value: "awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with manifest fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_MANIFEST",
+					value: "manifest.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing manifest key without manifest fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_MANIFESTKEY",
+					value: "id_ed25519",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with a signature and chain info passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "abcd",
+				},
+				{
+					key:   "TLE_CHAININFO",
+					value: "info.json",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with chain info fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_CHAININFO",
+					value: "info.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing status flag with follow symlinks without input dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_FOLLOWSYMLINKS",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing shred without in place fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_SHRED",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with several inputs passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			args:        []string{"a.tle", "b.tle"},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with several inputs fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+			},
+			args:        []string{"a", "b"},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with output dir passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "out",
+				},
+			},
+			args:        []string{"a.tle"},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with output dir from stdin fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "out",
+				},
+			},
+			args:        []string{"a.tle", "-"},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with output dir and output fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "out",
+				},
+				{
+					key:   "TLE_OUTPUT",
+					value: "a",
+				},
+			},
+			args:        []string{"a.tle"},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with files from passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "out",
+				},
+				{
+					key:   "TLE_FILESFROM",
+					value: "-",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with files from and input fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_OUTPUTDIR",
+					value: "out",
+				},
+				{
+					key:   "TLE_FILESFROM",
+					value: "-",
+				},
+			},
+			args:        []string{"a.tle"},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with files from without output dir fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_FILESFROM",
+					value: "-",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt in place fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_INPLACE",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with allow overlap passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ALLOWOVERLAP",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing metadata with allow overlap fails",
+			flags: []KV{
+				{
+					key:   "TLE_METADATA",
+					value: "true",
+				},
+				{
+					key:   "TLE_ALLOWOVERLAP",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with allow trailing passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ALLOWTRAILING",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing encrypt with allow trailing fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_ALLOWTRAILING",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing decrypt with proof passes",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_PROVE",
+					value: "proof.json",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "parsing decrypt with proof and signature fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_PROVE",
+					value: "proof.json",
+				},
+				{
+					key:   "TLE_SIGNATURE",
+					value: "beef",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing encrypt with proof fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_ROUND",
+					value: "1",
+				},
+				{
+					key:   "TLE_PROVE",
+					value: "proof.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "parsing check proof passes",
+			flags: []KV{
+				{
+					key:   "TLE_CHECKPROOF",
+					value: "proof.json",
+				},
+			},
+			args:        []string{"file.tle"},
+			shouldError: false,
+		},
+		{
+			name: "parsing check proof with decrypt fails",
+			flags: []KV{
+				{
+					key:   "TLE_CHECKPROOF",
+					value: "proof.json",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing status flag with json",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_JSON",
+					value: "true",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing status flag along with decrypt",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing several durations with encrypt",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+			},
+			args:        []string{"-D", "30d", "--duration", "1y"},
+			shouldError: false,
+		},
+		{
+			name: "passing several rounds with reencrypt",
+			flags: []KV{
+				{
+					key:   "TLE_REENCRYPT",
 					value: "true",
 				},
+			},
+			args:        []string{"-r", "1000", "-r", "2000"},
+			shouldError: false,
+		},
+		{
+			name: "passing both rounds and durations fails",
+			flags: []KV{
 				{
 					key:   "TLE_ENCRYPT",
 					value: "true",
 				},
 			},
+			args:        []string{"-r", "1000", "-D", "1d"},
 			shouldError: true,
 		},
 		{
-			name: "passing metadata flag along with decrypt",
+			name: "passing several rounds with metadata fails",
 			flags: []KV{
 				{
 					key:   "TLE_METADATA",
 					value: "true",
 				},
+			},
+			args:        []string{"-r", "1000", "-r", "2000"},
+			shouldError: true,
+		},
+		{
+			name: "passing several durations with manifest fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_MANIFEST",
+					value: "manifest.json",
+				},
+			},
+			args:        []string{"-D", "30d", "-D", "1y"},
+			shouldError: true,
+		},
+		{
+			name: "passing an invalid round fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+			},
+			args:        []string{"-r", "soon"},
+			shouldError: true,
+		},
+		{
+			name: "passing detached flag with encrypt",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_DETACHED",
+					value: "data.header",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing detached flag with decrypt",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DETACHED",
+					value: "data.header",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing detached flag with armor fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_ARMOR",
+					value: "true",
+				},
+				{
+					key:   "TLE_DETACHED",
+					value: "data.header",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing detached flag with several inputs fails",
+			flags: []KV{
 				{
 					key:   "TLE_DECRYPT",
 					value: "true",
 				},
+				{
+					key:   "TLE_DETACHED",
+					value: "data.header",
+				},
 			},
+			args:        []string{"a.tle", "b.tle"},
 			shouldError: true,
 		},
 		{
-			name: "passing metadata flag along with decrypt and encrypt",
+			name: "passing detached flag with status fails",
 			flags: []KV{
 				{
-					key:   "TLE_METADATA",
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_DETACHED",
+					value: "data.header",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing hide round flag with encrypt",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_HIDEROUND",
+					value: "pass.txt",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing hide round flag with manifest fails",
+			flags: []KV{
+				{
+					key:   "TLE_ENCRYPT",
 					value: "true",
 				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_HIDEROUND",
+					value: "pass.txt",
+				},
+				{
+					key:   "TLE_MANIFEST",
+					value: "manifest.json",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing hide round flag with status fails",
+			flags: []KV{
+				{
+					key:   "TLE_STATUS",
+					value: "true",
+				},
+				{
+					key:   "TLE_HIDEROUND",
+					value: "pass.txt",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing guess rounds flag with decrypt",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_GUESSROUNDS",
+					value: "1000-2000",
+				},
+			},
+			shouldError: false,
+		},
+		{
+			name: "passing guess rounds flag with hide round fails",
+			flags: []KV{
 				{
 					key:   "TLE_DECRYPT",
 					value: "true",
 				},
+				{
+					key:   "TLE_GUESSROUNDS",
+					value: "1000-2000",
+				},
+				{
+					key:   "TLE_HIDEROUND",
+					value: "pass.txt",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing guess rounds flag with encrypt fails",
+			flags: []KV{
 				{
 					key:   "TLE_ENCRYPT",
 					value: "true",
 				},
+				{
+					key:   "TLE_DURATION",
+					value: "1d",
+				},
+				{
+					key:   "TLE_GUESSROUNDS",
+					value: "1000-2000",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing invalid guess rounds flag fails",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_GUESSROUNDS",
+					value: "2000-1000",
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "passing json flag without status",
+			flags: []KV{
+				{
+					key:   "TLE_DECRYPT",
+					value: "true",
+				},
+				{
+					key:   "TLE_JSON",
+					value: "true",
+				},
 			},
 			shouldError: true,
 		},
@@ -229,6 +1785,12 @@ func Test(t *testing.T) {
 			defer require.NoError(t, w.Close())
 			flag.CommandLine.SetOutput(w)
 
+			args := os.Args
+			os.Args = append([]string{"tle"}, test.args...)
+			t.Cleanup(func() {
+				os.Args = args
+			})
+
 			for _, f := range test.flags {
 				require.NoError(t, os.Setenv(f.key, f.value))
 				t.Cleanup(func() {
@@ -247,3 +1809,167 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCrossCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected CrossCheckFlags
+		err      bool
+	}{
+		{
+			name: "flags after the input",
+			args: []string{"file.tle", "-n", "https://api.drand.sh/", "--network", "https://api2.drand.sh/"},
+			expected: CrossCheckFlags{
+				Networks: []string{"https://api.drand.sh/", "https://api2.drand.sh/"},
+				Input:    "file.tle",
+			},
+		},
+		{
+			name: "flags around the input",
+			args: []string{"-n", "https://api.drand.sh/", "-", "-n", "https://api2.drand.sh/"},
+			expected: CrossCheckFlags{
+				Networks: []string{"https://api.drand.sh/", "https://api2.drand.sh/"},
+				Input:    "-",
+			},
+		},
+		{
+			name: "a single network fails",
+			args: []string{"file.tle", "-n", "https://api.drand.sh/"},
+			err:  true,
+		},
+		{
+			name: "missing input fails",
+			args: []string{"-n", "https://api.drand.sh/", "-n", "https://api2.drand.sh/"},
+			err:  true,
+		},
+		{
+			name: "several inputs fail",
+			args: []string{"a.tle", "b.tle", "-n", "https://api.drand.sh/", "-n", "https://api2.drand.sh/"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := ParseCrossCheck(test.args)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, f)
+		})
+	}
+}
+
+func TestParseInstructions(t *testing.T) {
+	f, err := ParseInstructions([]string{"file.tle", "-o", "README.txt"})
+	require.NoError(t, err)
+	require.Equal(t, InstructionsFlags{Network: DefaultNetwork, Output: "README.txt", Input: "file.tle"}, f)
+
+	_, err = ParseInstructions([]string{"-o", "README.txt"})
+	require.Error(t, err)
+
+	_, err = ParseInstructions([]string{"-"})
+	require.Error(t, err)
+}
+
+func TestParseSweep(t *testing.T) {
+	f, err := ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--interval", "1m"})
+	require.NoError(t, err)
+	require.Equal(t, "vault", f.InputDir)
+	require.Equal(t, "out", f.OutputDir)
+	require.Equal(t, "sweep.json", f.State)
+	require.Equal(t, time.Minute, f.Interval)
+	require.Equal(t, []string{DefaultPattern}, f.Pattern)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out"})
+	require.Error(t, err)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--interval", "0s"})
+	require.Error(t, err)
+
+	f, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--preserve-links"})
+	require.NoError(t, err)
+	require.True(t, f.PreserveLinks)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--preserve-links", "--follow-symlinks"})
+	require.Error(t, err)
+	f, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--pattern", "*.json", "--pattern", "*.txt", "--exclude", "*_backup*", "--max-depth", "2"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"*.json", "*.txt"}, f.Pattern)
+	require.Equal(t, []string{"*_backup*"}, f.Exclude)
+	require.Equal(t, 2, f.MaxDepth)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--max-depth", "-1"})
+	require.Error(t, err)
+
+	f, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--output-template", "{{.Dir}}/{{.Name}}.{{.Round}}"})
+	require.NoError(t, err)
+	require.Equal(t, "{{.Dir}}/{{.Name}}.{{.Round}}", f.OutputTemplate)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--output-template", "{{.Name"})
+	require.Error(t, err)
+
+	f, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--max-rps", "0.5"})
+	require.NoError(t, err)
+	require.Equal(t, 0.5, f.MaxRPS)
+
+	_, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--max-rps", "-1"})
+	require.Error(t, err)
+
+	f, err = ParseSweep([]string{"--input-dir", "vault", "--output-dir", "out", "--state", "sweep.json", "--round-state", "rounds.json"})
+	require.NoError(t, err)
+	require.Equal(t, "rounds.json", f.RoundState)
+}
+
+func TestParseDeadman(t *testing.T) {
+	f, err := ParseDeadman([]string{"secret.tle", "--interval", "7d", "--window", "2d"})
+	require.NoError(t, err)
+	require.Equal(t, "secret.tle", f.Input)
+	require.Equal(t, "secret.tle.checkin", f.CheckInFile)
+	require.Equal(t, "7d", f.Interval)
+	require.Equal(t, "2d", f.Window)
+
+	f, err = ParseDeadman([]string{"--check-in", "--check-in-file", "alive", "secret.tle"})
+	require.NoError(t, err)
+	require.True(t, f.CheckIn)
+	require.Equal(t, "alive", f.CheckInFile)
+
+	_, err = ParseDeadman([]string{"secret.tle", "--interval", "7d"})
+	require.Error(t, err)
+
+	_, err = ParseDeadman([]string{"secret.tle", "--interval", "7x", "--window", "2d"})
+	require.Error(t, err)
+
+	_, err = ParseDeadman([]string{"--check-in", "--once", "secret.tle"})
+	require.Error(t, err)
+
+	_, err = ParseDeadman([]string{"--interval", "7d", "--window", "2d"})
+	require.Error(t, err)
+}
+
+func TestParseTranches(t *testing.T) {
+	f, err := ParseTranches([]string{"course.mp4", "--parts", "4", "--first", "7d", "--every", "7d", "--output-dir", "episodes"})
+	require.NoError(t, err)
+	require.Equal(t, "course.mp4", f.Input)
+	require.Equal(t, 4, f.Parts)
+	require.Equal(t, DefaultChain, f.Chain)
+
+	_, err = ParseTranches([]string{"course.mp4", "--parts", "1", "--first", "7d", "--output-dir", "episodes"})
+	require.NoError(t, err)
+
+	_, err = ParseTranches([]string{"course.mp4", "--parts", "4", "--first", "7d", "--output-dir", "episodes"})
+	require.Error(t, err)
+
+	_, err = ParseTranches([]string{"course.mp4", "--parts", "0", "--first", "7d", "--output-dir", "episodes"})
+	require.Error(t, err)
+
+	_, err = ParseTranches([]string{"course.mp4", "--parts", "4", "--first", "7x", "--every", "7d", "--output-dir", "episodes"})
+	require.Error(t, err)
+
+	_, err = ParseTranches([]string{"-", "--parts", "4", "--first", "7d", "--every", "7d", "--output-dir", "episodes"})
+	require.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/duration"
+)
+
+// ErrUnhealthy represents an error when the relay can't be used for timelock
+// encryption, or when the local clock is too far from the time of its beacons.
+var ErrUnhealthy = errors.New("unhealthy")
+
+// Healthcheck checks that the relay of the flags serves its chain, that the
+// scheme of the chain can be used by tlock, and that the local clock is within
+// the maximum skew of the time implied by the latest round of the chain. A
+// skew within the maximum is logged as a warning, since it shifts the rounds
+// computed from durations.
+func Healthcheck(flags Flags, dst io.Writer, log *log.Logger) error {
+	now := time.Now()
+	limit := flags.MaxSkew
+	if limit == "" {
+		limit = DefaultMaxSkew
+	}
+	maxSkew, err := duration.Parse(now, limit)
+	if err != nil {
+		return fmt.Errorf("--max-skew: %w", err)
+	}
+
+	network, err := ChainNetwork(flags)
+	if err != nil {
+		return fmt.Errorf("%w: chain %s on %s: %w", ErrUnhealthy, flags.Chain, flags.Network, err)
+	}
+
+	skew, err := network.ClockSkew(now)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnhealthy, err)
+	}
+
+	_, err = fmt.Fprintf(dst, "relay:  %s\nchain:  %s\nscheme: %s\nperiod: %s\nskew:   %s\n",
+		flags.Network, network.ChainHash(), network.Scheme().Name, network.Period(), skew)
+	if err != nil {
+		return err
+	}
+
+	if skew != 0 {
+		logSkew(log, skew)
+	}
+	if skew.Abs() > maxSkew {
+		return fmt.Errorf("%w: the clock skew of %s exceeds %s", ErrUnhealthy, skew, maxSkew)
+	}
+
+	return nil
+}
+
+// logSkew warns about the skew of the local clock.
+func logSkew(log *log.Logger, skew time.Duration) {
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	log.Printf("warning: the local clock is %s %s the beacons, shifting the rounds computed from durations", skew.Abs(), direction)
+}
+
+// =============================================================================
+
+// clockSkewer is implemented by the networks able to measure the skew of the
+// local clock against the time of their beacons.
+type clockSkewer interface {
+	ClockSkew(now time.Time) (time.Duration, error)
+}
+
+// CompensateSkew measures the skew of the local clock against the time of the
+// beacons of the network when encrypting with a duration, and warns when it
+// exceeds the maximum skew. With the compensate skew flag, the returned network
+// then computes the rounds from the time of the beacons instead. Networks
+// which can't measure the skew, such as the ones working offline, are returned
+// as is.
+func CompensateSkew(flags Flags, network tlock.Network, log *log.Logger) (tlock.Network, error) {
+	skewer, ok := network.(clockSkewer)
+	if flags.Duration == "" || !ok {
+		return network, nil
+	}
+
+	now := time.Now()
+	limit := flags.MaxSkew
+	if limit == "" {
+		limit = DefaultMaxSkew
+	}
+	maxSkew, err := duration.Parse(now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("--max-skew: %w", err)
+	}
+
+	skew, err := skewer.ClockSkew(now)
+	if err != nil {
+		// the encryption itself doesn't need the latest round.
+		log.Printf("warning: measuring the clock skew: %v", err)
+		return network, nil
+	}
+	if skew.Abs() <= maxSkew {
+		return network, nil
+	}
+
+	logSkew(log, skew)
+	if !flags.CompensateSkew {
+		return network, nil
+	}
+
+	return skewedNetwork{Network: network, skew: skew}, nil
+}
+
+// skewedNetwork converts the local times to and from the time of the beacons
+// of a network, given the skew of the local clock.
+type skewedNetwork struct {
+	tlock.Network
+	skew time.Duration
+}
+
+// Current returns the round of the beacons at the given local time.
+func (n skewedNetwork) Current(t time.Time) uint64 {
+	return n.Network.Current(t.Add(-n.skew))
+}
+
+// TimeOf returns the local time at which the round is produced.
+func (n skewedNetwork) TimeOf(round uint64) time.Time {
+	return n.Network.TimeOf(round).Add(n.skew)
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/drand/tlock"
+)
+
+// ErrEmptyPassphrase represents an error when the passphrase file of
+// --hide-round is empty.
+var ErrEmptyPassphrase = errors.New("the passphrase can't be empty")
+
+// ErrInvalidRoundRange represents an error when the rounds to guess aren't
+// given as FIRST-LAST, with 0 < FIRST <= LAST, or are more than
+// tlock.MaxScanRounds.
+var ErrInvalidRoundRange = errors.New("the rounds must be given as FIRST-LAST, with 0 < FIRST <= LAST")
+
+// ParseRoundRange parses the FIRST-LAST rounds to guess of --guess-rounds.
+func ParseRoundRange(s string) (uint64, uint64, error) {
+	before, after, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidRoundRange, s)
+	}
+
+	first, err := strconv.ParseUint(before, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidRoundRange, s)
+	}
+	last, err := strconv.ParseUint(after, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidRoundRange, s)
+	}
+	if first == 0 || first > last {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidRoundRange, s)
+	}
+	if last-first >= tlock.MaxScanRounds {
+		return 0, 0, fmt.Errorf("%w: %q is more than %d rounds", ErrInvalidRoundRange, s, tlock.MaxScanRounds)
+	}
+
+	return first, last, nil
+}
+
+// ReadPassphrase reads the passphrase of --hide-round from the file, without
+// its trailing newline.
+func ReadPassphrase(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+
+	passphrase := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+	if passphrase == "" {
+		return "", fmt.Errorf("%w: %s", ErrEmptyPassphrase, name)
+	}
+
+	return passphrase, nil
+}
+
+// withHiddenRound makes the tlock hide or reveal the rounds with the
+// passphrase of --hide-round, or guess them with --guess-rounds.
+func withHiddenRound(flags Flags, t tlock.Tlock) (tlock.Tlock, error) {
+	if flags.HideRound != "" {
+		passphrase, err := ReadPassphrase(flags.HideRound)
+		if err != nil {
+			return tlock.Tlock{}, err
+		}
+		t = t.HideRound(passphrase)
+	}
+
+	if flags.GuessRounds != "" {
+		first, last, err := ParseRoundRange(flags.GuessRounds)
+		if err != nil {
+			return tlock.Tlock{}, err
+		}
+		t = t.GuessRounds(first, last)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+// InstructionsFlags represent the values from the command line of the
+// instructions command.
+type InstructionsFlags struct {
+	Network string
+	Output  string
+	Input   string
+}
+
+// ParseInstructions will parse the command line arguments of the instructions
+// command. Validation takes place.
+func ParseInstructions(args []string) (InstructionsFlags, error) {
+	f := InstructionsFlags{
+		Network: DefaultNetwork,
+	}
+
+	fs := flag.NewFlagSet("instructions", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	fs.StringVar(&f.Network, "n", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Network, "network", f.Network, "the drand API endpoint")
+
+	fs.StringVar(&f.Output, "o", f.Output, "the path to the output file")
+	fs.StringVar(&f.Output, "output", f.Output, "the path to the output file")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return InstructionsFlags{}, err
+	}
+
+	if len(positional) != 1 || positional[0] == "-" {
+		return InstructionsFlags{}, fmt.Errorf("instructions expects exactly one INPUT file")
+	}
+	f.Input = positional[0]
+
+	if f.Network == "" {
+		return InstructionsFlags{}, fmt.Errorf("-n/--network can't be the empty string")
+	}
+
+	return f, nil
+}
+
+// instructions is the template of the generated instructions.
+var instructions = template.Must(template.New("instructions").Parse(`HOW TO DECRYPT {{.File}}
+{{range .Stanzas}}
+This file is timelock encrypted: nobody, including its author, can decrypt it
+before the drand network publishes the signature of round {{.Round}}.
+
+	Chain hash:  {{.ChainHash}}
+	Round:       {{.Round}}
+	Unlocks at:  {{if .Unlock}}{{.Unlock}} (estimated){{else}}unknown, the network couldn't be reached when writing these instructions{{end}}
+{{end}}
+1. Install the tle tool, for instance with Go:
+
+	go install github.com/drand/tlock/cmd/tle@latest
+
+2. Once the unlock time has passed, decrypt the file using the drand network:
+{{range .Stanzas}}
+	tle -d -n {{$.Network}} -c {{.ChainHash}} -o decrypted {{$.File}}
+{{end}}
+   Any other relay of the same chain can be used instead of {{.Network}}.
+
+3. Alternatively, to decrypt on a machine without network access, fetch the
+   signature of the round on any connected machine:
+{{range .Stanzas}}
+	tle --fetch-signature -n {{$.Network}} -c {{.ChainHash}} -r {{.Round}}
+{{end}}
+   and copy the "signature" it displays to the offline machine, to run:
+
+	tle -d --best-effort --signature SIGNATURE -o decrypted {{.File}}
+`))
+
+// Instructions writes to the destination human readable instructions on how
+// to decrypt the source, estimating its unlock time using the network.
+func Instructions(flags InstructionsFlags, dst io.Writer, src io.Reader) error {
+	header, err := tlock.ReadHeader(src)
+	if err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	type Stanza struct {
+		ChainHash string
+		Round     uint64
+		Unlock    string
+	}
+	data := struct {
+		File    string
+		Network string
+		Stanzas []Stanza
+	}{
+		File:    filepath.Base(flags.Input),
+		Network: flags.Network,
+	}
+
+	for _, s := range header.Stanzas {
+		stanza := Stanza{
+			ChainHash: s.ChainHash,
+			Round:     s.Round,
+		}
+
+		// the unlock time is a nice to have, the instructions remain valid without it.
+		if network, err := http.NewNetwork(flags.Network, s.ChainHash); err == nil {
+			stanza.Unlock = network.TimeOf(s.Round).UTC().Format(time.RFC1123)
+		}
+
+		data.Stanzas = append(data.Stanzas, stanza)
+	}
+
+	if err := instructions.Execute(dst, data); err != nil {
+		return fmt.Errorf("error writing instructions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/drand/tlock"
+	"golang.org/x/crypto/ssh"
+)
+
+// manifestNamespace is the namespace of the manifest signatures, which must
+// be given to `ssh-keygen -Y verify -n`.
+const manifestNamespace = "tlock-manifest"
+
+// Manifest describes what was encrypted, allowing to prove it without being
+// able to decrypt the ciphertext before its round.
+type Manifest struct {
+	PlaintextSHA256  string    `json:"plaintext_sha256"`
+	CiphertextSHA256 string    `json:"ciphertext_sha256"`
+	Round            uint64    `json:"round"`
+	ChainHash        string    `json:"chain_hash"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// EncryptWithManifest performs the encryption operation like Encrypt, and
+// returns the manifest of the encryption.
+func EncryptWithManifest(flags Flags, dst io.Writer, src io.Reader, network tlock.Network) (Manifest, error) {
+	now := time.Now()
+	roundNumber, err := encryptRound(flags, network, now)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	// the round is fixed so that the manifest describes the ciphertext.
+	flags.Round, flags.Duration = roundNumber, ""
+
+	plaintext, ciphertext := sha256.New(), sha256.New()
+	err = Encrypt(flags, io.MultiWriter(dst, ciphertext), io.TeeReader(src, plaintext), network)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return Manifest{
+		PlaintextSHA256:  hex.EncodeToString(plaintext.Sum(nil)),
+		CiphertextSHA256: hex.EncodeToString(ciphertext.Sum(nil)),
+		Round:            roundNumber,
+		ChainHash:        network.ChainHash(),
+		CreatedAt:        now.UTC(),
+	}, nil
+}
+
+// WriteManifest writes the manifest in json format to the named file and, if
+// a key is given, its signature to the same name with the .sig extension.
+func WriteManifest(name string, manifest Manifest, keyFile string) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if keyFile != "" {
+		sig, err := signManifest(b, keyFile)
+		if err != nil {
+			return err
+		}
+		err = WriteOutput(name+".sig", false, func(dst io.Writer) error {
+			_, err := dst.Write(sig)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteOutput(name, false, func(dst io.Writer) error {
+		_, err := dst.Write(b)
+		return err
+	})
+}
+
+// signManifest signs the manifest with the ssh private key of the named file,
+// in the format of `ssh-keygen -Y sign`.
+func signManifest(manifest []byte, keyFile string) ([]byte, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest key %q: %w", keyFile, err)
+	}
+
+	// the signature covers the hash of the manifest, as specified by the
+	// SSHSIG format of OpenSSH.
+	digest := sha512.Sum512(manifest)
+	signed := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{manifestNamespace, "", "sha512", string(digest[:])})
+	signed = append([]byte("SSHSIG"), signed...)
+
+	var sig *ssh.Signature
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// the SHA-1 signatures of ssh-rsa aren't accepted.
+		sig, err = as.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing manifest: %w", err)
+	}
+
+	blob := ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}{1, string(signer.PublicKey().Marshal()), manifestNamespace, "", "sha512", string(ssh.Marshal(sig))})
+
+	var out bytes.Buffer
+	if err := pem.Encode(&out, &pem.Block{Type: "SSH SIGNATURE", Bytes: append([]byte("SSHSIG"), blob...)}); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
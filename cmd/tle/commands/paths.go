@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSameFile represents an error when the output is the input, which would be
+// replaced by the result of the operation.
+var ErrSameFile = errors.New("the output is the same file as the input")
+
+// ErrOutputExists represents an error when the output already exists and
+// mustn't be overwritten.
+var ErrOutputExists = errors.New("the output already exists")
+
+// ErrOverlappingDirs represents an error when a directory contains the other.
+var ErrOverlappingDirs = errors.New("the input and output directories overlap")
+
+// CheckSameFile fails with ErrSameFile if the output designates the same file
+// as the input, including through links. Standard streams never collide.
+func CheckSameFile(input, output string) error {
+	if input == "" || input == "-" || output == "" || output == "-" {
+		return nil
+	}
+
+	in, err := os.Stat(input)
+	if err != nil {
+		// the error is reported when opening the input.
+		return nil
+	}
+	out, err := os.Stat(output)
+	if err != nil {
+		return nil
+	}
+
+	if os.SameFile(in, out) {
+		return fmt.Errorf("%w: %q and %q", ErrSameFile, input, output)
+	}
+
+	return nil
+}
+
+// CheckOverlap fails with ErrOverlappingDirs if one directory is the other or
+// is one of its subdirectories, once symbolic links are resolved.
+func CheckOverlap(inputDir, outputDir string) error {
+	in, err := resolvePath(inputDir)
+	if err != nil {
+		return err
+	}
+	out, err := resolvePath(outputDir)
+	if err != nil {
+		return err
+	}
+
+	if within(in, out) || within(out, in) {
+		return fmt.Errorf("%w: %q and %q", ErrOverlappingDirs, inputDir, outputDir)
+	}
+
+	return nil
+}
+
+// resolvePath returns the absolute path without symbolic links, the missing
+// trailing elements of the path being kept as is.
+func resolvePath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || dir == filepath.Dir(dir) {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// within reports whether the path is the directory or one of its descendants.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// =============================================================================
+
+// WriteOutput writes the named output file, which only appears or replaces the
+// existing file once fully written, and is never left partially written on
+// errors. With noClobber, an existing file is never replaced.
+func WriteOutput(name string, noClobber bool, write func(dst io.Writer) error) error {
+	if noClobber {
+		if _, err := os.Lstat(name); err == nil {
+			return fmt.Errorf("%w: %q", ErrOutputExists, name)
+		}
+	}
+
+	commit := replaceFile
+	if noClobber {
+		commit = linkFile
+	}
+
+	// the errors of the operation itself are returned as is.
+	return writeFile(name, func(f *os.File) error {
+		return write(f)
+	}, commit)
+}
+
+// ReplaceInPlace replaces the named file by the result of the operation once
+// fully written, keeping its permissions. With shred, the content of the file
+// is overwritten with zeros before being replaced, which is best effort only:
+// copy-on-write and journaling filesystems, snapshots and SSDs wear leveling
+// can keep copies of the original content.
+func ReplaceInPlace(name string, shred bool, write func(dst io.Writer) error) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", name)
+	}
+
+	commit := replaceFile
+	if shred {
+		commit = func(tmp, name string) error {
+			if err := shredFile(name, info.Size()); err != nil {
+				return fmt.Errorf("shredding %q: %w", name, err)
+			}
+			return replaceFile(tmp, name)
+		}
+	}
+
+	return writeFile(name, func(f *os.File) error {
+		if err := f.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+		return write(f)
+	}, commit)
+}
+
+// writeFileAtomic writes the named file through a temporary file in the same
+// directory, which is renamed once fully written and synced, or removed.
+func writeFileAtomic(name string, write func(f *os.File) error) error {
+	return writeFile(name, write, replaceFile)
+}
+
+// writeFile writes the named file through a temporary file in the same
+// directory, which is committed once fully written and synced, or removed on
+// errors.
+func writeFile(name string, write func(f *os.File) error, commit func(tmp, name string) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return commit(f.Name(), name)
+}
+
+// replaceFile commits the temporary file by renaming it over the named file.
+func replaceFile(tmp, name string) error {
+	return os.Rename(tmp, name)
+}
+
+// linkFile commits the temporary file by linking it to the named file, which
+// fails if the file was created in the meantime.
+func linkFile(tmp, name string) error {
+	if err := os.Link(tmp, name); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: %q", ErrOutputExists, name)
+		}
+		return err
+	}
+	return os.Remove(tmp)
+}
+
+// shredFile overwrites the first size bytes of the named file with zeros.
+func shredFile(name string, size int64) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zeros := make([]byte, 32*1024)
+	for written := int64(0); written < size; {
+		n := int64(len(zeros))
+		if size-written < n {
+			n = size - written
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return err
+		}
+		written += n
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/duration"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPolicyViolation represents an error when an encryption breaks a rule of
+// the policy.
+var ErrPolicyViolation = errors.New("policy violation")
+
+// Policy holds the rules an organization enforces on encryptions, read from a
+// yaml file such as:
+//
+//	rules:
+//	  - name: finance
+//	    paths: ["finance/*", "*.xlsx"]
+//	    chain: 52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971
+//	    min_duration: 1d
+//	    max_duration: 1y
+//	    armor: true
+//	    escrow: awskms://arn:aws:kms:us-east-1:111122223333:alias/escrow
+//
+// Every rule matching the input applies, a rule without paths matching any
+// input, including the standard input.
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule restricts the encryptions of the inputs matching one of its
+// paths. The paths are patterns as understood by filepath.Match, and patterns
+// without a separator match the base name of the input. The durations use the
+// grammar of the duration package, and bound the time between the encryption
+// and the unlock time of the round. The escrow is the URI --escrow must be,
+// so that the file key can always be recovered with the escrow key.
+type PolicyRule struct {
+	Name        string   `yaml:"name"`
+	Paths       []string `yaml:"paths"`
+	Chain       string   `yaml:"chain"`
+	MinDuration string   `yaml:"min_duration"`
+	MaxDuration string   `yaml:"max_duration"`
+	Armor       bool     `yaml:"armor"`
+	Escrow      string   `yaml:"escrow"`
+}
+
+// LoadPolicy reads the policy from the named file, rejecting unknown fields
+// so that misspelled rules aren't silently ignored.
+func LoadPolicy(name string) (Policy, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return Policy{}, fmt.Errorf("reading policy: %w", err)
+	}
+
+	var policy Policy
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&policy); err != nil {
+		return Policy{}, fmt.Errorf("decoding policy %q: %w", name, err)
+	}
+
+	now := time.Now()
+	for i, rule := range policy.Rules {
+		for _, pattern := range rule.Paths {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return Policy{}, fmt.Errorf("%s: path %q: %w", rule.ref(i), pattern, err)
+			}
+		}
+		for _, d := range []string{rule.MinDuration, rule.MaxDuration} {
+			if d == "" {
+				continue
+			}
+			if _, err := duration.Parse(now, d); err != nil {
+				return Policy{}, fmt.Errorf("%s: %w", rule.ref(i), err)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Check fails with ErrPolicyViolation if encrypting the named input, the empty
+// string standing for the standard input, towards the round of the network at
+// the given time breaks a rule.
+func (p Policy) Check(input string, flags Flags, network tlock.Network, roundNumber uint64, now time.Time) error {
+	unlock := network.TimeOf(roundNumber)
+
+	for i, rule := range p.Rules {
+		if !rule.matches(input) {
+			continue
+		}
+
+		if rule.Chain != "" && rule.Chain != network.ChainHash() {
+			return fmt.Errorf("%w: %s requires the chain %s", ErrPolicyViolation, rule.ref(i), rule.Chain)
+		}
+		if rule.Armor && !flags.Armor {
+			return fmt.Errorf("%w: %s requires -a/--armor", ErrPolicyViolation, rule.ref(i))
+		}
+		if rule.Escrow != "" && flags.Escrow != rule.Escrow {
+			return fmt.Errorf("%w: %s requires --escrow %s", ErrPolicyViolation, rule.ref(i), rule.Escrow)
+		}
+		if rule.MinDuration != "" {
+			d, err := duration.Parse(now, rule.MinDuration)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rule.ref(i), err)
+			}
+			if unlock.Before(now.Add(d)) {
+				return fmt.Errorf("%w: %s requires a duration of at least %s", ErrPolicyViolation, rule.ref(i), rule.MinDuration)
+			}
+		}
+		if rule.MaxDuration != "" {
+			d, err := duration.Parse(now, rule.MaxDuration)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rule.ref(i), err)
+			}
+			if unlock.After(now.Add(d)) {
+				return fmt.Errorf("%w: %s requires a duration of at most %s", ErrPolicyViolation, rule.ref(i), rule.MaxDuration)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the rule applies to the named input.
+func (r PolicyRule) matches(input string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	if input == "" {
+		return false
+	}
+
+	input = filepath.Clean(input)
+	for _, pattern := range r.Paths {
+		pattern = filepath.Clean(filepath.FromSlash(pattern))
+		name := input
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			name = filepath.Base(input)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ref returns how the rule at the index is referred to in errors.
+func (r PolicyRule) ref(index int) string {
+	if r.Name == "" {
+		return fmt.Sprintf("rule #%d", index+1)
+	}
+	return fmt.Sprintf("rule #%d (%s)", index+1, r.Name)
+}
+
+// CheckPolicy enforces the --policy file on the encryption of the named
+// input, the empty string standing for the standard input, at the given time.
+// The flags should be resolved at that time by ResolveRounds, so that the
+// rounds checked are the ones encrypted towards.
+func CheckPolicy(flags Flags, input string, network tlock.Network, now time.Time) error {
+	policy, err := LoadPolicy(flags.Policy)
+	if err != nil {
+		return err
+	}
+
+	roundNumbers, err := encryptRounds(flags, network, now)
+	if err != nil {
+		return err
+	}
+
+	for _, roundNumber := range roundNumbers {
+		if err := policy.Check(input, flags, network, roundNumber, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+// ErrInvalidProof represents an error when a proof of decryption doesn't
+// verify, or doesn't match the ciphertext it is checked against.
+var ErrInvalidProof = errors.New("invalid proof")
+
+// Proof records the beacon a ciphertext was decrypted with, along with the
+// chain information it verifies against, so that anyone can check that the
+// decryption only used a validly signed beacon.
+type Proof struct {
+	CiphertextSHA256 string          `json:"ciphertext_sha256"`
+	ChainHash        string          `json:"chain_hash"`
+	ChainInfo        json.RawMessage `json:"chain_info"`
+	Scheme           string          `json:"scheme"`
+	PublicKey        string          `json:"public_key"`
+	Round            uint64          `json:"round"`
+	Signature        string          `json:"signature"`
+	Verified         bool            `json:"verified"`
+	DecryptedAt      time.Time       `json:"decrypted_at"`
+}
+
+// DecryptWithProof performs the decryption operation like Decrypt, fetching
+// the signature of the round from the network, and returns the proof of the
+// beacon the input was decrypted with. It fails with ErrInvalidSignature if
+// the beacon doesn't verify.
+func DecryptWithProof(flags Flags, dst io.Writer, src io.Reader, network *http.Network) (Proof, error) {
+	// the network of the chain of the input, which may differ from the one of
+	// the flags.
+	used := network
+	t := tlock.New(network).WithChainSwitcher(func(chainHash string) (tlock.Network, error) {
+		clone := network.Clone()
+		if err := clone.SwitchChainHash(chainHash); err != nil {
+			return nil, err
+		}
+		used = clone
+		return clone, nil
+	})
+
+	ciphertext := sha256.New()
+	tee := io.TeeReader(src, ciphertext)
+	result, err := withTrailing(flags, t).DecryptWithResult(dst, tee)
+	if err != nil {
+		return Proof{}, err
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return Proof{}, fmt.Errorf("reading input: %w", err)
+	}
+
+	sig, err := used.Signature(result.Round)
+	if err != nil {
+		return Proof{}, fmt.Errorf("fetching signature: %w", err)
+	}
+
+	scheme := used.Scheme()
+	if err := scheme.VerifyBeacon(&chain.Beacon{Round: result.Round, Signature: sig}, used.PublicKey()); err != nil {
+		return Proof{}, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var info bytes.Buffer
+	if err := used.Info().ToJSON(&info, nil); err != nil {
+		return Proof{}, fmt.Errorf("encoding chain info: %w", err)
+	}
+	publicKey, err := used.PublicKey().MarshalBinary()
+	if err != nil {
+		return Proof{}, fmt.Errorf("encoding public key: %w", err)
+	}
+
+	return Proof{
+		CiphertextSHA256: hex.EncodeToString(ciphertext.Sum(nil)),
+		ChainHash:        result.ChainHash,
+		ChainInfo:        bytes.TrimSpace(info.Bytes()),
+		Scheme:           scheme.Name,
+		PublicKey:        hex.EncodeToString(publicKey),
+		Round:            result.Round,
+		Signature:        hex.EncodeToString(sig),
+		Verified:         true,
+		DecryptedAt:      time.Now().UTC(),
+	}, nil
+}
+
+// WriteProof writes the proof in json format to the named file.
+func WriteProof(name string, proof Proof) error {
+	b, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	return WriteOutput(name, false, func(dst io.Writer) error {
+		_, err := dst.Write(b)
+		return err
+	})
+}
+
+// CheckProof verifies the proof read from the source, without network access:
+// its chain information must hash to its chain hash, and its signature must
+// verify against the public key of the chain. If a ciphertext is given, it
+// must be the one the proof was made for. The verified proof is described to
+// the destination.
+func CheckProof(dst io.Writer, src io.Reader, ciphertext io.Reader) error {
+	var proof Proof
+	if err := json.NewDecoder(src).Decode(&proof); err != nil {
+		return fmt.Errorf("decoding proof: %w", err)
+	}
+
+	info, err := chaininfo.InfoFromJSON(bytes.NewReader(proof.ChainInfo))
+	if err != nil {
+		return fmt.Errorf("%w: decoding chain info: %v", ErrInvalidProof, err)
+	}
+	if info.HashString() != proof.ChainHash {
+		return fmt.Errorf("%w: the chain information hashes to %s instead of %s", ErrInvalidProof, info.HashString(), proof.ChainHash)
+	}
+	if info.Scheme != proof.Scheme {
+		return fmt.Errorf("%w: the chain uses the scheme %s instead of %s", ErrInvalidProof, info.Scheme, proof.Scheme)
+	}
+	publicKey, err := info.PublicKey.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encoding public key: %w", err)
+	}
+	if hex.EncodeToString(publicKey) != proof.PublicKey {
+		return fmt.Errorf("%w: the public key isn't the one of the chain", ErrInvalidProof)
+	}
+
+	scheme, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	sig, err := hex.DecodeString(proof.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: decoding signature: %v", ErrInvalidProof, err)
+	}
+	if err := scheme.VerifyBeacon(&chain.Beacon{Round: proof.Round, Signature: sig}, info.PublicKey); err != nil {
+		return fmt.Errorf("%w: the signature of round %d doesn't verify: %v", ErrInvalidProof, proof.Round, err)
+	}
+	if !proof.Verified {
+		return fmt.Errorf("%w: the beacon wasn't verified on decryption", ErrInvalidProof)
+	}
+
+	if ciphertext != nil {
+		if err := checkProofCiphertext(proof, ciphertext); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(dst, "Proof verified: round %d of chain %s, decrypted at %s.\n",
+		proof.Round, proof.ChainHash, proof.DecryptedAt.Format(time.RFC3339))
+	return err
+}
+
+// checkProofCiphertext checks that the ciphertext is the one the proof was
+// made for, and that it was encrypted towards the round of the proof.
+func checkProofCiphertext(proof Proof, ciphertext io.Reader) error {
+	digest := sha256.New()
+	header, err := tlock.ReadHeader(io.TeeReader(ciphertext, digest))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+	if _, err := io.Copy(digest, ciphertext); err != nil {
+		return fmt.Errorf("reading ciphertext: %w", err)
+	}
+
+	if hex.EncodeToString(digest.Sum(nil)) != proof.CiphertextSHA256 {
+		return fmt.Errorf("%w: the ciphertext doesn't match its digest", ErrInvalidProof)
+	}
+
+	for _, stanza := range header.Stanzas {
+		if stanza.Round == proof.Round && stanza.ChainHash == proof.ChainHash {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: the ciphertext wasn't encrypted towards round %d of chain %s", ErrInvalidProof, proof.Round, proof.ChainHash)
+}
@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+)
+
+// ReadRecipientsFile reads the age X25519 recipients listed in the named file,
+// one per line, empty lines and lines starting with # being ignored.
+func ReadRecipientsFile(name string) ([]age.Recipient, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening recipients file: %w", err)
+	}
+	defer f.Close()
+
+	recipients, err := age.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("recipients file %q: %w", name, err)
+	}
+
+	return recipients, nil
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/drand/tlock"
+)
+
+// Repair diagnoses the ciphertext of the source, logging each of its damaged
+// parts and whether its file key can still be unlocked, and writes the header
+// holding its intact stanzas to the destination, which the status of the
+// ciphertext can be read from. It fails if no stanza is intact.
+func Repair(dst io.Writer, src io.Reader, log *log.Logger) error {
+	d, err := tlock.Diagnose(src)
+	if err != nil {
+		return err
+	}
+
+	for _, damage := range d.Damages {
+		log.Printf("damaged %s", damage.Error())
+	}
+
+	switch {
+	case !d.Damaged():
+		log.Printf("intact: %d stanzas, %d body chunks", len(d.Stanzas), d.Chunks)
+	case d.DEKIntact:
+		log.Printf("the file key is intact in %d stanzas, %d complete body chunks", len(d.Stanzas), d.Chunks)
+	default:
+		log.Print("no intact stanza holds the file key, the ciphertext can't be decrypted")
+	}
+	if d.Damaged() && !d.HeaderIntact {
+		log.Print("the salvaged header can be read by --status, but can't be used to decrypt")
+	}
+
+	if err := d.WriteHeader(dst); err != nil {
+		return fmt.Errorf("salvaging header: %w", err)
+	}
+
+	return nil
+}
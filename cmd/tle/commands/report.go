@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the statuses of the files of a batch report.
+const (
+	StatusDecrypted = "decrypted"
+	StatusPending   = "pending"
+	StatusFailed    = "failed"
+)
+
+// FileReport describes the outcome of a file of a batch operation.
+type FileReport struct {
+	Input      string `json:"input"`
+	Output     string `json:"output,omitempty"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Bytes      int64  `json:"bytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BatchReport is the machine readable report of a batch operation, written
+// by --report.
+type BatchReport struct {
+	Decrypted int          `json:"decrypted"`
+	Pending   int          `json:"pending"`
+	Failed    int          `json:"failed"`
+	Files     []FileReport `json:"files"`
+}
+
+// add records the outcome of a file.
+func (r *BatchReport) add(file FileReport) {
+	switch file.Status {
+	case StatusDecrypted:
+		r.Decrypted++
+	case StatusPending:
+		r.Pending++
+	case StatusFailed:
+		r.Failed++
+	}
+	r.Files = append(r.Files, file)
+}
+
+// WriteReport writes the report to the named file, as csv if its extension is
+// .csv and as json otherwise.
+func WriteReport(name string, report BatchReport) error {
+	return WriteOutput(name, false, func(dst io.Writer) error {
+		if strings.EqualFold(filepath.Ext(name), ".csv") {
+			return writeReportCSV(dst, report)
+		}
+
+		enc := json.NewEncoder(dst)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	})
+}
+
+// writeReportCSV writes a line for each file of the report, after a header.
+func writeReportCSV(dst io.Writer, report BatchReport) error {
+	w := csv.NewWriter(dst)
+	if err := w.Write([]string{"input", "output", "status", "duration_ms", "bytes", "error"}); err != nil {
+		return err
+	}
+	for _, f := range report.Files {
+		record := []string{
+			f.Input,
+			f.Output,
+			f.Status,
+			strconv.FormatInt(f.DurationMS, 10),
+			strconv.FormatInt(f.Bytes, 10),
+			f.Error,
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// =============================================================================
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements the io.Writer interface.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// fileReport returns the report of the named input, decrypted into the output
+// since start by writing n bytes, unless the decryption failed with err.
+func fileReport(input string, output string, start time.Time, n int64, err error) FileReport {
+	if err != nil {
+		return FileReport{
+			Input:      input,
+			Status:     StatusFailed,
+			DurationMS: time.Since(start).Milliseconds(),
+			Error:      err.Error(),
+		}
+	}
+
+	return FileReport{
+		Input:      input,
+		Output:     output,
+		Status:     StatusDecrypted,
+		DurationMS: time.Since(start).Milliseconds(),
+		Bytes:      n,
+	}
+}
+
+// reportError returns ErrFilesFailed if some files of the report failed.
+func reportError(report BatchReport) error {
+	if report.Failed > 0 {
+		return fmt.Errorf("%w: %d of %d", ErrFilesFailed, report.Failed, len(report.Files))
+	}
+	return nil
+}
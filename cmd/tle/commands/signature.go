@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidSignature = errors.New("the signature received from the network does not verify against its public key")
+
+// ErrUnknownSignatureFormat represents an error when a signature is neither
+// hex, base64, nor a beacon in json or yaml format.
+var ErrUnknownSignatureFormat = errors.New("unknown signature format")
+
+// FetchSignature retrieves the signature of a past round from the network,
+// verifies it and writes both in yaml format to the destination.
+func FetchSignature(flags Flags, dst io.Writer, network *http.Network) error {
+	if current := network.Current(time.Now()); flags.Round > current {
+		return fmt.Errorf("%w: expected round %d > %d current round", tlock.ErrTooEarly, flags.Round, current)
+	}
+
+	sig, err := network.Signature(flags.Round)
+	if err != nil {
+		return fmt.Errorf("fetching signature: %w", err)
+	}
+
+	scheme := network.Scheme()
+	verifyErr := scheme.VerifyBeacon(&chain.Beacon{Round: flags.Round, Signature: sig}, network.PublicKey())
+
+	type Signature struct {
+		ChainHash string `yaml:"chain_hash"`
+		Round     uint64 `yaml:"round"`
+		Signature string `yaml:"signature"`
+		Verified  bool   `yaml:"verified"`
+	}
+	out, err := yaml.Marshal(Signature{
+		ChainHash: network.ChainHash(),
+		Round:     flags.Round,
+		Signature: hex.EncodeToString(sig),
+		Verified:  verifyErr == nil,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshalling signature: %w", err)
+	}
+	if _, err := dst.Write(out); err != nil {
+		return fmt.Errorf("error writing signature: %w", err)
+	}
+
+	if verifyErr != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, verifyErr)
+	}
+
+	return nil
+}
+
+// DeriveIdentity derives the age identity of a past round from its verified
+// signature, see tlock.DeriveKeypairAtRound, and writes it to the destination
+// in the format of age-keygen.
+func DeriveIdentity(flags Flags, dst io.Writer, network *http.Network) error {
+	identity, err := tlock.DeriveKeypairAtRound(network, flags.Round)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(dst, "# chain: %s\n# round: %d\n# public key: %s\n%s\n",
+		network.ChainHash(), flags.Round, identity.Recipient(), identity)
+	return err
+}
+
+// =============================================================================
+
+// ReadSignature reads a round signature pasted from other tools, detecting its
+// format: a beacon in json format as output by `drand get public` or served by
+// relays, the yaml output of --fetch-signature, or a bare hex or base64 encoded
+// signature.
+func ReadSignature(src io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %w", err)
+	}
+	b = bytes.TrimSpace(b)
+
+	// json being yaml, both beacon formats are decoded at once.
+	var beacon struct {
+		Signature string `yaml:"signature"`
+	}
+	if err := yaml.Unmarshal(b, &beacon); err == nil && beacon.Signature != "" {
+		b = []byte(beacon.Signature)
+	}
+
+	if sig, err := hex.DecodeString(string(b)); err == nil && validSignatureLength(sig) {
+		return sig, nil
+	}
+	if sig, err := base64.StdEncoding.DecodeString(string(b)); err == nil && validSignatureLength(sig) {
+		return sig, nil
+	}
+	if sig, err := base64.RawStdEncoding.DecodeString(string(b)); err == nil && validSignatureLength(sig) {
+		return sig, nil
+	}
+
+	return nil, ErrUnknownSignatureFormat
+}
+
+// validSignatureLength reports whether the signature has the length of a
+// signature on G1 or on G2.
+func validSignatureLength(sig []byte) bool {
+	return len(sig) == 48 || len(sig) == 96
+}
+
+// decryptSignature returns the signature given on the command line, if any.
+func decryptSignature(flags Flags) ([]byte, error) {
+	if flags.SignatureFile != "" {
+		f, err := os.Open(flags.SignatureFile)
+		if err != nil {
+			return nil, fmt.Errorf("opening signature file: %w", err)
+		}
+		defer f.Close()
+
+		return ReadSignature(f)
+	}
+
+	sig, err := hex.DecodeString(flags.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	return sig, nil
+}
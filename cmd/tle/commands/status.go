@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+// FileStatus describes when an encrypted file can be decrypted.
+type FileStatus struct {
+	File        string    `json:"file"`
+	Round       uint64    `json:"round,omitempty"`
+	ChainHash   string    `json:"chain_hash,omitempty"`
+	UnlockTime  time.Time `json:"unlock_time"`
+	Decryptable bool      `json:"decryptable"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Status reports when each of the named files, or the standard input for "-",
+// can be decrypted, sorted by unlock time. Files using another chainhash than
+// the network are looked up on the same relay.
+func Status(flags Flags, dst io.Writer, stdin io.Reader, names []string, network *http.Network) error {
+	networks := map[string]*http.Network{network.ChainHash(): network}
+
+	now := time.Now()
+	var statuses []FileStatus
+	for _, name := range names {
+		statuses = append(statuses, fileStatus(flags, stdin, name, networks, now)...)
+	}
+	sortStatuses(statuses)
+
+	if flags.JSON {
+		enc := json.NewEncoder(dst)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(statuses); err != nil {
+			return fmt.Errorf("error writing status: %w", err)
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(dst, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tROUND\tCHAIN\tUNLOCK TIME\tDECRYPTABLE")
+	for _, s := range statuses {
+		switch {
+		case s.Error != "":
+			fmt.Fprintf(tw, "%s\t-\t-\t-\terror: %s\n", s.File, s.Error)
+		case s.Decryptable:
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\tyes\n",
+				s.File, s.Round, s.ChainHash, s.UnlockTime.UTC().Format(time.RFC1123))
+		default:
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\tin %s\n",
+				s.File, s.Round, s.ChainHash, s.UnlockTime.UTC().Format(time.RFC1123), s.UnlockTime.Sub(now).Round(time.Second))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("error writing status: %w", err)
+	}
+
+	return nil
+}
+
+// LinkPolicy defines how symbolic links are treated when walking directories.
+// Sockets, devices and named pipes are always skipped, and hard links are
+// regular files like any other.
+type LinkPolicy int
+
+// These are the supported link policies.
+const (
+	// SkipLinks ignores symbolic links.
+	SkipLinks LinkPolicy = iota
+	// FollowLinks walks the files and directories symbolic links point to,
+	// each directory being walked at most once.
+	FollowLinks
+	// PreserveLinks returns the selected symbolic links as is,
+	// without following links to directories.
+	PreserveLinks
+)
+
+// Selection selects the files of a directory tree by their name and depth.
+type Selection struct {
+	// Patterns are the patterns of the names of the selected files, any of
+	// which must match.
+	Patterns []string
+	// Exclude are the patterns of the names of the files and directories which
+	// are skipped, even if they match Patterns.
+	Exclude []string
+	// MaxDepth is how many levels of directories are walked, 1 only selecting
+	// the files of the directory itself. Zero walks the whole tree.
+	MaxDepth int
+	// Links defines how the symbolic links are treated.
+	Links LinkPolicy
+}
+
+// Match reports whether the name of a file is selected.
+func (s Selection) Match(name string) (bool, error) {
+	excluded, err := matchAny(s.Exclude, name)
+	if err != nil || excluded {
+		return false, err
+	}
+
+	return matchAny(s.Patterns, name)
+}
+
+// Validate checks that the patterns are well formed.
+func (s Selection) Validate() error {
+	for _, pattern := range append(slices.Clone(s.Patterns), s.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%q: %w", pattern, err)
+		}
+	}
+	if s.MaxDepth < 0 {
+		return fmt.Errorf("the maximum depth can't be negative")
+	}
+
+	return nil
+}
+
+// matchAny reports whether the name matches any of the patterns.
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		match, err := filepath.Match(pattern, name)
+		if err != nil || match {
+			return match, err
+		}
+	}
+
+	return false, nil
+}
+
+// StatusFiles returns the regular files of the directory and its
+// subdirectories which are selected, symbolic links being treated according
+// to the policy of the selection.
+func StatusFiles(dir string, sel Selection) ([]string, error) {
+	w := walker{
+		sel:     sel,
+		visited: make(map[string]bool),
+	}
+	if err := w.walk(dir, 1); err != nil {
+		return nil, fmt.Errorf("walking %q: %w", dir, err)
+	}
+
+	return w.names, nil
+}
+
+// walker collects the files of a directory tree.
+type walker struct {
+	sel     Selection
+	visited map[string]bool
+	names   []string
+}
+
+// walk collects the files of the directory at the given depth, in lexical
+// order.
+func (w *walker) walk(dir string, depth int) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.visited[resolved] {
+		return nil
+	}
+	w.visited[resolved] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		mode := entry.Type()
+
+		if mode&fs.ModeSymlink != 0 {
+			switch w.sel.Links {
+			case SkipLinks:
+				continue
+			case PreserveLinks:
+				if err := w.add(path, entry.Name()); err != nil {
+					return err
+				}
+				continue
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				// dangling links have nothing to walk.
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+
+		switch {
+		case mode.IsDir():
+			if w.sel.MaxDepth != 0 && depth >= w.sel.MaxDepth {
+				continue
+			}
+			excluded, err := matchAny(w.sel.Exclude, entry.Name())
+			if err != nil {
+				return err
+			}
+			if excluded {
+				continue
+			}
+			if err := w.walk(path, depth+1); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := w.add(path, entry.Name()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// add collects the path if its name is selected.
+func (w *walker) add(path string, name string) error {
+	match, err := w.sel.Match(name)
+	if err != nil {
+		return err
+	}
+	if match {
+		w.names = append(w.names, path)
+	}
+	return nil
+}
+
+// sortStatuses orders the statuses by unlock time, with errors last.
+func sortStatuses(statuses []FileStatus) {
+	sort.SliceStable(statuses, func(i, j int) bool {
+		if (statuses[i].Error == "") != (statuses[j].Error == "") {
+			return statuses[i].Error == ""
+		}
+		return statuses[i].UnlockTime.Before(statuses[j].UnlockTime)
+	})
+}
+
+// fileStatus returns the status of every tlock stanza of the named file.
+// Errors are reported as part of the status so that other files are processed.
+func fileStatus(flags Flags, stdin io.Reader, name string, networks map[string]*http.Network, now time.Time) []FileStatus {
+	src := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return []FileStatus{{File: name, Error: err.Error()}}
+		}
+		defer f.Close()
+		src = f
+	}
+
+	header, err := tlock.ReadHeader(src)
+	if err != nil {
+		return []FileStatus{{File: name, Error: err.Error()}}
+	}
+
+	var statuses []FileStatus
+	for _, stanza := range header.Stanzas {
+		status := FileStatus{
+			File:      name,
+			Round:     stanza.Round,
+			ChainHash: stanza.ChainHash,
+		}
+
+		network, ok := networks[stanza.ChainHash]
+		if !ok {
+			network, err = http.NewNetwork(flags.Network, stanza.ChainHash)
+			if err != nil {
+				status.Error = fmt.Sprintf("unknown chain %s on %s: %v", stanza.ChainHash, flags.Network, err)
+				statuses = append(statuses, status)
+				continue
+			}
+			networks[stanza.ChainHash] = network
+		}
+
+		status.UnlockTime = network.TimeOf(stanza.Round)
+		status.Decryptable = network.Current(now) >= stanza.Round
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage provides the files the batch operations read and write, so that
+// other backends than the local file system can be used.
+type Storage interface {
+	// Open opens the named file for reading.
+	Open(name string) (io.ReadCloser, error)
+
+	// Create writes the named file, creating its parent directories. The file
+	// must only be visible once write succeeded. With noClobber, an existing
+	// file is never replaced and ErrOutputExists is returned.
+	Create(name string, noClobber bool, write func(dst io.Writer) error) error
+
+	// Walk returns the files of the directory and its subdirectories which
+	// are selected, in lexical order.
+	Walk(dir string, sel Selection) ([]string, error)
+}
+
+// LocalStorage is the Storage of the local file system.
+type LocalStorage struct{}
+
+// Open implements the Storage interface.
+func (LocalStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// Create implements the Storage interface.
+func (LocalStorage) Create(name string, noClobber bool, write func(dst io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	return WriteOutput(name, noClobber, write)
+}
+
+// Walk implements the Storage interface.
+func (LocalStorage) Walk(dir string, sel Selection) ([]string, error) {
+	return StatusFiles(dir, sel)
+}
@@ -0,0 +1,465 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+// SweepFlags represent the values from the command line of the sweep command.
+type SweepFlags struct {
+	Network    string
+	InputDir   string
+	OutputDir  string
+	State      string
+	RoundState string
+	Pattern    []string
+	Exclude    []string
+	MaxDepth   int
+	Interval   time.Duration
+	MinDelay   time.Duration
+	MaxRPS     float64
+	Once       bool
+
+	OutputTemplate string
+	Report         string
+
+	AllowOverlap   bool
+	FollowSymlinks bool
+	PreserveLinks  bool
+}
+
+// ParseSweep will parse the command line arguments of the sweep command.
+// Validation takes place.
+func ParseSweep(args []string) (SweepFlags, error) {
+	f := SweepFlags{
+		Network:  DefaultNetwork,
+		Interval: 30 * time.Second,
+		MinDelay: time.Second,
+	}
+
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	fs.StringVar(&f.Network, "n", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Network, "network", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.InputDir, "input-dir", f.InputDir, "the directory of the files to decrypt")
+	fs.StringVar(&f.OutputDir, "output-dir", f.OutputDir, "the directory of the decrypted files")
+	fs.StringVar(&f.OutputTemplate, "output-template", f.OutputTemplate, "the template of the paths in the output directory")
+	fs.StringVar(&f.Report, "report", f.Report, "the path to write the json or csv report of each sweep to")
+	fs.StringVar(&f.State, "state", f.State, "the path to the file recording the decrypted files")
+	fs.StringVar(&f.RoundState, "round-state", f.RoundState, "the path to the file recording the highest rounds served by the relay")
+	fs.Var((*stringsFlag)(&f.Pattern), "pattern", "a pattern of the file names in the input directory")
+	fs.Var((*stringsFlag)(&f.Exclude), "exclude", "a pattern of the file and directory names to skip")
+	fs.IntVar(&f.MaxDepth, "max-depth", f.MaxDepth, "how many levels of directories to walk")
+	fs.DurationVar(&f.Interval, "interval", f.Interval, "how long to wait between two sweeps")
+	fs.DurationVar(&f.MinDelay, "min-delay", f.MinDelay, "the minimum delay between two requests for the same chain")
+	fs.Float64Var(&f.MaxRPS, "max-rps", f.MaxRPS, "the maximum number of requests per second to the relay")
+	fs.BoolVar(&f.Once, "once", f.Once, "sweep only once instead of running continuously")
+	fs.BoolVar(&f.AllowOverlap, "allow-overlap", f.AllowOverlap, "allow the output directory to overlap the input directory")
+	fs.BoolVar(&f.FollowSymlinks, "follow-symlinks", f.FollowSymlinks, "walk the targets of the symbolic links of the input directory")
+	fs.BoolVar(&f.PreserveLinks, "preserve-links", f.PreserveLinks, "recreate the symbolic links of the input directory in the output directory")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return SweepFlags{}, err
+	}
+
+	switch {
+	case len(positional) != 0:
+		return SweepFlags{}, fmt.Errorf("sweep doesn't expect any INPUT")
+	case f.InputDir == "" || f.OutputDir == "" || f.State == "":
+		return SweepFlags{}, fmt.Errorf("--input-dir, --output-dir and --state must be specified")
+	case f.Interval <= 0:
+		return SweepFlags{}, fmt.Errorf("--interval must be positive")
+	case f.MinDelay < 0:
+		return SweepFlags{}, fmt.Errorf("--min-delay can't be negative")
+	case f.MaxRPS < 0:
+		return SweepFlags{}, fmt.Errorf("--max-rps can't be negative")
+	case f.FollowSymlinks && f.PreserveLinks:
+		return SweepFlags{}, fmt.Errorf("--follow-symlinks can't be used with --preserve-links")
+	}
+	if len(f.Pattern) == 0 {
+		f.Pattern = []string{DefaultPattern}
+	}
+	if err := f.selection().Validate(); err != nil {
+		return SweepFlags{}, fmt.Errorf("--pattern, --exclude or --max-depth: %w", err)
+	}
+	if f.OutputTemplate != "" {
+		if _, err := ParseOutputTemplate(f.OutputTemplate); err != nil {
+			return SweepFlags{}, fmt.Errorf("--output-template: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
+// selection returns the selection of the files of the input directory.
+func (f SweepFlags) selection() Selection {
+	links := SkipLinks
+	switch {
+	case f.FollowSymlinks:
+		links = FollowLinks
+	case f.PreserveLinks:
+		links = PreserveLinks
+	}
+
+	return Selection{Patterns: f.Pattern, Exclude: f.Exclude, MaxDepth: f.MaxDepth, Links: links}
+}
+
+// =============================================================================
+
+// sweepState is persisted after every decrypted file, so that a sweep can be
+// resumed after a crash without decrypting files twice.
+type sweepState struct {
+	Decrypted map[string]sweepEntry `json:"decrypted"`
+}
+
+// sweepEntry records where and when a file was decrypted.
+type sweepEntry struct {
+	Output      string    `json:"output"`
+	Round       uint64    `json:"round"`
+	ChainHash   string    `json:"chain_hash"`
+	DecryptedAt time.Time `json:"decrypted_at"`
+
+	// bytes is the size of the decrypted file, only known to the sweep which
+	// decrypted it.
+	bytes int64
+}
+
+// Sweep decrypts the files of the input directory into the output directory as
+// soon as their round is reached, until the context is done. Requests to the
+// relay are spaced by at least MinDelay for each chain. The directories must
+// not overlap unless AllowOverlap is set.
+func Sweep(ctx context.Context, flags SweepFlags, log *log.Logger) error {
+	if !flags.AllowOverlap {
+		if err := CheckOverlap(flags.InputDir, flags.OutputDir); err != nil {
+			return err
+		}
+	}
+
+	state, err := loadSweepState(flags.State)
+	if err != nil {
+		return err
+	}
+
+	s := sweeper{
+		flags:    flags,
+		log:      log,
+		storage:  LocalStorage{},
+		state:    state,
+		networks: make(map[string]*http.Network),
+		lastCall: make(map[string]time.Time),
+	}
+	if flags.RoundState != "" {
+		if s.rounds, err = http.NewFileRoundStore(flags.RoundState); err != nil {
+			return err
+		}
+	}
+
+	for {
+		report, err := s.sweep(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("sweep: %d decrypted, %d pending, %d failed, %d decrypted in total",
+			report.Decrypted, report.Pending, report.Failed, len(s.state.Decrypted))
+
+		if flags.Report != "" {
+			if err := WriteReport(flags.Report, report); err != nil {
+				return fmt.Errorf("writing report: %w", err)
+			}
+		}
+
+		if flags.Once {
+			return reportError(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(flags.Interval):
+		}
+	}
+}
+
+// sweeper holds what is kept between sweeps. The state file and the preserved
+// links are always on the local file system.
+type sweeper struct {
+	flags    SweepFlags
+	log      *log.Logger
+	storage  Storage
+	state    sweepState
+	networks map[string]*http.Network
+	rounds   http.RoundStore
+	lastCall map[string]time.Time
+}
+
+// sweep walks the input directory once and decrypts all the files whose round
+// was reached, returning the report of the files which weren't decrypted by
+// the previous sweeps.
+func (s *sweeper) sweep(ctx context.Context) (BatchReport, error) {
+	var report BatchReport
+
+	names, err := s.storage.Walk(s.flags.InputDir, s.flags.selection())
+	if err != nil {
+		return report, err
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return report, nil
+		}
+		if _, ok := s.state.Decrypted[name]; ok {
+			continue
+		}
+
+		start := time.Now()
+		entry, err := s.decrypt(ctx, name)
+		file := fileReport(name, entry.Output, start, entry.bytes, err)
+		switch {
+		case errors.Is(err, tlock.ErrTooEarly), errors.Is(err, errLinkPending):
+			file.Status = StatusPending
+			file.Error = ""
+			report.add(file)
+			continue
+		case err != nil:
+			report.add(file)
+			s.log.Printf("sweep: %s: %v", name, err)
+			continue
+		}
+
+		s.state.Decrypted[name] = entry
+		if err := saveSweepState(s.flags.State, s.state); err != nil {
+			return report, err
+		}
+		report.add(file)
+	}
+
+	return report, nil
+}
+
+// decrypt decrypts the named file into the output directory, if its round was
+// reached, through a temporary file so that no partial output is left behind.
+func (s *sweeper) decrypt(ctx context.Context, name string) (sweepEntry, error) {
+	if s.flags.PreserveLinks {
+		if info, err := os.Lstat(name); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return s.link(name)
+		}
+	}
+
+	header, err := s.header(name)
+	if err != nil {
+		return sweepEntry{}, err
+	}
+	stanza := header.Earliest()
+
+	network, err := s.network(stanza.ChainHash)
+	if err != nil {
+		return sweepEntry{}, err
+	}
+
+	if current := network.Current(time.Now()); stanza.Round > current {
+		return sweepEntry{}, tlock.ErrTooEarly
+	}
+
+	if wait := time.Until(s.lastCall[stanza.ChainHash].Add(s.flags.MinDelay)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return sweepEntry{}, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	s.lastCall[stanza.ChainHash] = time.Now()
+
+	output, err := s.output(name, stanza)
+	if err != nil {
+		return sweepEntry{}, err
+	}
+
+	counter := &countingWriter{}
+	err = s.storage.Create(output, false, func(dst io.Writer) error {
+		in, err := s.storage.Open(name)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		// the network was chosen for the chainhash of the file, no need to switch.
+		counter.w = dst
+		return tlock.New(network).Strict().Decrypt(counter, in)
+	})
+	if err != nil {
+		return sweepEntry{}, err
+	}
+
+	return sweepEntry{
+		Output:      output,
+		Round:       stanza.Round,
+		ChainHash:   stanza.ChainHash,
+		DecryptedAt: time.Now().UTC(),
+		bytes:       counter.n,
+	}, nil
+}
+
+// errLinkPending is returned for a link whose target isn't decrypted yet.
+var errLinkPending = errors.New("link target not decrypted yet")
+
+// link recreates the symbolic link of the input directory in the output
+// directory, towards the decrypted target, once the target is decrypted.
+func (s *sweeper) link(name string) (sweepEntry, error) {
+	target, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return sweepEntry{}, fmt.Errorf("resolving link: %w", err)
+	}
+	inputDir, err := filepath.EvalSymlinks(s.flags.InputDir)
+	if err != nil {
+		return sweepEntry{}, err
+	}
+
+	rel, err := filepath.Rel(inputDir, target)
+	if err != nil || !within(target, inputDir) {
+		return sweepEntry{}, fmt.Errorf("link target %q is outside of the input directory", target)
+	}
+
+	entry, ok := s.state.Decrypted[filepath.Join(s.flags.InputDir, rel)]
+	if !ok {
+		return sweepEntry{}, errLinkPending
+	}
+
+	output, err := s.output(name, tlock.Stanza{Type: tlock.StanzaType, Round: entry.Round, ChainHash: entry.ChainHash})
+	if err != nil {
+		return sweepEntry{}, err
+	}
+	linkTarget, err := filepath.Rel(filepath.Dir(output), entry.Output)
+	if err != nil {
+		return sweepEntry{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0700); err != nil {
+		return sweepEntry{}, err
+	}
+	// a link left by an interrupted sweep is replaced.
+	if info, err := os.Lstat(output); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(output); err != nil {
+			return sweepEntry{}, err
+		}
+	}
+	if err := os.Symlink(linkTarget, output); err != nil {
+		return sweepEntry{}, err
+	}
+
+	entry.Output = output
+	entry.DecryptedAt = time.Now().UTC()
+	return entry, nil
+}
+
+// header reads the header of the named file.
+func (s *sweeper) header(name string) (tlock.Header, error) {
+	in, err := s.storage.Open(name)
+	if err != nil {
+		return tlock.Header{}, err
+	}
+	defer in.Close()
+
+	return tlock.ReadHeader(in)
+}
+
+// network returns the network of the chain, reusing the ones of the previous
+// files.
+func (s *sweeper) network(chainHash string) (*http.Network, error) {
+	if network, ok := s.networks[chainHash]; ok {
+		return network, nil
+	}
+
+	network, err := http.NewNetwork(s.flags.Network, chainHash)
+	if err != nil {
+		return nil, err
+	}
+	if s.rounds != nil {
+		network.SetRoundStore(s.rounds)
+	}
+	s.networks[chainHash] = network
+
+	return network, nil
+}
+
+// output returns the path in the output directory of the decrypted file, given
+// by the output template if any.
+func (s *sweeper) output(name string, stanza tlock.Stanza) (string, error) {
+	if s.flags.OutputTemplate == "" {
+		rel, err := filepath.Rel(s.flags.InputDir, name)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(s.flags.OutputDir, strings.TrimSuffix(rel, ".tle")), nil
+	}
+
+	tmpl, err := ParseOutputTemplate(s.flags.OutputTemplate)
+	if err != nil {
+		return "", err
+	}
+	network, err := s.network(stanza.ChainHash)
+	if err != nil {
+		return "", err
+	}
+	fields, err := newOutputName(name, s.flags.InputDir, stanza, network.TimeOf(stanza.Round))
+	if err != nil {
+		return "", err
+	}
+
+	return templateOutput(tmpl, s.flags.OutputDir, fields)
+}
+
+// =============================================================================
+
+// loadSweepState reads the state file, an absent file being an empty state.
+func loadSweepState(name string) (sweepState, error) {
+	state := sweepState{Decrypted: make(map[string]sweepEntry)}
+
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return sweepState{}, fmt.Errorf("reading state: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return sweepState{}, fmt.Errorf("decoding state %q: %w", name, err)
+	}
+	if state.Decrypted == nil {
+		state.Decrypted = make(map[string]sweepEntry)
+	}
+
+	return state, nil
+}
+
+// saveSweepState atomically replaces the state file.
+func saveSweepState(name string, state sweepState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+
+	err = writeFileAtomic(name, func(f *os.File) error {
+		_, err := f.Write(b)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	return nil
+}
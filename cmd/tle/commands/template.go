@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/http"
+)
+
+// OutputName holds the fields of an input available to the output template,
+// which names its decryption in the output directory.
+type OutputName struct {
+	// Dir is the directory of the input, relative to the input directory of
+	// the sweep command, or as given otherwise.
+	Dir string
+	// Base is the base name of the input.
+	Base string
+	// Name is the base name of the input without its .tle extension.
+	Name string
+
+	// Round and ChainHash are the ones of the first tlock stanza of the
+	// input, which can be decrypted from Unlock on.
+	Round     uint64
+	ChainHash string
+	Unlock    time.Time
+}
+
+// ParseOutputTemplate parses the text of an output template, e.g.
+// "{{.Dir}}/{{.Name}}.{{.Round}}", referencing the fields of OutputName.
+func ParseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing output template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// newOutputName returns the fields of the named input for the output template,
+// its directory being relative to dir if given.
+func newOutputName(name string, dir string, stanza tlock.Stanza, unlock time.Time) (OutputName, error) {
+	rel := name
+	if dir != "" {
+		var err error
+		if rel, err = filepath.Rel(dir, name); err != nil {
+			return OutputName{}, err
+		}
+	}
+
+	base := filepath.Base(name)
+	return OutputName{
+		Dir:       filepath.Dir(rel),
+		Base:      base,
+		Name:      strings.TrimSuffix(base, ".tle"),
+		Round:     stanza.Round,
+		ChainHash: stanza.ChainHash,
+		Unlock:    unlock.UTC(),
+	}, nil
+}
+
+// templateOutput returns the path in the output directory given by executing
+// the template, which must stay within the output directory.
+func templateOutput(tmpl *template.Template, dir string, name OutputName) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, name); err != nil {
+		return "", fmt.Errorf("executing output template: %w", err)
+	}
+
+	output := filepath.Clean(b.String())
+	if output == "." || !filepath.IsLocal(output) {
+		return "", fmt.Errorf("the output template gives %q, outside of the output directory", b.String())
+	}
+
+	return filepath.Join(dir, output), nil
+}
+
+// unlockTime returns when the stanza can be decrypted, switching to its chain
+// on a clone of the network if needed. Without network, the time is unknown.
+func unlockTime(network *http.Network, stanza tlock.Stanza) (time.Time, error) {
+	if network == nil {
+		return time.Time{}, nil
+	}
+
+	if stanza.ChainHash != network.ChainHash() {
+		clone := network.Clone()
+		if err := clone.SwitchChainHash(stanza.ChainHash); err != nil {
+			return time.Time{}, err
+		}
+		network = clone
+	}
+
+	return network.TimeOf(stanza.Round), nil
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// ErrTimestampRejected represents an error when the time stamp authority
+// didn't grant the timestamp.
+var ErrTimestampRejected = errors.New("the time stamp authority rejected the request")
+
+// ErrInvalidTimestamp represents an error when the response of the time stamp
+// authority doesn't timestamp the requested digest.
+var ErrInvalidTimestamp = errors.New("invalid timestamp response")
+
+// timestampTimeout bounds the time waited for the time stamp authority.
+const timestampTimeout = 30 * time.Second
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// timestampRequest is the TimeStampReq of RFC 3161.
+type timestampRequest struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int
+	CertReq        bool
+}
+
+// messageImprint is the MessageImprint of RFC 3161.
+type messageImprint struct {
+	HashAlgorithm algorithmIdentifier
+	HashedMessage []byte
+}
+
+// algorithmIdentifier is the AlgorithmIdentifier of RFC 5280.
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue
+}
+
+// WriteTimestamp obtains from the time stamp authority at url an RFC 3161
+// timestamp of the ciphertext described by the manifest, and writes the DER
+// encoded response to the named file, as expected by openssl ts -verify.
+func WriteTimestamp(ctx context.Context, name string, url string, manifest Manifest) error {
+	digest, err := hex.DecodeString(manifest.CiphertextSHA256)
+	if err != nil {
+		return err
+	}
+
+	response, _, err := RequestTimestamp(ctx, url, digest)
+	if err != nil {
+		return err
+	}
+
+	return WriteOutput(name, false, func(dst io.Writer) error {
+		_, err := dst.Write(response)
+		return err
+	})
+}
+
+// RequestTimestamp obtains from the time stamp authority at url an RFC 3161
+// timestamp of the SHA-256 digest, returning the DER encoded response and the
+// time it attests. The signature of the authority isn't verified.
+func RequestTimestamp(ctx context.Context, url string, digest []byte) ([]byte, time.Time, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	request, err := asn1.Marshal(timestampRequest{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timestampTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("requesting timestamp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("requesting timestamp: %s", resp.Status)
+	}
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading timestamp: %w", err)
+	}
+
+	genTime, err := parseTimestampResponse(response, digest, nonce)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return response, genTime, nil
+}
+
+// parseTimestampResponse returns the time attested by the TimeStampResp, once
+// checked that it was granted for the digest and the nonce.
+func parseTimestampResponse(response []byte, digest []byte, nonce *big.Int) (time.Time, error) {
+	var resp, statusInfo cryptobyte.String
+	input := cryptobyte.String(response)
+	if !input.ReadASN1(&resp, cryptobyte_asn1.SEQUENCE) || !resp.ReadASN1(&statusInfo, cryptobyte_asn1.SEQUENCE) {
+		return time.Time{}, fmt.Errorf("%w: malformed response", ErrInvalidTimestamp)
+	}
+
+	// the status is granted (0) or granted with modifications (1).
+	var status int
+	if !statusInfo.ReadASN1Integer(&status) {
+		return time.Time{}, fmt.Errorf("%w: malformed status", ErrInvalidTimestamp)
+	}
+	if status > 1 {
+		var text, freeText cryptobyte.String
+		if statusInfo.ReadASN1(&freeText, cryptobyte_asn1.SEQUENCE) && freeText.ReadASN1(&text, cryptobyte_asn1.UTF8String) {
+			return time.Time{}, fmt.Errorf("%w: status %d: %s", ErrTimestampRejected, status, text)
+		}
+		return time.Time{}, fmt.Errorf("%w: status %d", ErrTimestampRejected, status)
+	}
+
+	// the token is a CMS SignedData whose content is the TSTInfo.
+	var contentInfo, content, signedData, encapContentInfo, eContent, tstInfo cryptobyte.String
+	var contentType, eContentType asn1.ObjectIdentifier
+	if !resp.ReadASN1(&contentInfo, cryptobyte_asn1.SEQUENCE) ||
+		!contentInfo.ReadASN1ObjectIdentifier(&contentType) || !contentType.Equal(oidSignedData) ||
+		!contentInfo.ReadASN1(&content, cryptobyte_asn1.Tag(0).ContextSpecific().Constructed()) ||
+		!content.ReadASN1(&signedData, cryptobyte_asn1.SEQUENCE) ||
+		!signedData.SkipASN1(cryptobyte_asn1.INTEGER) ||
+		!signedData.SkipASN1(cryptobyte_asn1.SET) ||
+		!signedData.ReadASN1(&encapContentInfo, cryptobyte_asn1.SEQUENCE) ||
+		!encapContentInfo.ReadASN1ObjectIdentifier(&eContentType) || !eContentType.Equal(oidTSTInfo) ||
+		!encapContentInfo.ReadASN1(&eContent, cryptobyte_asn1.Tag(0).ContextSpecific().Constructed()) ||
+		!eContent.ReadASN1(&tstInfo, cryptobyte_asn1.OCTET_STRING) {
+		return time.Time{}, fmt.Errorf("%w: malformed token", ErrInvalidTimestamp)
+	}
+
+	var info, imprint, hashed cryptobyte.String
+	var algorithm asn1.ObjectIdentifier
+	var genTime time.Time
+	if !tstInfo.ReadASN1(&info, cryptobyte_asn1.SEQUENCE) ||
+		!info.SkipASN1(cryptobyte_asn1.INTEGER) ||
+		!info.SkipASN1(cryptobyte_asn1.OBJECT_IDENTIFIER) ||
+		!info.ReadASN1(&imprint, cryptobyte_asn1.SEQUENCE) ||
+		!imprint.ReadASN1(&hashed, cryptobyte_asn1.SEQUENCE) ||
+		!hashed.ReadASN1ObjectIdentifier(&algorithm) ||
+		!imprint.ReadASN1(&hashed, cryptobyte_asn1.OCTET_STRING) ||
+		!info.SkipASN1(cryptobyte_asn1.INTEGER) ||
+		!info.ReadASN1GeneralizedTime(&genTime) ||
+		!info.SkipOptionalASN1(cryptobyte_asn1.SEQUENCE) ||
+		!info.SkipOptionalASN1(cryptobyte_asn1.BOOLEAN) {
+		return time.Time{}, fmt.Errorf("%w: malformed TSTInfo", ErrInvalidTimestamp)
+	}
+
+	if !algorithm.Equal(oidSHA256) || !bytes.Equal(hashed, digest) {
+		return time.Time{}, fmt.Errorf("%w: the token doesn't timestamp the ciphertext", ErrInvalidTimestamp)
+	}
+
+	got := new(big.Int)
+	if !info.PeekASN1Tag(cryptobyte_asn1.INTEGER) || !info.ReadASN1Integer(got) || got.Cmp(nonce) != 0 {
+		return time.Time{}, fmt.Errorf("%w: the nonce doesn't match", ErrInvalidTimestamp)
+	}
+
+	return genTime, nil
+}
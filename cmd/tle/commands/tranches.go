@@ -0,0 +1,246 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/duration"
+)
+
+// TranchesIndexName is the name of the index written in the output directory
+// of the tranches command.
+const TranchesIndexName = "index.json"
+
+// ErrTranchesNotEmpty represents an error when writing the tranches into a
+// directory which already holds files.
+var ErrTranchesNotEmpty = errors.New("the tranches directory isn't empty")
+
+// ErrTranchesTooClose represents an error when successive tranches would
+// unlock at the same round.
+var ErrTranchesTooClose = errors.New("the tranches are closer than the period of the chain")
+
+// TranchesFlags represent the values from the command line of the tranches
+// command.
+type TranchesFlags struct {
+	Network   string
+	Chain     string
+	Parts     int
+	First     string
+	Every     string
+	Horizon   string
+	Force     bool
+	Armor     bool
+	OutputDir string
+	Input     string
+}
+
+// ParseTranches will parse the command line arguments of the tranches
+// command. Validation takes place.
+func ParseTranches(args []string) (TranchesFlags, error) {
+	f := TranchesFlags{
+		Network: DefaultNetwork,
+		Chain:   DefaultChain,
+	}
+
+	fs := flag.NewFlagSet("tranches", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	fs.StringVar(&f.Network, "n", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Network, "network", f.Network, "the drand API endpoint")
+	fs.StringVar(&f.Chain, "c", f.Chain, "chain to use")
+	fs.StringVar(&f.Chain, "chain", f.Chain, "chain to use")
+	fs.IntVar(&f.Parts, "parts", f.Parts, "how many tranches to split the input into")
+	fs.StringVar(&f.First, "first", f.First, "how long to wait before being able to decrypt the first tranche")
+	fs.StringVar(&f.Every, "every", f.Every, "how long to wait between the unlocks of two tranches")
+	fs.StringVar(&f.Horizon, "horizon", f.Horizon, "how far away the round of the last tranche can be")
+	fs.BoolVar(&f.Force, "f", f.Force, "encrypt beyond the horizon")
+	fs.BoolVar(&f.Force, "force", f.Force, "encrypt beyond the horizon")
+	fs.BoolVar(&f.Armor, "a", f.Armor, "encrypt the tranches in PEM format")
+	fs.BoolVar(&f.Armor, "armor", f.Armor, "encrypt the tranches in PEM format")
+	fs.StringVar(&f.OutputDir, "output-dir", f.OutputDir, "the directory of the tranches")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return TranchesFlags{}, err
+	}
+	if len(positional) != 1 || positional[0] == "-" {
+		return TranchesFlags{}, fmt.Errorf("tranches expects a single INPUT file")
+	}
+	f.Input = positional[0]
+
+	switch {
+	case f.Parts < 1:
+		return TranchesFlags{}, fmt.Errorf("--parts must be positive")
+	case f.First == "" || f.OutputDir == "":
+		return TranchesFlags{}, fmt.Errorf("--first and --output-dir must be specified")
+	case f.Every == "" && f.Parts > 1:
+		return TranchesFlags{}, fmt.Errorf("--every must be specified with several --parts")
+	}
+	now := time.Now()
+	if _, err := duration.Parse(now, f.First); err != nil {
+		return TranchesFlags{}, fmt.Errorf("--first: %w", err)
+	}
+	if f.Every != "" {
+		if _, err := duration.Parse(now, f.Every); err != nil {
+			return TranchesFlags{}, fmt.Errorf("--every: %w", err)
+		}
+	}
+	if f.Horizon != "" {
+		if _, err := duration.Parse(now, f.Horizon); err != nil {
+			return TranchesFlags{}, fmt.Errorf("--horizon: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
+// =============================================================================
+
+// Tranche describes a tranche of the input, encrypted towards its own round.
+type Tranche struct {
+	File   string    `json:"file"`
+	Round  uint64    `json:"round"`
+	Unlock time.Time `json:"unlock"`
+	Offset int64     `json:"offset"`
+	Size   int64     `json:"size"`
+}
+
+// TranchesIndex lists the tranches of an input, in the order of their rounds,
+// which is also the order of their content in the input.
+type TranchesIndex struct {
+	ChainHash string    `json:"chain_hash"`
+	Size      int64     `json:"size"`
+	Tranches  []Tranche `json:"tranches"`
+}
+
+// Tranches splits the input into parts of equal size, the first one encrypted
+// towards the round following the first duration and each next one towards the
+// round following the interval after the previous one, and writes them along
+// with their index into the output directory, which must be empty or absent.
+func Tranches(flags TranchesFlags, network tlock.Network, now time.Time) (TranchesIndex, error) {
+	entries, err := os.ReadDir(flags.OutputDir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return TranchesIndex{}, err
+	case len(entries) != 0:
+		return TranchesIndex{}, fmt.Errorf("%w: %q", ErrTranchesNotEmpty, flags.OutputDir)
+	}
+
+	src, err := os.Open(flags.Input)
+	if err != nil {
+		return TranchesIndex{}, fmt.Errorf("failed to open input file %q: %v", flags.Input, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return TranchesIndex{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return TranchesIndex{}, fmt.Errorf("tranches expects a regular INPUT file: %q", flags.Input)
+	}
+
+	index, err := planTranches(flags, network, now, info.Size())
+	if err != nil {
+		return TranchesIndex{}, err
+	}
+
+	if err := os.MkdirAll(flags.OutputDir, 0o755); err != nil {
+		return TranchesIndex{}, err
+	}
+
+	for _, tranche := range index.Tranches {
+		section := io.NewSectionReader(src, tranche.Offset, tranche.Size)
+		// the rounds were already checked against the horizon.
+		encrypt := Flags{Round: tranche.Round, Force: true, Armor: flags.Armor}
+		err := WriteOutput(filepath.Join(flags.OutputDir, tranche.File), true, func(dst io.Writer) error {
+			return Encrypt(encrypt, dst, section, network)
+		})
+		if err != nil {
+			return TranchesIndex{}, fmt.Errorf("tranche %s: %w", tranche.File, err)
+		}
+	}
+
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return TranchesIndex{}, err
+	}
+	b = append(b, '\n')
+
+	err = WriteOutput(filepath.Join(flags.OutputDir, TranchesIndexName), true, func(dst io.Writer) error {
+		_, err := dst.Write(b)
+		return err
+	})
+	if err != nil {
+		return TranchesIndex{}, err
+	}
+
+	return index, nil
+}
+
+// planTranches returns the index of the tranches of an input of the size,
+// checking their rounds are successive and not beyond the horizon unless
+// forced.
+func planTranches(flags TranchesFlags, network tlock.Network, now time.Time, size int64) (TranchesIndex, error) {
+	index := TranchesIndex{
+		ChainHash: network.ChainHash(),
+		Size:      size,
+	}
+
+	first, err := duration.Parse(now, flags.First)
+	if err != nil {
+		return TranchesIndex{}, fmt.Errorf("first: %w", err)
+	}
+	if first <= 0 {
+		return TranchesIndex{}, ErrInvalidDurationValue
+	}
+
+	// the names are padded so that they sort in the order of the tranches.
+	width := len(strconv.Itoa(flags.Parts))
+	unlock := now.Add(first)
+	var offset int64
+	for i := range flags.Parts {
+		if i > 0 {
+			every, err := duration.Parse(unlock, flags.Every)
+			if err != nil {
+				return TranchesIndex{}, fmt.Errorf("every: %w", err)
+			}
+			unlock = unlock.Add(every)
+		}
+
+		check := Flags{Round: network.Current(unlock), Force: flags.Force, Horizon: flags.Horizon}
+		roundNumber, err := encryptRound(check, network, now)
+		if err != nil {
+			return TranchesIndex{}, err
+		}
+		if i > 0 && roundNumber <= index.Tranches[i-1].Round {
+			return TranchesIndex{}, fmt.Errorf("%w: round %d", ErrTranchesTooClose, roundNumber)
+		}
+
+		// the remainder of the size is spread over the first tranches.
+		partSize := size / int64(flags.Parts)
+		if int64(i) < size%int64(flags.Parts) {
+			partSize++
+		}
+
+		index.Tranches = append(index.Tranches, Tranche{
+			File:   fmt.Sprintf("part-%0*d.tle", width, i+1),
+			Round:  roundNumber,
+			Unlock: network.TimeOf(roundNumber).UTC(),
+			Offset: offset,
+			Size:   partSize,
+		})
+		offset += partSize
+	}
+
+	return index, nil
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drand/tlock/interop"
+)
+
+// VectorsManifest is the name of the manifest written by GenerateVectors, in
+// the format read by the interop package.
+const VectorsManifest = "manifest.json"
+
+// GenerateVectors writes the test vectors of the interop suite into the
+// directory, created if needed: the ciphertext of each vector to a .tle file
+// named after the vector, and the manifest describing them, which names their
+// file.
+func GenerateVectors(dir string) error {
+	file, err := interop.Suite()
+	if err != nil {
+		return fmt.Errorf("generating vectors: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+
+	for i, vector := range file.Vectors {
+		ciphertext := []byte(vector.Ciphertext)
+		if !vector.Armored {
+			ciphertext, err = base64.StdEncoding.DecodeString(vector.Ciphertext)
+			if err != nil {
+				return fmt.Errorf("%s: decoding ciphertext: %w", vector.Name, err)
+			}
+		}
+
+		name := strings.ReplaceAll(vector.Name, "/", "-") + ".tle"
+		if err := os.WriteFile(filepath.Join(dir, name), ciphertext, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+		file.Vectors[i].File = name
+	}
+
+	manifest, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, VectorsManifest), append(manifest, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", VectorsManifest, err)
+	}
+
+	return nil
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/drand/tlock"
 	"github.com/drand/tlock/cmd/tle/commands"
@@ -22,7 +26,15 @@ func main() {
 	}
 
 	if err := run(); err != nil {
+		var suggester interface{ Suggestions() []string }
 		switch {
+		case errors.As(err, &suggester) && len(suggester.Suggestions()) > 0:
+			log.Print(err)
+			log.Print("use one of the compatible chains of the relay instead:")
+			for _, suggestion := range suggester.Suggestions() {
+				log.Printf("\t%s", suggestion)
+			}
+			os.Exit(1)
 		case errors.Is(err, tlock.ErrTooEarly):
 			log.Fatal(errors.Unwrap(err))
 		case errors.Is(err, http.ErrNotUnchained):
@@ -36,10 +48,40 @@ func main() {
 func run() error {
 	var err error
 
+	switch os.Args[1] {
+	case "cross-check":
+		return crossCheck(os.Args[2:])
+	case "instructions":
+		return instructions(os.Args[2:])
+	case "sweep":
+		return sweep(os.Args[2:])
+	case "deadman":
+		return deadman(os.Args[2:])
+	case "tranches":
+		return tranches(os.Args[2:])
+	}
+
 	flags, err := commands.Parse()
 	if err != nil {
 		return fmt.Errorf("parse commands: %v", err)
 	}
+	http.SetMaxRPS(flags.MaxRPS)
+
+	if flags.CheckProof != "" {
+		return checkProof(flags.CheckProof, flag.Arg(0))
+	}
+
+	if flags.Healthcheck {
+		return commands.Healthcheck(flags, os.Stdout, log.New(os.Stderr, "", 0))
+	}
+
+	if flags.GenerateVectors {
+		return commands.GenerateVectors(flags.OutputDir)
+	}
+
+	if flags.OutputDir != "" || (flags.Decrypt && flag.NArg() > 1) {
+		return decryptFiles(flags, flag.Args())
+	}
 
 	var src io.Reader = os.Stdin
 	if name := flag.Arg(0); name != "" && name != "-" {
@@ -53,31 +95,367 @@ func run() error {
 		src = f
 	}
 
-	var dst io.Writer = os.Stdout
-	if name := flags.Output; name != "" && name != "-" {
-		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if flags.Archive != "" {
+		archive := commands.ArchiveReader(flags.Archive, flags.Zstd)
+		defer archive.Close()
+		src = archive
+	}
+
+	if flags.Extract != "" {
+		return commands.ExtractTo(flags.Extract, func(dst io.Writer) error {
+			return execute(flags, dst, src)
+		})
+	}
+
+	if flags.InPlace {
+		return commands.ReplaceInPlace(flag.Arg(0), flags.Shred, func(dst io.Writer) error {
+			return execute(flags, dst, src)
+		})
+	}
+
+	name := flags.Output
+	if name == "" || name == "-" {
+		return execute(flags, os.Stdout, src)
+	}
+
+	if !flags.AllowOverlap {
+		if err := commands.CheckSameFile(flag.Arg(0), name); err != nil {
+			return err
+		}
+	}
+
+	return commands.WriteOutput(name, flags.NoClobber, func(dst io.Writer) error {
+		return execute(flags, dst, src)
+	})
+}
+
+// execute runs the operation selected by the flags.
+func execute(flags commands.Flags, dst io.Writer, src io.Reader) error {
+	if flags.Repair {
+		return commands.Repair(dst, src, log.New(os.Stderr, "", 0))
+	}
+
+	if flags.Detached != "" {
+		return executeDetached(flags, dst, src)
+	}
+
+	if flags.BestEffort || (flags.Decrypt && (flags.Escrow != "" || hasSignature(flags))) {
+		// best effort and escrow decryptions don't need any information from
+		// the network, and decryptions with a signature only its chain
+		// information, found without the relay if possible.
+		return commands.Decrypt(flags, dst, src, nil)
+	}
+
+	if flags.Encrypt {
+		network, err := commands.EncryptNetwork(flags)
 		if err != nil {
-			return fmt.Errorf("failed to open output file %q: %v", name, err)
+			return err
 		}
-		defer func(f *os.File) {
-			err = f.Close()
-		}(f)
-		dst = f
+		if network, err = commands.CompensateSkew(flags, network, log.New(os.Stderr, "", 0)); err != nil {
+			return err
+		}
+		now := time.Now()
+		if flags, err = commands.ResolveRounds(flags, network, now); err != nil {
+			return err
+		}
+		if err := checkPolicy(flags, network, now); err != nil {
+			return err
+		}
+		if flags.Manifest != "" || flags.Timestamp != "" {
+			return encryptWithManifest(flags, dst, src, network)
+		}
+		return commands.Encrypt(flags, dst, src, network)
 	}
 
-	network, err := http.NewNetwork(flags.Network, flags.Chain)
+	network, err := commands.ChainNetwork(flags)
 	if err != nil {
 		return err
 	}
 
 	switch {
+	case flags.ReEncrypt:
+		var skewed tlock.Network
+		if skewed, err = commands.CompensateSkew(flags, network, log.New(os.Stderr, "", 0)); err != nil {
+			return err
+		}
+		now := time.Now()
+		if flags, err = commands.ResolveRounds(flags, skewed, now); err != nil {
+			return err
+		}
+		if err := checkPolicy(flags, skewed, now); err != nil {
+			return err
+		}
+		err = commands.ReEncrypt(flags, dst, src, skewed)
+	case flags.Metadata && flags.Round != 0:
+		err = tlock.New(network).RoundMetadata(dst, flags.Round)
 	case flags.Metadata:
 		err = tlock.New(network).Metadata(dst)
-	case flags.Decrypt:
-		err = tlock.New(network).Decrypt(dst, src)
+	case flags.Status:
+		names := flag.Args()
+		if flags.InputDir != "" {
+			names, err = commands.StatusFiles(flags.InputDir, flags.Selection())
+			if err != nil {
+				return err
+			}
+		} else if len(names) == 0 {
+			names = []string{"-"}
+		}
+		err = commands.Status(flags, dst, os.Stdin, names, network)
+	case flags.FetchSignature:
+		err = commands.FetchSignature(flags, dst, network)
+	case flags.DeriveIdentity:
+		err = commands.DeriveIdentity(flags, dst, network)
+	case flags.Prove != "":
+		err = decryptWithProof(flags, dst, src, network)
 	default:
-		err = commands.Encrypt(flags, dst, src, network)
+		err = commands.Decrypt(flags, dst, src, network)
 	}
 
 	return err
 }
+
+// executeDetached runs the operation with the header of the ciphertext apart
+// from its payload: the encryption writes the header to the detached file, and
+// the decryption reads it from there.
+func executeDetached(flags commands.Flags, dst io.Writer, src io.Reader) error {
+	name := flags.Detached
+	flags.Detached = ""
+
+	if flags.Encrypt {
+		return commands.WriteOutput(name, flags.NoClobber, func(header io.Writer) error {
+			return execute(flags, tlock.NewDetachedWriter(header, dst), src)
+		})
+	}
+
+	header, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open detached header %q: %v", name, err)
+	}
+	defer header.Close()
+
+	return execute(flags, dst, io.MultiReader(header, src))
+}
+
+// encryptWithManifest encrypts the input and writes the manifest, and the
+// timestamp of the ciphertext, as requested.
+func encryptWithManifest(flags commands.Flags, dst io.Writer, src io.Reader, network tlock.Network) error {
+	manifest, err := commands.EncryptWithManifest(flags, dst, src, network)
+	if err != nil {
+		return err
+	}
+
+	if flags.Manifest != "" {
+		if err := commands.WriteManifest(flags.Manifest, manifest, flags.ManifestKey); err != nil {
+			return err
+		}
+	}
+
+	if flags.Timestamp != "" {
+		if err := commands.WriteTimestamp(context.Background(), flags.Timestamp, flags.TSA, manifest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decryptWithProof decrypts the input and writes the proof of the beacon it was
+// decrypted with.
+func decryptWithProof(flags commands.Flags, dst io.Writer, src io.Reader, network *http.Network) error {
+	proof, err := commands.DecryptWithProof(flags, dst, src, network)
+	if err != nil {
+		return err
+	}
+
+	return commands.WriteProof(flags.Prove, proof)
+}
+
+// checkProof verifies the named proof, against the named ciphertext if any.
+func checkProof(name string, input string) error {
+	proof, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open proof file %q: %v", name, err)
+	}
+	defer proof.Close()
+
+	var ciphertext io.Reader
+	switch input {
+	case "":
+	case "-":
+		ciphertext = os.Stdin
+	default:
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("failed to open input file %q: %v", input, err)
+		}
+		defer f.Close()
+		ciphertext = f
+	}
+
+	return commands.CheckProof(os.Stdout, proof, ciphertext)
+}
+
+// hasSignature reports whether the signature to decrypt with is given.
+func hasSignature(flags commands.Flags) bool {
+	return flags.Signature != "" || flags.SignatureFile != ""
+}
+
+// decryptFiles decrypts several inputs in sequence, either into the output
+// directory, possibly from a list of files, or concatenated to the output.
+func decryptFiles(flags commands.Flags, names []string) error {
+	var network *http.Network
+	if !flags.BestEffort && flags.Escrow == "" && !hasSignature(flags) {
+		var err error
+		network, err = commands.ChainNetwork(flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	if flags.FilesFrom != "" {
+		var list io.Reader = os.Stdin
+		if flags.FilesFrom != "-" {
+			f, err := os.Open(flags.FilesFrom)
+			if err != nil {
+				return fmt.Errorf("failed to open files list %q: %v", flags.FilesFrom, err)
+			}
+			defer f.Close()
+			list = f
+		}
+		return commands.DecryptFilesFrom(flags, commands.LocalStorage{}, flags.OutputDir, os.Stdout, list, network)
+	}
+
+	if flags.OutputDir != "" {
+		return commands.DecryptToDir(flags, commands.LocalStorage{}, flags.OutputDir, names, network)
+	}
+
+	name := flags.Output
+	if name == "" || name == "-" {
+		return commands.DecryptFiles(flags, commands.LocalStorage{}, os.Stdout, names, network)
+	}
+
+	if !flags.AllowOverlap {
+		for _, input := range names {
+			if err := commands.CheckSameFile(input, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return commands.WriteOutput(name, flags.NoClobber, func(dst io.Writer) error {
+		return commands.DecryptFiles(flags, commands.LocalStorage{}, dst, names, network)
+	})
+}
+
+// checkPolicy enforces the policy, if any, on the encryption of the input at
+// the given time.
+func checkPolicy(flags commands.Flags, network tlock.Network, now time.Time) error {
+	if flags.Policy == "" {
+		return nil
+	}
+
+	input := flag.Arg(0)
+	if flags.Archive != "" {
+		input = flags.Archive
+	}
+
+	return commands.CheckPolicy(flags, input, network, now)
+}
+
+// crossCheck runs the cross-check command with the given arguments.
+func crossCheck(args []string) error {
+	flags, err := commands.ParseCrossCheck(args)
+	if err != nil {
+		return fmt.Errorf("parse commands: %v", err)
+	}
+
+	var src io.Reader = os.Stdin
+	if name := flags.Input; name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open input file %q: %v", name, err)
+		}
+		defer f.Close()
+		src = f
+	}
+
+	return commands.CrossCheck(os.Stdout, src, flags.Networks)
+}
+
+// instructions runs the instructions command with the given arguments.
+func instructions(args []string) error {
+	flags, err := commands.ParseInstructions(args)
+	if err != nil {
+		return fmt.Errorf("parse commands: %v", err)
+	}
+
+	src, err := os.Open(flags.Input)
+	if err != nil {
+		return fmt.Errorf("failed to open input file %q: %v", flags.Input, err)
+	}
+	defer src.Close()
+
+	name := flags.Output
+	if name == "" || name == "-" {
+		return commands.Instructions(flags, os.Stdout, src)
+	}
+
+	if err := commands.CheckSameFile(flags.Input, name); err != nil {
+		return err
+	}
+
+	return commands.WriteOutput(name, false, func(dst io.Writer) error {
+		return commands.Instructions(flags, dst, src)
+	})
+}
+
+// sweep runs the sweep command with the given arguments until interrupted.
+func sweep(args []string) error {
+	flags, err := commands.ParseSweep(args)
+	if err != nil {
+		return fmt.Errorf("parse commands: %v", err)
+	}
+	http.SetMaxRPS(flags.MaxRPS)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return commands.Sweep(ctx, flags, log.New(os.Stderr, "", log.LstdFlags))
+}
+
+// deadman runs the deadman command with the given arguments until interrupted
+// or a check-in is missed.
+func deadman(args []string) error {
+	flags, err := commands.ParseDeadman(args)
+	if err != nil {
+		return fmt.Errorf("parse commands: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return commands.Deadman(ctx, flags, log.New(os.Stderr, "", log.LstdFlags))
+}
+
+// tranches runs the tranches command with the given arguments.
+func tranches(args []string) error {
+	flags, err := commands.ParseTranches(args)
+	if err != nil {
+		return fmt.Errorf("parse commands: %v", err)
+	}
+
+	network, err := commands.EncryptNetwork(commands.Flags{Network: flags.Network, Chain: flags.Chain})
+	if err != nil {
+		return err
+	}
+
+	index, err := commands.Tranches(flags, network, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, tranche := range index.Tranches {
+		fmt.Printf("%s: round %d, unlocking at %s\n", tranche.File, tranche.Round, tranche.Unlock.Format(time.RFC1123))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Command tlock-vectors generates the interop test vectors of tlock, for
+// chains of every supported scheme whose secret key is derived from a fixed
+// seed, and writes them on stdout in the format read by the interop package.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/drand/tlock/interop"
+)
+
+const usage = `tlock-vectors -- github.com/drand/tlock
+
+Usage:
+	tlock-vectors > interop/testdata/vectors.json
+
+The vectors of other implementations, such as tlock-js and tlock-rs, can then
+be appended to the file for the interop tests to check them.`
+
+func main() {
+	log := log.New(os.Stderr, "", 0)
+
+	if len(os.Args) > 1 {
+		log.Fatal(usage)
+	}
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	file, err := interop.Suite()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(file)
+}
@@ -0,0 +1,147 @@
+// Command tlock-wrapkey timelock encrypts a key read on stdin and writes on
+// stdout the blob tlock.WrapKey returns, or the reverse, so that tools not
+// using the age format can reuse tlock to wrap their keys.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/cmd/tle/commands"
+	"github.com/drand/tlock/networks/http"
+)
+
+const usage = `tlock-wrapkey -- github.com/drand/tlock
+
+Usage:
+	tlock-wrapkey [-n NETWORK] [-c CHAIN] -r round < KEY > BLOB
+	tlock-wrapkey --unwrap [-n NETWORK] < BLOB > KEY
+
+Options:
+	-u, --unwrap   Unwrap the blob read on stdin instead of wrapping a key.
+	-n, --network  The drand API endpoint to use.
+	-c, --chain    The chain to use to wrap the key.
+	-r, --round    The round to wrap the key towards.
+
+KEY is the raw key, of 1 to 32 bytes, e.g. an AES-256 key, and BLOB the
+compact binary blob returned by tlock.WrapKey, which tlock.UnwrapKey decrypts.`
+
+// maxKeySize is the size of the largest key tlock.WrapKey encrypts.
+const maxKeySize = 32
+
+// maxBlobSize is larger than the largest blob tlock.WrapKey returns.
+const maxBlobSize = 1 << 10
+
+func main() {
+	log := log.New(os.Stderr, "", 0)
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	var (
+		unwrap  bool
+		network = commands.DefaultNetwork
+		chain   = commands.DefaultChain
+		round   uint64
+	)
+
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+	flag.BoolVar(&unwrap, "u", unwrap, "unwrap the stanza instead of wrapping a key")
+	flag.BoolVar(&unwrap, "unwrap", unwrap, "unwrap the stanza instead of wrapping a key")
+	flag.StringVar(&network, "n", network, "the drand API endpoint")
+	flag.StringVar(&network, "network", network, "the drand API endpoint")
+	flag.StringVar(&chain, "c", chain, "chain to use")
+	flag.StringVar(&chain, "chain", chain, "chain to use")
+	flag.Uint64Var(&round, "r", round, "the round to wrap the key towards")
+	flag.Uint64Var(&round, "round", round, "the round to wrap the key towards")
+	flag.Parse()
+
+	if unwrap {
+		if round != 0 {
+			return errors.New("-r/--round can't be used with -u/--unwrap")
+		}
+		return unwrapKey(os.Stdout, os.Stdin, network)
+	}
+
+	if round == 0 {
+		return errors.New("-r/--round must be specified")
+	}
+	return wrapKey(os.Stdout, os.Stdin, network, chain, round)
+}
+
+// wrapKey timelock encrypts the key read from src towards the round and
+// writes the resulting blob to dst.
+func wrapKey(dst io.Writer, src io.Reader, host string, chainHash string, round uint64) error {
+	key, err := readAll(src, maxKeySize)
+	if err != nil {
+		return fmt.Errorf("read key: %w", err)
+	}
+	defer clear(key)
+
+	network, err := http.NewNetwork(host, chainHash)
+	if err != nil {
+		return err
+	}
+
+	blob, err := tlock.WrapKey(network, round, key)
+	if err != nil {
+		return fmt.Errorf("wrap: %w", err)
+	}
+
+	if _, err := dst.Write(blob); err != nil {
+		return fmt.Errorf("write blob: %w", err)
+	}
+
+	return nil
+}
+
+// unwrapKey decrypts the blob read from src and writes the key to dst.
+func unwrapKey(dst io.Writer, src io.Reader, host string) error {
+	blob, err := readAll(src, maxBlobSize)
+	if err != nil {
+		return fmt.Errorf("read blob: %w", err)
+	}
+	_, chainHash, err := tlock.WrappedKeyTarget(blob)
+	if err != nil {
+		return fmt.Errorf("read blob: %w", err)
+	}
+
+	network, err := http.NewNetwork(host, chainHash)
+	if err != nil {
+		return err
+	}
+
+	key, err := tlock.UnwrapKey(network, blob)
+	if err != nil {
+		return fmt.Errorf("unwrap: %w", err)
+	}
+	defer clear(key)
+
+	if _, err := dst.Write(key); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+
+	return nil
+}
+
+// readAll reads src, failing if it holds more than limit bytes.
+func readAll(src io.Reader, limit int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(src, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		clear(b)
+		return nil, fmt.Errorf("more than %d bytes", limit)
+	}
+
+	return b, nil
+}
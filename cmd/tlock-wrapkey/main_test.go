@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapKeyRoundTrip(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	round := beacon.Current(time.Now())
+
+	var blob bytes.Buffer
+	require.NoError(t, wrapKey(&blob, bytes.NewReader(key), relay.URL, beacon.ChainHash(), round))
+
+	// the command writes the blob of tlock.WrapKey.
+	gotRound, gotChainHash, err := tlock.WrappedKeyTarget(blob.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, round, gotRound)
+	require.Equal(t, beacon.ChainHash(), gotChainHash)
+
+	var out bytes.Buffer
+	require.NoError(t, unwrapKey(&out, &blob, relay.URL))
+	require.Equal(t, key, out.Bytes())
+}
+
+func TestWrapKeyLength(t *testing.T) {
+	err := wrapKey(&bytes.Buffer{}, strings.NewReader(strings.Repeat("x", 33)), "http://127.0.0.1:1", "", 1)
+	require.ErrorContains(t, err, "32 bytes")
+}
+
+func TestUnwrapKeyInvalid(t *testing.T) {
+	err := unwrapKey(&bytes.Buffer{}, strings.NewReader("not a blob"), "http://127.0.0.1:1")
+	require.ErrorIs(t, err, tlock.ErrInvalidWrappedKey)
+}
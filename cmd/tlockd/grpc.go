@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxChunkSize is the maximum size of the data of the chunks sent, well below
+// the default maximum size of the messages gRPC receives.
+const maxChunkSize = 64 * 1024
+
+// serviceDesc describes the Tlock service of tlockd.proto.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "tlock.v1.Tlock",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Encrypt", Handler: encryptHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "Decrypt", Handler: decryptHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "Inspect", Handler: inspectHandler(false), ClientStreams: true},
+		{StreamName: "Status", Handler: inspectHandler(true), ClientStreams: true},
+	},
+	Metadata: "tlockd.proto",
+}
+
+// grpcOptions returns the options of the gRPC server, encoding the messages
+// of tlockd.proto and authorizing every call.
+func (s *server) grpcOptions() []grpc.ServerOption {
+	authorize := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var apiKey string
+		if md, ok := metadata.FromIncomingContext(ss.Context()); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				apiKey, _ = strings.CutPrefix(values[0], "Bearer ")
+			}
+		}
+
+		var addr string
+		if p, ok := peer.FromContext(ss.Context()); ok {
+			addr = p.Addr.String()
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				addr = host
+			}
+		}
+
+		if err := s.authorize(apiKey, addr); err != nil {
+			return statusError(err)
+		}
+
+		return handler(srv, ss)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ForceServerCodec(codec{}),
+		grpc.StreamInterceptor(authorize),
+	}
+}
+
+// encryptHandler encrypts the data of the requests towards the round given by
+// the first one.
+func encryptHandler(srv any, stream grpc.ServerStream) error {
+	var first encryptRequest
+	if err := stream.RecvMsg(&first); err != nil {
+		if errors.Is(err, io.EOF) {
+			return status.Error(codes.InvalidArgument, "no request received")
+		}
+		return err
+	}
+
+	src := &streamReader{
+		buf: first.data,
+		recv: func() ([]byte, error) {
+			var req encryptRequest
+			err := stream.RecvMsg(&req)
+			return req.data, err
+		},
+	}
+	opts := encryptOptions{
+		Round:    first.round,
+		Duration: first.duration,
+		Armor:    first.armor,
+	}
+
+	s := srv.(*server)
+	return statusError(s.encrypt(&streamWriter{stream: stream}, s.limit(src), opts))
+}
+
+// decryptHandler decrypts the streamed ciphertext.
+func decryptHandler(srv any, stream grpc.ServerStream) error {
+	s := srv.(*server)
+	return statusError(s.decrypt(&streamWriter{stream: stream}, s.limit(chunkReader(stream))))
+}
+
+// inspectHandler describes the tlock stanzas of the streamed ciphertext, and
+// when they can be decrypted if withStatus is set.
+func inspectHandler(withStatus bool) grpc.StreamHandler {
+	return func(srv any, stream grpc.ServerStream) error {
+		s := srv.(*server)
+		header, err := s.inspect(s.limit(chunkReader(stream)), withStatus)
+		if err != nil {
+			return statusError(err)
+		}
+
+		msg := headerMessage{armored: header.Armored}
+		for _, st := range header.Stanzas {
+			stanza := stanzaMessage{
+				typ:         st.Type,
+				round:       st.Round,
+				chainHash:   st.ChainHash,
+				decryptable: st.Decryptable,
+			}
+			if !st.UnlockTime.IsZero() {
+				stanza.unlockTime = st.UnlockTime.Unix()
+			}
+			msg.stanzas = append(msg.stanzas, stanza)
+		}
+
+		return stream.SendMsg(&msg)
+	}
+}
+
+// statusError returns the gRPC status of the error of an operation.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.InvalidArgument
+	switch classify(err) {
+	case classTooEarly:
+		code = codes.FailedPrecondition
+	case classUnavailable:
+		code = codes.Unavailable
+	case classUntrusted:
+		code = codes.Internal
+	case classUnauthenticated:
+		code = codes.Unauthenticated
+	case classRateLimited, classTooLarge:
+		code = codes.ResourceExhausted
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// =============================================================================
+
+// streamReader reads the data received on a stream.
+type streamReader struct {
+	buf  []byte
+	recv func() ([]byte, error)
+}
+
+// chunkReader returns a reader of the data of the chunks received on the
+// stream.
+func chunkReader(stream grpc.ServerStream) *streamReader {
+	return &streamReader{
+		recv: func() ([]byte, error) {
+			var c chunk
+			err := stream.RecvMsg(&c)
+			return c.data, err
+		},
+	}
+}
+
+// Read implements the io.Reader interface.
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// streamWriter sends the data written to it on a stream, in chunks.
+type streamWriter struct {
+	stream grpc.ServerStream
+}
+
+// Write implements the io.Writer interface.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := min(len(p), maxChunkSize)
+		// gRPC may use the message after SendMsg returns.
+		if err := w.stream.SendMsg(&chunk{data: bytes.Clone(p[:n])}); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// =============================================================================
+
+// message is implemented by the messages of tlockd.proto, which are encoded
+// by hand since they are few and small.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// codec encodes the messages of tlockd.proto in the protobuf wire format.
+type codec struct{}
+
+// Marshal implements the encoding.Codec interface.
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+// Unmarshal implements the encoding.Codec interface.
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// Name implements the encoding.Codec interface. The messages being protobuf
+// messages, clients generated from tlockd.proto use the default content type.
+func (codec) Name() string {
+	return "proto"
+}
+
+// consumeFields decodes the fields of a message, calling field with the value
+// of each one. It returns the size of the value it consumed, or 0 if the field
+// is unknown and must be skipped.
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// consumeBytes decodes a bytes field, copying its value.
+func consumeBytes(b []byte, v *[]byte) int {
+	value, n := protowire.ConsumeBytes(b)
+	*v = bytes.Clone(value)
+	return n
+}
+
+// consumeString decodes a string field.
+func consumeString(b []byte, v *string) int {
+	value, n := protowire.ConsumeString(b)
+	*v = value
+	return n
+}
+
+// consumeVarint decodes a varint field.
+func consumeVarint(b []byte, v *uint64) int {
+	value, n := protowire.ConsumeVarint(b)
+	*v = value
+	return n
+}
+
+// consumeBool decodes a bool field.
+func consumeBool(b []byte, v *bool) int {
+	value, n := protowire.ConsumeVarint(b)
+	*v = protowire.DecodeBool(value)
+	return n
+}
+
+// encryptRequest is the EncryptRequest message.
+type encryptRequest struct {
+	round    uint64
+	duration string
+	armor    bool
+	data     []byte
+}
+
+func (m *encryptRequest) marshal() []byte {
+	var b []byte
+	if m.round != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.round)
+	}
+	if m.duration != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, m.duration)
+	}
+	if m.armor {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(m.armor))
+	}
+	if len(m.data) > 0 {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.data)
+	}
+	return b
+}
+
+func (m *encryptRequest) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeVarint(b, &m.round)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, &m.duration)
+		case num == 3 && typ == protowire.VarintType:
+			return consumeBool(b, &m.armor)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeBytes(b, &m.data)
+		}
+		return 0
+	})
+}
+
+// chunk is the Chunk message.
+type chunk struct {
+	data []byte
+}
+
+func (m *chunk) marshal() []byte {
+	if len(m.data) == 0 {
+		return nil
+	}
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, m.data)
+}
+
+func (m *chunk) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == 1 && typ == protowire.BytesType {
+			return consumeBytes(b, &m.data)
+		}
+		return 0
+	})
+}
+
+// stanzaMessage is the Stanza message.
+type stanzaMessage struct {
+	typ         string
+	round       uint64
+	chainHash   string
+	unlockTime  int64
+	decryptable bool
+}
+
+func (m *stanzaMessage) marshal() []byte {
+	var b []byte
+	if m.typ != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, m.typ)
+	}
+	if m.round != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.round)
+	}
+	if m.chainHash != "" {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, m.chainHash)
+	}
+	if m.unlockTime != 0 {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.unlockTime))
+	}
+	if m.decryptable {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(m.decryptable))
+	}
+	return b
+}
+
+func (m *stanzaMessage) unmarshal(b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(b, &m.typ)
+		case num == 2 && typ == protowire.VarintType:
+			return consumeVarint(b, &m.round)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, &m.chainHash)
+		case num == 4 && typ == protowire.VarintType:
+			var v uint64
+			n := consumeVarint(b, &v)
+			m.unlockTime = int64(v)
+			return n
+		case num == 5 && typ == protowire.VarintType:
+			return consumeBool(b, &m.decryptable)
+		}
+		return 0
+	})
+}
+
+// headerMessage is the Header message.
+type headerMessage struct {
+	armored bool
+	stanzas []stanzaMessage
+}
+
+func (m *headerMessage) marshal() []byte {
+	var b []byte
+	if m.armored {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(m.armored))
+	}
+	for _, stanza := range m.stanzas {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, stanza.marshal())
+	}
+	return b
+}
+
+func (m *headerMessage) unmarshal(b []byte) error {
+	var err error
+	parseErr := consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeBool(b, &m.armored)
+		case num == 2 && typ == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			var stanza stanzaMessage
+			if err = stanza.unmarshal(value); err != nil {
+				return -1
+			}
+			m.stanzas = append(m.stanzas, stanza)
+			return n
+		}
+		return 0
+	})
+	if err != nil {
+		return err
+	}
+	return parseErr
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handler returns the handler of the HTTP API.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/encrypt", s.handleEncrypt)
+	mux.HandleFunc("POST /v1/decrypt", s.handleDecrypt)
+	mux.HandleFunc("POST /v1/inspect", s.handleInspect(false))
+	mux.HandleFunc("POST /v1/status", s.handleInspect(true))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+		apiKey, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if err := s.authorize(apiKey, addr); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleEncrypt encrypts the body towards the round given by the query.
+func (s *server) handleEncrypt(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var opts encryptOptions
+	if round := query.Get("round"); round != "" {
+		n, err := strconv.ParseUint(round, 10, 64)
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: round: %v", errInvalidRequest, err))
+			return
+		}
+		opts.Round = n
+	}
+	opts.Duration = query.Get("duration")
+	if armor := query.Get("armor"); armor != "" {
+		b, err := strconv.ParseBool(armor)
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: armor: %v", errInvalidRequest, err))
+			return
+		}
+		opts.Armor = b
+	}
+
+	contentType := "application/octet-stream"
+	if opts.Armor {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	dst := &lazyWriter{w: w, contentType: contentType}
+	streamError(dst, s.encrypt(dst, s.body(w, r), opts))
+}
+
+// handleDecrypt decrypts the body.
+func (s *server) handleDecrypt(w http.ResponseWriter, r *http.Request) {
+	dst := &lazyWriter{w: w, contentType: "application/octet-stream"}
+	streamError(dst, s.decrypt(dst, s.body(w, r)))
+}
+
+// handleInspect describes the tlock stanzas of the body, and when they can be
+// decrypted if status is set.
+func (s *server) handleInspect(status bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header, err := s.inspect(s.body(w, r), status)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(header)
+	}
+}
+
+// body returns the body of the request, bounded by the maximum size of the
+// server.
+func (s *server) body(w http.ResponseWriter, r *http.Request) io.Reader {
+	if s.maxSize == 0 {
+		return r.Body
+	}
+
+	return http.MaxBytesReader(w, r.Body, s.maxSize)
+}
+
+// =============================================================================
+
+// lazyWriter only writes the header of the response along with the first
+// bytes of its body, so that an operation failing before writing anything is
+// reported with the status code of its error.
+type lazyWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	written     bool
+}
+
+// Write implements the io.Writer interface.
+func (l *lazyWriter) Write(p []byte) (int, error) {
+	if !l.written {
+		l.w.Header().Set("Content-Type", l.contentType)
+		l.w.WriteHeader(http.StatusOK)
+		l.written = true
+	}
+
+	return l.w.Write(p)
+}
+
+// streamError reports the error of an operation streaming its result. Once the
+// response started, the connection is aborted instead, so that the client
+// doesn't mistake a partial result for a complete one.
+func streamError(dst *lazyWriter, err error) {
+	switch {
+	case err == nil:
+		if !dst.written {
+			dst.Write(nil)
+		}
+	case dst.written:
+		panic(http.ErrAbortHandler)
+	default:
+		writeError(dst.w, err)
+	}
+}
+
+// writeError reports the error with the status code of its class.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch classify(err) {
+	case classTooEarly:
+		code = http.StatusTooEarly
+	case classUnavailable, classUntrusted:
+		code = http.StatusBadGateway
+	case classUnauthenticated:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		code = http.StatusUnauthorized
+	case classRateLimited:
+		w.Header().Set("Retry-After", "1")
+		code = http.StatusTooManyRequests
+	case classTooLarge:
+		code = http.StatusRequestEntityTooLarge
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
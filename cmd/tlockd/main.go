@@ -0,0 +1,223 @@
+// Command tlockd serves timelock encryption, decryption, inspection and status
+// over HTTP with json, and over gRPC, so that services not written in Go can
+// use tlock without embedding the library or running the tle command.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drand/tlock/cmd/tle/commands"
+	dhttp "github.com/drand/tlock/networks/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const usage = `tlockd -- github.com/drand/tlock
+
+Usage:
+	tlockd [--listen ADDR] [--grpc-listen ADDR] [-n NETWORK] [-c CHAIN] [--trust-chains CHAINS] [--max-size SIZE] [--api-keys FILE] [--rate RATE] [--burst BURST] [--tls-cert FILE --tls-key FILE] [--round-state FILE]
+
+Options:
+	--listen       The address to serve HTTP on, defaults to localhost:8080.
+	--grpc-listen  The address to serve gRPC on, not served if empty.
+	-n, --network  The drand API endpoint to use.
+	-c, --chain    The chain to encrypt towards and decrypt the ciphertexts of.
+	--trust-chains Also decrypts the ciphertexts of the comma separated CHAINS of the relay. Ciphertexts of any other chain are refused.
+	--max-size     The maximum size in bytes of the bodies of the requests and of the decrypted plaintexts, unlimited if 0. Defaults to 64MiB.
+	--api-keys     Requires the requests to hold one of the API keys listed in FILE, one per line.
+	--rate         How many requests per second each API key, or client address without --api-keys, can make, unlimited if 0. Defaults to 10.
+	--burst        How many requests above the rate each API key or client address can make at once. Defaults to 20.
+	--tls-cert     Serves over TLS using the PEM certificate in FILE.
+	--tls-key      Serves over TLS using the PEM private key in FILE.
+	--round-state  Records the highest round served by the relay for each chain in FILE, and refuses the answers of the relay going back below it.
+
+The HTTP API streams the bodies of the requests and responses:
+	POST /v1/encrypt?round=ROUND        encrypts the body towards the round.
+	POST /v1/encrypt?duration=DURATION  encrypts the body towards the round after the duration.
+	POST /v1/decrypt                    decrypts the body.
+	POST /v1/inspect                    describes the tlock stanzas of the body, without network access.
+	POST /v1/status                     describes when the body can be decrypted.
+Encryptions are armored with armor=true. The API key is given as a bearer
+token in the Authorization header. A round which wasn't reached yet fails with
+the status 425, a relay which can't be reached with the status 502, and a body
+larger than --max-size with the status 413.
+
+The gRPC service is described in tlockd.proto, the API key being given as a
+bearer token in the authorization metadata.`
+
+func main() {
+	log := log.New(os.Stderr, "", 0)
+
+	if err := run(log); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(log *log.Logger) error {
+	var (
+		listen     = "localhost:8080"
+		grpcListen string
+		host       = commands.DefaultNetwork
+		chain      = commands.DefaultChain
+		trusted    string
+		maxSize    int64 = 64 << 20
+		apiKeys    string
+		rate       = 10.0
+		burst      = 20
+		tlsCert    string
+		tlsKey     string
+		roundState string
+	)
+
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+	flag.StringVar(&listen, "listen", listen, "the address to serve HTTP on")
+	flag.StringVar(&grpcListen, "grpc-listen", grpcListen, "the address to serve gRPC on")
+	flag.StringVar(&host, "n", host, "the drand API endpoint")
+	flag.StringVar(&host, "network", host, "the drand API endpoint")
+	flag.StringVar(&chain, "c", chain, "chain to use")
+	flag.StringVar(&chain, "chain", chain, "chain to use")
+	flag.StringVar(&trusted, "trust-chains", trusted, "the other chains to decrypt the ciphertexts of")
+	flag.Int64Var(&maxSize, "max-size", maxSize, "the maximum size of the requests and plaintexts")
+	flag.StringVar(&apiKeys, "api-keys", apiKeys, "the path to the API keys")
+	flag.Float64Var(&rate, "rate", rate, "the requests per second of each client")
+	flag.IntVar(&burst, "burst", burst, "the requests above the rate each client can make at once")
+	flag.StringVar(&tlsCert, "tls-cert", tlsCert, "the path to the TLS certificate")
+	flag.StringVar(&tlsKey, "tls-key", tlsKey, "the path to the TLS private key")
+	flag.StringVar(&roundState, "round-state", roundState, "the path to the highest rounds served by the relay")
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		return errors.New("tlockd doesn't take any argument")
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		return errors.New("--tls-cert and --tls-key must be used together")
+	}
+	if rate < 0 || burst < 1 {
+		return errors.New("--rate can't be negative and --burst must be positive")
+	}
+	if maxSize < 0 {
+		return errors.New("--max-size can't be negative")
+	}
+
+	var store dhttp.RoundStore
+	if roundState != "" {
+		var err error
+		if store, err = dhttp.NewFileRoundStore(roundState); err != nil {
+			return err
+		}
+	}
+
+	network, err := dhttp.NewNetwork(host, chain)
+	if err != nil {
+		return err
+	}
+	network.SetRoundStore(store)
+
+	s := &server{
+		network: network,
+		host:    host,
+		limiter: newLimiter(rate, burst),
+		chains:  make(map[string]*dhttp.Network),
+		maxSize: maxSize,
+	}
+
+	// the trusted chains are set up once, so that requests never make the
+	// server fetch chain information.
+	for _, chainHash := range strings.Split(trusted, ",") {
+		chainHash = strings.ToLower(strings.TrimSpace(chainHash))
+		if chainHash == "" || chainHash == network.ChainHash() {
+			continue
+		}
+		trustedNetwork, err := dhttp.NewNetwork(host, chainHash)
+		if err != nil {
+			return fmt.Errorf("--trust-chains: %w", err)
+		}
+		trustedNetwork.SetRoundStore(store)
+		s.chains[chainHash] = trustedNetwork
+	}
+	if apiKeys != "" {
+		if s.keys, err = readKeys(apiKeys); err != nil {
+			return err
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 2)
+
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           s.handler(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("serving HTTP on %s", listen)
+		if tlsConfig != nil {
+			errs <- httpServer.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	var grpcServer *grpc.Server
+	if grpcListen != "" {
+		lis, err := net.Listen("tcp", grpcListen)
+		if err != nil {
+			return err
+		}
+
+		opts := s.grpcOptions()
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer = grpc.NewServer(opts...)
+		grpcServer.RegisterService(&serviceDesc, s)
+
+		go func() {
+			log.Printf("serving gRPC on %s", grpcListen)
+			errs <- grpcServer.Serve(lis)
+		}()
+	}
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	if shutdownErr := httpServer.Shutdown(shutdown); err == nil {
+		err = shutdownErr
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
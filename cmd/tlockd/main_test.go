@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	dhttp "github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const apiKey = "very secret"
+
+// newServer returns a server of an in-process beacon, requiring apiKey.
+func newServer(t *testing.T) (*server, *testsupport.Beacon) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	t.Cleanup(relay.Close)
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	return &server{
+		network: network,
+		host:    relay.URL,
+		keys:    []string{apiKey},
+		limiter: newLimiter(0, 1),
+		maxSize: 64 << 20,
+	}, beacon
+}
+
+// post makes a request to the HTTP API.
+func post(t *testing.T, url string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, b
+}
+
+func TestHTTP(t *testing.T) {
+	s, beacon := newServer(t)
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	roundNumber := beacon.Current(time.Now())
+	code, ciphertext := post(t, srv.URL+"/v1/encrypt?armor=true&round="+strconv.FormatUint(roundNumber, 10), []byte("very nice"))
+	require.Equal(t, http.StatusOK, code, string(ciphertext))
+	require.True(t, strings.HasPrefix(string(ciphertext), "-----BEGIN AGE ENCRYPTED FILE-----"))
+
+	code, plaintext := post(t, srv.URL+"/v1/decrypt", ciphertext)
+	require.Equal(t, http.StatusOK, code, string(plaintext))
+	require.Equal(t, "very nice", string(plaintext))
+
+	code, b := post(t, srv.URL+"/v1/inspect", ciphertext)
+	require.Equal(t, http.StatusOK, code, string(b))
+	var header headerStatus
+	require.NoError(t, json.Unmarshal(b, &header))
+	require.True(t, header.Armored)
+	require.Len(t, header.Stanzas, 1)
+	require.Equal(t, roundNumber, header.Stanzas[0].Round)
+	require.Equal(t, beacon.ChainHash(), header.Stanzas[0].ChainHash)
+	require.True(t, header.Stanzas[0].UnlockTime.IsZero())
+
+	code, b = post(t, srv.URL+"/v1/status", ciphertext)
+	require.Equal(t, http.StatusOK, code, string(b))
+	require.NoError(t, json.Unmarshal(b, &header))
+	require.True(t, header.Stanzas[0].Decryptable)
+	require.Equal(t, beacon.TimeOf(roundNumber).Unix(), header.Stanzas[0].UnlockTime.Unix())
+
+	// a round which wasn't reached yet.
+	code, ciphertext = post(t, srv.URL+"/v1/encrypt?duration=1m", []byte("very nice"))
+	require.Equal(t, http.StatusOK, code, string(ciphertext))
+	code, _ = post(t, srv.URL+"/v1/decrypt", ciphertext)
+	require.Equal(t, http.StatusTooEarly, code)
+
+	code, _ = post(t, srv.URL+"/v1/encrypt", []byte("very nice"))
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(t, srv.URL+"/v1/encrypt?round=1&armor=maybe", []byte("very nice"))
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(t, srv.URL+"/v1/decrypt", []byte("not a ciphertext"))
+	require.Equal(t, http.StatusBadRequest, code)
+
+	resp, err := http.Post(srv.URL+"/v1/inspect", "", bytes.NewReader(ciphertext))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestHTTPRateLimit(t *testing.T) {
+	s, _ := newServer(t)
+	s.limiter = newLimiter(0.001, 2)
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	for range 2 {
+		code, _ := post(t, srv.URL+"/v1/inspect", nil)
+		require.Equal(t, http.StatusBadRequest, code)
+	}
+	code, _ := post(t, srv.URL+"/v1/inspect", nil)
+	require.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func TestHTTPLimits(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	other, err := testsupport.NewBeacon(crypto.NewPedersenBLSUnchained(), testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	var infoRequests atomic.Int32
+	relay := testsupport.Handler(beacon, other)
+	relayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			infoRequests.Add(1)
+		}
+		relay.ServeHTTP(w, r)
+	}))
+	defer relayServer.Close()
+
+	network, err := dhttp.NewNetwork(relayServer.URL, beacon.ChainHash())
+	require.NoError(t, err)
+	s := &server{
+		network: network,
+		host:    relayServer.URL,
+		keys:    []string{apiKey},
+		limiter: newLimiter(0, 1),
+		chains:  map[string]*dhttp.Network{},
+		maxSize: 4 << 10,
+	}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	var ciphertext bytes.Buffer
+	require.NoError(t, tlock.New(other).Encrypt(&ciphertext, bytes.NewBufferString("very nice"), 1))
+
+	// the ciphertexts of other chains are refused without asking the relay.
+	fetched := infoRequests.Load()
+	code, b := post(t, srv.URL+"/v1/decrypt", ciphertext.Bytes())
+	require.Equal(t, http.StatusBadRequest, code, string(b))
+	code, b = post(t, srv.URL+"/v1/status", ciphertext.Bytes())
+	require.Equal(t, http.StatusBadRequest, code, string(b))
+	require.Equal(t, fetched, infoRequests.Load())
+
+	// unless they are trusted.
+	s.chains[other.ChainHash()], err = dhttp.NewNetwork(relayServer.URL, other.ChainHash())
+	require.NoError(t, err)
+	code, b = post(t, srv.URL+"/v1/decrypt", ciphertext.Bytes())
+	require.Equal(t, http.StatusOK, code, string(b))
+	require.Equal(t, "very nice", string(b))
+
+	rounds := make([]uint64, maxStanzas+1)
+	for i := range rounds {
+		rounds[i] = uint64(i + 1)
+	}
+	ciphertext.Reset()
+	require.NoError(t, tlock.New(beacon).EncryptRounds(&ciphertext, bytes.NewBufferString("very nice"), rounds...))
+	s.maxSize = 0
+	code, b = post(t, srv.URL+"/v1/inspect", ciphertext.Bytes())
+	require.Equal(t, http.StatusBadRequest, code, string(b))
+
+	s.maxSize = 4 << 10
+	code, b = post(t, srv.URL+"/v1/decrypt", bytes.Repeat([]byte("a"), 8<<10))
+	require.Equal(t, http.StatusRequestEntityTooLarge, code, string(b))
+
+	// encryptions stream their result, so that the response is aborted.
+	err = s.encrypt(io.Discard, s.limit(bytes.NewReader(bytes.Repeat([]byte("a"), 8<<10))), encryptOptions{Round: beacon.Current(time.Now()) + 1000})
+	require.ErrorIs(t, err, errTooLarge)
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1, 2)
+	now := time.Now()
+
+	require.True(t, l.allow("a", now))
+	require.True(t, l.allow("a", now))
+	require.False(t, l.allow("a", now))
+	require.True(t, l.allow("b", now))
+
+	require.True(t, l.allow("a", now.Add(time.Second)))
+	require.False(t, l.allow("a", now.Add(time.Second)))
+
+	require.True(t, newLimiter(0, 1).allow("a", now))
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]struct {
+		err   error
+		class int
+	}{
+		"too early":      {err: fmt.Errorf("%w: round 2", tlock.ErrTooEarly), class: classTooEarly},
+		"unavailable":    {err: fmt.Errorf("round 1: %w", dhttp.ErrRelayUnavailable), class: classUnavailable},
+		"invalid beacon": {err: fmt.Errorf("round 1: %w", dhttp.ErrInvalidBeacon), class: classUntrusted},
+		"rollback":       {err: fmt.Errorf("round 1: %w", dhttp.ErrRollback), class: classUntrusted},
+		"invalid":        {err: tlock.ErrInvalidRound, class: classInvalid},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.class, classify(test.err))
+		})
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	s, beacon := newServer(t)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(s.grpcOptions()...)
+	srv.RegisterService(&serviceDesc, s)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+apiKey)
+
+	// call streams the requests and returns the data of the responses.
+	call := func(ctx context.Context, method int, requests ...message) ([]byte, error) {
+		desc := &serviceDesc.Streams[method]
+		stream, err := conn.NewStream(ctx, desc, "/tlock.v1.Tlock/"+desc.StreamName)
+		require.NoError(t, err)
+		for _, req := range requests {
+			require.NoError(t, stream.SendMsg(req))
+		}
+		require.NoError(t, stream.CloseSend())
+
+		var out []byte
+		for {
+			var c chunk
+			if err := stream.RecvMsg(&c); err != nil {
+				if err == io.EOF {
+					return out, nil
+				}
+				return out, err
+			}
+			out = append(out, c.data...)
+		}
+	}
+
+	roundNumber := beacon.Current(time.Now())
+	ciphertext, err := call(authorized, 0,
+		&encryptRequest{round: roundNumber, data: []byte("very ")},
+		&encryptRequest{data: []byte("nice")},
+	)
+	require.NoError(t, err)
+
+	plaintext, err := call(authorized, 1, &chunk{data: ciphertext[:10]}, &chunk{data: ciphertext[10:]})
+	require.NoError(t, err)
+	require.Equal(t, "very nice", string(plaintext))
+
+	stream, err := conn.NewStream(authorized, &serviceDesc.Streams[3], "/tlock.v1.Tlock/Status")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(&chunk{data: ciphertext}))
+	require.NoError(t, stream.CloseSend())
+	var header headerMessage
+	require.NoError(t, stream.RecvMsg(&header))
+	require.Len(t, header.stanzas, 1)
+	require.Equal(t, roundNumber, header.stanzas[0].round)
+	require.Equal(t, beacon.ChainHash(), header.stanzas[0].chainHash)
+	require.Equal(t, beacon.TimeOf(roundNumber).Unix(), header.stanzas[0].unlockTime)
+	require.True(t, header.stanzas[0].decryptable)
+
+	ciphertext, err = call(authorized, 0, &encryptRequest{duration: "1m", data: []byte("very nice")})
+	require.NoError(t, err)
+	_, err = call(authorized, 1, &chunk{data: ciphertext})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = call(ctx, 1, &chunk{data: ciphertext})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestMessages(t *testing.T) {
+	header := headerMessage{
+		armored: true,
+		stanzas: []stanzaMessage{
+			{typ: "tlock", round: 1234, chainHash: "abcd", unlockTime: 1700000000, decryptable: true},
+			{typ: "tlock", round: 5678, chainHash: "ef01"},
+		},
+	}
+
+	var got headerMessage
+	require.NoError(t, got.unmarshal(header.marshal()))
+	require.Equal(t, header, got)
+
+	req := encryptRequest{round: 1234, duration: "1d", armor: true, data: []byte("very nice")}
+	var gotReq encryptRequest
+	require.NoError(t, gotReq.unmarshal(req.marshal()))
+	require.Equal(t, req, gotReq)
+
+	// unknown fields are skipped.
+	var c chunk
+	require.NoError(t, c.unmarshal(req.marshal()))
+	require.Nil(t, c.data)
+}
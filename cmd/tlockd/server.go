@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age/armor"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/cmd/tle/commands"
+	dhttp "github.com/drand/tlock/networks/http"
+)
+
+// These errors classify the failures of the requests, so that each API
+// reports them with its own status codes.
+var (
+	// errUnauthenticated represents an error when a request doesn't hold a
+	// valid API key.
+	errUnauthenticated = errors.New("missing or invalid API key")
+
+	// errRateLimited represents an error when a client made too many
+	// requests.
+	errRateLimited = errors.New("too many requests")
+
+	// errInvalidRequest represents an error when the options of a request are
+	// invalid.
+	errInvalidRequest = errors.New("invalid request")
+
+	// errTooLarge represents an error when the body of a request exceeds the
+	// maximum size.
+	errTooLarge = errors.New("request too large")
+)
+
+// maxStanzas bounds the number of stanzas of the ciphertexts inspected.
+const maxStanzas = 64
+
+// server implements the operations of both APIs.
+type server struct {
+	network *dhttp.Network
+	host    string
+	keys    []string
+	limiter *limiter
+
+	// chains holds the networks of the other chains of the relay whose
+	// ciphertexts are decrypted, by chain hash. The ciphertexts of any other
+	// chain are refused, so that clients can't make the server fetch the
+	// information of arbitrary chains.
+	chains map[string]*dhttp.Network
+
+	// maxSize bounds the bodies of the requests and the decrypted plaintexts,
+	// unlimited if 0.
+	maxSize int64
+}
+
+// encryptOptions are the options of an encryption.
+type encryptOptions struct {
+	Round    uint64
+	Duration string
+	Armor    bool
+}
+
+// stanzaStatus describes a tlock stanza of a ciphertext, along with when it can
+// be decrypted for status requests.
+type stanzaStatus struct {
+	Type        string    `json:"type"`
+	Round       uint64    `json:"round"`
+	ChainHash   string    `json:"chain_hash"`
+	UnlockTime  time.Time `json:"unlock_time"`
+	Decryptable bool      `json:"decryptable"`
+}
+
+// headerStatus describes the tlock stanzas of a ciphertext.
+type headerStatus struct {
+	Armored bool           `json:"armored"`
+	Stanzas []stanzaStatus `json:"stanzas"`
+}
+
+// authorize checks the API key of a request, if the server requires one, and
+// that its client, identified by the API key or by its address, didn't exceed
+// its rate.
+func (s *server) authorize(apiKey string, addr string) error {
+	client := addr
+	if s.keys != nil {
+		if !s.validKey(apiKey) {
+			return errUnauthenticated
+		}
+		client = apiKey
+	}
+
+	if !s.limiter.allow(client, time.Now()) {
+		return errRateLimited
+	}
+
+	return nil
+}
+
+// validKey reports whether the API key is one of the keys of the server,
+// comparing them in constant time.
+func (s *server) validKey(apiKey string) bool {
+	valid := 0
+	for _, key := range s.keys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(apiKey))
+	}
+	return apiKey != "" && valid == 1
+}
+
+// encrypt encrypts the source to the destination towards the round given by
+// the options.
+func (s *server) encrypt(dst io.Writer, src io.Reader, opts encryptOptions) error {
+	if (opts.Round == 0) == (opts.Duration == "") {
+		return fmt.Errorf("%w: exactly one of round or duration must be given", errInvalidRequest)
+	}
+
+	flags := commands.Flags{
+		Encrypt:  true,
+		Network:  s.host,
+		Chain:    s.network.ChainHash(),
+		Round:    opts.Round,
+		Duration: opts.Duration,
+	}
+
+	// the armor is only closed on success, since closing it writes its footer
+	// even if nothing was encrypted.
+	if !opts.Armor {
+		return commands.Encrypt(flags, dst, src, s.network)
+	}
+
+	a := armor.NewWriter(dst)
+	if err := commands.Encrypt(flags, a, src, s.network); err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+// decrypt decrypts the source to the destination, switching to the chain of
+// the source if it is one of the trusted chains of the server.
+func (s *server) decrypt(dst io.Writer, src io.Reader) error {
+	switcher := func(chainHash string) (tlock.Network, error) {
+		return s.chain(chainHash)
+	}
+
+	return tlock.New(s.network).
+		TrustChains(slices.Collect(maps.Keys(s.chains))...).
+		WithChainSwitcher(switcher).
+		WithMaxSize(s.maxSize).
+		Decrypt(dst, src)
+}
+
+// chain returns the network of the chain hash, which must be the one of the
+// server or one of its trusted chains.
+func (s *server) chain(chainHash string) (*dhttp.Network, error) {
+	if strings.EqualFold(chainHash, s.network.ChainHash()) {
+		return s.network, nil
+	}
+
+	network, ok := s.chains[strings.ToLower(chainHash)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s isn't one of the chains served", tlock.ErrWrongChainhash, chainHash)
+	}
+
+	return network, nil
+}
+
+// limit returns a reader of the body of a request failing with errTooLarge
+// once more than the maximum size was read.
+func (s *server) limit(src io.Reader) io.Reader {
+	if s.maxSize == 0 {
+		return src
+	}
+
+	return &limitedReader{r: src, n: s.maxSize}
+}
+
+// inspect describes the tlock stanzas of the source, and when they can be
+// decrypted if status is set.
+func (s *server) inspect(src io.Reader, status bool) (headerStatus, error) {
+	header, err := tlock.ReadHeader(src)
+	if err != nil {
+		return headerStatus{}, err
+	}
+
+	if len(header.Stanzas) > maxStanzas {
+		return headerStatus{}, fmt.Errorf("%w: more than %d stanzas", errInvalidRequest, maxStanzas)
+	}
+
+	result := headerStatus{Armored: header.Armored, Stanzas: []stanzaStatus{}}
+	now := time.Now()
+	for _, stanza := range header.Stanzas {
+		st := stanzaStatus{
+			Type:      stanza.Type,
+			Round:     stanza.Round,
+			ChainHash: stanza.ChainHash,
+		}
+
+		if status {
+			network, err := s.chain(stanza.ChainHash)
+			if err != nil {
+				return headerStatus{}, err
+			}
+			st.UnlockTime = network.TimeOf(stanza.Round)
+			st.Decryptable = network.Current(now) >= stanza.Round
+		}
+
+		result.Stanzas = append(result.Stanzas, st)
+	}
+
+	return result, nil
+}
+
+// =============================================================================
+
+// These classes of errors are mapped to the status codes of each API.
+const (
+	classInvalid = iota
+	classTooEarly
+	classUnavailable
+	classUntrusted
+	classUnauthenticated
+	classRateLimited
+	classTooLarge
+)
+
+// classify returns the class of the error of an operation. Errors not
+// otherwise classified are caused by the request, such as an invalid
+// ciphertext.
+func classify(err error) int {
+	var unavailable interface{ Unavailable() bool }
+	var untrusted interface{ Untrusted() bool }
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		return classUnauthenticated
+	case errors.Is(err, errRateLimited):
+		return classRateLimited
+	case errors.Is(err, errTooLarge), errors.Is(err, tlock.ErrTooLarge), errors.As(err, &maxBytes):
+		return classTooLarge
+	case errors.Is(err, tlock.ErrTooEarly):
+		return classTooEarly
+	case errors.As(err, &unavailable) && unavailable.Unavailable():
+		return classUnavailable
+	case errors.As(err, &untrusted) && untrusted.Untrusted():
+		return classUntrusted
+	default:
+		return classInvalid
+	}
+}
+
+// =============================================================================
+
+// limitedReader reads at most n more bytes from its reader, failing with
+// errTooLarge if it has more.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the io.Reader interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errTooLarge
+	}
+
+	// reading one more byte than allowed tells a too large body from one of
+	// exactly the maximum size.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), errTooLarge
+	}
+
+	return n, err
+}
+
+// readKeys reads the API keys listed in the named file, one per line. Empty
+// lines and lines starting with # are ignored.
+func readKeys(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening API keys: %w", err)
+	}
+	defer f.Close()
+
+	keys := []string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no API key found in %s", name)
+	}
+
+	return keys, nil
+}
+
+// =============================================================================
+
+// maxBuckets is how many clients the limiter tracks before forgetting the ones
+// which didn't make any request for long enough to be back to their burst.
+const maxBuckets = 10000
+
+// limiter limits the rate of the requests of each client using a token
+// bucket. It is safe for concurrent use.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+// bucket holds the tokens of a client at the time of its last request.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter constructs a limiter allowing each client the rate of requests
+// per second, and the burst of requests at once. A zero rate allows every
+// request.
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow reports whether the client can make a request at the given time,
+// consuming a token if so.
+func (l *limiter) allow(client string, now time.Time) bool {
+	if l.rate == 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// prune forgets the clients whose bucket is full again.
+func (l *limiter) prune(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cose
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// These are the major types of the CBOR items used by the messages.
+const (
+	majorUint  = 0
+	majorNeg   = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorMap   = 5
+	majorTag   = 6
+)
+
+// appendHead appends the head of a CBOR item of the major type, in its
+// shortest form as deterministic encoding requires.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+// appendInt appends the integer, negative or not.
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, majorNeg, uint64(-1-n))
+	}
+	return appendHead(b, majorUint, uint64(n))
+}
+
+// appendBytes appends the byte string.
+func appendBytes(b []byte, data []byte) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(data))), data...)
+}
+
+// appendText appends the text string.
+func appendText(b []byte, text string) []byte {
+	return append(appendHead(b, majorText, uint64(len(text))), text...)
+}
+
+// =============================================================================
+
+// decoder reads the CBOR items of a message in sequence. Only the definite
+// length items used by the messages are supported.
+type decoder struct {
+	b []byte
+}
+
+// head reads the head of the next item, checking its major type.
+func (d *decoder) head(major byte) (uint64, error) {
+	if len(d.b) == 0 {
+		return 0, fmt.Errorf("%w: unexpected end", ErrInvalidMessage)
+	}
+	if got := d.b[0] >> 5; got != major {
+		return 0, fmt.Errorf("%w: major type %d instead of %d", ErrInvalidMessage, got, major)
+	}
+
+	info := d.b[0] & 0x1f
+	d.b = d.b[1:]
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("%w: unsupported additional information %d", ErrInvalidMessage, info)
+	}
+	if len(d.b) < size {
+		return 0, fmt.Errorf("%w: unexpected end", ErrInvalidMessage)
+	}
+
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+
+	return n, nil
+}
+
+// uint reads an unsigned integer.
+func (d *decoder) uint() (uint64, error) {
+	return d.head(majorUint)
+}
+
+// int reads an integer, negative or not.
+func (d *decoder) int() (int64, error) {
+	if len(d.b) > 0 && d.b[0]>>5 == majorNeg {
+		n, err := d.head(majorNeg)
+		if err != nil {
+			return 0, err
+		}
+		if n > 1<<63-1 {
+			return 0, fmt.Errorf("%w: integer overflow", ErrInvalidMessage)
+		}
+		return -1 - int64(n), nil
+	}
+
+	n, err := d.head(majorUint)
+	if err != nil {
+		return 0, err
+	}
+	if n > 1<<63-1 {
+		return 0, fmt.Errorf("%w: integer overflow", ErrInvalidMessage)
+	}
+	return int64(n), nil
+}
+
+// bytes reads a byte string.
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.head(majorBytes)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(d.b)) < n {
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidMessage)
+	}
+
+	data := d.b[:n]
+	d.b = d.b[n:]
+	return data, nil
+}
+
+// array reads the head of an array of the given length.
+func (d *decoder) array(length uint64) error {
+	n, err := d.head(majorArray)
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("%w: array of %d items instead of %d", ErrInvalidMessage, n, length)
+	}
+	return nil
+}
+
+// mapLen reads the head of a map and returns its number of pairs.
+func (d *decoder) mapLen() (uint64, error) {
+	return d.head(majorMap)
+}
+
+// tag reads the tag of the next item, checking it.
+func (d *decoder) tag(tag uint64) error {
+	n, err := d.head(majorTag)
+	if err != nil {
+		return err
+	}
+	if n != tag {
+		return fmt.Errorf("%w: tag %d instead of %d", ErrInvalidMessage, n, tag)
+	}
+	return nil
+}
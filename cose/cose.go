@@ -0,0 +1,306 @@
+// Package cose seals data in a COSE_Encrypt message (RFC 9052) whose content
+// encryption key is timelocked by tlock, as a compact alternative to the age
+// format for constrained devices, such as microcontrollers receiving the
+// timelocked keys decrypting their firmware.
+//
+// The message is the CBOR structure:
+//
+//	96([
+//	  << {1: 1} >>,                  / protected: alg A128GCM /
+//	  {5: iv},                       / unprotected: 12 bytes IV /
+//	  ciphertext,                    / ciphertext followed by the GCM tag /
+//	  [[
+//	    h'',                         / protected: empty /
+//	    {1: -65537,                  / alg tlock /
+//	     -65538: round,
+//	     -65539: chain hash},        / raw 32 bytes /
+//	    U || V || W                  / IBE ciphertext of the key /
+//	  ]]
+//	])
+package cose
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/drand/tlock"
+)
+
+// ErrInvalidMessage represents an error when a message isn't a COSE_Encrypt
+// message of the tlock algorithm.
+var ErrInvalidMessage = errors.New("invalid tlock cose message")
+
+// Tag is the CBOR tag of the COSE_Encrypt messages.
+const Tag = 96
+
+// These are the COSE algorithms of the messages.
+const (
+	// AlgorithmA128GCM encrypts the content.
+	AlgorithmA128GCM = 1
+	// AlgorithmTlock timelocks the content encryption key, using the private
+	// use range of the COSE algorithms.
+	AlgorithmTlock = -65537
+)
+
+// These are the COSE header labels of the messages, the private use ones
+// holding the round and the chain hash of the recipient.
+const (
+	labelAlg       = 1
+	labelIV        = 5
+	labelRound     = -65538
+	labelChainHash = -65539
+)
+
+// keySize is the size of the content encryption keys, the one of age file keys.
+const keySize = 16
+
+// wrappedKeyVersion is the version of the tlock.WrapKey blobs rebuilt from the
+// recipients of the messages.
+const wrappedKeyVersion = 1
+
+// Message is a COSE_Encrypt message of the tlock algorithm, as parsed by
+// Parse.
+type Message struct {
+	Round     uint64
+	ChainHash string
+
+	// WrappedKey is the IBE ciphertext of the content encryption key.
+	WrappedKey []byte
+	IV         []byte
+	// Ciphertext is the encrypted content followed by the GCM tag.
+	Ciphertext []byte
+
+	// protected is the serialized protected header, authenticated by the
+	// content encryption.
+	protected []byte
+}
+
+// Seal encrypts the plaintext with a random content encryption key using
+// AES-128-GCM, and returns the message holding the key timelocked towards the
+// round of the chain of the network.
+func Seal(network tlock.Network, roundNumber uint64, plaintext []byte) ([]byte, error) {
+	cek := make([]byte, keySize)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, fmt.Errorf("content encryption key: %w", err)
+	}
+	defer clear(cek)
+
+	// the blob holds the version, round and chain hash before U || V || W.
+	blob, err := tlock.WrapKey(network, roundNumber, cek)
+	if err != nil {
+		return nil, err
+	}
+	chainHash := blob[9:41]
+	wrappedKey := blob[41:]
+
+	protected := appendInt(appendHead(nil, majorMap, 1), labelAlg)
+	protected = appendInt(protected, AlgorithmA128GCM)
+
+	aead, err := newAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("iv: %w", err)
+	}
+	ciphertext := aead.Seal(nil, iv, plaintext, encStructure(protected))
+
+	b := appendHead(nil, majorTag, Tag)
+	b = appendHead(b, majorArray, 4)
+	b = appendBytes(b, protected)
+	b = appendHead(b, majorMap, 1)
+	b = appendInt(b, labelIV)
+	b = appendBytes(b, iv)
+	b = appendBytes(b, ciphertext)
+
+	b = appendHead(b, majorArray, 1)
+	b = appendHead(b, majorArray, 3)
+	b = appendBytes(b, nil)
+	b = appendHead(b, majorMap, 3)
+	b = appendInt(b, labelAlg)
+	b = appendInt(b, AlgorithmTlock)
+	b = appendInt(b, labelRound)
+	b = appendHead(b, majorUint, roundNumber)
+	b = appendInt(b, labelChainHash)
+	b = appendBytes(b, chainHash)
+	b = appendBytes(b, wrappedKey)
+
+	return b, nil
+}
+
+// Parse parses the message, without any network access.
+func Parse(msg []byte) (Message, error) {
+	d := decoder{b: msg}
+	if err := d.tag(Tag); err != nil {
+		return Message{}, err
+	}
+	if err := d.array(4); err != nil {
+		return Message{}, err
+	}
+
+	protected, err := d.bytes()
+	if err != nil {
+		return Message{}, err
+	}
+	inner := decoder{b: protected}
+	h, err := inner.header()
+	if err != nil {
+		return Message{}, err
+	}
+	if h.alg != AlgorithmA128GCM || len(inner.b) != 0 {
+		return Message{}, fmt.Errorf("%w: unsupported content algorithm %d", ErrInvalidMessage, h.alg)
+	}
+
+	h, err = d.header()
+	if err != nil {
+		return Message{}, err
+	}
+	iv := h.iv
+
+	ciphertext, err := d.bytes()
+	if err != nil {
+		return Message{}, err
+	}
+
+	if err := d.array(1); err != nil {
+		return Message{}, err
+	}
+	if err := d.array(3); err != nil {
+		return Message{}, err
+	}
+	if recipientProtected, err := d.bytes(); err != nil || len(recipientProtected) != 0 {
+		return Message{}, fmt.Errorf("%w: unexpected protected header of the recipient", ErrInvalidMessage)
+	}
+	h, err = d.header()
+	if err != nil {
+		return Message{}, err
+	}
+	if h.alg != AlgorithmTlock || h.round == 0 || len(h.chainHash) != 32 {
+		return Message{}, fmt.Errorf("%w: unsupported recipient", ErrInvalidMessage)
+	}
+	wrappedKey, err := d.bytes()
+	if err != nil {
+		return Message{}, err
+	}
+
+	if len(d.b) != 0 {
+		return Message{}, fmt.Errorf("%w: trailing data", ErrInvalidMessage)
+	}
+
+	return Message{
+		Round:      h.round,
+		ChainHash:  hex.EncodeToString(h.chainHash),
+		WrappedKey: wrappedKey,
+		IV:         iv,
+		Ciphertext: ciphertext,
+		protected:  protected,
+	}, nil
+}
+
+// Open decrypts the content of the message once its round is reached by the
+// network, failing with tlock.ErrTooEarly before.
+func (m Message) Open(network tlock.Network) ([]byte, error) {
+	chainHash, err := hex.DecodeString(m.ChainHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chain hash: %w", ErrInvalidMessage, err)
+	}
+
+	blob := []byte{wrappedKeyVersion}
+	blob = binary.BigEndian.AppendUint64(blob, m.Round)
+	blob = append(blob, chainHash...)
+	blob = append(blob, m.WrappedKey...)
+
+	cek, err := tlock.UnwrapKey(network, blob)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(cek)
+
+	aead, err := newAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.IV) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: iv of %d bytes", ErrInvalidMessage, len(m.IV))
+	}
+
+	plaintext, err := aead.Open(nil, m.IV, m.Ciphertext, encStructure(m.protected))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	return plaintext, nil
+}
+
+// =============================================================================
+
+// header holds the parameters of a header map.
+type header struct {
+	alg       int64
+	iv        []byte
+	round     uint64
+	chainHash []byte
+}
+
+// header reads a header map, refusing the labels the messages don't use.
+func (d *decoder) header() (header, error) {
+	n, err := d.mapLen()
+	if err != nil {
+		return header{}, err
+	}
+
+	var h header
+	for range n {
+		label, err := d.int()
+		if err != nil {
+			return header{}, err
+		}
+
+		switch label {
+		case labelAlg:
+			h.alg, err = d.int()
+		case labelIV:
+			h.iv, err = d.bytes()
+		case labelRound:
+			h.round, err = d.uint()
+		case labelChainHash:
+			h.chainHash, err = d.bytes()
+		default:
+			return header{}, fmt.Errorf("%w: unsupported header label %d", ErrInvalidMessage, label)
+		}
+		if err != nil {
+			return header{}, err
+		}
+	}
+
+	return h, nil
+}
+
+// encStructure returns the additional data of the content encryption, the
+// Enc_structure of RFC 9052 without external data.
+func encStructure(protected []byte) []byte {
+	b := appendHead(nil, majorArray, 3)
+	b = appendText(b, "Encrypt")
+	b = appendBytes(b, protected)
+	return appendBytes(b, nil)
+}
+
+// newAEAD returns the AES-128-GCM of the content encryption key.
+func newAEAD(cek []byte) (cipher.AEAD, error) {
+	if len(cek) != keySize {
+		return nil, fmt.Errorf("%w: content encryption key of %d bytes", ErrInvalidMessage, len(cek))
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
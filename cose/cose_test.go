@@ -0,0 +1,66 @@
+package cose_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/cose"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+func TestSealOpen(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	firmwareKey := bytes.Repeat([]byte{0x42}, 32)
+	msg, err := cose.Seal(network, 1234, firmwareKey)
+	require.NoError(t, err)
+
+	// the message is smaller than the age file of the same plaintext.
+	var age bytes.Buffer
+	require.NoError(t, tlock.New(network).Encrypt(&age, bytes.NewReader(firmwareKey), 1234))
+	require.Less(t, len(msg)+100, age.Len())
+
+	m, err := cose.Parse(msg)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), m.Round)
+	require.Equal(t, quicknet, m.ChainHash)
+
+	_, err = m.Open(network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	plaintext, err := m.Open(network)
+	require.NoError(t, err)
+	require.Equal(t, firmwareKey, plaintext)
+
+	// the content is authenticated.
+	tampered := bytes.Clone(msg)
+	tampered[40] ^= 1
+	m, err = cose.Parse(tampered)
+	require.NoError(t, err)
+	_, err = m.Open(network)
+	require.ErrorIs(t, err, cose.ErrInvalidMessage)
+
+	_, err = cose.Parse(msg[:len(msg)-1])
+	require.ErrorIs(t, err, cose.ErrInvalidMessage)
+	_, err = cose.Parse(append(bytes.Clone(msg), 0))
+	require.ErrorIs(t, err, cose.ErrInvalidMessage)
+	_, err = cose.Parse(msg[2:])
+	require.ErrorIs(t, err, cose.ErrInvalidMessage)
+}
@@ -0,0 +1,199 @@
+// Package deadman implements a dead man's switch using timelock encryption: a
+// ciphertext is encrypted again towards a later round each time its round is
+// reached, as long as its operator checked in during the window preceding that
+// round. Once a check-in is missed, the ciphertext is left as is, so that
+// anyone holding it can decrypt it.
+//
+// A timelock can't be extended before its round is reached, since that would
+// require decrypting it: every version of the ciphertext can be decrypted once
+// its own round is reached. Only the latest version must thus ever be shared.
+package deadman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age/armor"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/duration"
+)
+
+// ErrMissedCheckIn represents an error when the operator didn't check in
+// during the window preceding the round of the ciphertext, which is then left
+// decryptable.
+var ErrMissedCheckIn = errors.New("missed check-in, the ciphertext is left decryptable")
+
+// retryDelay is how long to wait before refreshing again after an error, such
+// as the signature of the round not being available yet.
+var retryDelay = 30 * time.Second
+
+// Switch keeps the named ciphertext locked. The durations use the grammar of
+// the duration package.
+type Switch struct {
+	// Name is the ciphertext, initially encrypted towards the first round.
+	Name string
+
+	// CheckIn is the file whose modification time records the last check-in
+	// of the operator, see CheckIn.
+	CheckIn string
+
+	// Interval is how long the ciphertext is locked after each refresh.
+	Interval string
+
+	// Window is how long before the round of the ciphertext the operator must
+	// check in for the ciphertext to be refreshed.
+	Window string
+
+	// Network is the network of the chain of the ciphertext.
+	Network tlock.Network
+}
+
+// CheckIn records a check-in of the operator in the named file, which is
+// created if needed.
+func CheckIn(name string) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return os.Chtimes(name, now, now)
+}
+
+// Refresh encrypts the ciphertext towards the round following the interval if
+// its round is reached and the operator checked in during the window, and
+// returns the time of the round of the ciphertext, when it must be refreshed
+// again. It fails with ErrMissedCheckIn if the operator didn't check in.
+func (s Switch) Refresh(now time.Time) (time.Time, error) {
+	header, err := readHeader(s.Name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unlock := s.Network.TimeOf(header.Earliest().Round)
+	if now.Before(unlock) {
+		return unlock, nil
+	}
+
+	window, err := duration.Parse(unlock, s.Window)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("window: %w", err)
+	}
+	interval, err := duration.Parse(now, s.Interval)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("interval: %w", err)
+	}
+
+	info, err := os.Stat(s.CheckIn)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, err
+	}
+	if err != nil || info.ModTime().Before(unlock.Add(-window)) {
+		return unlock, ErrMissedCheckIn
+	}
+
+	roundNumber := s.Network.Current(now.Add(interval))
+	err = replaceFile(s.Name, func(dst io.Writer) error {
+		src, err := os.Open(s.Name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		if header.Armored {
+			a := armor.NewWriter(dst)
+			if err := tlock.New(s.Network).Strict().ReEncrypt(a, src, roundNumber); err != nil {
+				return err
+			}
+			return a.Close()
+		}
+
+		return tlock.New(s.Network).Strict().ReEncrypt(dst, src, roundNumber)
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("refreshing %q: %w", s.Name, err)
+	}
+
+	return s.Network.TimeOf(roundNumber), nil
+}
+
+// Run refreshes the ciphertext each time its round is reached, until the
+// context is done or a check-in is missed. Other errors are logged and the
+// refresh is retried.
+func (s Switch) Run(ctx context.Context, log *log.Logger) error {
+	for {
+		next, err := s.Refresh(time.Now())
+		switch {
+		case errors.Is(err, ErrMissedCheckIn):
+			return err
+		case err != nil:
+			log.Printf("deadman: %v", err)
+			next = time.Now().Add(retryDelay)
+		default:
+			log.Printf("deadman: %s is locked until %s", s.Name, next.Format(time.RFC3339))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// readHeader reads the header of the named ciphertext.
+func readHeader(name string) (tlock.Header, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return tlock.Header{}, err
+	}
+	defer f.Close()
+
+	return tlock.ReadHeader(f)
+}
+
+// replaceFile replaces the named file by the result of the operation once
+// fully written, keeping its permissions.
+func replaceFile(name string, write func(dst io.Writer) error) (err error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
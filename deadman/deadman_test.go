@@ -0,0 +1,134 @@
+package deadman_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/deadman"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+func TestRefresh(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	now := time.Now()
+	network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, now.Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+
+	sign := func(roundNumber uint64) {
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+		require.NoError(t, err)
+		network.AddSignature(roundNumber, signature)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "secret.tle")
+	var cipherData bytes.Buffer
+	w := armor.NewWriter(&cipherData)
+	first := network.Current(now.Add(-time.Minute))
+	require.NoError(t, tlock.New(network).Encrypt(w, bytes.NewBufferString("very nice"), first))
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(name, cipherData.Bytes(), 0640))
+	sign(first)
+
+	s := deadman.Switch{
+		Name:     name,
+		CheckIn:  filepath.Join(dir, "secret.checkin"),
+		Interval: "7d",
+		Window:   "2d",
+		Network:  network,
+	}
+
+	// without any check-in, the ciphertext is left decryptable.
+	_, err = s.Refresh(now)
+	require.ErrorIs(t, err, deadman.ErrMissedCheckIn)
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, cipherData.Bytes(), b)
+
+	// a check-in before the window doesn't count.
+	require.NoError(t, deadman.CheckIn(s.CheckIn))
+	old := now.Add(-3 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(s.CheckIn, old, old))
+	_, err = s.Refresh(now)
+	require.ErrorIs(t, err, deadman.ErrMissedCheckIn)
+
+	require.NoError(t, deadman.CheckIn(s.CheckIn))
+	next, err := s.Refresh(now)
+	require.NoError(t, err)
+	require.WithinDuration(t, now.Add(7*24*time.Hour), next, 3*time.Second)
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	header, err := tlock.ReadHeader(f)
+	require.NoError(t, err)
+	require.True(t, header.Armored)
+	require.Equal(t, network.Current(next), header.Stanzas[0].Round)
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// the refreshed ciphertext stays locked until its round.
+	again, err := s.Refresh(now)
+	require.NoError(t, err)
+	require.Equal(t, next, again)
+
+	sign(header.Stanzas[0].Round)
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	var plainData bytes.Buffer
+	require.NoError(t, tlock.New(network).Decrypt(&plainData, f))
+	require.Equal(t, "very nice", plainData.String())
+}
+
+func TestRefreshEarliestRound(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	now := time.Now()
+	network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, now.Add(-time.Hour).Unix(), nil)
+	require.NoError(t, err)
+
+	// the ciphertext unlocks with its earliest round, whatever the order of
+	// its stanzas.
+	dir := t.TempDir()
+	name := filepath.Join(dir, "secret.tle")
+	var cipherData bytes.Buffer
+	first := network.Current(now.Add(-time.Minute))
+	later := network.Current(now.Add(time.Hour))
+	w, err := age.Encrypt(&cipherData, tlock.NewRecipient(network, later), tlock.NewRecipient(network, first))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("very nice"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(name, cipherData.Bytes(), 0600))
+
+	s := deadman.Switch{
+		Name:     name,
+		CheckIn:  filepath.Join(dir, "secret.checkin"),
+		Interval: "7d",
+		Window:   "2d",
+		Network:  network,
+	}
+
+	unlock, err := s.Refresh(now)
+	require.ErrorIs(t, err, deadman.ErrMissedCheckIn)
+	require.Equal(t, network.TimeOf(first), unlock)
+}
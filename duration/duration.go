@@ -0,0 +1,153 @@
+// Package duration implements the parsing of the durations accepted by tle,
+// so that other tools compute the same decryption time as the command line.
+//
+// A duration is a sequence of groups made of a non-negative decimal number
+// directly followed by a unit, such as "1y2M3d" or "90s". Each unit can be
+// used at most once, in any order, and the groups are added up:
+//
+//	s  seconds
+//	m  minutes
+//	h  hours
+//	d  days
+//	w  weeks, of 7 days
+//	M  months
+//	y  years
+//
+// Seconds, minutes and hours are fixed lengths of time. Days, weeks, months
+// and years are calendar units: their length depends on the start time and on
+// its location, e.g. "1d" across a daylight saving change lasts 23 or 25 hours
+// and "1M" from the 1st of February lasts 28 or 29 days.
+package duration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidFormat represents an error when a duration doesn't follow the
+// grammar, such as an unknown unit or a missing number.
+var ErrInvalidFormat = errors.New("unsupported duration type or malformed duration - note: drand can only support as short as seconds")
+
+// ErrDuplicateUnit represents an error when a unit is used more than once.
+var ErrDuplicateUnit = errors.New("you cannot use the same duration unit specifier twice in one duration")
+
+// ErrInvalidValue represents an error when a duration is too large and would
+// cause an overflow.
+var ErrInvalidValue = errors.New("the duration you entered is either in the past or was too large and would cause an overflow")
+
+// Error describes a duration which couldn't be parsed, the reason being one
+// of the errors of this package.
+type Error struct {
+	Input string
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("parsing duration %q: %v", e.Input, e.Err)
+}
+
+// Unwrap returns the reason why the duration couldn't be parsed.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// units lists the units of the grammar, from the shortest to the longest.
+const units = "smhdwMy"
+
+var (
+	validDuration = regexp.MustCompile(fmt.Sprintf("^([0-9]+[%s]{1})+$", units))
+	durationGroup = regexp.MustCompile(fmt.Sprintf("([0-9]+)([%s])", units))
+)
+
+// Parse returns the duration described by the input, with the calendar units
+// evaluated from the start time in its own location.
+func Parse(start time.Time, input string) (time.Duration, error) {
+	return ParseIn(start, input, start.Location())
+}
+
+// ParseIn returns the duration described by the input, with the calendar
+// units evaluated from the start time in the given location. A nil location
+// stands for UTC.
+func ParseIn(start time.Time, input string, loc *time.Location) (time.Duration, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	start = start.In(loc)
+
+	// first we check that there are no extra characters or malformed groups
+	if !validDuration.MatchString(input) {
+		return 0, &Error{Input: input, Err: ErrInvalidFormat}
+	}
+
+	// then we iterate through each group and combine them into one
+	seen := make(map[byte]bool, len(units))
+	total := time.Duration(0)
+	for _, group := range durationGroup.FindAllStringSubmatch(input, -1) {
+		unit := group[2][0]
+		if seen[unit] {
+			return 0, &Error{Input: input, Err: ErrDuplicateUnit}
+		}
+		seen[unit] = true
+
+		value, err := strconv.Atoi(group[1])
+		if err != nil {
+			return 0, &Error{Input: input, Err: ErrInvalidValue}
+		}
+
+		d, ok := durationFrom(start, value, unit)
+		if !ok || total > math.MaxInt64-d {
+			return 0, &Error{Input: input, Err: ErrInvalidValue}
+		}
+		total += d
+	}
+
+	return total, nil
+}
+
+// durationFrom returns the length of the value in the unit from the start
+// time, and false if it overflows.
+func durationFrom(start time.Time, value int, unit byte) (time.Duration, bool) {
+	switch unit {
+	case 's':
+		return fixedDuration(value, time.Second)
+	case 'm':
+		return fixedDuration(value, time.Minute)
+	case 'h':
+		return fixedDuration(value, time.Hour)
+	case 'd':
+		return calendarDuration(start, start.AddDate(0, 0, value))
+	case 'w':
+		if value > math.MaxInt/7 {
+			return 0, false
+		}
+		return calendarDuration(start, start.AddDate(0, 0, value*7))
+	case 'M':
+		return calendarDuration(start, start.AddDate(0, value, 0))
+	case 'y':
+		return calendarDuration(start, start.AddDate(value, 0, 0))
+	}
+	return 0, false
+}
+
+// fixedDuration multiplies the value by the unit, checking for overflows.
+func fixedDuration(value int, unit time.Duration) (time.Duration, bool) {
+	if int64(value) > math.MaxInt64/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(value) * unit, true
+}
+
+// calendarDuration returns the time between start and end, which saturates
+// instead of overflowing, and is negative if the date arithmetic wrapped.
+func calendarDuration(start, end time.Time) (time.Duration, bool) {
+	d := end.Sub(start)
+	if d < 0 || d == math.MaxInt64 || end.Before(start) {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,163 @@
+package duration_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drand/tlock/duration"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	type test struct {
+		name     string
+		duration string
+		date     time.Time
+		expected time.Duration
+		err      error
+	}
+
+	tests := []test{
+		{
+			name:     "seconds are parsed correctly",
+			duration: "1s",
+			date:     time.Now(),
+			expected: 1 * time.Second,
+		},
+		{
+			name:     "hours are parsed correctly",
+			duration: "1h",
+			date:     time.Now(),
+			expected: 1 * time.Hour,
+		},
+		{
+			name:     "days are parsed correctly",
+			duration: "1d",
+			date:     time.Now(),
+			expected: 24 * time.Hour,
+		},
+		{
+			name:     "months are parsed correctly",
+			duration: "1M",
+			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
+			expected: 31 * 24 * time.Hour,
+		},
+		{
+			name:     "years are parsed correctly",
+			duration: "1y",
+			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
+			expected: 365 * 24 * time.Hour,
+		},
+		{
+			name:     "a mix of timespans parse successfully",
+			duration: "1y1M1s",
+			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
+			expected: 365*24*time.Hour + 31*24*time.Hour + 1*time.Second,
+		},
+		{
+			name:     "a mix of timespans in a funny order parse successfully",
+			duration: "2s1y1M",
+			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
+			expected: 365*24*time.Hour + 31*24*time.Hour + 2*time.Second,
+		},
+		{
+			name:     "times with multiple digits parse successfully",
+			duration: "203m",
+			date:     time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC),
+			expected: 203 * time.Minute,
+		},
+		{
+			name:     "parsing an invalid timespan character fails",
+			duration: "1C",
+			date:     time.Now(),
+			err:      duration.ErrInvalidFormat,
+		},
+		{
+			name:     "missing multipliers fails",
+			duration: "DM",
+			date:     time.Now(),
+			err:      duration.ErrInvalidFormat,
+		},
+		{
+			name:     "0 values are in the middle are allowed",
+			duration: "4y0M1m",
+			date:     time.Now(),
+			// note that this will fail in 2096-2099 since 2100 is not a leap year
+			expected: (4*365+1)*24*time.Hour + 1*time.Minute,
+		},
+		{
+			name:     "total of 0 should also be fine",
+			duration: "0s",
+			date:     time.Now(),
+			expected: 0 * time.Second,
+		},
+		{
+			name:     "if characters are repeated, an error is returned",
+			duration: "3s2s1d1s",
+			date:     time.Now(),
+			err:      duration.ErrDuplicateUnit,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			seconds, err := duration.Parse(tc.date, tc.duration)
+			if tc.err == nil && err != nil {
+				t.Fatalf("unexpected parse error: %s", err)
+			}
+
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Fatalf("expecting parsing error '%s'; got %v", tc.err, err)
+			}
+
+			expected := tc.date.Add(tc.expected)
+			result := tc.date.Add(seconds)
+
+			if !result.Equal(tc.date.Add(tc.expected)) {
+				t.Fatalf("expecting end time %s; got %s", expected, result)
+			}
+
+		})
+	}
+}
+
+func TestParseIn(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	// the night of the switch to summer time lasts 23 hours in Paris.
+	start := time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC)
+
+	d, err := duration.ParseIn(start, "1d", paris)
+	require.NoError(t, err)
+	require.Equal(t, 23*time.Hour, d)
+
+	d, err = duration.ParseIn(start.AddDate(0, 0, -1), "1d", paris)
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, d)
+
+	d, err = duration.ParseIn(start, "1d", nil)
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, d)
+
+	d, err = duration.ParseIn(start, "2w", nil)
+	require.NoError(t, err)
+	require.Equal(t, 14*24*time.Hour, d)
+}
+
+func TestParseOverflow(t *testing.T) {
+	start := time.Date(2022, 01, 01, 0, 0, 0, 0, time.UTC)
+
+	for _, input := range []string{"292277042628y", "9999999999999h", "300y300y", "250y600M", "99999999999999999999s"} {
+		_, err := duration.Parse(start, input)
+		require.Error(t, err, input)
+
+		var perr *duration.Error
+		require.ErrorAs(t, err, &perr)
+		require.Equal(t, input, perr.Input)
+	}
+
+	_, err := duration.Parse(start, "292277042628y")
+	require.ErrorIs(t, err, duration.ErrInvalidValue)
+}
@@ -0,0 +1,263 @@
+// Package awskms implements an escrow.KeyWrapper using an AWS KMS key, through
+// the JSON API of AWS KMS signed with AWS Signature Version 4.
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidARN represents an error when a key ARN isn't the one of an AWS KMS
+// key or alias.
+var ErrInvalidARN = errors.New("invalid AWS KMS key ARN")
+
+// ErrMissingCredentials represents an error when the AWS credentials aren't
+// set in the environment.
+var ErrMissingCredentials = errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+
+// ErrKMS represents an error returned by AWS KMS.
+var ErrKMS = errors.New("AWS KMS error")
+
+// requestTimeout bounds the time waited for each request to AWS KMS.
+const requestTimeout = 30 * time.Second
+
+// encryptionContext binds the wrapped file keys to their purpose, and can be
+// used in the conditions of the key policies.
+var encryptionContext = map[string]string{"purpose": "tlock-escrow"}
+
+// Credentials are the AWS credentials signing the requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv reads the credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and, for temporary credentials, AWS_SESSION_TOKEN
+// environment variables.
+func CredentialsFromEnv() (Credentials, error) {
+	credentials := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return Credentials{}, ErrMissingCredentials
+	}
+
+	return credentials, nil
+}
+
+// KeyWrapper wraps file keys using an AWS KMS key.
+type KeyWrapper struct {
+	keyARN      string
+	region      string
+	endpoint    string
+	credentials Credentials
+	client      *http.Client
+}
+
+// New returns the key wrapper of the key, whose ARN gives the region, such as
+// arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab.
+func New(keyARN string, credentials Credentials) (*KeyWrapper, error) {
+	parts := strings.SplitN(keyARN, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "kms" || parts[3] == "" ||
+		!(strings.HasPrefix(parts[5], "key/") || strings.HasPrefix(parts[5], "alias/")) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidARN, keyARN)
+	}
+
+	domain := "amazonaws.com"
+	if parts[1] == "aws-cn" {
+		domain = "amazonaws.com.cn"
+	}
+
+	return &KeyWrapper{
+		keyARN:      keyARN,
+		region:      parts[3],
+		endpoint:    fmt.Sprintf("https://kms.%s.%s/", parts[3], domain),
+		credentials: credentials,
+		client:      http.DefaultClient,
+	}, nil
+}
+
+// KeyID implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) KeyID() string {
+	return w.keyARN
+}
+
+// Wrap implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) Wrap(ctx context.Context, fileKey []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte
+	}
+	err := w.call(ctx, "Encrypt", struct {
+		KeyId             string
+		Plaintext         []byte
+		EncryptionContext map[string]string
+	}{w.keyARN, fileKey, encryptionContext}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.CiphertextBlob, nil
+}
+
+// Unwrap implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte
+	}
+	err := w.call(ctx, "Decrypt", struct {
+		KeyId             string
+		CiphertextBlob    []byte
+		EncryptionContext map[string]string
+	}{w.keyARN, wrapped, encryptionContext}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Plaintext, nil
+}
+
+// call performs the operation of the AWS KMS JSON API, whose binary fields are
+// base64 encoded like encoding/json does.
+func (w *KeyWrapper) call(ctx context.Context, operation string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+operation)
+	sign(req, body, w.credentials, w.region, "kms", time.Now())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &kmsErr) == nil && kmsErr.Type != "" {
+			return fmt.Errorf("%w: %s: %s: %s", ErrKMS, operation, kmsErr.Type, kmsErr.Message)
+		}
+		return fmt.Errorf("%w: %s: %s", ErrKMS, operation, resp.Status)
+	}
+
+	if err := json.Unmarshal(b, response); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// sign adds the AWS Signature Version 4 of the request and its body to its
+// headers, signing all of them.
+func sign(req *http.Request, body []byte, credentials Credentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{amzDate[:8], region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the query string sorted by key and value, encoded as
+// required by AWS Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	slices.Sort(params)
+
+	return strings.Join(params, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
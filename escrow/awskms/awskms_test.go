@@ -0,0 +1,101 @@
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	// the example of the AWS Signature Version 4 documentation.
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	credentials := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	sign(req, nil, credentials, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	require.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+}
+
+func TestNew(t *testing.T) {
+	w, err := New("arn:aws:kms:eu-west-3:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab", Credentials{})
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-3", w.region)
+	require.Equal(t, "https://kms.eu-west-3.amazonaws.com/", w.endpoint)
+
+	_, err = New("arn:aws:kms:eu-west-3:111122223333:alias/escrow", Credentials{})
+	require.NoError(t, err)
+
+	_, err = New("arn:aws:s3:::bucket", Credentials{})
+	require.ErrorIs(t, err, ErrInvalidARN)
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	keyARN := "arn:aws:kms:eu-west-3:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	// the fake service "encrypts" by reversing the bytes.
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		require.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+
+		var req struct {
+			KeyId             string
+			Plaintext         []byte
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+		require.Equal(t, keyARN, req.KeyId)
+		require.Equal(t, encryptionContext, req.EncryptionContext)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": reversed(req.Plaintext)})
+		case "TrentService.Decrypt":
+			if len(req.CiphertextBlob) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"InvalidCiphertextException","message":"nope"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": reversed(req.CiphertextBlob)})
+		}
+	}))
+	defer kms.Close()
+
+	w, err := New(keyARN, Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"})
+	require.NoError(t, err)
+	w.endpoint = kms.URL
+
+	wrapped, err := w.Wrap(context.Background(), []byte("file key"))
+	require.NoError(t, err)
+	require.False(t, bytes.Equal([]byte("file key"), wrapped))
+
+	fileKey, err := w.Unwrap(context.Background(), wrapped)
+	require.NoError(t, err)
+	require.Equal(t, []byte("file key"), fileKey)
+
+	_, err = w.Unwrap(context.Background(), nil)
+	require.ErrorIs(t, err, ErrKMS)
+	require.ErrorContains(t, err, "InvalidCiphertextException")
+}
+
+func reversed(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,128 @@
+// Package escrow wraps the file key of timelock ciphertexts with a key held by
+// a key management service, in addition to the timelock. The ciphertext can
+// then be decrypted before its round by those the access policies of the key
+// management service allow to, as a break-glass path.
+//
+// The escrowed file key is stored in an additional stanza of the age header,
+// which tlock skips when decrypting.
+package escrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"github.com/drand/tlock"
+)
+
+// ErrInvalidKeyID represents an error when a key identifier can't be used as
+// an argument of a stanza.
+var ErrInvalidKeyID = errors.New("the key identifier must be printable ASCII without spaces")
+
+// StanzaType is the type of the stanzas holding escrowed file keys, whose
+// argument is the identifier of the key.
+const StanzaType = "tlock-escrow"
+
+// KeyWrapper wraps and unwraps file keys using a key of a key management
+// service.
+type KeyWrapper interface {
+	// KeyID identifies the key, such as the ARN of an AWS KMS key or the
+	// resource name of a GCP Cloud KMS key.
+	KeyID() string
+
+	// Wrap encrypts the file key.
+	Wrap(ctx context.Context, fileKey []byte) ([]byte, error)
+
+	// Unwrap decrypts a file key encrypted by Wrap.
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Encrypt encrypts the source towards the round like tlock, the file key also
+// being wrapped with the key wrapper.
+func Encrypt(t tlock.Tlock, dst io.Writer, src io.Reader, roundNumber uint64, wrapper KeyWrapper) error {
+	return t.WithRecipients(NewRecipient(wrapper)).Encrypt(dst, src, roundNumber)
+}
+
+// Decrypt decrypts the source using the file key escrowed with the key
+// wrapper, regardless of the round of the ciphertext.
+func Decrypt(dst io.Writer, src io.Reader, wrapper KeyWrapper) error {
+	return tlock.DecryptWith(dst, src, NewIdentity(wrapper))
+}
+
+// =============================================================================
+
+// Recipient implements the age Recipient interface, wrapping the file key with
+// the key wrapper.
+type Recipient struct {
+	wrapper KeyWrapper
+}
+
+// NewRecipient returns the recipient escrowing file keys with the key wrapper.
+func NewRecipient(wrapper KeyWrapper) *Recipient {
+	return &Recipient{wrapper: wrapper}
+}
+
+// Wrap implements the age.Recipient interface. As the interface doesn't carry
+// a context, the key wrapper is expected to bound its own requests.
+func (r *Recipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	keyID := r.wrapper.KeyID()
+	if !validKeyID(keyID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKeyID, keyID)
+	}
+
+	wrapped, err := r.wrapper.Wrap(context.Background(), fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("escrow file key: %w", err)
+	}
+
+	return []*age.Stanza{{
+		Type: StanzaType,
+		Args: []string{keyID},
+		Body: wrapped,
+	}}, nil
+}
+
+// Identity implements the age Identity interface, unwrapping the file keys
+// escrowed with the key wrapper.
+type Identity struct {
+	wrapper KeyWrapper
+}
+
+// NewIdentity returns the identity unwrapping the file keys escrowed with the
+// key wrapper.
+func NewIdentity(wrapper KeyWrapper) *Identity {
+	return &Identity{wrapper: wrapper}
+}
+
+// Unwrap implements the age.Identity interface.
+func (i *Identity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	keyID := i.wrapper.KeyID()
+	for _, stanza := range stanzas {
+		if stanza.Type != StanzaType || len(stanza.Args) != 1 || stanza.Args[0] != keyID {
+			continue
+		}
+
+		fileKey, err := i.wrapper.Unwrap(context.Background(), stanza.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap escrowed file key: %w", err)
+		}
+		return fileKey, nil
+	}
+
+	return nil, age.ErrIncorrectIdentity
+}
+
+// validKeyID reports whether the key identifier can be a stanza argument.
+func validKeyID(keyID string) bool {
+	if keyID == "" {
+		return false
+	}
+	for _, c := range keyID {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package escrow_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/escrow"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+// xorWrapper "wraps" file keys by xoring them with its key.
+type xorWrapper struct {
+	keyID string
+	key   byte
+}
+
+func (w xorWrapper) KeyID() string {
+	return w.keyID
+}
+
+func (w xorWrapper) Wrap(_ context.Context, fileKey []byte) ([]byte, error) {
+	wrapped := make([]byte, len(fileKey))
+	for i := range fileKey {
+		wrapped[i] = fileKey[i] ^ w.key
+	}
+	return wrapped, nil
+}
+
+func (w xorWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return w.Wrap(ctx, wrapped)
+}
+
+func TestEscrow(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	wrapper := xorWrapper{keyID: "arn:aws:kms:eu-west-3:111122223333:alias/escrow", key: 0x42}
+
+	var cipherData bytes.Buffer
+	err = escrow.Encrypt(tlock.New(network), &cipherData, bytes.NewBufferString("very nice"), 1234, wrapper)
+	require.NoError(t, err)
+
+	// the escrowed file key decrypts before the round.
+	var plainData bytes.Buffer
+	err = escrow.Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()), wrapper)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+
+	// but only with the key it was escrowed with.
+	plainData.Reset()
+	err = escrow.Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()), xorWrapper{keyID: "other", key: 0x42})
+	var noMatch *age.NoIdentityMatchError
+	require.True(t, errors.As(err, &noMatch))
+
+	// tlock skips the escrow stanza once the round is reached.
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	plainData.Reset()
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+}
+
+func TestInvalidKeyID(t *testing.T) {
+	_, err := escrow.NewRecipient(xorWrapper{keyID: "key with spaces"}).Wrap(make([]byte, 16))
+	require.ErrorIs(t, err, escrow.ErrInvalidKeyID)
+}
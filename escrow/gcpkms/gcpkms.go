@@ -0,0 +1,161 @@
+// Package gcpkms implements an escrow.KeyWrapper using a GCP Cloud KMS key,
+// through the REST API of Cloud KMS authenticated with an OAuth 2.0 access
+// token.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKeyName represents an error when a key name isn't the resource
+// name of a Cloud KMS key.
+var ErrInvalidKeyName = errors.New("invalid GCP Cloud KMS key name")
+
+// ErrMissingToken represents an error when the access token isn't set in the
+// environment.
+var ErrMissingToken = errors.New("GOOGLE_OAUTH_ACCESS_TOKEN must be set")
+
+// ErrKMS represents an error returned by Cloud KMS.
+var ErrKMS = errors.New("GCP Cloud KMS error")
+
+// requestTimeout bounds the time waited for each request to Cloud KMS.
+const requestTimeout = 30 * time.Second
+
+// additionalAuthenticatedData binds the wrapped file keys to their purpose.
+var additionalAuthenticatedData = []byte("tlock-escrow")
+
+// TokenFromEnv reads the access token from the GOOGLE_OAUTH_ACCESS_TOKEN
+// environment variable, as output by gcloud auth print-access-token.
+func TokenFromEnv() (string, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return "", ErrMissingToken
+	}
+
+	return token, nil
+}
+
+// KeyWrapper wraps file keys using a Cloud KMS key.
+type KeyWrapper struct {
+	keyName  string
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// New returns the key wrapper of the key, given by its resource name such as
+// projects/PROJECT/locations/global/keyRings/RING/cryptoKeys/KEY.
+func New(keyName string, token string) (*KeyWrapper, error) {
+	parts := strings.Split(keyName, "/")
+	if len(parts) != 8 || parts[0] != "projects" || parts[2] != "locations" ||
+		parts[4] != "keyRings" || parts[6] != "cryptoKeys" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKeyName, keyName)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeyName, keyName)
+		}
+	}
+
+	return &KeyWrapper{
+		keyName:  keyName,
+		endpoint: "https://cloudkms.googleapis.com/v1/",
+		token:    token,
+		client:   http.DefaultClient,
+	}, nil
+}
+
+// KeyID implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) KeyID() string {
+	return w.keyName
+}
+
+// Wrap implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) Wrap(ctx context.Context, fileKey []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := w.call(ctx, "encrypt", struct {
+		Plaintext                   []byte `json:"plaintext"`
+		AdditionalAuthenticatedData []byte `json:"additionalAuthenticatedData"`
+	}{fileKey, additionalAuthenticatedData}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Ciphertext, nil
+}
+
+// Unwrap implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := w.call(ctx, "decrypt", struct {
+		Ciphertext                  []byte `json:"ciphertext"`
+		AdditionalAuthenticatedData []byte `json:"additionalAuthenticatedData"`
+	}{wrapped, additionalAuthenticatedData}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Plaintext, nil
+}
+
+// call performs the method of the Cloud KMS REST API on the key, whose binary
+// fields are base64 encoded like encoding/json does.
+func (w *KeyWrapper) call(ctx context.Context, method string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.endpoint+w.keyName+":"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+w.token)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(b, &kmsErr) == nil && kmsErr.Error.Status != "" {
+			return fmt.Errorf("%w: %s: %s: %s", ErrKMS, method, kmsErr.Error.Status, kmsErr.Error.Message)
+		}
+		return fmt.Errorf("%w: %s: %s", ErrKMS, method, resp.Status)
+	}
+
+	if err := json.Unmarshal(b, response); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	return nil
+}
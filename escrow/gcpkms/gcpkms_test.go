@@ -0,0 +1,83 @@
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const keyName = "projects/tlock/locations/global/keyRings/escrow/cryptoKeys/break-glass"
+
+func TestNew(t *testing.T) {
+	w, err := New(keyName, "token")
+	require.NoError(t, err)
+	require.Equal(t, keyName, w.KeyID())
+
+	_, err = New("projects/tlock/locations/global/keyRings/escrow", "token")
+	require.ErrorIs(t, err, ErrInvalidKeyName)
+
+	_, err = New("projects//locations/global/keyRings/escrow/cryptoKeys/break-glass", "token")
+	require.ErrorIs(t, err, ErrInvalidKeyName)
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	// the fake service "encrypts" by reversing the bytes.
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var req struct {
+			Plaintext                   []byte `json:"plaintext"`
+			Ciphertext                  []byte `json:"ciphertext"`
+			AdditionalAuthenticatedData []byte `json:"additionalAuthenticatedData"`
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+		require.Equal(t, additionalAuthenticatedData, req.AdditionalAuthenticatedData)
+
+		switch r.URL.Path {
+		case "/" + keyName + ":encrypt":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": reversed(req.Plaintext)})
+		case "/" + keyName + ":decrypt":
+			if len(req.Ciphertext) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"nope"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"plaintext": reversed(req.Ciphertext)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer kms.Close()
+
+	w, err := New(keyName, "token")
+	require.NoError(t, err)
+	w.endpoint = kms.URL + "/"
+
+	wrapped, err := w.Wrap(context.Background(), []byte("file key"))
+	require.NoError(t, err)
+	require.False(t, bytes.Equal([]byte("file key"), wrapped))
+
+	fileKey, err := w.Unwrap(context.Background(), wrapped)
+	require.NoError(t, err)
+	require.Equal(t, []byte("file key"), fileKey)
+
+	_, err = w.Unwrap(context.Background(), nil)
+	require.ErrorIs(t, err, ErrKMS)
+	require.ErrorContains(t, err, "INVALID_ARGUMENT")
+}
+
+func reversed(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,233 @@
+// Package vault implements an escrow.KeyWrapper using a key of the transit
+// secrets engine of HashiCorp Vault, authenticated with a token or an AppRole.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidKeyPath represents an error when a key path isn't the one of a
+// transit key.
+var ErrInvalidKeyPath = errors.New("the key path must be MOUNT/keys/KEY")
+
+// ErrMissingCredentials represents an error when the Vault address or
+// credentials aren't set in the environment.
+var ErrMissingCredentials = errors.New("VAULT_ADDR and either VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID must be set")
+
+// ErrVault represents an error returned by Vault.
+var ErrVault = errors.New("Vault error")
+
+// requestTimeout bounds the time waited for each request to Vault.
+const requestTimeout = 30 * time.Second
+
+// Config holds the address of Vault and the credentials authenticating to it,
+// either a token or the role and secret identifiers of an AppRole.
+type Config struct {
+	Address   string
+	Namespace string
+
+	Token string
+
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+}
+
+// ConfigFromEnv reads the configuration from the VAULT_ADDR, VAULT_NAMESPACE
+// and VAULT_TOKEN environment variables, or VAULT_ROLE_ID, VAULT_SECRET_ID and
+// VAULT_APPROLE_MOUNT, defaulting to approle, when no token is set.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Address:      os.Getenv("VAULT_ADDR"),
+		Namespace:    os.Getenv("VAULT_NAMESPACE"),
+		Token:        os.Getenv("VAULT_TOKEN"),
+		RoleID:       os.Getenv("VAULT_ROLE_ID"),
+		SecretID:     os.Getenv("VAULT_SECRET_ID"),
+		AppRoleMount: os.Getenv("VAULT_APPROLE_MOUNT"),
+	}
+	if config.Address == "" || (config.Token == "" && (config.RoleID == "" || config.SecretID == "")) {
+		return Config{}, ErrMissingCredentials
+	}
+
+	return config, nil
+}
+
+// KeyWrapper wraps file keys using a transit key of Vault.
+type KeyWrapper struct {
+	mount  string
+	key    string
+	config Config
+	client *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// New returns the key wrapper of the transit key at the path, such as
+// transit/keys/tlock, MOUNT being the path the transit engine is mounted at.
+func New(keyPath string, config Config) (*KeyWrapper, error) {
+	i := strings.LastIndex(keyPath, "/keys/")
+	if i <= 0 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKeyPath, keyPath)
+	}
+	mount, key := strings.Trim(keyPath[:i], "/"), keyPath[i+len("/keys/"):]
+	if mount == "" || key == "" || strings.Contains(key, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKeyPath, keyPath)
+	}
+
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = "approle"
+	}
+
+	return &KeyWrapper{
+		mount:  mount,
+		key:    key,
+		config: config,
+		client: http.DefaultClient,
+		token:  config.Token,
+	}, nil
+}
+
+// KeyID implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) KeyID() string {
+	return w.mount + "/keys/" + w.key
+}
+
+// Wrap implements the escrow.KeyWrapper interface. The wrapped file key is the
+// ciphertext returned by Vault, such as vault:v1:...
+func (w *KeyWrapper) Wrap(ctx context.Context, fileKey []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := w.call(ctx, w.mount+"/encrypt/"+w.key, struct {
+		Plaintext []byte `json:"plaintext"`
+	}{fileKey}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// Unwrap implements the escrow.KeyWrapper interface.
+func (w *KeyWrapper) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext []byte `json:"plaintext"`
+		} `json:"data"`
+	}
+	err := w.call(ctx, w.mount+"/decrypt/"+w.key, struct {
+		Ciphertext string `json:"ciphertext"`
+	}{string(wrapped)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data.Plaintext, nil
+}
+
+// call performs the request on the path of the Vault API, whose binary fields
+// are base64 encoded like encoding/json does, logging in with the AppRole
+// first if there is no token yet.
+func (w *KeyWrapper) call(ctx context.Context, path string, request any, response any) error {
+	token, err := w.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	return w.post(ctx, path, token, request, response)
+}
+
+// login returns the token, obtained from the AppRole the first time if it
+// wasn't configured.
+func (w *KeyWrapper) login(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.token != "" {
+		return w.token, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err := w.post(ctx, "auth/"+strings.Trim(w.config.AppRoleMount, "/")+"/login", "", struct {
+		RoleID   string `json:"role_id"`
+		SecretID string `json:"secret_id"`
+	}{w.config.RoleID, w.config.SecretID}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("%w: login: no client token", ErrVault)
+	}
+	w.token = resp.Auth.ClientToken
+
+	return w.token, nil
+}
+
+// post sends the request in json format to the path of the Vault API, and
+// decodes the response.
+func (w *KeyWrapper) post(ctx context.Context, path string, token string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(w.config.Address, "/") + "/v1/" + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if w.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", w.config.Namespace)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(b, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("%w: %s: %s", ErrVault, path, strings.Join(vaultErr.Errors, "; "))
+		}
+		return fmt.Errorf("%w: %s: %s", ErrVault, path, resp.Status)
+	}
+
+	if err := json.Unmarshal(b, response); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
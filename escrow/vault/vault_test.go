@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	w, err := New("transit/keys/tlock", Config{})
+	require.NoError(t, err)
+	require.Equal(t, "transit", w.mount)
+	require.Equal(t, "tlock", w.key)
+	require.Equal(t, "transit/keys/tlock", w.KeyID())
+
+	w, err = New("secrets/transit/keys/tlock", Config{})
+	require.NoError(t, err)
+	require.Equal(t, "secrets/transit", w.mount)
+
+	for _, keyPath := range []string{"transit/tlock", "/keys/tlock", "transit/keys/", "transit/keys/a/b"} {
+		_, err = New(keyPath, Config{})
+		require.ErrorIs(t, err, ErrInvalidKeyPath, keyPath)
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	logins := 0
+
+	// the fake transit engine "encrypts" by prefixing the base64 plaintext.
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "ns", r.Header.Get("X-Vault-Namespace"))
+
+		var req map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if r.URL.Path == "/v1/auth/approle/login" {
+			logins++
+			require.Equal(t, map[string]string{"role_id": "role", "secret_id": "secret"}, req)
+			_ = json.NewEncoder(w).Encode(map[string]any{"auth": map[string]string{"client_token": "token"}})
+			return
+		}
+		require.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/tlock":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + req["plaintext"]}})
+		case "/v1/transit/decrypt/tlock":
+			plaintext, ok := strings.CutPrefix(req["ciphertext"], "vault:v1:")
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid ciphertext: no prefix"]}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": plaintext}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	w, err := New("transit/keys/tlock", Config{Address: vault.URL, Namespace: "ns", RoleID: "role", SecretID: "secret"})
+	require.NoError(t, err)
+
+	wrapped, err := w.Wrap(context.Background(), []byte("file key"))
+	require.NoError(t, err)
+	require.Equal(t, "vault:v1:"+base64.StdEncoding.EncodeToString([]byte("file key")), string(wrapped))
+
+	fileKey, err := w.Unwrap(context.Background(), wrapped)
+	require.NoError(t, err)
+	require.Equal(t, []byte("file key"), fileKey)
+
+	_, err = w.Unwrap(context.Background(), []byte("nope"))
+	require.ErrorIs(t, err, ErrVault)
+	require.ErrorContains(t, err, "no prefix")
+
+	// the token of the AppRole is reused.
+	require.Equal(t, 1, logins)
+}
@@ -0,0 +1,266 @@
+// Package interop checks tlock against the test vectors shared with the other
+// implementations, such as tlock-js and tlock-rs, so that a ciphertext written
+// by any of them decrypts with the others.
+//
+// A vector file holds the chain information, round and signature a plaintext
+// was encrypted with, along with its ciphertext and the components expected
+// in its header. The ciphertexts are randomized, so they're compared by
+// decrypting them rather than byte for byte.
+package interop
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age/armor"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+)
+
+// ErrMismatch represents an error when an implementation doesn't produce what
+// a vector expects.
+var ErrMismatch = errors.New("vector mismatch")
+
+// File is the format of the vector files.
+type File struct {
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector describes a plaintext encrypted towards a round of a chain. The
+// signature of the round and the plaintext are hex encoded.
+type Vector struct {
+	Name      string          `json:"name"`
+	Generator string          `json:"generator"`
+	ChainInfo json.RawMessage `json:"chain_info"`
+	Round     uint64          `json:"round"`
+	Signature string          `json:"signature"`
+	Plaintext string          `json:"plaintext"`
+
+	// Ciphertext is armored, or standard base64 encoded if binary.
+	Ciphertext string `json:"ciphertext"`
+	Armored    bool   `json:"armored"`
+
+	// Stanzas are the components of the header the ciphertext must have.
+	Stanzas []Stanza `json:"stanzas"`
+
+	// File optionally names the file holding the ciphertext, next to the
+	// vector file, such as in the directories written by tle
+	// --generate-vectors.
+	File string `json:"file,omitempty"`
+}
+
+// Stanza describes a stanza expected in the header of a ciphertext.
+type Stanza struct {
+	Type      string `json:"type"`
+	Round     uint64 `json:"round"`
+	ChainHash string `json:"chain_hash"`
+}
+
+// ReadFile reads the vectors in json format.
+func ReadFile(r io.Reader) (File, error) {
+	var file File
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return File{}, fmt.Errorf("decoding vectors: %w", err)
+	}
+
+	return file, nil
+}
+
+// Generate encrypts the plaintext towards the round of the network, which
+// must have been constructed from chain information, and returns the vector
+// describing it. The signature is the one of the round.
+func Generate(name string, network *fixed.Network, roundNumber uint64, signature []byte, plaintext []byte, armored bool) (Vector, error) {
+	return GenerateRounds(name, network, []uint64{roundNumber}, signature, plaintext, armored)
+}
+
+// GenerateRounds is like Generate, but encrypts the plaintext with a stanza
+// for each of the rounds, sorted from the earliest, which is the round of the
+// vector and the one of the signature.
+func GenerateRounds(name string, network *fixed.Network, roundNumbers []uint64, signature []byte, plaintext []byte, armored bool) (Vector, error) {
+	roundNumbers = slices.Clone(roundNumbers)
+	slices.Sort(roundNumbers)
+	roundNumbers = slices.Compact(roundNumbers)
+	if len(roundNumbers) == 0 {
+		return Vector{}, tlock.ErrInvalidRound
+	}
+
+	info, err := network.MarshalInfo()
+	if err != nil {
+		return Vector{}, err
+	}
+
+	ciphertext, err := encrypt(network, roundNumbers, plaintext, armored)
+	if err != nil {
+		return Vector{}, err
+	}
+
+	stanzas := make([]Stanza, 0, len(roundNumbers))
+	for _, roundNumber := range roundNumbers {
+		stanzas = append(stanzas, Stanza{
+			Type:      tlock.StanzaType,
+			Round:     roundNumber,
+			ChainHash: network.ChainHash(),
+		})
+	}
+
+	encoded := string(ciphertext)
+	if !armored {
+		encoded = base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	return Vector{
+		Name:       name,
+		Generator:  "tlock (go)",
+		ChainInfo:  info,
+		Round:      roundNumbers[0],
+		Signature:  hex.EncodeToString(signature),
+		Plaintext:  hex.EncodeToString(plaintext),
+		Ciphertext: encoded,
+		Armored:    armored,
+		Stanzas:    stanzas,
+	}, nil
+}
+
+// CheckDecrypt decrypts the ciphertext of the vector with the signature of its
+// round, and checks its header and plaintext.
+func (v Vector) CheckDecrypt() error {
+	network, plaintext, err := v.decode()
+	if err != nil {
+		return err
+	}
+
+	ciphertext := []byte(v.Ciphertext)
+	if !v.Armored {
+		// the binary ciphertexts may be wrapped over several lines.
+		ciphertext, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(v.Ciphertext), ""))
+		if err != nil {
+			return fmt.Errorf("decoding ciphertext: %w", err)
+		}
+	}
+
+	return v.check(network, ciphertext, plaintext)
+}
+
+// CheckEncrypt encrypts the plaintext of the vector towards the rounds of its
+// stanzas, and checks the header and decryption of the resulting ciphertext,
+// as an implementation consuming the vector would.
+func (v Vector) CheckEncrypt() error {
+	network, plaintext, err := v.decode()
+	if err != nil {
+		return err
+	}
+
+	roundNumbers := []uint64{v.Round}
+	if len(v.Stanzas) != 0 {
+		roundNumbers = roundNumbers[:0]
+		for _, stanza := range v.Stanzas {
+			roundNumbers = append(roundNumbers, stanza.Round)
+		}
+	}
+
+	ciphertext, err := encrypt(network, roundNumbers, plaintext, v.Armored)
+	if err != nil {
+		return err
+	}
+
+	return v.check(network, ciphertext, plaintext)
+}
+
+// =============================================================================
+
+// decode returns the network of the chain information of the vector, with the
+// signature of its round, and its plaintext.
+func (v Vector) decode() (*fixed.Network, []byte, error) {
+	info, err := chaininfo.InfoFromJSON(bytes.NewReader(v.ChainInfo))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding chain info: %w", err)
+	}
+
+	signature, err := hex.DecodeString(v.Signature)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	network, err := fixed.FromInfo(info, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	network.AddSignature(v.Round, signature)
+
+	plaintext, err := hex.DecodeString(v.Plaintext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding plaintext: %w", err)
+	}
+
+	return network, plaintext, nil
+}
+
+// check verifies the header of the ciphertext against the expected stanzas,
+// and that the ciphertext decrypts to the plaintext both with the network and
+// with the signature only.
+func (v Vector) check(network *fixed.Network, ciphertext []byte, plaintext []byte) error {
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		return err
+	}
+	if header.Armored != v.Armored {
+		return fmt.Errorf("%w: armored is %t", ErrMismatch, header.Armored)
+	}
+	if len(header.Stanzas) != len(v.Stanzas) {
+		return fmt.Errorf("%w: %d stanzas instead of %d", ErrMismatch, len(header.Stanzas), len(v.Stanzas))
+	}
+	for i, stanza := range header.Stanzas {
+		if (Stanza{Type: stanza.Type, Round: stanza.Round, ChainHash: stanza.ChainHash}) != v.Stanzas[i] {
+			return fmt.Errorf("%w: stanza %+v instead of %+v", ErrMismatch, stanza, v.Stanzas[i])
+		}
+	}
+
+	var decrypted bytes.Buffer
+	if err := tlock.New(network).Strict().Decrypt(&decrypted, bytes.NewReader(ciphertext)); err != nil {
+		return fmt.Errorf("decrypt: %w", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		return fmt.Errorf("%w: decrypted plaintext differs", ErrMismatch)
+	}
+
+	signature, _ := hex.DecodeString(v.Signature)
+	decrypted.Reset()
+	if err := tlock.DecryptBestEffort(&decrypted, bytes.NewReader(ciphertext), signature); err != nil {
+		return fmt.Errorf("best effort decrypt: %w", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		return fmt.Errorf("%w: best effort decrypted plaintext differs", ErrMismatch)
+	}
+
+	return nil
+}
+
+// encrypt encrypts the plaintext towards the rounds of the network.
+func encrypt(network *fixed.Network, roundNumbers []uint64, plaintext []byte, armored bool) ([]byte, error) {
+	var ciphertext bytes.Buffer
+	var dst io.Writer = &ciphertext
+	var a io.WriteCloser
+	if armored {
+		a = armor.NewWriter(&ciphertext)
+		dst = a
+	}
+
+	if err := tlock.New(network).EncryptRounds(dst, bytes.NewReader(plaintext), roundNumbers...); err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	if a != nil {
+		if err := a.Close(); err != nil {
+			return nil, fmt.Errorf("armor: %w", err)
+		}
+	}
+
+	return ciphertext.Bytes(), nil
+}
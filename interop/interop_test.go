@@ -0,0 +1,60 @@
+package interop_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drand/tlock/interop"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectors(t *testing.T) {
+	f, err := os.Open("testdata/vectors.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	file, err := interop.ReadFile(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, file.Vectors)
+
+	for _, vector := range file.Vectors {
+		t.Run(vector.Name, func(t *testing.T) {
+			require.NoError(t, vector.CheckDecrypt())
+			require.NoError(t, vector.CheckEncrypt())
+		})
+	}
+}
+
+func TestVectorMismatch(t *testing.T) {
+	f, err := os.Open("testdata/vectors.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	file, err := interop.ReadFile(f)
+	require.NoError(t, err)
+
+	vector := file.Vectors[0]
+	vector.Stanzas[0].Round++
+	require.ErrorIs(t, vector.CheckDecrypt(), interop.ErrMismatch)
+
+	vector = file.Vectors[1]
+	vector.Plaintext = strings.Repeat("00", 4)
+	require.ErrorIs(t, vector.CheckDecrypt(), interop.ErrMismatch)
+}
+
+func TestSuiteDeterministic(t *testing.T) {
+	first, err := interop.Suite()
+	require.NoError(t, err)
+	second, err := interop.Suite()
+	require.NoError(t, err)
+
+	require.Len(t, second.Vectors, len(first.Vectors))
+	for i, vector := range first.Vectors {
+		require.Equal(t, vector.Name, second.Vectors[i].Name)
+		require.JSONEq(t, string(vector.ChainInfo), string(second.Vectors[i].ChainInfo))
+		require.Equal(t, vector.Signature, second.Vectors[i].Signature)
+		require.Equal(t, vector.Stanzas, second.Vectors[i].Stanzas)
+		require.NoError(t, vector.CheckDecrypt())
+	}
+}
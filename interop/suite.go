@@ -0,0 +1,91 @@
+package interop
+
+import (
+	"fmt"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/xof/blake2xb"
+	"github.com/drand/tlock/networks/fixed"
+)
+
+// These are the rounds the vectors of the suite are encrypted towards, the
+// multi stanza ones also being encrypted towards the later round.
+const (
+	SuiteRound      = 1000
+	SuiteLaterRound = 2000
+)
+
+// Suite returns the vectors of every scheme supported by tlock, with binary
+// and armored ciphertexts holding a single or several stanzas. The secret keys
+// of their chains are derived from fixed seeds, so that the chain information
+// and signatures of the suite are the same on every run, while the
+// ciphertexts are randomized like any other.
+func Suite() (File, error) {
+	plaintexts := []struct {
+		name      string
+		plaintext []byte
+		armored   bool
+		rounds    []uint64
+	}{
+		{"empty", nil, false, []uint64{SuiteRound}},
+		{"text", []byte("hello world and other things\n"), true, []uint64{SuiteRound}},
+		{"binary", []byte{0x00, 0xff, 0x01, 0xfe, 0x7f, 0x80}, false, []uint64{SuiteRound}},
+		{"multi", []byte{0x00, 0xff, 0x01, 0xfe, 0x7f, 0x80}, false, []uint64{SuiteRound, SuiteLaterRound}},
+		{"multi-text", []byte("hello world and other things\n"), true, []uint64{SuiteRound, SuiteLaterRound}},
+	}
+
+	var file File
+	for _, newScheme := range []func() *crypto.Scheme{
+		crypto.NewPedersenBLSUnchainedG1,
+		crypto.NewPedersenBLSUnchainedSwapped,
+		crypto.NewPedersenBLSUnchained,
+	} {
+		scheme := newScheme()
+		network, signature, err := suiteChain(scheme, SuiteRound)
+		if err != nil {
+			return File{}, fmt.Errorf("%s: %w", scheme.Name, err)
+		}
+
+		for _, p := range plaintexts {
+			name := scheme.Name + "/" + p.name
+			vector, err := GenerateRounds(name, network, p.rounds, signature, p.plaintext, p.armored)
+			if err != nil {
+				return File{}, fmt.Errorf("%s: %w", name, err)
+			}
+			file.Vectors = append(file.Vectors, vector)
+		}
+	}
+
+	return file, nil
+}
+
+// suiteChain returns the network of the chain of the scheme whose secret key
+// is derived from its name, and the signature of the round.
+func suiteChain(scheme *crypto.Scheme, roundNumber uint64) (*fixed.Network, []byte, error) {
+	seed := blake2xb.New([]byte("tlock interop test vectors " + scheme.Name))
+	secret := scheme.KeyGroup.Scalar().Pick(seed)
+
+	info := &chaininfo.Info{
+		PublicKey:   scheme.KeyGroup.Point().Mul(secret, nil),
+		ID:          "interop",
+		Period:      3 * time.Second,
+		Scheme:      scheme.Name,
+		GenesisTime: 1692803367,
+		GenesisSeed: []byte("tlock interop test vectors chain"),
+	}
+
+	network, err := fixed.FromInfo(info, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign: %w", err)
+	}
+
+	return network, signature, nil
+}
@@ -0,0 +1,202 @@
+// Package mobile exposes tlock to Android and iOS applications through
+// gomobile:
+//
+//	gomobile bind -target=android ./mobile
+//	gomobile bind -target=ios ./mobile
+//
+// Its API only uses the types gomobile supports: the data is passed as byte
+// slices, the rounds as int64 and the headers through accessors instead of
+// slices of structs. Panics of the underlying implementation are returned as
+// errors, so that they don't crash the application.
+package mobile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"filippo.io/age/armor"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/duration"
+	"github.com/drand/tlock/networks/http"
+)
+
+// ErrInvalidRound represents an error when a round isn't a positive number.
+var ErrInvalidRound = errors.New("rounds must be positive numbers")
+
+// ErrStanzaIndex represents an error when a stanza of a header is requested
+// out of its range.
+var ErrStanzaIndex = errors.New("stanza index out of range")
+
+// IsTooEarly returns true if the error was returned by Decrypt because the
+// round of the ciphertext isn't reached yet.
+func IsTooEarly(err error) bool {
+	return errors.Is(err, tlock.ErrTooEarly)
+}
+
+// =============================================================================
+
+// Network is a drand network to timelock data with.
+type Network struct {
+	network tlock.Network
+}
+
+// NewHTTPNetwork constructs a network reading the chain of the chain hash from
+// the HTTP relay of the host, such as "https://api.drand.sh/".
+func NewHTTPNetwork(host string, chainHash string) (n *Network, err error) {
+	defer recoverError(&err)
+
+	network, err := http.NewNetwork(host, chainHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Network{network: network}, nil
+}
+
+// ChainHash returns the chain hash of the network.
+func (n *Network) ChainHash() string {
+	return n.network.ChainHash()
+}
+
+// RoundAt returns the round emitted by the network at the unix time, in
+// seconds.
+func (n *Network) RoundAt(unixTime int64) int64 {
+	return int64(n.network.Current(time.Unix(unixTime, 0)))
+}
+
+// RoundIn returns the round emitted by the network once the duration, in the
+// format of tle such as "1M2d", elapsed from now.
+func (n *Network) RoundIn(d string) (round int64, err error) {
+	defer recoverError(&err)
+
+	now := time.Now()
+	dur, err := duration.Parse(now, d)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(n.network.Current(now.Add(dur))), nil
+}
+
+// UnlockTime returns the unix time, in seconds, at which the round is emitted
+// by the network.
+func (n *Network) UnlockTime(round int64) (int64, error) {
+	if round <= 0 {
+		return 0, ErrInvalidRound
+	}
+
+	return n.network.TimeOf(uint64(round)).Unix(), nil
+}
+
+// Encrypt timelock encrypts the data towards the round, and returns the
+// ciphertext, armored if requested.
+func (n *Network) Encrypt(data []byte, round int64, armored bool) (ciphertext []byte, err error) {
+	defer recoverError(&err)
+
+	if round <= 0 {
+		return nil, ErrInvalidRound
+	}
+
+	var out bytes.Buffer
+	if !armored {
+		if err := tlock.New(n.network).Encrypt(&out, bytes.NewReader(data), uint64(round)); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	a := armor.NewWriter(&out)
+	if err := tlock.New(n.network).Encrypt(a, bytes.NewReader(data), uint64(round)); err != nil {
+		return nil, err
+	}
+	if err := a.Close(); err != nil {
+		return nil, fmt.Errorf("close armor: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Decrypt decrypts the armored or binary ciphertext, failing with an error
+// for which IsTooEarly is true before its round is reached.
+func (n *Network) Decrypt(ciphertext []byte) (data []byte, err error) {
+	defer recoverError(&err)
+
+	var out bytes.Buffer
+	if err := tlock.New(n.network).Decrypt(&out, bytes.NewReader(ciphertext)); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// =============================================================================
+
+// Header describes the timelock information of a ciphertext, see Inspect.
+type Header struct {
+	Armored bool
+
+	stanzas []tlock.Stanza
+}
+
+// Stanza describes a tlock stanza of a header.
+type Stanza struct {
+	Type      string
+	Round     int64
+	ChainHash string
+
+	// Chain is the name of the chain of the chain hash, and UnlockTime the
+	// unix time at which the round is emitted, when the chain is known.
+	Chain      string
+	UnlockTime int64
+}
+
+// Inspect parses the header of the armored or binary ciphertext, without any
+// network access.
+func Inspect(ciphertext []byte) (h *Header, err error) {
+	defer recoverError(&err)
+
+	header, err := tlock.ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Header{Armored: header.Armored, stanzas: header.Stanzas}, nil
+}
+
+// StanzaCount returns the number of tlock stanzas of the header.
+func (h *Header) StanzaCount() int {
+	return len(h.stanzas)
+}
+
+// Stanza returns the stanza of the header at the index.
+func (h *Header) Stanza(i int) (*Stanza, error) {
+	if i < 0 || i >= len(h.stanzas) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrStanzaIndex, i, len(h.stanzas))
+	}
+
+	s := h.stanzas[i]
+	if s.Round > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRound, s.Round)
+	}
+
+	stanza := Stanza{Type: s.Type, Round: int64(s.Round), ChainHash: s.ChainHash}
+	if known, ok := tlock.LookupChain(s.ChainHash); ok {
+		stanza.Chain = known.Name
+		stanza.UnlockTime = known.TimeOf(s.Round).Unix()
+	}
+
+	return &stanza, nil
+}
+
+// =============================================================================
+
+// recoverError turns a panic into the error, as panics aren't handled by the
+// bindings and would crash the application.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("tlock: %v", r)
+	}
+}
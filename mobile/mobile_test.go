@@ -0,0 +1,61 @@
+package mobile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drand/tlock/mobile"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := mobile.NewHTTPNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+	require.Equal(t, beacon.ChainHash(), network.ChainHash())
+
+	round, err := network.RoundIn("2s")
+	require.NoError(t, err)
+	require.Greater(t, round, network.RoundAt(time.Now().Unix()))
+
+	ciphertext, err := network.Encrypt([]byte("very nice"), round, true)
+	require.NoError(t, err)
+
+	header, err := mobile.Inspect(ciphertext)
+	require.NoError(t, err)
+	require.True(t, header.Armored)
+	require.Equal(t, 1, header.StanzaCount())
+	stanza, err := header.Stanza(0)
+	require.NoError(t, err)
+	require.Equal(t, round, stanza.Round)
+	require.Equal(t, beacon.ChainHash(), stanza.ChainHash)
+	_, err = header.Stanza(1)
+	require.ErrorIs(t, err, mobile.ErrStanzaIndex)
+
+	_, err = network.Decrypt(ciphertext)
+	require.True(t, mobile.IsTooEarly(err))
+
+	unlock, err := network.UnlockTime(round)
+	require.NoError(t, err)
+	time.Sleep(time.Until(time.Unix(unlock, 0)))
+
+	plaintext, err := network.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", string(plaintext))
+}
+
+func TestErrors(t *testing.T) {
+	_, err := mobile.NewHTTPNetwork("http://127.0.0.1:1", "")
+	require.Error(t, err)
+
+	_, err = (&mobile.Network{}).Encrypt([]byte("very nice"), 0, false)
+	require.ErrorIs(t, err, mobile.ErrInvalidRound)
+
+	_, err = mobile.Inspect([]byte("very nice"))
+	require.Error(t, err)
+}
@@ -2,10 +2,15 @@
 package fixed
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
 	"github.com/drand/drand/v2/crypto"
 
 	"github.com/drand/kyber"
@@ -19,13 +24,25 @@ type Network struct {
 	period    time.Duration
 	genesis   int64
 	fixedSig  []byte
+	info      *chaininfo.Info
+
+	mu         sync.RWMutex
+	signatures map[uint64][]byte
 }
 
 // ErrNotUnchained represents an error when the informed chain belongs to a
 // chained network.
 var ErrNotUnchained = errors.New("not an unchained network")
 
-// NewNetwork constructs a network with static, fixed data
+// ErrNoChainInfo represents an error when a network wasn't constructed from
+// chain information, which can't be rebuilt from its parameters alone.
+var ErrNoChainInfo = errors.New("network not constructed from chain information")
+
+// ErrNoSignature represents an error when no signature is known for a round.
+var ErrNoSignature = errors.New("no signature available for this round")
+
+// NewNetwork constructs a network with static, fixed data. If sig is not nil, it
+// is returned for any round that wasn't added using AddSignature.
 func NewNetwork(chainHash string, publicKey kyber.Point, sch *crypto.Scheme, period time.Duration, genesis int64, sig []byte) (*Network, error) {
 	switch sch.Name {
 	case crypto.ShortSigSchemeID:
@@ -36,15 +53,71 @@ func NewNetwork(chainHash string, publicKey kyber.Point, sch *crypto.Scheme, per
 	}
 
 	return &Network{
-		chainHash: chainHash,
-		publicKey: publicKey,
-		scheme:    sch,
-		period:    period,
-		genesis:   genesis,
-		fixedSig:  sig,
+		chainHash:  chainHash,
+		publicKey:  publicKey,
+		scheme:     sch,
+		period:     period,
+		genesis:    genesis,
+		fixedSig:   sig,
+		signatures: make(map[uint64][]byte),
 	}, nil
 }
 
+// FromInfo constructs a network from the chain information served by drand
+// relays on their /info endpoint, e.g. read with chain.InfoFromJSON. The chain
+// hash is computed from the information itself.
+func FromInfo(info *chaininfo.Info, sig []byte) (*Network, error) {
+	sch, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil {
+		return nil, ErrNotUnchained
+	}
+
+	network, err := NewNetwork(info.HashString(), info.PublicKey, sch, info.Period, info.GenesisTime, sig)
+	if err != nil {
+		return nil, err
+	}
+	network.info = info
+
+	return network, nil
+}
+
+// FromInfoWithSignatures constructs a network from the JSON chain information
+// served by drand relays, with the signatures of the given rounds, allowing to
+// decrypt ciphertexts towards these rounds later on without any networking.
+func FromInfoWithSignatures(infoJSON string, sigs map[uint64][]byte) (*Network, error) {
+	info, err := chaininfo.InfoFromJSON(strings.NewReader(infoJSON))
+	if err != nil {
+		return nil, fmt.Errorf("decoding chain info: %w", err)
+	}
+
+	network, err := FromInfo(info, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for round, sig := range sigs {
+		network.AddSignature(round, sig)
+	}
+
+	return network, nil
+}
+
+// MarshalInfo returns the JSON chain information the network was constructed
+// from, as accepted by FromInfoWithSignatures, including the genesis seed and
+// beacon ID it hashes to the chain hash with.
+func (n *Network) MarshalInfo() ([]byte, error) {
+	if n.info == nil {
+		return nil, ErrNoChainInfo
+	}
+
+	var buf bytes.Buffer
+	if err := n.info.ToJSON(&buf, nil); err != nil {
+		return nil, fmt.Errorf("encoding chain info: %w", err)
+	}
+
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
 // ChainHash returns the chain hash for this network.
 func (n *Network) ChainHash() string {
 	return n.chainHash
@@ -55,6 +128,21 @@ func (n *Network) Current(date time.Time) uint64 {
 	return chain.CurrentRound(date.Unix(), n.period, n.genesis)
 }
 
+// Period returns the frequency at which the network emits beacons.
+func (n *Network) Period() time.Duration {
+	return n.period
+}
+
+// GenesisTime returns the UNIX time of the first round of the network.
+func (n *Network) GenesisTime() int64 {
+	return n.genesis
+}
+
+// TimeOf returns the time at which the given round is emitted by the network.
+func (n *Network) TimeOf(roundNumber uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(n.period, n.genesis, roundNumber), 0)
+}
+
 // PublicKey returns the kyber point needed for encryption and decryption.
 func (n *Network) PublicKey() kyber.Point {
 	return n.publicKey
@@ -65,11 +153,45 @@ func (n *Network) Scheme() crypto.Scheme {
 	return *n.scheme
 }
 
-// Signature only returns a fixed signature if set with the fixed network
-func (n *Network) Signature(_ uint64) ([]byte, error) {
+// Signature returns the signature added for the given round, or the fixed
+// signature the network was constructed with if there is none.
+func (n *Network) Signature(roundNumber uint64) ([]byte, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if sig, ok := n.signatures[roundNumber]; ok {
+		return sig, nil
+	}
+
+	if n.fixedSig == nil {
+		return nil, fmt.Errorf("%w: round %d", ErrNoSignature, roundNumber)
+	}
+
 	return n.fixedSig, nil
 }
 
+// AddSignature stores the signature for the given round, allowing to decrypt
+// ciphertexts towards many different rounds without any networking.
+func (n *Network) AddSignature(roundNumber uint64, sig []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.signatures[roundNumber] = sig
+}
+
+// Signatures returns a copy of the signatures added using AddSignature.
+func (n *Network) Signatures() map[uint64][]byte {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	sigs := make(map[uint64][]byte, len(n.signatures))
+	for round, sig := range n.signatures {
+		sigs[round] = sig
+	}
+
+	return sigs
+}
+
 // RoundNumber will return the latest round of randomness that is available
 func (n *Network) RoundNumber(t time.Time) uint64 {
 	// + 1 because round 1 happened at genesis time
@@ -0,0 +1,130 @@
+package fixed_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	common "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+func TestSignatures(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	publicKey := scheme.KeyGroup.Point().Base()
+
+	t.Run("without fixed signature", func(t *testing.T) {
+		network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, 1692803367, nil)
+		require.NoError(t, err)
+
+		_, err = network.Signature(1)
+		require.ErrorIs(t, err, fixed.ErrNoSignature)
+
+		network.AddSignature(1, []byte("one"))
+		network.AddSignature(2, []byte("two"))
+
+		sig, err := network.Signature(1)
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), sig)
+
+		sig, err = network.Signature(2)
+		require.NoError(t, err)
+		require.Equal(t, []byte("two"), sig)
+
+		_, err = network.Signature(3)
+		require.ErrorIs(t, err, fixed.ErrNoSignature)
+	})
+
+	t.Run("with fixed signature", func(t *testing.T) {
+		network, err := fixed.NewNetwork(quicknet, publicKey, scheme, 3*time.Second, 1692803367, []byte("fixed"))
+		require.NoError(t, err)
+
+		network.AddSignature(1, []byte("one"))
+
+		sig, err := network.Signature(1)
+		require.NoError(t, err)
+		require.Equal(t, []byte("one"), sig)
+
+		sig, err = network.Signature(3)
+		require.NoError(t, err)
+		require.Equal(t, []byte("fixed"), sig)
+	})
+}
+
+func TestFromInfo(t *testing.T) {
+	f, err := os.Open("../../testdata/quicknet-info.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	info, err := chain.InfoFromJSON(f)
+	require.NoError(t, err)
+
+	network, err := fixed.FromInfo(info, nil)
+	require.NoError(t, err)
+	require.Equal(t, quicknet, network.ChainHash())
+	require.Equal(t, crypto.SigsOnG1ID, network.Scheme().Name)
+	require.Equal(t, 3*time.Second, network.Period())
+	require.Equal(t, int64(1692803367), network.GenesisTime())
+	require.True(t, network.PublicKey().Equal(info.PublicKey))
+
+	info.Scheme = "pedersen-bls-chained"
+	_, err = fixed.FromInfo(info, nil)
+	require.ErrorIs(t, err, fixed.ErrNotUnchained)
+}
+
+func TestFromInfoWithSignatures(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+
+	info := &chain.Info{
+		PublicKey:   scheme.KeyGroup.Point().Mul(secret, nil),
+		ID:          "test",
+		Period:      3 * time.Second,
+		Scheme:      scheme.Name,
+		GenesisTime: 1692803367,
+		GenesisSeed: []byte("seed"),
+	}
+	network, err := fixed.FromInfo(info, nil)
+	require.NoError(t, err)
+
+	roundNumber := uint64(1234)
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewBufferString("very nice"), roundNumber)
+	require.NoError(t, err)
+
+	infoJSON, err := network.MarshalInfo()
+	require.NoError(t, err)
+
+	sig, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&common.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	restored, err := fixed.FromInfoWithSignatures(string(infoJSON), map[uint64][]byte{roundNumber: sig})
+	require.NoError(t, err)
+	require.Equal(t, network.ChainHash(), restored.ChainHash())
+	require.Equal(t, map[uint64][]byte{roundNumber: sig}, restored.Signatures())
+
+	restoredJSON, err := restored.MarshalInfo()
+	require.NoError(t, err)
+	require.Equal(t, infoJSON, restoredJSON)
+
+	var plainData bytes.Buffer
+	err = tlock.New(restored).Strict().Decrypt(&plainData, &cipherData)
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+
+	_, err = fixed.FromInfoWithSignatures("{", nil)
+	require.Error(t, err)
+
+	bare, err := fixed.NewNetwork(quicknet, info.PublicKey, scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+	_, err = bare.MarshalInfo()
+	require.ErrorIs(t, err, fixed.ErrNoChainInfo)
+}
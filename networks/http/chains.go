@@ -0,0 +1,165 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock/networks/registry"
+)
+
+// ErrDeprecatedChain represents an error when encrypting towards a chain the
+// registry marks as deprecated.
+var ErrDeprecatedChain = errors.New("deprecated chain")
+
+// ChainError reports a chain which can't be used for timelock encryption,
+// either because it's a chained network or because it's deprecated, along
+// with the compatible chains of the same relay to use instead.
+type ChainError struct {
+	Host      string
+	ChainHash string
+	// Compatible lists the unchained chains of the relay which aren't
+	// deprecated, as found using its /chains endpoint, or in the registry if
+	// the relay doesn't list its chains.
+	Compatible []CompatibleChain
+
+	err error
+}
+
+// CompatibleChain is a chain to use instead of the one of a ChainError.
+type CompatibleChain struct {
+	Name      string
+	ChainHash string
+}
+
+// NewChainError returns the error of the chain of the relay, wrapping err,
+// e.g. ErrNotUnchained or ErrDeprecatedChain, and looks up the compatible
+// chains of the relay.
+func NewChainError(host string, chainHash string, err error) *ChainError {
+	if !strings.HasPrefix(host, "http") {
+		host = "https://" + host
+	}
+	host = strings.TrimSuffix(host, "/")
+
+	return &ChainError{
+		Host:       host,
+		ChainHash:  chainHash,
+		Compatible: compatibleChains(host, chainHash),
+		err:        err,
+	}
+}
+
+// Error implements the error interface.
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%v: %s on %s", e.err, e.ChainHash, e.Host)
+}
+
+// Unwrap returns the reason the chain can't be used.
+func (e *ChainError) Unwrap() error {
+	return e.err
+}
+
+// Suggestions returns the flags selecting each compatible chain of the relay,
+// e.g. "-n https://api.drand.sh -c 52db9b… (quicknet)".
+func (e *ChainError) Suggestions() []string {
+	suggestions := make([]string, 0, len(e.Compatible))
+	for _, c := range e.Compatible {
+		suggestion := fmt.Sprintf("-n %s -c %s", e.Host, c.ChainHash)
+		if c.Name != "" {
+			suggestion += " (" + c.Name + ")"
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions
+}
+
+// =============================================================================
+
+// compatibleChains returns the chains of the relay which can be encrypted
+// towards, other than the given one. It falls back to the chains of the
+// registry served by the relay if it doesn't list its chains.
+func compatibleChains(host string, chainHash string) []CompatibleChain {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tr, err := transport()
+	if err != nil {
+		return registryChains(host, chainHash)
+	}
+	client := &http.Client{Transport: &politeTransport{next: tr}}
+
+	var hashes []string
+	if err := getJSON(ctx, client, host+"/chains", &hashes); err != nil {
+		return registryChains(host, chainHash)
+	}
+
+	var compatible []CompatibleChain
+	for _, hash := range hashes {
+		if hash == chainHash {
+			continue
+		}
+		if c, ok := registry.Lookup(hash); ok && c.Deprecated {
+			continue
+		}
+
+		var raw json.RawMessage
+		if err := getJSON(ctx, client, host+"/"+hash+"/info", &raw); err != nil {
+			continue
+		}
+		info, err := chaininfo.InfoFromJSON(bytes.NewReader(raw))
+		if err != nil || !unchained(info.Scheme) {
+			continue
+		}
+
+		compatible = append(compatible, CompatibleChain{Name: info.ID, ChainHash: hash})
+	}
+
+	return compatible
+}
+
+// registryChains returns the chains of the registry served by the relay which
+// aren't deprecated, other than the given one.
+func registryChains(host string, chainHash string) []CompatibleChain {
+	var compatible []CompatibleChain
+	for _, c := range registry.Chains() {
+		if c.Host == host && !c.Deprecated && c.ChainHash() != chainHash {
+			compatible = append(compatible, CompatibleChain{Name: c.Name, ChainHash: c.ChainHash()})
+		}
+	}
+
+	return compatible
+}
+
+// unchained reports whether the scheme is the one of an unchained network,
+// which timelock encryption requires.
+func unchained(scheme string) bool {
+	return slices.Contains([]string{crypto.UnchainedSchemeID, crypto.ShortSigSchemeID, crypto.SigsOnG1ID}, scheme)
+}
+
+// getJSON decodes the json response to the GET request of the url.
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
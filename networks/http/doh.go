@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsMessageType is the media type of the DNS queries and answers exchanged
+// with a DNS-over-HTTPS resolver, see RFC 8484.
+const dnsMessageType = "application/dns-message"
+
+// maxDNSMessageSize is the maximum size of a DNS message.
+const maxDNSMessageSize = 65535
+
+// dohResolver resolves hostnames with a DNS-over-HTTPS resolver, so that the
+// local network can't observe which relays are resolved, and when.
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+}
+
+// newDoHResolver constructs a resolver querying the https endpoint, such as
+// "https://1.1.1.1/dns-query", through the transport. The hostname of the
+// endpoint itself is resolved by the system resolver, unless it's an IP
+// address.
+func newDoHResolver(endpoint string, tr *http.Transport) (*dohResolver, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q isn't an https URL", endpoint)
+	}
+
+	return &dohResolver{endpoint: endpoint, client: &http.Client{Transport: tr, Timeout: timeout}}, nil
+}
+
+// dialContext resolves the host of the address with the resolver, and dials
+// its addresses in turn with the dialer until one connects.
+func (r *dohResolver) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := netip.ParseAddr(host); err == nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addrs, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var errs []error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+
+		return nil, errors.Join(errs...)
+	}
+}
+
+// lookup returns the IPv4 and IPv6 addresses of the host.
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, err := r.query(ctx, host, qtype)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s over https: %w", host, err)
+		}
+		addrs = append(addrs, found...)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("resolving %s over https: no such host", host)
+	}
+
+	return addrs, nil
+}
+
+// query sends the query of the type for the host to the resolver, and returns
+// the addresses of its answer.
+func (r *dohResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	// the ID is zero, so that the answers can be cached by HTTP caches.
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.endpoint+"?dns="+base64.RawURLEncoding.EncodeToString(packed), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resolver answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var answer dnsmessage.Message
+	if err := answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("parsing answer: %w", err)
+	}
+	switch answer.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, fmt.Errorf("resolver answered %s", answer.RCode)
+	}
+
+	var addrs []netip.Addr
+	for _, rr := range answer.Answers {
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+		}
+	}
+
+	return addrs, nil
+}
@@ -3,6 +3,8 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -10,15 +12,20 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
 	"github.com/drand/drand/v2/crypto"
 
 	dhttp "github.com/drand/go-clients/client/http"
 	dclient "github.com/drand/go-clients/drand"
 	"github.com/drand/kyber"
+	"github.com/drand/tlock/networks/registry"
 )
 
 // timeout represents the maximum amount of time to wait for network operations.
@@ -28,6 +35,73 @@ const timeout = 5 * time.Second
 // chained network.
 var ErrNotUnchained = errors.New("not an unchained network")
 
+// ErrPinnedNetwork represents an error when switching the chain of a network
+// pinned to its chain information, which would trust the relay.
+var ErrPinnedNetwork = errors.New("the network is pinned to its chain information")
+
+// ErrRoundNotYetAvailable represents an error when the relay doesn't have the
+// signature of a round yet, which it will have once the round is emitted.
+var ErrRoundNotYetAvailable = errors.New("round not yet available")
+
+// ErrRelayUnavailable represents an error when the relay couldn't be reached
+// or failed to answer, such as a DNS failure, a timeout or a server error,
+// which may be worth retrying. Unlike other failures to get a signature, it
+// isn't reported as tlock.ErrTooEarly by the decryption.
+var ErrRelayUnavailable error = unavailableError("relay unavailable")
+
+// ErrInvalidBeacon represents an error when the signature served by the relay
+// doesn't verify against the public key of the chain, such as from a faulty or
+// malicious relay. Unlike ErrRelayUnavailable, it isn't worth retrying, and
+// like it, it isn't reported as tlock.ErrTooEarly by the decryption.
+var ErrInvalidBeacon error = untrustedError("invalid beacon")
+
+// unavailableError is an error reporting that the network couldn't be
+// reached, as recognized by the tlock package.
+type unavailableError string
+
+// Error implements the error interface.
+func (e unavailableError) Error() string {
+	return string(e)
+}
+
+// Unavailable reports that the network couldn't be reached.
+func (unavailableError) Unavailable() bool {
+	return true
+}
+
+// untrustedError is an error reporting that the network answered with data
+// which can't be trusted, as recognized by the tlock package.
+type untrustedError string
+
+// Error implements the error interface.
+func (e untrustedError) Error() string {
+	return string(e)
+}
+
+// Untrusted reports that the answer of the network can't be trusted.
+func (untrustedError) Untrusted() bool {
+	return true
+}
+
+// These environment variables configure the connections to the relay, on top
+// of the usual HTTP_PROXY, HTTPS_PROXY and NO_PROXY ones.
+const (
+	// EnvCAFile is the path to a PEM bundle of certificate authorities trusted
+	// in addition to the system ones, e.g. for corporate TLS interception.
+	EnvCAFile = "TLOCK_CA_FILE"
+	// EnvCertFile and EnvKeyFile are the paths to the PEM certificate and key
+	// presented to relays requiring mutual TLS.
+	EnvCertFile = "TLOCK_CERT_FILE"
+	EnvKeyFile  = "TLOCK_KEY_FILE"
+	// EnvDisableHTTP2 disables HTTP/2 when set to a true value.
+	EnvDisableHTTP2 = "TLOCK_DISABLE_HTTP2"
+	// EnvDoHResolver is the https URL of a DNS-over-HTTPS resolver, such as
+	// "https://1.1.1.1/dns-query", resolving the hostname of the relay instead
+	// of the system resolver, so that local DNS observers can't tell when it's
+	// contacted.
+	EnvDoHResolver = "TLOCK_DOH_RESOLVER"
+)
+
 // =============================================================================
 
 // Network represents the network support using the drand http client.
@@ -39,6 +113,12 @@ type Network struct {
 	scheme    crypto.Scheme
 	period    time.Duration
 	genesis   int64
+	info      *chaininfo.Info
+	rounds    RoundStore
+
+	// pinned prevents switching away from the chain information given to
+	// NewPinnedNetwork.
+	pinned bool
 }
 
 // NewNetwork constructs a network for use that will use the http client.
@@ -56,9 +136,14 @@ func NewNetwork(host string, chainHash string) (*Network, error) {
 		return nil, fmt.Errorf("decoding chain hash: %w", err)
 	}
 
-	client, err := dhttp.New(context.Background(), nil, host, hash, transport())
+	tr, err := transport()
 	if err != nil {
-		return nil, fmt.Errorf("creating client: %w", err)
+		return nil, fmt.Errorf("configuring transport: %w", err)
+	}
+
+	client, err := dhttp.New(context.Background(), nil, host, hash, &statusTransport{next: newMirrorTransport(host, &politeTransport{next: tr})})
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w%s", err, registryHint(host, chainHash))
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -66,16 +151,62 @@ func NewNetwork(host string, chainHash string) (*Network, error) {
 
 	info, err := client.Info(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("getting client information: %w", err)
+		return nil, fmt.Errorf("getting client information: %w%s", err, registryHint(host, chainHash))
+	}
+
+	// the relay can't serve another chain under a well-known chain hash.
+	if err := registry.Check(chainHash, info); err != nil {
+		return nil, err
 	}
 
 	sch, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil || !unchained(sch.Name) {
+		return nil, NewChainError(host, chainHash, ErrNotUnchained)
+	}
+
+	network := Network{
+		chainHash: chainHash,
+		host:      host,
+		client:    client,
+		publicKey: info.PublicKey,
+		scheme:    *sch,
+		period:    info.Period,
+		genesis:   info.GenesisTime,
+		info:      info,
+	}
+
+	return &network, nil
+}
+
+// NewPinnedNetwork constructs a network for use that will use the http client
+// with the given chain information, such as distributed out of band, instead
+// of the one served by the relay, which is never fetched: the signatures of the
+// relay are verified against the public key of that information. The network
+// can't be switched to another chain, which would trust the relay.
+func NewPinnedNetwork(host string, info *chaininfo.Info) (*Network, error) {
+	if !strings.HasPrefix(host, "http") {
+		host = "https://" + host
+	}
+	chainHash := info.HashString()
+
+	// the pinned information can't give another chain a well-known chain hash.
+	if err := registry.Check(chainHash, info); err != nil {
+		return nil, err
+	}
+
+	sch, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil || !unchained(sch.Name) {
+		return nil, NewChainError(host, chainHash, ErrNotUnchained)
+	}
+
+	tr, err := transport()
 	if err != nil {
-		return nil, ErrNotUnchained
+		return nil, fmt.Errorf("configuring transport: %w", err)
 	}
 
-	if !(sch.Name == crypto.UnchainedSchemeID || sch.Name == crypto.ShortSigSchemeID || sch.Name == crypto.SigsOnG1ID) {
-		return nil, ErrNotUnchained
+	client, err := dhttp.NewWithInfo(nil, host, info, &statusTransport{next: newMirrorTransport(host, &politeTransport{next: tr})})
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
 	}
 
 	network := Network{
@@ -86,11 +217,25 @@ func NewNetwork(host string, chainHash string) (*Network, error) {
 		scheme:    *sch,
 		period:    info.Period,
 		genesis:   info.GenesisTime,
+		info:      info,
+		pinned:    true,
 	}
 
 	return &network, nil
 }
 
+// NewClient returns an http client connecting like the networks do, through
+// the proxy, certificate authorities, client certificate, DNS resolver and
+// rate limit they are configured with.
+func NewClient() (*http.Client, error) {
+	tr, err := transport()
+	if err != nil {
+		return nil, fmt.Errorf("configuring transport: %w", err)
+	}
+
+	return &http.Client{Transport: &politeTransport{next: tr}, Timeout: timeout}, nil
+}
+
 // ChainHash returns the chain hash for this network.
 func (n *Network) ChainHash() string {
 	return n.chainHash
@@ -101,6 +246,11 @@ func (n *Network) Current(date time.Time) uint64 {
 	return chain.CurrentRound(date.Unix(), n.period, n.genesis)
 }
 
+// TimeOf returns the time at which the given round is emitted by the network.
+func (n *Network) TimeOf(roundNumber uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(n.period, n.genesis, roundNumber), 0)
+}
+
 // PublicKey returns the kyber point needed for encryption and decryption.
 func (n *Network) PublicKey() kyber.Point {
 	return n.publicKey
@@ -111,18 +261,110 @@ func (n *Network) Scheme() crypto.Scheme {
 	return n.scheme
 }
 
+// Period returns the frequency at which the network emits beacons.
+func (n *Network) Period() time.Duration {
+	return n.period
+}
+
+// GenesisTime returns the UNIX time of the first round of the network.
+func (n *Network) GenesisTime() int64 {
+	return n.genesis
+}
+
+// Info returns the chain information served by the relay, which hashes to
+// the chain hash of the network.
+func (n *Network) Info() *chaininfo.Info {
+	return n.info
+}
+
 // Signature makes a call to the network to retrieve the signature for the
-// specified round number.
+// specified round number. It fails with ErrRoundNotYetAvailable if the relay
+// doesn't have it yet, ErrRelayUnavailable if the relay couldn't serve it, and
+// ErrInvalidBeacon if the signature doesn't verify against the public key of
+// the chain, which is pinned by its chain hash.
 func (n *Network) Signature(roundNumber uint64) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
+	ctx, status := withStatus(ctx)
 
 	result, err := n.client.Get(ctx, roundNumber)
 	if err != nil {
+		err = signatureError(roundNumber, int(status.Load()), err)
+		// the latest round of the relay is then below the round.
+		if errors.Is(err, ErrRoundNotYetAvailable) && roundNumber > 0 {
+			if rollback := n.checkRollback(roundNumber - 1); rollback != nil {
+				return nil, rollback
+			}
+		}
+		return nil, err
+	}
+
+	// the round is the requested one, so that a relay can't serve the
+	// signature of another round instead.
+	beacon := chain.Beacon{
+		Round:       roundNumber,
+		Signature:   result.GetSignature(),
+		PreviousSig: result.GetPreviousSignature(),
+	}
+	if err := n.scheme.VerifyBeacon(&beacon, n.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: round %d: %w", ErrInvalidBeacon, roundNumber, err)
+	}
+	if err := n.observeRound(roundNumber); err != nil {
 		return nil, err
 	}
 
-	return result.GetSignature(), nil
+	return beacon.Signature, nil
+}
+
+// LatestRound makes a call to the network to retrieve its latest round. With a
+// round store, it fails with ErrRollback if the round is below the highest one
+// previously seen on the chain.
+func (n *Network) LatestRound() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := n.client.Get(ctx, 0)
+	if err != nil {
+		return 0, fmt.Errorf("fetching latest round: %w", err)
+	}
+
+	latest := result.GetRound()
+	if err := n.checkRollback(latest); err != nil {
+		return 0, err
+	}
+	if err := n.observeRound(latest); err != nil {
+		return 0, err
+	}
+
+	return latest, nil
+}
+
+// SetRoundStore records the rounds served by the relay in the store, and
+// refuses the answers of the relay going back below the highest round it
+// holds for the chain. A nil store, the default, disables the protection.
+func (n *Network) SetRoundStore(store RoundStore) {
+	n.rounds = store
+}
+
+// ClockSkew estimates how far the given time, such as the one of the local
+// clock, is from the time implied by the latest round served by the relay:
+// zero if it falls within the period of that round, and otherwise how far it
+// is from it, positive if the time is ahead. The estimate is only as accurate
+// as the period of the network.
+func (n *Network) ClockSkew(now time.Time) (time.Duration, error) {
+	latest, err := n.LatestRound()
+	if err != nil {
+		return 0, err
+	}
+
+	switch start, end := n.TimeOf(latest), n.TimeOf(latest+1); {
+	case now.Before(start):
+		return now.Sub(start), nil
+	case !now.Before(end):
+		return now.Sub(end), nil
+	}
+
+	return 0, nil
 }
 
 // RoundNumber will return the latest round of randomness that is available
@@ -132,30 +374,181 @@ func (n *Network) RoundNumber(t time.Time) uint64 {
 	return n.client.RoundAt(t)
 }
 
-// SwitchChainHash allows to start using another chainhash on the same host network
+// Clone returns a copy of the network, whose chain hash can be switched
+// without altering the network.
+func (n *Network) Clone() *Network {
+	clone := *n
+	return &clone
+}
+
+// SwitchChainHash allows to start using another chainhash on the same host
+// network. It fails with ErrPinnedNetwork if the network is pinned.
 func (n *Network) SwitchChainHash(new string) error {
+	if n.pinned {
+		return fmt.Errorf("%w: chain %s", ErrPinnedNetwork, n.chainHash)
+	}
+
 	test, err := NewNetwork(n.host, new)
 	if err != nil {
 		return err
 	}
+	test.rounds = n.rounds
 	*n = *test
 	return nil
 }
 
+// checkRollback fails with ErrRollback if the latest round of the relay is
+// below the highest round of the chain held by the round store.
+func (n *Network) checkRollback(latest uint64) error {
+	if n.rounds == nil {
+		return nil
+	}
+
+	highest, err := n.rounds.HighestRound(n.chainHash)
+	if err != nil {
+		return fmt.Errorf("reading highest round: %w", err)
+	}
+	if latest < highest {
+		return fmt.Errorf("%w: latest round %d is below round %d seen before", ErrRollback, latest, highest)
+	}
+
+	return nil
+}
+
+// observeRound records the round served by the relay in the round store.
+func (n *Network) observeRound(roundNumber uint64) error {
+	if n.rounds == nil {
+		return nil
+	}
+
+	if err := n.rounds.ObserveRound(n.chainHash, roundNumber); err != nil {
+		return fmt.Errorf("recording round: %w", err)
+	}
+
+	return nil
+}
+
 // =============================================================================
 
-// transport sets reasonable defaults for the connection.
-func transport() *http.Transport {
-	return &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   timeout,
-			KeepAlive: 5 * time.Second,
-		}).DialContext,
+// signatureError qualifies the failure of the drand client to get the
+// signature of the round from the relay, given the HTTP status of its
+// response, or 0 if it got none.
+func signatureError(roundNumber uint64, status int, err error) error {
+	var urlErr *url.Error
+	switch {
+	case status == http.StatusNotFound || status == http.StatusTooEarly:
+		return fmt.Errorf("%w: round %d: %w", ErrRoundNotYetAvailable, roundNumber, err)
+	case status != 0 || errors.As(err, &urlErr):
+		return fmt.Errorf("%w: round %d: %w", ErrRelayUnavailable, roundNumber, err)
+	default:
+		return err
+	}
+}
+
+// registryHint returns a hint naming the relay of the chain when it's a chain
+// of the registry served by another relay than the host, e.g. a testnet chain
+// requested from a mainnet relay.
+func registryHint(host string, chainHash string) string {
+	c, ok := registry.Lookup(chainHash)
+	if !ok || strings.TrimSuffix(host, "/") == c.Host {
+		return ""
+	}
+
+	return fmt.Sprintf(" (%s is the %s chain of %s, served by %s)", chainHash, c.Name, c.Network, c.Host)
+}
+
+// statusKey is the context key of the HTTP status recorded by
+// statusTransport.
+type statusKey struct{}
+
+// withStatus returns a context in which statusTransport records the HTTP
+// status of the last response to the requests of the drand client, which it
+// doesn't return along with its errors.
+func withStatus(ctx context.Context) (context.Context, *atomic.Int32) {
+	status := new(atomic.Int32)
+	return context.WithValue(ctx, statusKey{}, status), status
+}
+
+// statusTransport records the HTTP status of the responses in the context of
+// their request, when it was given by withStatus.
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if status, ok := req.Context().Value(statusKey{}).(*atomic.Int32); ok && resp != nil {
+		status.Store(int32(resp.StatusCode))
+	}
+
+	return resp, err
+}
+
+// transport sets reasonable defaults for the connection, and applies the
+// configuration found in the environment.
+func transport() (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 5 * time.Second,
+	}
+	tr := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          2,
 		IdleConnTimeout:       5 * time.Second,
 		TLSHandshakeTimeout:   5 * time.Second,
 		ExpectContinueTimeout: 2 * time.Second,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
 	}
+
+	if name := os.Getenv(EnvCAFile); name != "" {
+		pem, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", EnvCAFile, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s %q contains no PEM certificate", EnvCAFile, name)
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := os.Getenv(EnvCertFile), os.Getenv(EnvKeyFile)
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s and %s: %w", EnvCertFile, EnvKeyFile, err)
+		}
+		tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if v := os.Getenv(EnvDisableHTTP2); v != "" {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", EnvDisableHTTP2, err)
+		}
+		if disable {
+			// a non-nil empty map prevents the transport from negotiating HTTP/2.
+			tr.ForceAttemptHTTP2 = false
+			tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+	}
+
+	if endpoint := os.Getenv(EnvDoHResolver); endpoint != "" {
+		// the resolver is reached with the system resolver and the same TLS
+		// configuration.
+		resolver, err := newDoHResolver(endpoint, tr.Clone())
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", EnvDoHResolver, err)
+		}
+		tr.DialContext = resolver.dialContext(dialer)
+	}
+
+	return tr, nil
 }
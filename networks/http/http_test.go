@@ -0,0 +1,589 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestTransportCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("without the CA", func(t *testing.T) {
+		tr, err := transport()
+		require.NoError(t, err)
+
+		_, err = (&http.Client{Transport: tr}).Get(server.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("with the CA", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "ca.pem")
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		require.NoError(t, os.WriteFile(name, ca, 0600))
+		t.Setenv(EnvCAFile, name)
+
+		tr, err := transport()
+		require.NoError(t, err)
+
+		resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("with an invalid CA file", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(name, []byte("not a certificate"), 0600))
+		t.Setenv(EnvCAFile, name)
+
+		_, err := transport()
+		require.Error(t, err)
+	})
+}
+
+func TestTransportOptions(t *testing.T) {
+	t.Run("disable HTTP/2", func(t *testing.T) {
+		t.Setenv(EnvDisableHTTP2, "true")
+
+		tr, err := transport()
+		require.NoError(t, err)
+		require.False(t, tr.ForceAttemptHTTP2)
+		require.NotNil(t, tr.TLSNextProto)
+	})
+
+	t.Run("invalid HTTP/2 setting", func(t *testing.T) {
+		t.Setenv(EnvDisableHTTP2, "maybe")
+
+		_, err := transport()
+		require.Error(t, err)
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		t.Setenv(EnvCertFile, "cert.pem")
+
+		_, err := transport()
+		require.Error(t, err)
+	})
+
+	t.Run("plain http resolver", func(t *testing.T) {
+		t.Setenv(EnvDoHResolver, "http://1.1.1.1/dns-query")
+
+		_, err := transport()
+		require.Error(t, err)
+	})
+}
+
+func TestDoHResolver(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	var queries atomic.Int32
+	resolver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		var query dnsmessage.Message
+		packed, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err == nil {
+			err = query.Unpack(packed)
+		}
+		if err != nil || len(query.Questions) != 1 {
+			http.Error(w, "malformed query", http.StatusBadRequest)
+			return
+		}
+
+		answer := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: query.Questions,
+		}
+		if q := query.Questions[0]; q.Name.String() == "relay.test." {
+			answer.RCode = dnsmessage.RCodeSuccess
+			if q.Type == dnsmessage.TypeA {
+				answer.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+		}
+		packed, _ = answer.Pack()
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(packed)
+	}))
+	defer resolver.Close()
+
+	name := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: resolver.Certificate().Raw})
+	require.NoError(t, os.WriteFile(name, ca, 0600))
+	t.Setenv(EnvCAFile, name)
+	t.Setenv(EnvDoHResolver, resolver.URL+"/dns-query")
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(relay.URL, "http://"))
+	require.NoError(t, err)
+
+	network, err := NewNetwork("http://relay.test:"+port, beacon.ChainHash())
+	require.NoError(t, err)
+	_, err = network.Signature(1)
+	require.NoError(t, err)
+	require.Positive(t, queries.Load())
+
+	_, err = NewNetwork("http://unknown.test:"+port, beacon.ChainHash())
+	require.ErrorContains(t, err, "no such host")
+}
+
+func TestSignatureErrors(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	var failing atomic.Bool
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() && strings.Contains(r.URL.Path, "/public/") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		relay.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	network, err := NewNetwork(server.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	_, err = network.Signature(1)
+	require.NoError(t, err)
+
+	_, err = network.Signature(network.Current(time.Now()) + 10)
+	require.ErrorIs(t, err, ErrRoundNotYetAvailable)
+
+	failing.Store(true)
+	_, err = network.Signature(1)
+	require.ErrorIs(t, err, ErrRelayUnavailable)
+
+	server.Close()
+	_, err = network.Signature(1)
+	require.ErrorIs(t, err, ErrRelayUnavailable)
+	require.NotErrorIs(t, err, ErrRoundNotYetAvailable)
+}
+
+func TestInvalidBeacon(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	var forging atomic.Bool
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if forging.Load() && strings.HasSuffix(r.URL.Path, "/public/2") {
+			// serves the signature of round 1 instead.
+			r.URL.Path = strings.TrimSuffix(r.URL.Path, "2") + "1"
+		}
+		relay.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	network, err := NewNetwork(server.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	beacon.WaitFor(2)
+	signature, err := network.Signature(2)
+	require.NoError(t, err)
+	expected, err := beacon.Signature(2)
+	require.NoError(t, err)
+	require.Equal(t, expected, signature)
+
+	forging.Store(true)
+	_, err = network.Signature(2)
+	require.ErrorIs(t, err, ErrInvalidBeacon)
+	require.NotErrorIs(t, err, ErrRelayUnavailable)
+
+	// a forged signature isn't a temporary outage.
+	var unavailable interface{ Unavailable() bool }
+	require.False(t, errors.As(err, &unavailable))
+}
+
+func TestPinnedNetwork(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	b, err := beacon.MarshalInfo()
+	require.NoError(t, err)
+	info, err := chaininfo.InfoFromJSON(bytes.NewReader(b))
+	require.NoError(t, err)
+
+	// the pinned information is served under its chain hash, with the
+	// signatures of the beacon, but the relay reports another public key.
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	pinned := *info
+	pinned.PublicKey = scheme.KeyGroup.Point().Pick(random.New())
+	var infoRequests atomic.Int32
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			infoRequests.Add(1)
+		}
+		r.URL.Path = strings.Replace(r.URL.Path, pinned.HashString(), beacon.ChainHash(), 1)
+		relay.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	network, err := NewPinnedNetwork(server.URL, info)
+	require.NoError(t, err)
+	require.Equal(t, beacon.ChainHash(), network.ChainHash())
+	require.Equal(t, info, network.Info())
+
+	beacon.WaitFor(1)
+	signature, err := network.Signature(1)
+	require.NoError(t, err)
+	expected, err := beacon.Signature(1)
+	require.NoError(t, err)
+	require.Equal(t, expected, signature)
+
+	// the signatures are verified against the pinned public key only.
+	network, err = NewPinnedNetwork(server.URL, &pinned)
+	require.NoError(t, err)
+	require.Equal(t, pinned.HashString(), network.ChainHash())
+	_, err = network.Signature(1)
+	require.ErrorIs(t, err, ErrInvalidBeacon)
+	require.Zero(t, infoRequests.Load())
+
+	// switching chains would trust the relay.
+	require.ErrorIs(t, network.Clone().SwitchChainHash(beacon.ChainHash()), ErrPinnedNetwork)
+	require.Zero(t, infoRequests.Load())
+
+	chained := *info
+	chained.Scheme = crypto.DefaultSchemeID
+	_, err = NewPinnedNetwork(server.URL, &chained)
+	require.ErrorIs(t, err, ErrNotUnchained)
+}
+
+func TestRollback(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	var rolledBack atomic.Bool
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rolledBack.Load() {
+			switch {
+			case strings.HasSuffix(r.URL.Path, "/public/latest"):
+				r.URL.Path = strings.TrimSuffix(r.URL.Path, "latest") + "1"
+			case strings.Contains(r.URL.Path, "/public/") && !strings.HasSuffix(r.URL.Path, "/public/1"):
+				http.NotFound(w, r)
+				return
+			}
+		}
+		relay.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	name := filepath.Join(t.TempDir(), "rounds.json")
+	store, err := NewFileRoundStore(name)
+	require.NoError(t, err)
+
+	network, err := NewNetwork(server.URL, beacon.ChainHash())
+	require.NoError(t, err)
+	network.SetRoundStore(store)
+
+	beacon.WaitFor(2)
+	_, err = network.Signature(2)
+	require.NoError(t, err)
+
+	rolledBack.Store(true)
+	_, err = network.Signature(1)
+	require.NoError(t, err)
+	_, err = network.Signature(2)
+	require.ErrorIs(t, err, ErrRollback)
+	_, err = network.LatestRound()
+	require.ErrorIs(t, err, ErrRollback)
+
+	// the round survives the restarts.
+	store, err = NewFileRoundStore(name)
+	require.NoError(t, err)
+	highest, err := store.HighestRound(beacon.ChainHash())
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), highest)
+
+	// a round not available yet isn't a rollback.
+	rolledBack.Store(false)
+	network.SetRoundStore(store)
+	_, err = network.Signature(network.Current(time.Now()) + 10)
+	require.ErrorIs(t, err, ErrRoundNotYetAvailable)
+	require.NotErrorIs(t, err, ErrRollback)
+}
+
+func TestRegistryHint(t *testing.T) {
+	const quicknetT = "cc9c398442737cbd141526600919edd69f1d6f9b4adb67e4d912fbc64341a9a5"
+
+	require.Contains(t, registryHint("https://api.drand.sh", quicknetT), "served by https://pl-us.testnet.drand.sh")
+	require.Empty(t, registryHint("https://pl-us.testnet.drand.sh/", quicknetT))
+	require.Empty(t, registryHint("https://api.drand.sh", "7672797f548f3f4748ac4bf3352fc6c6b6468c9ad40ad456a397545c6e2df5bf"))
+}
+
+func TestClockSkew(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	skew, err := network.ClockSkew(time.Now())
+	require.NoError(t, err)
+	require.LessOrEqual(t, skew.Abs(), network.Period())
+
+	skew, err = network.ClockSkew(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.InDelta(t, time.Minute, skew, float64(2*network.Period()))
+
+	skew, err = network.ClockSkew(time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.InDelta(t, -time.Minute, skew, float64(2*network.Period()))
+
+	relay.Close()
+	_, err = network.ClockSkew(time.Now())
+	require.Error(t, err)
+}
+
+func TestRateLimitedRelay(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	var limited, requests atomic.Int32
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/public/") {
+			requests.Add(1)
+			if limited.Add(-1) >= 0 {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+		}
+		relay.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	network, err := NewNetwork(server.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	limited.Store(2)
+	_, err = network.Signature(1)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), requests.Load())
+
+	limited.Store(maxRetries + 1)
+	_, err = network.Signature(1)
+	require.ErrorIs(t, err, ErrRelayUnavailable)
+}
+
+func TestSetMaxRPS(t *testing.T) {
+	SetMaxRPS(20)
+	defer SetMaxRPS(0)
+
+	start := time.Now()
+	for range 4 {
+		require.NoError(t, relayLimiter.wait(context.Background()))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, relayLimiter.wait(ctx), context.Canceled)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	require.Equal(t, 5*time.Second, retryAfter("5", now, 1))
+	require.Equal(t, 10*time.Second, retryAfter(now.Add(10*time.Second).UTC().Format(http.TimeFormat), now.Truncate(time.Second), 1))
+	require.Equal(t, time.Duration(0), retryAfter(now.Add(-time.Hour).UTC().Format(http.TimeFormat), now, 1))
+	require.Equal(t, 2*time.Second, retryAfter("", now, 2))
+}
+
+func TestChainError(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	scheme := crypto.NewPedersenBLSChained()
+	chained := chaininfo.Info{
+		PublicKey:   scheme.KeyGroup.Point().Pick(random.New()),
+		ID:          "default",
+		Period:      30 * time.Second,
+		Scheme:      scheme.Name,
+		GenesisTime: time.Now().Add(-time.Hour).Unix(),
+		GenesisSeed: []byte("chained"),
+	}
+	var info bytes.Buffer
+	require.NoError(t, chained.ToJSON(&info, nil))
+
+	relay := testsupport.Handler(beacon)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chains":
+			w.Write([]byte(`["` + chained.HashString() + `", "` + beacon.ChainHash() + `"]`))
+		case "/" + chained.HashString() + "/info":
+			w.Write(info.Bytes())
+		default:
+			relay.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	_, err = NewNetwork(server.URL, chained.HashString())
+	require.ErrorIs(t, err, ErrNotUnchained)
+
+	var chainErr *ChainError
+	require.ErrorAs(t, err, &chainErr)
+	require.Equal(t, []CompatibleChain{{Name: "testnet", ChainHash: beacon.ChainHash()}}, chainErr.Compatible)
+	require.Equal(t, []string{"-n " + server.URL + " -c " + beacon.ChainHash() + " (testnet)"}, chainErr.Suggestions())
+
+	// relays which don't list their chains fall back to the registry.
+	const fastnet = "dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493"
+	require.Equal(t, []CompatibleChain{{Name: "quicknet", ChainHash: "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"}},
+		registryChains("https://api.drand.sh", fastnet))
+}
+
+func TestMirrors(t *testing.T) {
+	defer SetMirrors(DefaultMirrors, false)
+
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	var failures atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		failures.Add(1)
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	t.Run("without mirrors", func(t *testing.T) {
+		SetMirrors(nil, false)
+		_, err := NewNetwork(closed.URL, beacon.ChainHash())
+		require.Error(t, err)
+	})
+
+	t.Run("failing over", func(t *testing.T) {
+		SetMirrors([]string{closed.URL, failing.URL, relay.URL + "/"}, false)
+		network, err := NewNetwork(closed.URL, beacon.ChainHash())
+		require.NoError(t, err)
+		require.Equal(t, int32(1), failures.Load())
+
+		// the mirror answering last answers the next requests.
+		_, err = network.Signature(1)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), failures.Load())
+	})
+
+	t.Run("host not mirrored", func(t *testing.T) {
+		SetMirrors([]string{failing.URL, relay.URL}, false)
+		_, err := NewNetwork(closed.URL, beacon.ChainHash())
+		require.Error(t, err)
+	})
+
+	t.Run("shuffled", func(t *testing.T) {
+		SetMirrors([]string{closed.URL, failing.URL, relay.URL}, true)
+		for range 5 {
+			network, err := NewNetwork(failing.URL, beacon.ChainHash())
+			require.NoError(t, err)
+			_, err = network.Signature(1)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("all failing", func(t *testing.T) {
+		SetMirrors([]string{closed.URL, failing.URL}, false)
+		_, err := NewNetwork(closed.URL, beacon.ChainHash())
+		require.Error(t, err)
+	})
+}
+
+func TestMirrorsOf(t *testing.T) {
+	mirrors := mirrorsOf("https://api2.drand.sh/")
+	require.Len(t, mirrors, len(DefaultMirrors))
+	require.Equal(t, "https://api2.drand.sh", mirrors[0].String())
+	require.Equal(t, "https://api.drand.sh", mirrors[1].String())
+
+	require.Nil(t, mirrorsOf("https://relay.example.com"))
+}
+
+func TestWatch(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	beacons, err := network.Watch(ctx)
+	require.NoError(t, err)
+
+	scheme := network.Scheme()
+	first := <-beacons
+	require.NoError(t, scheme.VerifyBeacon(&first, network.PublicKey()))
+	second := <-beacons
+	require.Equal(t, first.Round+1, second.Round)
+	require.Less(t, time.Since(beacon.TimeOf(second.Round)), testsupport.DefaultPeriod)
+
+	cancel()
+	for range beacons {
+	}
+
+	_, err = network.Watch(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNotifier(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifier, err := network.Notify(ctx)
+	require.NoError(t, err)
+
+	scheme := network.Scheme()
+	reached := make(chan chain.Beacon, 2)
+	next := beacon.Current(time.Now()) + 1
+	notifier.OnRound(next, func(b chain.Beacon) { reached <- b })
+	notifier.OnRound(1, func(b chain.Beacon) { reached <- b })
+
+	past := <-reached
+	require.Equal(t, uint64(1), past.Round)
+	require.NoError(t, scheme.VerifyBeacon(&past, network.PublicKey()))
+
+	future := <-reached
+	require.Equal(t, next, future.Round)
+	require.NoError(t, scheme.VerifyBeacon(&future, network.PublicKey()))
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMirrors are the relays of the League of Entropy, which serve the same
+// chains and mirror each other, see SetMirrors.
+var DefaultMirrors = []string{
+	"https://api.drand.sh",
+	"https://api2.drand.sh",
+	"https://api3.drand.sh",
+	"https://drand.cloudflare.com",
+}
+
+// mirrorSet holds the mirrors the networks fail over to.
+var mirrorSet = struct {
+	mu      sync.Mutex
+	hosts   []string
+	shuffle bool
+}{hosts: DefaultMirrors}
+
+// SetMirrors sets the relays mirroring each other, which the networks
+// constructed afterwards fail over to when their host is one of them and
+// fails to answer, such as on a connection error or a server error. The
+// mirrors are tried in order after the host, or in a random order starting at
+// a random mirror with shuffle, to spread the load of the networks. An empty
+// list disables the failover, and DefaultMirrors, the default, restores it.
+//
+// The signatures served by the mirrors are verified against the public key of
+// the chain, so that a mirror is trusted as little as the host.
+func SetMirrors(hosts []string, shuffle bool) {
+	mirrorSet.mu.Lock()
+	defer mirrorSet.mu.Unlock()
+
+	mirrorSet.hosts = slices.Clone(hosts)
+	mirrorSet.shuffle = shuffle
+}
+
+// mirrorsOf returns the mirrors to try for the host, in order, or nil when the
+// host isn't one of the mirrors.
+func mirrorsOf(host string) []*url.URL {
+	mirrorSet.mu.Lock()
+	hosts, shuffle := mirrorSet.hosts, mirrorSet.shuffle
+	mirrorSet.mu.Unlock()
+
+	host = strings.TrimSuffix(host, "/")
+	i := slices.IndexFunc(hosts, func(mirror string) bool {
+		return strings.TrimSuffix(mirror, "/") == host
+	})
+	if i < 0 || len(hosts) < 2 {
+		return nil
+	}
+
+	// the host comes first, unless the mirrors are shuffled.
+	ordered := append([]string{hosts[i]}, slices.Delete(slices.Clone(hosts), i, i+1)...)
+	if shuffle {
+		rand.Shuffle(len(ordered), func(i, j int) {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		})
+	}
+
+	mirrors := make([]*url.URL, 0, len(ordered))
+	for _, mirror := range ordered {
+		u, err := url.Parse(strings.TrimSuffix(mirror, "/"))
+		if err != nil {
+			continue
+		}
+		mirrors = append(mirrors, u)
+	}
+
+	return mirrors
+}
+
+// =============================================================================
+
+// mirrorTransport sends the requests built for the host by the drand client to
+// the mirror answering last, and to the next mirrors when it fails to answer.
+type mirrorTransport struct {
+	next    http.RoundTripper
+	host    *url.URL
+	mirrors []*url.URL
+	current atomic.Int32
+}
+
+// newMirrorTransport returns a transport failing over to the mirrors of the
+// host, or the transport itself when the host has no mirrors.
+func newMirrorTransport(host string, next http.RoundTripper) http.RoundTripper {
+	mirrors := mirrorsOf(host)
+	if mirrors == nil {
+		return next
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(host, "/"))
+	if err != nil {
+		return next
+	}
+
+	return &mirrorTransport{next: next, host: base, mirrors: mirrors}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		// the body can't be sent again to another mirror.
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	start := int(t.current.Load())
+
+	var resp *http.Response
+	var err error
+	for attempt := range t.mirrors {
+		i := (start + attempt) % len(t.mirrors)
+		resp, err = t.next.RoundTrip(t.rebase(req, t.mirrors[i]))
+		if !failed(resp, err) {
+			t.current.Store(int32(i))
+			return resp, nil
+		}
+
+		// the next requests start at the next mirror, even when the deadline
+		// of this one doesn't leave time to try it.
+		next := (i + 1) % len(t.mirrors)
+		t.current.CompareAndSwap(int32(i), int32(next))
+		if ctx.Err() != nil || attempt == len(t.mirrors)-1 {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+
+	return resp, err
+}
+
+// rebase returns a copy of the request built for the host, sent to the mirror.
+func (t *mirrorTransport) rebase(req *http.Request, mirror *url.URL) *http.Request {
+	if mirror.String() == t.host.String() {
+		return req
+	}
+
+	r := req.Clone(req.Context())
+	r.Host = ""
+	r.URL.Scheme = mirror.Scheme
+	r.URL.Host = mirror.Host
+	r.URL.Path = mirror.Path + strings.TrimPrefix(req.URL.Path, t.host.Path)
+	r.URL.RawPath = ""
+
+	return r
+}
+
+// failed reports whether the mirror failed to answer the request, so that
+// another mirror may answer it.
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
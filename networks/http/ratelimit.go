@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRetries is how many times a request rate limited by the relay is retried.
+const maxRetries = 3
+
+// relayLimiter spaces the requests of all the networks to their relays.
+var relayLimiter limiter
+
+// SetMaxRPS limits the requests of all the networks to their relays, such as
+// the fetches of signatures and chain information, to rps requests per second
+// on average, shared by all the goroutines. Zero, the default, removes the
+// limit.
+func SetMaxRPS(rps float64) {
+	relayLimiter.set(rps)
+}
+
+// limiter is a token bucket holding a single token, so that requests are
+// evenly spaced. It is safe for concurrent use.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// set changes the rate of the limiter, in tokens per second.
+func (l *limiter) set(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = max(rate, 0)
+	l.tokens = 1
+	l.last = time.Now()
+}
+
+// wait blocks until a token is available, or until the context is done. The
+// token is taken right away, so that concurrent waits are served in order.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	l.tokens = min(1, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// =============================================================================
+
+// politeTransport waits for the relay limiter before each request, and
+// retries the requests rate limited by the relay once the delay given by their
+// Retry-After header elapsed, as long as it doesn't exceed their deadline.
+type politeTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		if err := relayLimiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt > maxRetries {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			// the body was consumed by the first attempt.
+			return resp, nil
+		}
+
+		delay := retryAfter(resp.Header.Get("Retry-After"), time.Now(), attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter returns the delay given by the Retry-After header, either in
+// seconds or as a date, or a delay growing with the attempts without it.
+func retryAfter(header string, now time.Time, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return time.Duration(attempt) * time.Second
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrRollback represents an error when the relay claims a round isn't
+// available yet, or serves a latest round, below the highest round it was
+// previously seen serving for the chain, such as after a rollback of the relay
+// or a replay of its old responses. Like ErrInvalidBeacon, it isn't reported
+// as tlock.ErrTooEarly by the decryption.
+var ErrRollback error = untrustedError("relay rolled back")
+
+// RoundStore records the highest round observed on each chain, so that a
+// network can detect a relay rolling back. It must be safe for concurrent use.
+type RoundStore interface {
+	// HighestRound returns the highest round recorded for the chain, or 0.
+	HighestRound(chainHash string) (uint64, error)
+	// ObserveRound records the round for the chain if it's the highest one.
+	ObserveRound(chainHash string, round uint64) error
+}
+
+// =============================================================================
+
+// FileRoundStore is a RoundStore persisted in a json file, which survives the
+// restarts of long-running processes.
+type FileRoundStore struct {
+	name   string
+	mu     sync.Mutex
+	rounds map[string]uint64
+}
+
+// NewFileRoundStore returns a store persisted in the named file, loading the
+// rounds it holds if it exists.
+func NewFileRoundStore(name string) (*FileRoundStore, error) {
+	s := FileRoundStore{
+		name:   name,
+		rounds: make(map[string]uint64),
+	}
+
+	b, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &s, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading rounds: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &s.rounds); err != nil {
+		return nil, fmt.Errorf("decoding rounds %q: %w", name, err)
+	}
+	if s.rounds == nil {
+		s.rounds = make(map[string]uint64)
+	}
+
+	return &s, nil
+}
+
+// HighestRound implements the RoundStore interface.
+func (s *FileRoundStore) HighestRound(chainHash string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rounds[chainHash], nil
+}
+
+// ObserveRound implements the RoundStore interface. The file is only written
+// when the round is higher than the recorded one.
+func (s *FileRoundStore) ObserveRound(chainHash string, round uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if round <= s.rounds[chainHash] {
+		return nil
+	}
+
+	previous := s.rounds[chainHash]
+	s.rounds[chainHash] = round
+	if err := s.save(); err != nil {
+		s.rounds[chainHash] = previous
+		return err
+	}
+
+	return nil
+}
+
+// save atomically replaces the file with the recorded rounds.
+func (s *FileRoundStore) save() error {
+	b, err := json.MarshalIndent(s.rounds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding rounds: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.name), "."+filepath.Base(s.name)+".*")
+	if err != nil {
+		return fmt.Errorf("writing rounds: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing rounds: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing rounds: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.name); err != nil {
+		return fmt.Errorf("writing rounds: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+)
+
+// These bound the delay between the polls of the relay for the beacon of a
+// round just emitted, which it may take a moment to serve.
+const (
+	minWatchPoll = 50 * time.Millisecond
+	maxWatchPoll = time.Second
+)
+
+// Watch returns the beacons of the chain from the next round onwards, until
+// the context is done, when the channel is closed. The relays don't stream
+// the beacons, so the beacon of each round is fetched as soon as the round is
+// emitted, polling the relay until it serves it, and verified like Signature.
+// A round whose beacon isn't served within the period, or is refused, is
+// skipped, as are the rounds emitted while the channel wasn't read.
+func (n *Network) Watch(ctx context.Context) (<-chan chain.Beacon, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	beacons := make(chan chain.Beacon)
+	go func() {
+		defer close(beacons)
+
+		next := n.Current(time.Now()) + 1
+		for {
+			if !sleepUntil(ctx, n.TimeOf(next)) {
+				return
+			}
+
+			signature, err := n.awaitSignature(ctx, next)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				select {
+				case beacons <- chain.Beacon{Round: next, Signature: signature}:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			next = max(next+1, n.Current(time.Now())+1)
+		}
+	}()
+
+	return beacons, nil
+}
+
+// awaitSignature polls the relay for the signature of the round just emitted,
+// until it serves it or the period of the round elapses.
+func (n *Network) awaitSignature(ctx context.Context, roundNumber uint64) ([]byte, error) {
+	deadline := n.TimeOf(roundNumber).Add(n.period)
+
+	for delay := minWatchPoll; ; delay = min(2*delay, maxWatchPoll) {
+		signature, err := n.Signature(roundNumber)
+		if err == nil || !errors.Is(err, ErrRoundNotYetAvailable) && !errors.Is(err, ErrRelayUnavailable) {
+			return signature, err
+		}
+		if time.Now().Add(delay).After(deadline) || !sleepUntil(ctx, time.Now().Add(delay)) {
+			return nil, err
+		}
+	}
+}
+
+// sleepUntil waits until the time, and returns false if the context is done
+// before.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// =============================================================================
+
+// Notifier calls the callbacks registered for rounds as soon as their beacon
+// is watched, such as to decrypt the ciphertexts of a scheduler the instant
+// they unlock. It is safe for concurrent use.
+type Notifier struct {
+	network *Network
+
+	mu        sync.Mutex
+	callbacks map[uint64][]func(chain.Beacon)
+}
+
+// Notify watches the beacons of the network until the context is done, and
+// returns the notifier calling the callbacks registered for their rounds.
+func (n *Network) Notify(ctx context.Context) (*Notifier, error) {
+	beacons, err := n.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier := Notifier{
+		network:   n,
+		callbacks: make(map[uint64][]func(chain.Beacon)),
+	}
+	go func() {
+		for beacon := range beacons {
+			notifier.reached(beacon)
+		}
+	}()
+
+	return &notifier, nil
+}
+
+// OnRound registers the callback to be called once with the beacon of the
+// round, from a goroutine of the notifier, as soon as it's watched. The beacon
+// of a round already emitted is fetched right away. The callbacks of the rounds
+// skipped by the watch are called once their beacon is fetched, when a later
+// round is watched.
+func (w *Notifier) OnRound(roundNumber uint64, callback func(chain.Beacon)) {
+	w.mu.Lock()
+	w.callbacks[roundNumber] = append(w.callbacks[roundNumber], callback)
+	w.mu.Unlock()
+
+	if roundNumber <= w.network.Current(time.Now()) {
+		go w.fetch(roundNumber)
+	}
+}
+
+// reached calls the callbacks of the round of the beacon, and fetches the
+// beacons of the earlier rounds still having callbacks.
+func (w *Notifier) reached(beacon chain.Beacon) {
+	w.mu.Lock()
+	callbacks := w.callbacks[beacon.Round]
+	delete(w.callbacks, beacon.Round)
+	var missed []uint64
+	for roundNumber := range w.callbacks {
+		if roundNumber < beacon.Round {
+			missed = append(missed, roundNumber)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(beacon)
+	}
+	for _, roundNumber := range missed {
+		go w.fetch(roundNumber)
+	}
+}
+
+// fetch calls the callbacks of the round with its beacon fetched from the
+// network. On failure, they're kept for the next watched round to retry.
+func (w *Notifier) fetch(roundNumber uint64) {
+	signature, err := w.network.Signature(roundNumber)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	callbacks := w.callbacks[roundNumber]
+	delete(w.callbacks, roundNumber)
+	w.mu.Unlock()
+
+	beacon := chain.Beacon{Round: roundNumber, Signature: signature}
+	for _, callback := range callbacks {
+		callback(beacon)
+	}
+}
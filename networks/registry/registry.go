@@ -0,0 +1,137 @@
+// Package registry holds the chain information of the well-known drand chains,
+// embedded at build time, so that they can be used without network access and
+// the chain information served by relays can be checked against it.
+package registry
+
+import (
+	"bytes"
+	_ "embed" // Embeds the registry.
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	chaininfo "github.com/drand/drand/v2/common/chain"
+)
+
+// ErrInfoMismatch represents an error when the chain information served for a
+// chain differs from the one pinned by the registry.
+var ErrInfoMismatch = errors.New("chain information doesn't match the registry")
+
+//go:embed chains.json
+var chainsJSON []byte
+
+// Chain is a well-known chain, along with its pinned chain information.
+type Chain struct {
+	// Name is the beacon ID of the chain, e.g. quicknet.
+	Name string
+	// Network is the League of Entropy network running the chain, either
+	// mainnet or testnet.
+	Network string
+	// Host is a relay serving the chain.
+	Host string
+	// Deprecated chains should no longer be encrypted towards.
+	Deprecated bool
+	// Info is the chain information, which hashes to the chain hash.
+	Info *chaininfo.Info
+}
+
+// ChainHash returns the chain hash of the chain.
+func (c Chain) ChainHash() string {
+	return c.Info.HashString()
+}
+
+// Version is the version of the embedded registry, increased whenever chains
+// are added, deprecated or removed.
+var Version int
+
+// chains are the chains of the embedded registry, in the order of the file.
+var chains []Chain
+
+func init() {
+	var err error
+	if Version, chains, err = parse(chainsJSON); err != nil {
+		panic(fmt.Sprintf("registry: %v", err))
+	}
+}
+
+// Chains returns the chains of the registry.
+func Chains() []Chain {
+	return append([]Chain(nil), chains...)
+}
+
+// Lookup returns the chain of the registry with the chain hash, if any.
+func Lookup(chainHash string) (Chain, bool) {
+	for _, c := range chains {
+		if c.ChainHash() == chainHash {
+			return c, true
+		}
+	}
+
+	return Chain{}, false
+}
+
+// Check verifies that the chain information served by a relay for the chain
+// hash matches the one pinned by the registry. Chains missing from the
+// registry aren't checked.
+func Check(chainHash string, info *chaininfo.Info) error {
+	c, ok := Lookup(chainHash)
+	if !ok {
+		return nil
+	}
+
+	pinned := c.Info
+	if info.HashString() != chainHash || !info.PublicKey.Equal(pinned.PublicKey) || info.Period != pinned.Period ||
+		info.GenesisTime != pinned.GenesisTime || info.Scheme != pinned.Scheme {
+		return fmt.Errorf("%w: %s of %s", ErrInfoMismatch, c.Name, c.Network)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// parse decodes the registry, checking that the chain information of each
+// chain hashes to its chain hash.
+func parse(b []byte) (int, []Chain, error) {
+	var registry struct {
+		Version int `json:"version"`
+		Chains  []struct {
+			Name       string          `json:"name"`
+			Network    string          `json:"network"`
+			Host       string          `json:"host"`
+			Deprecated bool            `json:"deprecated"`
+			Info       json.RawMessage `json:"info"`
+		} `json:"chains"`
+	}
+	if err := json.Unmarshal(b, &registry); err != nil {
+		return 0, nil, fmt.Errorf("decoding: %w", err)
+	}
+
+	var chains []Chain
+	for _, c := range registry.Chains {
+		info, err := chaininfo.InfoFromJSON(bytes.NewReader(c.Info))
+		if err != nil {
+			return 0, nil, fmt.Errorf("chain information of %s: %w", c.Name, err)
+		}
+
+		var hash struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(c.Info, &hash); err != nil {
+			return 0, nil, fmt.Errorf("chain information of %s: %w", c.Name, err)
+		}
+		if info.HashString() != hash.Hash {
+			return 0, nil, fmt.Errorf("chain information of %s hashes to %s instead of %s", c.Name, info.HashString(), hash.Hash)
+		}
+
+		chains = append(chains, Chain{
+			Name:       c.Name,
+			Network:    c.Network,
+			Host:       c.Host,
+			Deprecated: c.Deprecated,
+			Info:       info,
+		})
+	}
+
+	return registry.Version, chains, nil
+}
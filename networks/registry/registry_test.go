@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+const quicknet = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+
+func TestRegistry(t *testing.T) {
+	require.GreaterOrEqual(t, Version, 1)
+	require.NotEmpty(t, Chains())
+
+	c, ok := Lookup(quicknet)
+	require.True(t, ok)
+	require.Equal(t, "quicknet", c.Name)
+	require.Equal(t, "mainnet", c.Network)
+	require.Equal(t, quicknet, c.ChainHash())
+	require.Equal(t, 3*time.Second, c.Info.Period)
+	require.Equal(t, crypto.SigsOnG1ID, c.Info.Scheme)
+
+	_, ok = Lookup("7672797f548f3f4748ac4bf3352fc6c6b6468c9ad40ad456a397545c6e2df5bf")
+	require.False(t, ok)
+
+	// the chains are copied.
+	Chains()[0].Name = "changed"
+	require.Equal(t, "quicknet", Chains()[0].Name)
+}
+
+func TestCheck(t *testing.T) {
+	quicknetT, ok := Lookup("cc9c398442737cbd141526600919edd69f1d6f9b4adb67e4d912fbc64341a9a5")
+	require.True(t, ok)
+	c, ok := Lookup(quicknet)
+	require.True(t, ok)
+
+	require.NoError(t, Check(quicknet, c.Info))
+	require.ErrorIs(t, Check(quicknet, quicknetT.Info), ErrInfoMismatch)
+
+	// chains missing from the registry aren't checked.
+	require.NoError(t, Check("7672797f548f3f4748ac4bf3352fc6c6b6468c9ad40ad456a397545c6e2df5bf", c.Info))
+}
+
+func TestParse(t *testing.T) {
+	_, _, err := parse([]byte(`{"version": 1, "chains": [{"name": "quicknet", "info": {"public_key":"83cf0f2896adee7eb8b5f01fcad3912212c437e0073e911fb90022d3e760183c8c4b450b6a0a6c3ac6a5776a2d1064510d1fec758c921cc22b0e17e63aaf4bcb5ed66304de9cf809bd274ca73bab4af5a6e9c76a4bc09e76eae8991ef5ece45a","period":4,"genesis_time":1692803367,"hash":"52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971","groupHash":"f477d5c89f21a17c863a7f937c6a6d15859414d2be09cd448d4279af331c5d3e","schemeID":"bls-unchained-g1-rfc9380","metadata":{"beaconID":"quicknet"}}}]}`))
+	require.ErrorContains(t, err, "hashes to")
+
+	_, _, err = parse([]byte(`{"version": 1, "chains": [{"name": "broken", "info": {}}]}`))
+	require.Error(t, err)
+}
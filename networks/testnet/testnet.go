@@ -0,0 +1,226 @@
+// Package testnet implements the Network interface for the tlock package with
+// an in-memory chain, whose secret key is known and whose clock is controlled,
+// so that encryptions and decryptions can be tested offline and
+// deterministically.
+package testnet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	"github.com/drand/kyber/util/random"
+)
+
+// ErrNotUnchained represents an error when the scheme of the key pair isn't
+// the one of an unchained network.
+var ErrNotUnchained = errors.New("not an unchained network")
+
+// ErrInvalidPeriod represents an error when the period isn't a positive
+// number of seconds, as drand requires.
+var ErrInvalidPeriod = errors.New("the period must be a positive number of seconds")
+
+// ErrNotReached represents an error when the signature of a round is requested
+// before the clock of the network reached it.
+var ErrNotReached = errors.New("round not reached yet")
+
+// ErrUnknownChain represents an error when switching to another chain than the
+// one of the network.
+var ErrUnknownChain = errors.New("unknown chain")
+
+// KeyPair is the secret key of a chain and its public key.
+type KeyPair struct {
+	Scheme *crypto.Scheme
+	Secret kyber.Scalar
+	Public kyber.Point
+}
+
+// GenerateKeyPair draws a key pair of the scheme at random.
+func GenerateKeyPair(scheme *crypto.Scheme) KeyPair {
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+
+	return KeyPair{
+		Scheme: scheme,
+		Secret: secret,
+		Public: scheme.KeyGroup.Point().Mul(secret, nil),
+	}
+}
+
+// =============================================================================
+
+// Clock is a fake clock, which only moves when told to. It is safe for
+// concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock set to the time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set sets the time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the clock forward by the duration.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// =============================================================================
+
+// Network is an in-memory unchained network, signing the rounds reached by
+// its clock on demand.
+type Network struct {
+	info    *chaininfo.Info
+	keyPair KeyPair
+	clock   *Clock
+}
+
+// New constructs a network of the key pair, or of a key pair of the quicknet
+// scheme drawn at random if it's the zero value, emitting a round every period
+// since the genesis. Its clock is set to the genesis, when the first round is
+// emitted.
+func New(period time.Duration, genesis time.Time, keyPair KeyPair) (*Network, error) {
+	if keyPair.Scheme == nil {
+		keyPair = GenerateKeyPair(crypto.NewPedersenBLSUnchainedG1())
+	}
+
+	switch keyPair.Scheme.Name {
+	case crypto.ShortSigSchemeID:
+	case crypto.SigsOnG1ID:
+	case crypto.UnchainedSchemeID:
+	default:
+		return nil, ErrNotUnchained
+	}
+
+	if period < time.Second || period%time.Second != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPeriod, period)
+	}
+
+	info := &chaininfo.Info{
+		PublicKey:   keyPair.Public,
+		ID:          "testnet",
+		Period:      period,
+		Scheme:      keyPair.Scheme.Name,
+		GenesisTime: genesis.Unix(),
+		GenesisSeed: []byte("tlock testnet"),
+	}
+
+	return &Network{
+		info:    info,
+		keyPair: keyPair,
+		clock:   NewClock(time.Unix(genesis.Unix(), 0)),
+	}, nil
+}
+
+// Clock returns the clock of the network, which decides what rounds can be
+// signed.
+func (n *Network) Clock() *Clock {
+	return n.clock
+}
+
+// KeyPair returns the key pair of the network.
+func (n *Network) KeyPair() KeyPair {
+	return n.keyPair
+}
+
+// MarshalInfo returns the JSON chain information of the network, as served on
+// the /info endpoint of drand relays.
+func (n *Network) MarshalInfo() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := n.info.ToJSON(&buf, nil); err != nil {
+		return nil, fmt.Errorf("encoding chain info: %w", err)
+	}
+
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// ChainHash returns the chain hash for this network.
+func (n *Network) ChainHash() string {
+	return n.info.HashString()
+}
+
+// Current returns the current round for that network at the given date.
+func (n *Network) Current(date time.Time) uint64 {
+	return chain.CurrentRound(date.Unix(), n.info.Period, n.info.GenesisTime)
+}
+
+// Period returns the frequency at which the network emits beacons.
+func (n *Network) Period() time.Duration {
+	return n.info.Period
+}
+
+// GenesisTime returns the UNIX time of the first round of the network.
+func (n *Network) GenesisTime() int64 {
+	return n.info.GenesisTime
+}
+
+// TimeOf returns the time at which the given round is emitted by the network.
+func (n *Network) TimeOf(roundNumber uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(n.info.Period, n.info.GenesisTime, roundNumber), 0)
+}
+
+// PublicKey returns the kyber point needed for encryption and decryption.
+func (n *Network) PublicKey() kyber.Point {
+	return n.keyPair.Public
+}
+
+// Scheme returns the drand crypto Scheme used by the network.
+func (n *Network) Scheme() crypto.Scheme {
+	return *n.keyPair.Scheme
+}
+
+// Signature returns the signature of the given round, which fails with
+// ErrNotReached if the clock didn't reach the round yet.
+func (n *Network) Signature(roundNumber uint64) ([]byte, error) {
+	if current := n.Current(n.clock.Now()); roundNumber > current {
+		return nil, fmt.Errorf("%w: round %d > %d current round", ErrNotReached, roundNumber, current)
+	}
+
+	return n.Sign(roundNumber)
+}
+
+// Sign returns the signature of the given round, regardless of the clock.
+func (n *Network) Sign(roundNumber uint64) ([]byte, error) {
+	scheme := n.keyPair.Scheme
+	signature, err := scheme.AuthScheme.Sign(n.keyPair.Secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	if err != nil {
+		return nil, fmt.Errorf("sign round %d: %w", roundNumber, err)
+	}
+
+	return signature, nil
+}
+
+// SwitchChainHash fails with ErrUnknownChain unless the chain hash is the one
+// of the network, which is the only chain it knows.
+func (n *Network) SwitchChainHash(chainHash string) error {
+	if chainHash != n.ChainHash() {
+		return fmt.Errorf("%w: %s", ErrUnknownChain, chainHash)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package testnet_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/drand/tlock/networks/testnet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork(t *testing.T) {
+	genesis := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	network, err := testnet.New(3*time.Second, genesis, testnet.KeyPair{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), network.Current(network.Clock().Now()))
+
+	roundNumber := network.Current(genesis.Add(time.Hour))
+	require.Equal(t, uint64(1201), roundNumber)
+	require.Equal(t, genesis.Add(time.Hour), network.TimeOf(roundNumber).UTC())
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewBufferString("very nice"), roundNumber)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	network.Clock().Advance(time.Hour)
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+
+	_, err = network.Signature(roundNumber + 1)
+	require.ErrorIs(t, err, testnet.ErrNotReached)
+}
+
+func TestMarshalInfo(t *testing.T) {
+	keyPair := testnet.GenerateKeyPair(crypto.NewPedersenBLSUnchained())
+	network, err := testnet.New(30*time.Second, time.Unix(1692803367, 0), keyPair)
+	require.NoError(t, err)
+	require.True(t, keyPair.Public.Equal(network.PublicKey()))
+
+	info, err := network.MarshalInfo()
+	require.NoError(t, err)
+
+	// the chain information hashes to the chain of the network.
+	offline, err := fixed.FromInfoWithSignatures(string(info), nil)
+	require.NoError(t, err)
+	require.Equal(t, network.ChainHash(), offline.ChainHash())
+	require.NoError(t, network.SwitchChainHash(offline.ChainHash()))
+	require.ErrorIs(t, network.SwitchChainHash("beef"), testnet.ErrUnknownChain)
+}
+
+func TestNew(t *testing.T) {
+	_, err := testnet.New(1500*time.Millisecond, time.Now(), testnet.KeyPair{})
+	require.ErrorIs(t, err, testnet.ErrInvalidPeriod)
+
+	_, err = testnet.New(time.Second, time.Now(), testnet.GenerateKeyPair(crypto.NewPedersenBLSChained()))
+	require.ErrorIs(t, err, testnet.ErrNotUnchained)
+}
@@ -0,0 +1,92 @@
+// Package http implements the Oracle interface for the tlock package, resolving
+// the conditions of ciphertexts with an HTTP service.
+//
+// The oracle queries the URL of the service with the chain hash and condition
+// as the chain and condition query parameters, such as
+//
+//	GET https://oracle.example.com/resolve?chain=52db9b...&condition=btc%3Aheight%3A850000
+//
+// to which the service answers with a json object holding the round of the
+// chain from which the condition is met, or 0 if it isn't known yet:
+//
+//	{"round": 12345678}
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/drand/tlock"
+)
+
+// timeout represents the maximum amount of time to wait for the service.
+const timeout = 5 * time.Second
+
+// maxResponseSize bounds the size of the responses read from the service.
+const maxResponseSize = 4 << 10
+
+// ErrOracleUnavailable represents an error when the service can't be reached
+// or fails to answer.
+var ErrOracleUnavailable = errors.New("oracle unavailable")
+
+// Oracle resolves conditions with the HTTP service at its URL.
+type Oracle struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// NewOracle constructs an oracle querying the service at the URL, which must
+// be an http or https one.
+func NewOracle(rawURL string) (*Oracle, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse oracle url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("oracle url %q: not an http or https url", rawURL)
+	}
+
+	oracle := Oracle{
+		url:    u,
+		client: &http.Client{Timeout: timeout},
+	}
+
+	return &oracle, nil
+}
+
+// Resolve implements the tlock.Oracle interface.
+func (o *Oracle) Resolve(chainHash string, condition string) (uint64, error) {
+	u := *o.url
+	query := u.Query()
+	query.Set("chain", chainHash)
+	query.Set("condition", condition)
+	u.RawQuery = query.Encode()
+
+	resp, err := o.client.Get(u.String())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrOracleUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w: %s", ErrOracleUnavailable, resp.Status)
+	}
+
+	var resolution struct {
+		Round uint64 `json:"round"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&resolution); err != nil {
+		return 0, fmt.Errorf("decode resolution: %w", err)
+	}
+
+	if resolution.Round == 0 {
+		return 0, fmt.Errorf("%w: %q", tlock.ErrConditionPending, condition)
+	}
+
+	return resolution.Round, nil
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drand/tlock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOracle(t *testing.T) {
+	rounds := map[string]uint64{"btc:height:850000": 1234}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/resolve" || r.URL.Query().Get("chain") != "abcd" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]uint64{"round": rounds[r.URL.Query().Get("condition")]})
+	}))
+	defer server.Close()
+
+	oracle, err := NewOracle(server.URL + "/resolve")
+	require.NoError(t, err)
+
+	roundNumber, err := oracle.Resolve("abcd", "btc:height:850000")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), roundNumber)
+
+	_, err = oracle.Resolve("abcd", "btc:height:999999")
+	require.ErrorIs(t, err, tlock.ErrConditionPending)
+
+	_, err = oracle.Resolve("other", "btc:height:850000")
+	require.ErrorIs(t, err, ErrOracleUnavailable)
+
+	_, err = NewOracle("ftp://example.com")
+	require.Error(t, err)
+}
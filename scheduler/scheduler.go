@@ -0,0 +1,270 @@
+// Package scheduler calls back the applications waiting for rounds of a drand
+// chain as soon as the beacon of each round is available, such as to decrypt
+// their ciphertexts the instant they unlock, without each application writing
+// its own polling loop.
+//
+// Callbacks and channels are registered in memory, while registrations are
+// kept in a store, so that the ones still pending when a process stops are
+// handled once it runs again.
+package scheduler
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+)
+
+// ErrInvalidRegistration represents an error when a registration has no ID
+// or is for round 0.
+var ErrInvalidRegistration = errors.New("registrations need an ID and a round")
+
+// Network is the network of the chain a scheduler watches, such as the one of
+// the http package.
+type Network interface {
+	Current(time.Time) uint64
+	Signature(roundNumber uint64) ([]byte, error)
+	Watch(ctx context.Context) (<-chan chain.Beacon, error)
+}
+
+// Registration records the interest of an application in a round. Its ID
+// identifies it in the store, and its data is the application's, such as the
+// name of the ciphertext to decrypt.
+type Registration struct {
+	ID    string `json:"id"`
+	Round uint64 `json:"round"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Handler handles a registration with the beacon of its round. A registration
+// whose handler fails is handled again with the next beacon watched.
+type Handler func(Registration, chain.Beacon) error
+
+// =============================================================================
+
+// Scheduler dispatches the beacons of the rounds of its network to the
+// callbacks, channels and registrations waiting for them. It is safe for
+// concurrent use.
+type Scheduler struct {
+	network Network
+	store   Store
+	handler Handler
+
+	mu            sync.Mutex
+	callbacks     map[uint64][]func(chain.Beacon)
+	registrations map[string]Registration
+	handling      map[string]bool
+}
+
+// New constructs a scheduler of the network, whose registrations are handled
+// by the handler and kept in the store, loading the ones it holds. A nil store
+// keeps them in memory only.
+func New(network Network, store Store, handler Handler) (*Scheduler, error) {
+	s := Scheduler{
+		network:       network,
+		store:         store,
+		handler:       handler,
+		callbacks:     make(map[uint64][]func(chain.Beacon)),
+		registrations: make(map[string]Registration),
+		handling:      make(map[string]bool),
+	}
+
+	if store != nil {
+		registrations, err := store.List()
+		if err != nil {
+			return nil, fmt.Errorf("loading registrations: %w", err)
+		}
+		for _, r := range registrations {
+			s.registrations[r.ID] = r
+		}
+	}
+
+	return &s, nil
+}
+
+// RegisterUnlock registers the callback to be called once with the beacon of
+// the round, from a goroutine of the scheduler. The beacon of a round already
+// emitted is fetched right away.
+func (s *Scheduler) RegisterUnlock(roundNumber uint64, callback func(chain.Beacon)) {
+	s.mu.Lock()
+	s.callbacks[roundNumber] = append(s.callbacks[roundNumber], callback)
+	s.mu.Unlock()
+
+	s.dispatchReached(roundNumber)
+}
+
+// Wait returns a channel receiving the beacon of the round, like
+// RegisterUnlock.
+func (s *Scheduler) Wait(roundNumber uint64) <-chan chain.Beacon {
+	beacons := make(chan chain.Beacon, 1)
+	s.RegisterUnlock(roundNumber, func(beacon chain.Beacon) {
+		beacons <- beacon
+	})
+
+	return beacons
+}
+
+// Register stores the registration, replacing the one of the same ID, to be
+// handled by the handler of the scheduler with the beacon of its round. The
+// registrations are handled at least once: one whose handling succeeded may be
+// handled again if the process stops before it's removed from the store.
+func (s *Scheduler) Register(r Registration) error {
+	if r.ID == "" || r.Round == 0 {
+		return fmt.Errorf("%w: %q for round %d", ErrInvalidRegistration, r.ID, r.Round)
+	}
+	r.Data = slices.Clone(r.Data)
+
+	if s.store != nil {
+		if err := s.store.Put(r); err != nil {
+			return fmt.Errorf("storing registration: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.registrations[r.ID] = r
+	s.mu.Unlock()
+
+	s.dispatchReached(r.Round)
+
+	return nil
+}
+
+// Cancel removes the registration of the ID, if any.
+func (s *Scheduler) Cancel(id string) error {
+	if s.store != nil {
+		if err := s.store.Delete(id); err != nil {
+			return fmt.Errorf("removing registration: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.registrations, id)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Pending returns the registrations not handled yet, sorted by round.
+func (s *Scheduler) Pending() []Registration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]Registration, 0, len(s.registrations))
+	for _, r := range s.registrations {
+		pending = append(pending, r)
+	}
+	slices.SortFunc(pending, func(a, b Registration) int {
+		if c := cmp.Compare(a.Round, b.Round); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return pending
+}
+
+// Run watches the network until the context is done, dispatching each beacon
+// to what waits for its round, along with the earlier rounds still waited
+// for, such as the registrations pending since before a restart. It returns
+// the error of the context, or the one of the network if it can't be watched.
+func (s *Scheduler) Run(ctx context.Context) error {
+	beacons, err := s.network.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("watching network: %w", err)
+	}
+
+	s.dispatch(s.network.Current(time.Now()), nil)
+	for beacon := range beacons {
+		s.dispatch(beacon.Round, &beacon)
+	}
+
+	return ctx.Err()
+}
+
+// =============================================================================
+
+// dispatchReached dispatches the round in the background if it was already
+// emitted.
+func (s *Scheduler) dispatchReached(roundNumber uint64) {
+	if roundNumber <= s.network.Current(time.Now()) {
+		go s.dispatch(roundNumber, nil)
+	}
+}
+
+// dispatch delivers the beacon of each round waited for up to the latest one,
+// using the given beacon for its round, if any, and fetching the others. The
+// rounds whose beacon can't be fetched remain waited for.
+func (s *Scheduler) dispatch(latest uint64, beacon *chain.Beacon) {
+	s.mu.Lock()
+	var rounds []uint64
+	for roundNumber := range s.callbacks {
+		if roundNumber <= latest {
+			rounds = append(rounds, roundNumber)
+		}
+	}
+	for _, r := range s.registrations {
+		if r.Round <= latest && !s.handling[r.ID] {
+			rounds = append(rounds, r.Round)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.Sort(rounds)
+	for _, roundNumber := range slices.Compact(rounds) {
+		if beacon != nil && beacon.Round == roundNumber {
+			s.deliver(*beacon)
+			continue
+		}
+
+		signature, err := s.network.Signature(roundNumber)
+		if err != nil {
+			continue
+		}
+		s.deliver(chain.Beacon{Round: roundNumber, Signature: signature})
+	}
+}
+
+// deliver calls the callbacks of the round of the beacon, and handles its
+// registrations, removing the ones handled successfully.
+func (s *Scheduler) deliver(beacon chain.Beacon) {
+	s.mu.Lock()
+	callbacks := s.callbacks[beacon.Round]
+	delete(s.callbacks, beacon.Round)
+	var registrations []Registration
+	for _, r := range s.registrations {
+		if r.Round == beacon.Round && !s.handling[r.ID] {
+			registrations = append(registrations, r)
+			s.handling[r.ID] = true
+		}
+	}
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(beacon)
+	}
+
+	for _, r := range registrations {
+		handled := s.handler != nil && s.handler(r, beacon) == nil
+
+		// The registration may have been replaced or canceled while handled.
+		s.mu.Lock()
+		delete(s.handling, r.ID)
+		current, ok := s.registrations[r.ID]
+		handled = handled && ok && current.Round == r.Round && slices.Equal(current.Data, r.Data)
+		if handled {
+			delete(s.registrations, r.ID)
+		}
+		s.mu.Unlock()
+
+		if handled && s.store != nil {
+			// A registration failing to be removed from the store is handled
+			// again after a restart.
+			_ = s.store.Delete(r.ID)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	dhttp "github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/scheduler"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+)
+
+func newNetwork(t *testing.T) (*testsupport.Beacon, *dhttp.Network) {
+	t.Helper()
+
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	t.Cleanup(relay.Close)
+
+	network, err := dhttp.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	return beacon, network
+}
+
+func TestScheduler(t *testing.T) {
+	beacon, network := newNetwork(t)
+
+	s, err := scheduler.New(network, nil, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	scheme := network.Scheme()
+	next := beacon.Current(time.Now()) + 1
+	future := s.Wait(next)
+	past := s.Wait(1)
+
+	b := <-past
+	require.Equal(t, uint64(1), b.Round)
+	require.NoError(t, scheme.VerifyBeacon(&b, network.PublicKey()))
+
+	b = <-future
+	require.Equal(t, next, b.Round)
+	require.NoError(t, scheme.VerifyBeacon(&b, network.PublicKey()))
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	err = s.Register(scheduler.Registration{Round: next})
+	require.ErrorIs(t, err, scheduler.ErrInvalidRegistration)
+}
+
+func TestSchedulerPersistence(t *testing.T) {
+	beacon, network := newNetwork(t)
+	name := filepath.Join(t.TempDir(), "registrations.json")
+
+	store, err := scheduler.NewFileStore(name)
+	require.NoError(t, err)
+	s, err := scheduler.New(network, store, nil)
+	require.NoError(t, err)
+
+	// Registered while no scheduler runs, as if the process stopped.
+	next := beacon.Current(time.Now()) + 1
+	require.NoError(t, s.Register(scheduler.Registration{ID: "later", Round: next, Data: []byte("ciphertext")}))
+	require.NoError(t, s.Register(scheduler.Registration{ID: "canceled", Round: next}))
+	require.NoError(t, s.Cancel("canceled"))
+	beacon.WaitFor(next)
+
+	var failures atomic.Int32
+	handled := make(chan scheduler.Registration, 1)
+	handler := func(r scheduler.Registration, b chain.Beacon) error {
+		if failures.Add(1) == 1 {
+			return errors.New("failing once")
+		}
+		require.Equal(t, r.Round, b.Round)
+		handled <- r
+		return nil
+	}
+
+	store, err = scheduler.NewFileStore(name)
+	require.NoError(t, err)
+	s, err = scheduler.New(network, store, handler)
+	require.NoError(t, err)
+	require.Equal(t, []scheduler.Registration{{ID: "later", Round: next, Data: []byte("ciphertext")}}, s.Pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	r := <-handled
+	require.Equal(t, "later", r.ID)
+	require.Equal(t, []byte("ciphertext"), r.Data)
+	require.Equal(t, int32(2), failures.Load())
+
+	require.Eventually(t, func() bool {
+		registrations, err := store.List()
+		return err == nil && len(registrations) == 0 && len(s.Pending()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	store, err = scheduler.NewFileStore(name)
+	require.NoError(t, err)
+	registrations, err := store.List()
+	require.NoError(t, err)
+	require.Empty(t, registrations)
+}
@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the pending registrations of a scheduler. It must be safe
+// for concurrent use.
+type Store interface {
+	// Put records the registration, replacing the one of the same ID.
+	Put(Registration) error
+	// Delete removes the registration of the ID, if any.
+	Delete(id string) error
+	// List returns the registrations recorded.
+	List() ([]Registration, error)
+}
+
+// =============================================================================
+
+// FileStore is a Store persisted in a json file, which survives the restarts
+// of long-running processes.
+type FileStore struct {
+	name          string
+	mu            sync.Mutex
+	registrations map[string]Registration
+}
+
+// NewFileStore returns a store persisted in the named file, loading the
+// registrations it holds if it exists.
+func NewFileStore(name string) (*FileStore, error) {
+	s := FileStore{
+		name:          name,
+		registrations: make(map[string]Registration),
+	}
+
+	b, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &s, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading registrations: %w", err)
+	}
+
+	var registrations []Registration
+	if err := json.Unmarshal(b, &registrations); err != nil {
+		return nil, fmt.Errorf("decoding registrations %q: %w", name, err)
+	}
+	for _, r := range registrations {
+		s.registrations[r.ID] = r
+	}
+
+	return &s, nil
+}
+
+// Put implements the Store interface.
+func (s *FileStore) Put(r Registration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.registrations[r.ID]
+	s.registrations[r.ID] = r
+	if err := s.save(); err != nil {
+		if existed {
+			s.registrations[r.ID] = previous
+		} else {
+			delete(s.registrations, r.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete implements the Store interface. The file is only written when the
+// registration is recorded.
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.registrations[id]
+	if !ok {
+		return nil
+	}
+
+	delete(s.registrations, id)
+	if err := s.save(); err != nil {
+		s.registrations[id] = previous
+		return err
+	}
+
+	return nil
+}
+
+// List implements the Store interface.
+func (s *FileStore) List() ([]Registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registrations := make([]Registration, 0, len(s.registrations))
+	for _, r := range s.registrations {
+		registrations = append(registrations, r)
+	}
+
+	return registrations, nil
+}
+
+// save atomically replaces the file with the recorded registrations.
+func (s *FileStore) save() error {
+	registrations := make([]Registration, 0, len(s.registrations))
+	for _, r := range s.registrations {
+		registrations = append(registrations, r)
+	}
+
+	b, err := json.MarshalIndent(registrations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding registrations: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.name), "."+filepath.Base(s.name)+".*")
+	if err != nil {
+		return fmt.Errorf("writing registrations: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing registrations: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing registrations: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.name); err != nil {
+		return fmt.Errorf("writing registrations: %w", err)
+	}
+
+	return nil
+}
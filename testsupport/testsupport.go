@@ -0,0 +1,180 @@
+// Package testsupport provides an in-process drand beacon, and a relay serving
+// it over HTTP, so that tests exercising the network, such as the end-to-end
+// tests of the tle command, don't depend on a live drand network being up.
+//
+// The key of the beacon is derived from a seed, so that its public key is
+// stable across runs, and it emits a round every period in real time since
+// its start.
+package testsupport
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/xof/blake2xb"
+	"github.com/drand/tlock/networks/testnet"
+)
+
+// DefaultPeriod is the period of the beacons, short enough for tests to wait
+// for a round.
+const DefaultPeriod = time.Second
+
+// DefaultSeed is the seed the key of the beacons is derived from.
+const DefaultSeed = "tlock testsupport"
+
+// KeyPair derives the key pair of the scheme from the seed, always returning
+// the same key pair for the same seed. It must only be used in tests.
+func KeyPair(scheme *crypto.Scheme, seed string) testnet.KeyPair {
+	secret := scheme.KeyGroup.Scalar().Pick(blake2xb.New([]byte(seed)))
+
+	return testnet.KeyPair{
+		Scheme: scheme,
+		Secret: secret,
+		Public: scheme.KeyGroup.Point().Mul(secret, nil),
+	}
+}
+
+// =============================================================================
+
+// Beacon is an in-process unchained drand beacon. It implements the Network
+// interface of the tlock package.
+type Beacon struct {
+	*testnet.Network
+}
+
+// NewBeacon constructs a beacon of the scheme, or of the quicknet scheme if
+// nil, with the key of DefaultSeed. Its first round is emitted now, and the
+// next ones every period.
+func NewBeacon(scheme *crypto.Scheme, period time.Duration) (*Beacon, error) {
+	if scheme == nil {
+		scheme = crypto.NewPedersenBLSUnchainedG1()
+	}
+
+	network, err := testnet.New(period, time.Now(), KeyPair(scheme, DefaultSeed))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Beacon{Network: network}, nil
+}
+
+// Signature returns the signature of the given round, which fails with
+// testnet.ErrNotReached if the round wasn't emitted yet.
+func (b *Beacon) Signature(roundNumber uint64) ([]byte, error) {
+	b.Clock().Set(time.Now())
+	return b.Network.Signature(roundNumber)
+}
+
+// WaitFor blocks until the beacon emitted the given round.
+func (b *Beacon) WaitFor(roundNumber uint64) {
+	time.Sleep(time.Until(b.TimeOf(roundNumber)))
+}
+
+// =============================================================================
+
+// Handler returns an http.Handler speaking the relay API for the beacons: the
+// chain information on /{chainhash}/info and the rounds on
+// /{chainhash}/public/{round} and /{chainhash}/public/latest, along with the
+// list of chains on /chains. The first beacon is the default chain of the
+// relay, whose information is also served on /info.
+func Handler(beacons ...*Beacon) http.Handler {
+	chains := make(map[string]*Beacon, len(beacons))
+	hashes := make([]string, 0, len(beacons))
+	for _, b := range beacons {
+		chains[b.ChainHash()] = b
+		hashes = append(hashes, b.ChainHash())
+	}
+
+	beacon := func(r *http.Request) *Beacon {
+		chainHash := r.PathValue("chainhash")
+		if chainHash == "" && len(hashes) > 0 {
+			chainHash = hashes[0]
+		}
+		return chains[chainHash]
+	}
+
+	info := func(w http.ResponseWriter, r *http.Request) {
+		b := beacon(r)
+		if b == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		info, err := b.MarshalInfo()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(info)
+	}
+
+	public := func(w http.ResponseWriter, r *http.Request) {
+		b := beacon(r)
+		if b == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		roundNumber := b.Current(time.Now())
+		if round := r.PathValue("round"); round != "latest" {
+			n, err := strconv.ParseUint(round, 10, 64)
+			if err != nil || n == 0 {
+				http.Error(w, "invalid round", http.StatusBadRequest)
+				return
+			}
+			roundNumber = n
+		}
+
+		signature, err := b.Signature(roundNumber)
+		if errors.Is(err, testnet.ErrNotReached) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, struct {
+			Round      uint64 `json:"round"`
+			Randomness string `json:"randomness"`
+			Signature  string `json:"signature"`
+		}{
+			Round:      roundNumber,
+			Randomness: hex.EncodeToString(crypto.RandomnessFromSignature(signature)),
+			Signature:  hex.EncodeToString(signature),
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /chains", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, hashes)
+	})
+	mux.HandleFunc("GET /info", info)
+	mux.HandleFunc("GET /{chainhash}/info", info)
+	mux.HandleFunc("GET /{chainhash}/public/{round}", public)
+
+	return mux
+}
+
+// NewRelay starts a relay serving the beacons, to be closed by the caller.
+// Its URL is a host for the http network.
+func NewRelay(beacons ...*Beacon) *httptest.Server {
+	return httptest.NewServer(Handler(beacons...))
+}
+
+// writeJSON writes the value as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
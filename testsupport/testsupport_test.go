@@ -0,0 +1,86 @@
+package testsupport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	dhttp "github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/networks/testnet"
+	"github.com/drand/tlock/testsupport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyPair(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	keyPair := testsupport.KeyPair(scheme, testsupport.DefaultSeed)
+	require.True(t, keyPair.Public.Equal(testsupport.KeyPair(scheme, testsupport.DefaultSeed).Public))
+	require.False(t, keyPair.Public.Equal(testsupport.KeyPair(scheme, "other").Public))
+}
+
+func TestBeacon(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	require.True(t, beacon.KeyPair().Public.Equal(testsupport.KeyPair(crypto.NewPedersenBLSUnchainedG1(), testsupport.DefaultSeed).Public))
+
+	_, err = beacon.Signature(1)
+	require.NoError(t, err)
+
+	roundNumber := beacon.Current(time.Now()) + 2
+	_, err = beacon.Signature(roundNumber)
+	require.ErrorIs(t, err, testnet.ErrNotReached)
+
+	beacon.WaitFor(roundNumber)
+	_, err = beacon.Signature(roundNumber)
+	require.NoError(t, err)
+}
+
+func TestRelay(t *testing.T) {
+	quicknet, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	unchained, err := testsupport.NewBeacon(crypto.NewPedersenBLSUnchained(), testsupport.DefaultPeriod)
+	require.NoError(t, err)
+
+	relay := testsupport.NewRelay(quicknet, unchained)
+	defer relay.Close()
+
+	resp, err := http.Get(relay.URL + "/chains")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var chains []string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&chains))
+	require.Equal(t, []string{quicknet.ChainHash(), unchained.ChainHash()}, chains)
+
+	resp, err = http.Get(relay.URL + "/" + quicknet.ChainHash() + "/public/1000")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	network, err := dhttp.NewNetwork(relay.URL, unchained.ChainHash())
+	require.NoError(t, err)
+	require.True(t, unchained.PublicKey().Equal(network.PublicKey()))
+
+	roundNumber := network.Current(time.Now()) + 2
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewBufferString("very nice"), roundNumber)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	unchained.WaitFor(roundNumber)
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+
+	// the network switches to the other chain of the relay.
+	require.NoError(t, network.SwitchChainHash(quicknet.ChainHash()))
+	require.True(t, quicknet.PublicKey().Equal(network.PublicKey()))
+}
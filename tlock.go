@@ -5,9 +5,12 @@ package tlock
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"sync"
 	"time"
 
 	"filippo.io/age"
@@ -24,13 +27,40 @@ import (
 var ErrTooEarly = errors.New("too early to decrypt")
 var ErrInvalidPublicKey = errors.New("the public key received from the network to encrypt this was infinity and thus insecure")
 
+// ErrTrailingData represents an error when an armored ciphertext is followed
+// by other data than whitespace, which could hide tampering or concatenation.
+var ErrTrailingData = errors.New("trailing data after armored file")
+
+// ErrNoCompatibleScheme represents an error when a best effort decryption
+// didn't find any scheme able to decrypt the ciphertext with the signature.
+var ErrNoCompatibleScheme = errors.New("no compatible scheme could decrypt the ciphertext with this signature")
+
+// ErrInvalidRound represents an error when encrypting towards round 0, which
+// precedes the first beacon and is never signed.
+var ErrInvalidRound = errors.New("round 0 can't be encrypted towards")
+
+// ErrStanzaMismatch represents an error when the file key of a stanza can't be
+// decrypted with the signature of the round of the chain it records, which
+// happens if the arguments or the body of the stanza were altered.
+var ErrStanzaMismatch = errors.New("the stanza doesn't decrypt with the signature of its round")
+
+// ErrAlteredHeader represents an error when the header of a ciphertext doesn't
+// match the MAC computed with its file key, which authenticates the arguments
+// of every stanza, such as their rounds and chain hashes.
+var ErrAlteredHeader = errors.New("the header of the ciphertext was altered")
+
 // =============================================================================
 
 // Network represents a system that provides support for encrypting/decrypting
-// a DEK based on a future time.
+// a DEK based on a future time. The failures of Signature are reported as
+// ErrTooEarly, unless the error has an Unavailable method returning true, for
+// a network which couldn't be reached.
 type Network interface {
 	ChainHash() string
 	Current(time.Time) uint64
+	Period() time.Duration
+	GenesisTime() int64
+	TimeOf(uint64) time.Time
 	PublicKey() kyber.Point
 	Scheme() crypto.Scheme
 	Signature(roundNumber uint64) ([]byte, error)
@@ -43,6 +73,40 @@ type Network interface {
 type Tlock struct {
 	network        Network
 	trustChainhash bool
+	allowTrailing  bool
+	lockMemory     bool
+	recipients     []age.Recipient
+	switcher       ChainSwitcher
+	trustedChains  []string
+	restricted     bool
+
+	roundPassphrase string
+	guessFirst      uint64
+	guessLast       uint64
+
+	condition string
+	oracle    Oracle
+	version   int
+
+	auditHook func(Event)
+	maxSize   int64
+}
+
+// ChainSwitcher returns a network of the chain hash without altering the
+// network of the tlock, such as a clone of it switched to the chain hash.
+type ChainSwitcher func(chainHash string) (Network, error)
+
+// DecryptResult describes the stanza a ciphertext was decrypted with.
+type DecryptResult struct {
+	// ChainHash is the chain hash of the stanza, the one switched to if it
+	// differs from the one of the network.
+	ChainHash string
+
+	// Round is the round of the stanza.
+	Round uint64
+
+	// Switched reports whether the chain hash was switched to.
+	Switched bool
 }
 
 // New constructs a tlock for the specified network which can encrypt data that
@@ -61,65 +125,356 @@ func (t Tlock) Strict() Tlock {
 	return t
 }
 
+// TrustChains makes decryptions switch to the chain of a ciphertext only if its
+// chain hash is one of the given ones, refusing the others with
+// ErrWrongChainhash, instead of trusting any chain hash. The chain of the
+// network is always accepted, and every other chain is refused if none is
+// given.
+func (t Tlock) TrustChains(chainHashes ...string) Tlock {
+	t.trustChainhash = true
+	t.trustedChains = slices.Clone(chainHashes)
+	t.restricted = true
+	return t
+}
+
+// Trusts reports whether decryptions switch to the chain hash when it differs
+// from the one of the network, as allowed by Strict and TrustChains.
+func (t Tlock) Trusts(chainHash string) bool {
+	identity := t.identity()
+	return identity.trustChainhash && identity.trusts(chainHash)
+}
+
+// AllowTrailing makes Decrypt ignore any data following the end of armored
+// ciphertexts, instead of failing with ErrTrailingData. Binary ciphertexts
+// never accept trailing data.
+func (t Tlock) AllowTrailing() Tlock {
+	t.allowTrailing = true
+	return t
+}
+
+// LockMemory makes Decrypt copy the plaintext through a buffer locked in
+// memory, which is never swapped to disk, failing if the platform doesn't
+// allow it. Either way the buffers of the plaintext held by tlock are wiped
+// after use, unlike the ones of age and of the destination.
+func (t Tlock) LockMemory() Tlock {
+	t.lockMemory = true
+	return t
+}
+
+// WithRecipients makes Encrypt and ReEncrypt also wrap the file key to the
+// recipients, which can then decrypt the ciphertext regardless of its round
+// using DecryptWith, e.g. to escrow the file key, or with age itself for age
+// recipients, e.g. auditors. The tlock stanzas always come first in the header,
+// followed by the stanzas of the recipients in the order they were given.
+func (t Tlock) WithRecipients(recipients ...age.Recipient) Tlock {
+	t.recipients = append(slices.Clip(t.recipients), recipients...)
+	return t
+}
+
+// WithChainSwitcher makes the decryptions of ciphertexts of another chain than
+// the one of the network switch to it on the network returned by the switcher,
+// which is only used for that decryption, instead of switching the network
+// itself. It has no effect once Strict was called.
+func (t Tlock) WithChainSwitcher(switcher ChainSwitcher) Tlock {
+	t.switcher = switcher
+	return t
+}
+
+// HideRound makes Encrypt and ReEncrypt write stanzas of type
+// HiddenStanzaType, whose round is sealed with the passphrase, so that the
+// unlock time isn't disclosed to whoever holds the ciphertext, and Decrypt
+// reveal the round of such stanzas with the passphrase. The signature of the
+// round can't be checked against a ciphertext before the round is reached, so
+// its unlock time remains hidden until then, but anyone can find it afterwards
+// by guessing the past rounds, see GuessRounds.
+func (t Tlock) HideRound(passphrase string) Tlock {
+	t.roundPassphrase = passphrase
+	return t
+}
+
+// WithStanzaVersion makes Encrypt and ReEncrypt write tlock stanzas of the
+// version, see StanzaVersion. The default version 1 is decrypted by every
+// version of tlock and of its other implementations, while the later ones
+// require decrypters supporting them.
+func (t Tlock) WithStanzaVersion(version int) Tlock {
+	t.version = version
+	return t
+}
+
+// GuessRounds makes Decrypt try each of the rounds from first to last for the
+// stanzas of type HiddenStanzaType, when their passphrase isn't known. Each
+// guess requires the signature of its round, so the range should be as narrow
+// as possible, and Decrypt fails with ErrInvalidScanRange if it holds more than
+// MaxScanRounds rounds.
+func (t Tlock) GuessRounds(first uint64, last uint64) Tlock {
+	t.guessFirst, t.guessLast = first, last
+	return t
+}
+
 // Encrypt will encrypt the source and write that to the destination. The encrypted
 // data will not be decryptable until the specified round is reached by the network.
-func (t Tlock) Encrypt(dst io.Writer, src io.Reader, roundNumber uint64) (err error) {
-	w, err := age.Encrypt(dst, &Recipient{network: t.network, roundNumber: roundNumber})
+func (t Tlock) Encrypt(dst io.Writer, src io.Reader, roundNumber uint64) error {
+	return t.EncryptRounds(dst, src, roundNumber)
+}
+
+// EncryptRounds is like Encrypt, but wraps the file key in a tlock stanza for
+// each of the rounds, from the earliest to the latest, so that the data is
+// decryptable once the earliest round is reached by the network, and remains
+// decryptable with the signature of any of the later rounds.
+func (t Tlock) EncryptRounds(dst io.Writer, src io.Reader, roundNumbers ...uint64) (err error) {
+	a := t.audit(OpEncrypt)
+	a.encrypted(roundNumbers)
+	defer func() { a.done(err) }()
+
+	recipients, err := t.ageRecipients(roundNumbers)
+	if err != nil {
+		return err
+	}
+
+	w, err := age.Encrypt(dst, recipients...)
 	if err != nil {
 		return fmt.Errorf("hybrid encrypt: %w", err)
 	}
 
+	// a failure to write isn't hidden by the close succeeding.
 	defer func() {
-		if err = w.Close(); err != nil {
-			err = fmt.Errorf("close: %w", err)
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close: %w", closeErr)
 		}
 	}()
 
-	if _, err := io.Copy(w, src); err != nil {
+	if _, err := io.Copy(w, a.reader(t.limitReader(src))); err != nil {
 		return fmt.Errorf("write: %w", err)
 	}
 
 	return nil
 }
 
+// ReEncrypt decrypts the source, whose round must have been reached, and
+// encrypts its plaintext towards the new round to the destination in a single
+// streaming pass, so that the plaintext is never stored. The output is armored
+// only if the destination is an armor writer.
+func (t Tlock) ReEncrypt(dst io.Writer, src io.Reader, roundNumber uint64) error {
+	return t.ReEncryptRounds(dst, src, roundNumber)
+}
+
+// ReEncryptRounds is like ReEncrypt, but encrypts towards each of the rounds
+// like EncryptRounds.
+func (t Tlock) ReEncryptRounds(dst io.Writer, src io.Reader, roundNumbers ...uint64) (err error) {
+	a := t.audit(OpReEncrypt)
+	a.encrypted(roundNumbers)
+	defer func() { a.done(err) }()
+
+	recipients, err := t.ageRecipients(roundNumbers)
+	if err != nil {
+		return err
+	}
+
+	w, err := age.Encrypt(dst, recipients...)
+	if err != nil {
+		return fmt.Errorf("hybrid encrypt: %w", err)
+	}
+
+	if err := decrypt(a.writer(t.limitWriter(w)), src, t.identity(), t.allowTrailing, t.lockMemory); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	return nil
+}
+
+// ageRecipients returns the recipients of the rounds, sorted and without
+// duplicates, followed by the additional recipients.
+func (t Tlock) ageRecipients(roundNumbers []uint64) ([]age.Recipient, error) {
+	roundNumbers = slices.Clone(roundNumbers)
+	slices.Sort(roundNumbers)
+	roundNumbers = slices.Compact(roundNumbers)
+	if len(roundNumbers) == 0 || roundNumbers[0] == 0 {
+		return nil, ErrInvalidRound
+	}
+	if t.version > StanzaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedStanzaVersion, t.version)
+	}
+
+	recipients := make([]age.Recipient, 0, len(roundNumbers)+len(t.recipients))
+	for _, roundNumber := range roundNumbers {
+		recipients = append(recipients, &Recipient{network: t.network, roundNumber: roundNumber, passphrase: t.roundPassphrase, condition: t.condition, version: t.version})
+	}
+
+	return append(recipients, t.recipients...), nil
+}
+
 // Decrypt will decrypt the source and write that to the destination. The decrypted
 // data will not be decryptable unless the specified round from the encrypt call
 // is reached by the network.
 func (t Tlock) Decrypt(dst io.Writer, src io.Reader) error {
-	rr := bufio.NewReader(src)
+	_, err := t.DecryptWithResult(dst, src)
+	return err
+}
+
+// DecryptWithResult will decrypt the source like Decrypt, and return the chain
+// hash and round of the stanza it was decrypted with.
+func (t Tlock) DecryptWithResult(dst io.Writer, src io.Reader) (_ DecryptResult, err error) {
+	a := t.audit(OpDecrypt)
+	identity := t.identity()
+	defer func() {
+		a.decrypted(identity)
+		a.done(err)
+	}()
+
+	if err := decrypt(a.writer(t.limitWriter(dst)), src, identity, t.allowTrailing, t.lockMemory); err != nil {
+		return DecryptResult{}, err
+	}
+
+	return DecryptResult{
+		ChainHash: identity.network.ChainHash(),
+		Round:     identity.unlocked,
+		Switched:  identity.switched,
+	}, nil
+}
+
+// identity returns the identity decrypting a single ciphertext.
+func (t Tlock) identity() *Identity {
+	identity := &Identity{
+		network:         t.network,
+		trustChainhash:  t.trustChainhash,
+		trustedChains:   t.trustedChains,
+		restricted:      t.restricted,
+		switcher:        t.switcher,
+		roundPassphrase: t.roundPassphrase,
+		oracle:          t.oracle,
+	}
+	if t.guessLast != 0 {
+		identity.SetGuessedRounds(t.guessFirst, t.guessLast)
+	}
+
+	return identity
+}
+
+// DecryptBestEffort will decrypt the source and write that to the destination
+// using only the signature of the round it was encrypted towards, without
+// requiring any information about the network. See TimeUnlockBestEffort.
+func DecryptBestEffort(dst io.Writer, src io.Reader, signature []byte) error {
+	return decrypt(dst, src, &SignatureIdentity{signature: signature}, false, false)
+}
+
+// DecryptWith will decrypt the source and write that to the destination using
+// the age identity instead of the signature of the round, such as one of the
+// additional recipients of the ciphertext. Like Decrypt, it handles armored
+// and binary sources.
+func DecryptWith(dst io.Writer, src io.Reader, identity age.Identity) error {
+	return decrypt(dst, src, identity, false, false)
+}
 
-	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
-		src = armor.NewReader(rr)
+// decrypt handles armored and binary sources for the given age identity.
+func decrypt(dst io.Writer, src io.Reader, identity age.Identity, allowTrailing bool, lockMemory bool) error {
+	return decryptPayload(src, identity, allowTrailing, func(r io.Reader) error {
+		return copyPlaintext(dst, r, lockMemory)
+	})
+}
+
+// decryptPayload opens the armored or binary source for the given age
+// identity, and calls read with the reader of its plaintext. The file key is
+// wiped once age derived the key of the payload from it.
+func decryptPayload(src io.Reader, identity age.Identity, allowTrailing bool, read func(r io.Reader) error) error {
+	rr := readerPool.Get().(*bufio.Reader)
+	rr.Reset(src)
+	defer func() {
+		rr.Reset(nil)
+		readerPool.Put(rr)
+	}()
+
+	if start, _ := rr.Peek(len(armor.Header)); bytes.Equal(start, armorHeader) {
+		src = armor.NewReader(&armorEnd{r: rr, allowTrailing: allowTrailing})
 	} else {
 		src = rr
 	}
 
-	r, err := age.Decrypt(src, &Identity{network: t.network, trustChainhash: t.trustChainhash})
+	recorder := fileKeyIdentity{identity: identity}
+	r, err := age.Decrypt(src, &recorder)
+	wipe(recorder.fileKey)
 	if err != nil {
-		return fmt.Errorf("hybrid decrypt: %w", err)
+		return headerError(err, recorder.fileKey != nil)
 	}
 
-	if _, err := io.Copy(dst, r); err != nil {
-		return fmt.Errorf("write: %w", err)
+	return read(r)
+}
+
+// headerError qualifies the failure of age to decrypt a ciphertext: once the
+// file key is unwrapped, the failures other than a truncated payload are the
+// ones of the header MAC, and are reported as ErrAlteredHeader.
+func headerError(err error, unwrapped bool) error {
+	if unwrapped && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("hybrid decrypt: %w: %w", ErrAlteredHeader, err)
 	}
 
-	return nil
+	return fmt.Errorf("hybrid decrypt: %w", err)
 }
 
+// These pools allow services decrypting many ciphertexts to reuse the buffers
+// needed for every decryption. The readers are only put back once the
+// plaintext was fully copied, since age reads the payload lazily.
+var (
+	readerPool = sync.Pool{New: func() any { return bufio.NewReader(nil) }}
+	copyPool   = sync.Pool{New: func() any { buf := make([]byte, copyBufferSize); return &buf }}
+)
+
+// armorHeader is compared against the start of the ciphertexts to detect the
+// armored ones.
+var armorHeader = []byte(armor.Header)
+
 // Metadata will return details about the drand network
 func (t Tlock) Metadata(dst io.Writer) (err error) {
+	return t.writeMetadata(dst, nil)
+}
+
+// RoundMetadata will return details about the drand network like Metadata,
+// along with when the round is reached, allowing to check the round towards
+// which data is about to be encrypted.
+func (t Tlock) RoundMetadata(dst io.Writer, roundNumber uint64) error {
+	now := time.Now()
+	unlockTime := t.network.TimeOf(roundNumber)
+
+	return t.writeMetadata(dst, &roundMetadata{
+		Number:     roundNumber,
+		UnlockTime: unlockTime.UTC(),
+		Remaining:  max(unlockTime.Sub(now), 0).Round(time.Second),
+		Passed:     roundNumber <= t.network.Current(now),
+	})
+}
+
+// roundMetadata describes when a round is reached.
+type roundMetadata struct {
+	Number     uint64        `yaml:"number"`
+	UnlockTime time.Time     `yaml:"unlock_time"`
+	Remaining  time.Duration `yaml:"remaining"`
+	Passed     bool          `yaml:"passed"`
+}
+
+// writeMetadata writes the details about the drand network, and about the
+// round if any, in yaml format.
+func (t Tlock) writeMetadata(dst io.Writer, round *roundMetadata) error {
 	type Metadata struct {
-		ChainHash string `yaml:"chain_hash"`
-		Current   uint64 `yaml:"current"`
-		PublicKey string `yaml:"public_key"`
-		Scheme    string `yaml:"scheme"`
+		ChainHash   string         `yaml:"chain_hash"`
+		Current     uint64         `yaml:"current"`
+		Period      time.Duration  `yaml:"period"`
+		GenesisTime int64          `yaml:"genesis_time"`
+		PublicKey   string         `yaml:"public_key"`
+		Scheme      string         `yaml:"scheme"`
+		Round       *roundMetadata `yaml:"round,omitempty"`
 	}
 	scheme := t.network.Scheme()
 	metadata := Metadata{
-		ChainHash: t.network.ChainHash(),
-		Current:   t.network.Current(time.Now()),
-		PublicKey: t.network.PublicKey().String(),
-		Scheme:    scheme.String(),
+		ChainHash:   t.network.ChainHash(),
+		Current:     t.network.Current(time.Now()),
+		Period:      t.network.Period(),
+		GenesisTime: t.network.GenesisTime(),
+		PublicKey:   t.network.PublicKey().String(),
+		Scheme:      scheme.String(),
+		Round:       round,
 	}
 	metadataBytes, err := yaml.Marshal(metadata)
 	if err != nil {
@@ -172,25 +527,80 @@ func TimeUnlock(scheme crypto.Scheme, publicKey kyber.Point, beacon chain.Beacon
 		return nil, fmt.Errorf("verify beacon: %w", err)
 	}
 
+	return unlock(scheme, beacon.Signature, ciphertext)
+}
+
+// TimeUnlockBatch decrypts the ciphertexts encrypted towards the round of the
+// given beacon, verifying the beacon once for all of them instead of once per
+// ciphertext. Each decryption still requires its own pairing, the ciphertexts
+// having distinct ephemeral keys.
+func TimeUnlockBatch(scheme crypto.Scheme, publicKey kyber.Point, beacon chain.Beacon, ciphertexts []*ibe.Ciphertext) ([][]byte, error) {
+	if err := scheme.VerifyBeacon(&beacon, publicKey); err != nil {
+		return nil, fmt.Errorf("verify beacon: %w", err)
+	}
+
+	data := make([][]byte, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		d, err := unlock(scheme, beacon.Signature, ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		data[i] = d
+	}
+
+	return data, nil
+}
+
+// TimeUnlockBestEffort decrypts the specified ciphertext bytes using only the
+// signature of the round they were encrypted towards. Since the public key of
+// the network is unknown, the beacon can't be verified: the scheme is inferred
+// from the signature and ciphertext lengths and all compatible schemes are
+// tried in turn, relying on the CCA check of the IBE to reject wrong ones.
+func TimeUnlockBestEffort(signature []byte, ciphertext []byte) ([]byte, error) {
+	for _, newScheme := range []func() *crypto.Scheme{
+		crypto.NewPedersenBLSUnchainedG1,
+		crypto.NewPedersenBLSUnchainedSwapped,
+		crypto.NewPedersenBLSUnchained,
+	} {
+		scheme := newScheme()
+		if len(signature) != scheme.SigGroup.PointLen() {
+			continue
+		}
+
+		ct, err := BytesToCiphertext(*scheme, ciphertext)
+		if err != nil {
+			continue
+		}
+
+		if data, err := unlock(*scheme, signature, ct); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, ErrNoCompatibleScheme
+}
+
+// unlock decrypts the ciphertext with the signature without verifying it.
+func unlock(scheme crypto.Scheme, sig []byte, ciphertext *ibe.Ciphertext) ([]byte, error) {
 	var data []byte
 	var err error
 	switch scheme.Name {
 	case crypto.ShortSigSchemeID:
 		var signature bls.KyberG1
-		if err := signature.UnmarshalBinary(beacon.Signature); err != nil {
+		if err := signature.UnmarshalBinary(sig); err != nil {
 			return nil, fmt.Errorf("unmarshal kyber G1: %w", err)
 		}
 		// the ShortSigSchemeID uses the wrong DST for G1, so we keep it for retro-compatibility
 		data, err = ibe.DecryptCCAonG2(bls.NewBLS12381SuiteWithDST(bls.DefaultDomainG2(), bls.DefaultDomainG2()), &signature, ciphertext)
 	case crypto.UnchainedSchemeID:
 		var signature bls.KyberG2
-		if err := signature.UnmarshalBinary(beacon.Signature); err != nil {
+		if err := signature.UnmarshalBinary(sig); err != nil {
 			return nil, fmt.Errorf("unmarshal kyber G2: %w", err)
 		}
 		data, err = ibe.DecryptCCAonG1(bls.NewBLS12381Suite(), &signature, ciphertext)
 	case crypto.SigsOnG1ID:
 		var signature bls.KyberG1
-		if err := signature.UnmarshalBinary(beacon.Signature); err != nil {
+		if err := signature.UnmarshalBinary(sig); err != nil {
 			return nil, fmt.Errorf("unmarshal kyber G1: %w", err)
 		}
 		data, err = ibe.DecryptCCAonG2(bls.NewBLS12381Suite(), &signature, ciphertext)
@@ -205,6 +615,117 @@ func TimeUnlock(scheme crypto.Scheme, publicKey kyber.Point, beacon chain.Beacon
 	return data, nil
 }
 
+// TimeLockNamed is like TimeLock, but takes the drand scheme name and the
+// marshalled public key of the network instead of their decoded values.
+func TimeLockNamed(schemeName string, publicKey []byte, roundNumber uint64, data []byte) (*ibe.Ciphertext, error) {
+	scheme, pk, err := schemeAndKey(schemeName, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return TimeLock(scheme, pk, roundNumber, data)
+}
+
+// TimeUnlockNamed is like TimeUnlock, but takes the drand scheme name, the
+// marshalled public key of the network and the signature of the given round
+// instead of their decoded values.
+func TimeUnlockNamed(schemeName string, publicKey []byte, roundNumber uint64, signature []byte, ciphertext *ibe.Ciphertext) ([]byte, error) {
+	scheme, pk, err := schemeAndKey(schemeName, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	beacon := chain.Beacon{
+		Round:     roundNumber,
+		Signature: signature,
+	}
+
+	return TimeUnlock(scheme, pk, beacon, ciphertext)
+}
+
+// schemeAndKey resolves the scheme name through the drand registry and decodes
+// the public key on the key group of that scheme.
+func schemeAndKey(schemeName string, publicKey []byte) (crypto.Scheme, kyber.Point, error) {
+	scheme, err := crypto.SchemeFromName(schemeName)
+	if err != nil {
+		return crypto.Scheme{}, nil, fmt.Errorf("unsupported drand scheme: %w", err)
+	}
+
+	if exp := scheme.KeyGroup.PointLen(); len(publicKey) != exp {
+		return crypto.Scheme{}, nil, fmt.Errorf("incorrect public key length: exp: %d got: %d", exp, len(publicKey))
+	}
+
+	pk := scheme.KeyGroup.Point()
+	if err := pk.UnmarshalBinary(publicKey); err != nil {
+		return crypto.Scheme{}, nil, fmt.Errorf("unmarshal public key (type %T): %w", scheme.KeyGroup, err)
+	}
+
+	return *scheme, pk, nil
+}
+
+// =============================================================================
+
+// maxTrailingWhitespace is the amount of whitespace accepted after an armored
+// ciphertext, as done by age.
+const maxTrailingWhitespace = 1024
+
+// armorEnd passes an armored ciphertext through up to its footer line, and
+// then either checks that only whitespace follows or ignores what follows.
+type armorEnd struct {
+	r             *bufio.Reader
+	allowTrailing bool
+	pending       []byte
+	midLine       bool
+	done          bool
+}
+
+func (a *armorEnd) Read(p []byte) (int, error) {
+	if len(a.pending) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		// the line points into the buffer of the reader, which is only read
+		// again once the line was fully consumed, avoiding a copy per line.
+		line, err := a.r.ReadSlice('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+
+		atStart := !a.midLine
+		a.midLine = errors.Is(err, bufio.ErrBufferFull)
+
+		if atStart && !a.midLine && string(bytes.TrimRight(line, "\r\n")) == armor.Footer {
+			a.done = true
+			if !a.allowTrailing {
+				// checking the trailing data reads past the footer line.
+				line = append([]byte(nil), line...)
+				if err := a.checkTrailing(); err != nil {
+					return 0, err
+				}
+			}
+		}
+		a.pending = line
+	}
+
+	n := copy(p, a.pending)
+	a.pending = a.pending[n:]
+	return n, nil
+}
+
+// checkTrailing fails if anything else than whitespace follows the footer.
+func (a *armorEnd) checkTrailing() error {
+	buf, err := io.ReadAll(io.LimitReader(a.r, maxTrailingWhitespace))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(buf)) != 0 || len(buf) == maxTrailingWhitespace {
+		return ErrTrailingData
+	}
+
+	return nil
+}
+
 // =============================================================================
 
 // These constants define the size of the different CipherDEK fields.
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"filippo.io/age"
 	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/kyber/encrypt/ibe"
 )
 
 var ErrWrongChainhash = errors.New("invalid chainhash")
@@ -20,6 +23,10 @@ var ErrWrongChainhash = errors.New("invalid chainhash")
 type Recipient struct {
 	network     Network
 	roundNumber uint64
+	stanzaType  string
+	passphrase  string
+	condition   string
+	version     int
 }
 
 func NewRecipient(network Network, roundNumber uint64) *Recipient {
@@ -40,10 +47,33 @@ func (t *Recipient) SetRound(round uint64) {
 	t.roundNumber = round
 }
 
+// SetStanzaType sets the type of the stanzas written by Wrap, which must have
+// been registered using RegisterStanzaCodec. It defaults to StanzaType.
+func (t *Recipient) SetStanzaType(stanzaType string) {
+	t.stanzaType = stanzaType
+}
+
+// SetStanzaVersion sets the version of the tlock stanzas written by Wrap, see
+// StanzaVersion. It defaults to 1, which every decrypter supports.
+func (t *Recipient) SetStanzaVersion(version int) {
+	t.version = version
+}
+
+// SetRoundPassphrase makes Wrap write stanzas of type HiddenStanzaType, hiding
+// the round from anyone not knowing the passphrase, instead of stanzas of its
+// stanza type.
+func (t *Recipient) SetRoundPassphrase(passphrase string) {
+	t.passphrase = passphrase
+}
+
 // Wrap is called by the age Encrypt API and is provided the DEK generated by
 // age that is used for encrypting/decrypting data. Inside of Wrap we encrypt
 // the DEK using timelock encryption.
 func (t *Recipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	if t.roundNumber == 0 {
+		return nil, ErrInvalidRound
+	}
+
 	ciphertext, err := TimeLock(t.network.Scheme(), t.network.PublicKey(), t.roundNumber, fileKey)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt dek: %w", err)
@@ -54,13 +84,45 @@ func (t *Recipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
 		return nil, fmt.Errorf("bytes: %w", err)
 	}
 
-	stanza := age.Stanza{
-		Type: "tlock",
-		Args: []string{strconv.FormatUint(t.roundNumber, 10), t.network.ChainHash()},
-		Body: body,
+	if t.passphrase != "" && t.condition != "" {
+		return nil, errors.New("conditional stanzas can't hide their round")
+	}
+
+	if t.condition != "" {
+		return []*age.Stanza{encodeOracle(t.roundNumber, t.network.ChainHash(), t.condition, body)}, nil
+	}
+
+	if t.passphrase != "" {
+		stanza, err := hideRound(t.passphrase, t.roundNumber, t.network.ChainHash(), body)
+		if err != nil {
+			return nil, fmt.Errorf("hide round: %w", err)
+		}
+		return []*age.Stanza{stanza}, nil
+	}
+
+	stanzaType := t.stanzaType
+	if stanzaType == "" {
+		stanzaType = StanzaType
+	}
+	if stanzaType == StanzaType && t.version > 1 {
+		stanza, err := encodeVersioned(t.version, t.roundNumber, t.network.ChainHash(), body)
+		if err != nil {
+			return nil, err
+		}
+		return []*age.Stanza{stanza}, nil
+	}
+
+	codec, ok := stanzaCodec(stanzaType)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStanzaType, stanzaType)
 	}
 
-	return []*age.Stanza{&stanza}, nil
+	stanza, err := codec.Encode(t.roundNumber, t.network.ChainHash(), body)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s stanza: %w", stanzaType, err)
+	}
+
+	return []*age.Stanza{stanza}, nil
 }
 
 func (t *Recipient) String() string {
@@ -85,6 +147,20 @@ func (t *Recipient) String() string {
 type Identity struct {
 	network        Network
 	trustChainhash bool
+	trustedChains  []string
+	restricted     bool
+	switcher       ChainSwitcher
+	switched       bool
+	unlocked       uint64
+
+	roundPassphrase string
+	guessFirst      uint64
+	guessLast       uint64
+
+	oracle Oracle
+
+	// scan makes the guessed rounds replace the rounds of every stanza.
+	scan bool
 }
 
 func NewIdentity(network Network, trustChainhash bool) *Identity {
@@ -102,6 +178,34 @@ func (t *Identity) SetTrust(trust bool) {
 	t.trustChainhash = trust
 }
 
+// SetTrustedChains restricts the chains the identity switches to, when it
+// trusts the chain hash of ciphertexts, to the given ones. No chain is
+// switched to if none is given.
+func (t *Identity) SetTrustedChains(chainHashes ...string) {
+	t.trustedChains = chainHashes
+	t.restricted = true
+}
+
+// SetChainSwitcher makes the identity switch to the chain hash of a ciphertext
+// on the network returned by the switcher, instead of switching its network.
+func (t *Identity) SetChainSwitcher(switcher ChainSwitcher) {
+	t.switcher = switcher
+}
+
+// SetRoundPassphrase makes Unwrap reveal the round of the stanzas of type
+// HiddenStanzaType with the passphrase.
+func (t *Identity) SetRoundPassphrase(passphrase string) {
+	t.roundPassphrase = passphrase
+}
+
+// SetGuessedRounds makes Unwrap try each of the rounds from first to last for
+// the stanzas of type HiddenStanzaType, when their passphrase isn't known.
+// Each guess requires the signature of its round, so only the rounds up to
+// the current one of the network are tried.
+func (t *Identity) SetGuessedRounds(first uint64, last uint64) {
+	t.guessFirst, t.guessLast = max(first, 1), last
+}
+
 // Unwrap is called by the age Decrypt API and is provided the DEK that was time
 // lock encrypted by the Wrap function via the Stanza. Inside of Unwrap we decrypt
 // the DEK and provide back to age. If the ciphertext uses a chainhash different
@@ -111,59 +215,106 @@ func (t *Identity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
 		return nil, errors.New("check stanzas length: should be at least one")
 	}
 
-	invalid := ""
+	invalid, untrusted, unsupported, hidden := "", "", "", false
+	var (
+		candidates []candidate
+		unresolved error
+	)
 	for _, stanza := range stanzas {
-		if stanza.Type != "tlock" {
+		var (
+			roundNumber uint64
+			chainHash   string
+			condition   string
+			body        []byte
+			err         error
+		)
+		switch stanza.Type {
+		case HiddenStanzaType:
+			if t.roundPassphrase == "" && t.guessFirst == 0 {
+				hidden = true
+				continue
+			}
+			chainHash, body, err = decodeHidden(stanza)
+		case OracleStanzaType:
+			roundNumber, chainHash, condition, body, err = decodeOracle(stanza)
+		default:
+			roundNumber, chainHash, body, err = decodeStanza(stanza)
+		}
+		var versionErr *versionError
+		if errors.As(err, &versionErr) {
+			unsupported = versionErr.reason
 			continue
 		}
-
-		if len(stanza.Args) != 2 {
+		if errors.Is(err, age.ErrIncorrectIdentity) {
 			continue
 		}
-
-		roundNumber, err := strconv.ParseUint(stanza.Args[0], 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("parse block round: %w", err)
-		}
-
-		if t.network.ChainHash() != stanza.Args[1] {
-			invalid = stanza.Args[1]
-			if t.trustChainhash {
-				fmt.Fprintf(os.Stderr, "WARN: stanza using different chainhash '%s', trying to use it instead.\n", invalid)
-				err = t.network.SwitchChainHash(invalid)
-				if err != nil {
-					continue
-				}
-			} else {
+			return nil, err
+		}
+
+		if t.network.ChainHash() != chainHash {
+			invalid = chainHash
+			// the network can only be switched before any stanza of the
+			// current chain is retained.
+			if !t.trustChainhash || len(candidates) > 0 {
+				continue
+			}
+			if !t.trusts(invalid) {
+				untrusted = invalid
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "WARN: stanza using different chainhash '%s', trying to use it instead.\n", invalid)
+			if err := t.switchChainHash(invalid); err != nil {
 				continue
 			}
 		}
 
-		ciphertext, err := BytesToCiphertext(t.network.Scheme(), stanza.Body)
-		if err != nil {
-			return nil, fmt.Errorf("parse cipher dek: %w", err)
+		if condition != "" {
+			if err := t.resolve(chainHash, condition); err != nil {
+				unresolved = err
+				continue
+			}
 		}
 
-		signature, err := t.network.Signature(roundNumber)
+		ciphertext, err := BytesToCiphertext(t.network.Scheme(), body)
 		if err != nil {
-			return nil, fmt.Errorf(
-				"%w: expected round %d > %d current round",
-				ErrTooEarly,
-				roundNumber,
-				t.network.Current(time.Now()))
+			return nil, fmt.Errorf("parse cipher dek: %w", err)
 		}
 
-		beacon := chain.Beacon{
-			Round:     roundNumber,
-			Signature: signature,
+		roundNumbers := []uint64{roundNumber}
+		switch {
+		case t.scan:
+			if roundNumbers, err = t.guessedRounds(); err != nil {
+				return nil, err
+			}
+		case stanza.Type == HiddenStanzaType:
+			if roundNumbers, err = t.hiddenRounds(stanza); err != nil {
+				return nil, err
+			}
 		}
-
-		fileKey, err := TimeUnlock(t.network.Scheme(), t.network.PublicKey(), beacon, ciphertext)
-		if err != nil {
-			return nil, fmt.Errorf("decrypt dek: %w", err)
+		for _, roundNumber := range roundNumbers {
+			candidates = append(candidates, candidate{roundNumber: roundNumber, ciphertext: ciphertext})
 		}
+	}
 
-		return fileKey, nil
+	if len(candidates) > 0 {
+		return t.unlockAny(candidates)
+	}
+
+	if unresolved != nil {
+		return nil, unresolved
+	}
+
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("%w: %s, a later version of tlock is required to decrypt the ciphertext", ErrUnsupportedStanzaVersion, unsupported)
+	}
+
+	if len(untrusted) > 0 {
+		return nil, fmt.Errorf("%w: %s the ciphertext requires isn't one of the trusted chains", ErrWrongChainhash, untrusted)
+	}
+
+	if hidden {
+		return nil, fmt.Errorf("%w: its passphrase or the rounds to guess are required", ErrHiddenRound)
 	}
 
 	if len(invalid) > 0 {
@@ -174,6 +325,173 @@ func (t *Identity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
 	return nil, fmt.Errorf("check stanza type: wrong type: %w", age.ErrIncorrectIdentity)
 }
 
+// trusts reports whether the identity may switch to the chain hash, which is
+// any chain unless the trusted chains were set.
+func (t *Identity) trusts(chainHash string) bool {
+	return !t.restricted || slices.ContainsFunc(t.trustedChains, func(trusted string) bool {
+		return strings.EqualFold(trusted, chainHash)
+	})
+}
+
+// switchChainHash switches the identity to the chain hash, on the network
+// returned by its switcher if it has one, or by switching its network.
+func (t *Identity) switchChainHash(chainHash string) error {
+	if t.switcher == nil {
+		if err := t.network.SwitchChainHash(chainHash); err != nil {
+			return err
+		}
+		t.switched = true
+		return nil
+	}
+
+	network, err := t.switcher(chainHash)
+	if err != nil {
+		return err
+	}
+	t.network = network
+	t.switched = true
+
+	return nil
+}
+
+// candidate is a stanza of the chain of the network, which may be unlocked.
+type candidate struct {
+	roundNumber uint64
+	ciphertext  *ibe.Ciphertext
+}
+
+// maxConcurrentUnlocks bounds the number of stanzas unlocked at once, each
+// requiring a pairing.
+var maxConcurrentUnlocks = runtime.GOMAXPROCS(0)
+
+// unlockAny unlocks the candidates concurrently and returns the first file key
+// unlocked, recording its round. The candidates not started yet are then
+// skipped, but it doesn't wait for the ones in progress, whose requests to the
+// network may complete after it returned. If none of them can be unlocked, the
+// error of the candidate with the earliest round is returned.
+func (t *Identity) unlockAny(candidates []candidate) ([]byte, error) {
+	if len(candidates) == 1 {
+		fileKey, err := t.unlock(candidates[0])
+		if err != nil {
+			return nil, err
+		}
+		t.unlocked = candidates[0].roundNumber
+		return fileKey, nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		once    sync.Once
+		fileKey []byte
+		errs    = make([]error, len(candidates))
+		sem     = make(chan struct{}, maxConcurrentUnlocks)
+		done    = make(chan struct{})
+	)
+
+start:
+	for i, c := range candidates {
+		select {
+		case sem <- struct{}{}:
+		case <-done:
+			break start
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// another candidate may have been unlocked while waiting.
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			key, err := t.unlock(c)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			won := false
+			once.Do(func() {
+				fileKey = key
+				t.unlocked = c.roundNumber
+				won = true
+				close(done)
+			})
+			if !won {
+				wipe(key)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-done:
+		return fileKey, nil
+	case <-finished:
+	}
+
+	// every candidate was tried if none succeeded.
+	if fileKey != nil {
+		return fileKey, nil
+	}
+	earliest := 0
+	for i, c := range candidates {
+		if c.roundNumber < candidates[earliest].roundNumber {
+			earliest = i
+		}
+	}
+	return nil, errs[earliest]
+}
+
+// unlock decrypts the file key of the candidate using the signature of its
+// round.
+func (t *Identity) unlock(c candidate) ([]byte, error) {
+	signature, err := t.network.Signature(c.roundNumber)
+	if err != nil {
+		return nil, signatureError(t.network, c.roundNumber, err)
+	}
+
+	beacon := chain.Beacon{
+		Round:     c.roundNumber,
+		Signature: signature,
+	}
+
+	fileKey, err := TimeUnlock(t.network.Scheme(), t.network.PublicKey(), beacon, c.ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w %d: %w", ErrStanzaMismatch, c.roundNumber, err)
+	}
+
+	return fileKey, nil
+}
+
+// signatureError qualifies the failure of the network to give the signature of
+// the round: it wraps ErrTooEarly along with the error of the network, unless
+// the network reports it couldn't be reached or answered with data which can't
+// be trusted, in which case its error is propagated as it is.
+func signatureError(network Network, roundNumber uint64, err error) error {
+	var unavailable interface{ Unavailable() bool }
+	var untrusted interface{ Untrusted() bool }
+	if errors.As(err, &unavailable) && unavailable.Unavailable() ||
+		errors.As(err, &untrusted) && untrusted.Untrusted() {
+		return fmt.Errorf("signature of round %d: %w", roundNumber, err)
+	}
+
+	return fmt.Errorf(
+		"%w: expected round %d > %d current round: %w",
+		ErrTooEarly,
+		roundNumber,
+		network.Current(time.Now()),
+		err)
+}
+
 func (t *Identity) String() string {
 	sb := strings.Builder{}
 
@@ -184,3 +502,44 @@ func (t *Identity) String() string {
 
 	return sb.String()
 }
+
+// =============================================================================
+
+// SignatureIdentity implements the age Identity interface when only the
+// signature of a round is known. This is used to decrypt data with the age
+// Decrypt API on a best effort basis, without any network information.
+type SignatureIdentity struct {
+	signature []byte
+}
+
+func NewSignatureIdentity(signature []byte) *SignatureIdentity {
+	return &SignatureIdentity{
+		signature: signature,
+	}
+}
+
+// Unwrap is called by the age Decrypt API and tries to decrypt the DEK of every
+// tlock stanza with the signature, since we can't know which round it is for.
+func (t *SignatureIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	var err error
+	for _, stanza := range stanzas {
+		_, _, body, decodeErr := decodeStanza(stanza)
+		if decodeErr != nil {
+			continue
+		}
+
+		var fileKey []byte
+		fileKey, err = TimeUnlockBestEffort(t.signature, body)
+		if err != nil {
+			continue
+		}
+
+		return fileKey, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("decrypt dek: %w", err)
+	}
+
+	return nil, fmt.Errorf("check stanza type: wrong type: %w", age.ErrIncorrectIdentity)
+}
@@ -3,9 +3,15 @@ package tlock
 import (
 	"bytes"
 	"crypto/rand"
+	"runtime"
 	"testing"
 	"time"
 
+	"filippo.io/age"
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock/networks/fixed"
 	"github.com/drand/tlock/networks/http"
 )
 
@@ -49,3 +55,93 @@ func Test_WrapUnwrap(t *testing.T) {
 		t.Fatalf("decrypted filekey is invalid; expected %d; got %d", len(b), len(fileKey))
 	}
 }
+
+func BenchmarkUnwrap(b *testing.B) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	// only the last of the stanzas can be unlocked, the signature being the
+	// one of its round.
+	const stanzasCount = 8
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: stanzasCount}))
+	if err != nil {
+		b.Fatalf("sign: %s", err)
+	}
+	network, err := fixed.NewNetwork(testnetChainHash, publicKey, scheme, 3*time.Second, 0, signature)
+	if err != nil {
+		b.Fatalf("network error %s", err)
+	}
+
+	fileKey := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		b.Fatalf("rand read filekey: %s", err)
+	}
+
+	var stanzas []*age.Stanza
+	for round := range uint64(stanzasCount) {
+		stanza, err := NewRecipient(network, round+1).Wrap(fileKey)
+		if err != nil {
+			b.Fatalf("wrap error %s", err)
+		}
+		stanzas = append(stanzas, stanza...)
+	}
+
+	for name, concurrency := range map[string]int{"serial": 1, "parallel": runtime.GOMAXPROCS(0)} {
+		b.Run(name, func(b *testing.B) {
+			defer func(n int) { maxConcurrentUnlocks = n }(maxConcurrentUnlocks)
+			maxConcurrentUnlocks = concurrency
+
+			identity := NewIdentity(network, false)
+			for range b.N {
+				if _, err := identity.Unwrap(stanzas); err != nil {
+					b.Fatalf("unwrap error %s", err)
+				}
+			}
+		})
+	}
+}
+
+// keyIdentity records the file key returned by the identity.
+type keyIdentity struct {
+	age.Identity
+	fileKey []byte
+}
+
+func (i *keyIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := i.Identity.Unwrap(stanzas)
+	i.fileKey = fileKey
+	return fileKey, err
+}
+
+func TestDecryptWipesFileKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("identity: %v", err)
+	}
+
+	var cipherData bytes.Buffer
+	w, err := age.Encrypt(&cipherData, identity.Recipient())
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := w.Write([]byte("very nice")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	recorder := keyIdentity{Identity: identity}
+	var plainData bytes.Buffer
+	if err := decrypt(&plainData, &cipherData, &recorder, false, false); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plainData.String() != "very nice" {
+		t.Fatalf("unexpected plaintext %q", plainData.String())
+	}
+
+	if len(recorder.fileKey) == 0 || !bytes.Equal(recorder.fileKey, make([]byte, len(recorder.fileKey))) {
+		t.Fatalf("file key not wiped: %x", recorder.fileKey)
+	}
+}
@@ -0,0 +1,151 @@
+package tlock
+
+import (
+	"io"
+	"time"
+)
+
+// Operation is the kind of operation reported to an audit hook.
+type Operation string
+
+// These are the operations reported to an audit hook.
+const (
+	OpEncrypt   Operation = "encrypt"
+	OpDecrypt   Operation = "decrypt"
+	OpReEncrypt Operation = "reencrypt"
+)
+
+// Event describes an encryption or decryption, as reported to the audit hook
+// of WithAuditHook once it ends.
+type Event struct {
+	Operation Operation
+
+	// Round is the earliest round encrypted towards, or the round the file key
+	// was unlocked with, or zero if the decryption failed before. ChainHash is
+	// the chain hash of the network, the one switched to by the decryption if
+	// it differs.
+	Round     uint64
+	ChainHash string
+
+	// Bytes is the number of bytes of plaintext read by the encryption or
+	// written by the decryption, which is zero for OpenReaderAt as its
+	// plaintext is read afterwards.
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+// WithAuditHook makes the encryptions and decryptions of the tlock, and of the
+// decrypt sessions it creates, report an event to the hook once they end, such
+// as to stream an audit trail to a SIEM. The hook is called synchronously by
+// the goroutine of the operation, so it should hand the event off rather than
+// block. A nil hook, the default, disables the reporting.
+func (t Tlock) WithAuditHook(hook func(Event)) Tlock {
+	t.auditHook = hook
+	return t
+}
+
+// =============================================================================
+
+// auditor records an operation for an audit hook. Its methods do nothing on a
+// nil auditor, the one of the tlocks without a hook.
+type auditor struct {
+	hook  func(Event)
+	event Event
+	start time.Time
+}
+
+// audit starts recording the operation for the audit hook of the tlock, on the
+// chain of its network.
+func (t Tlock) audit(op Operation) *auditor {
+	if t.auditHook == nil {
+		return nil
+	}
+
+	a := auditor{hook: t.auditHook, event: Event{Operation: op}, start: time.Now()}
+	if t.network != nil {
+		a.event.ChainHash = t.network.ChainHash()
+	}
+
+	return &a
+}
+
+// reader counts the bytes of plaintext read from r.
+func (a *auditor) reader(r io.Reader) io.Reader {
+	if a == nil {
+		return r
+	}
+
+	return &countingReader{r: r, n: &a.event.Bytes}
+}
+
+// writer counts the bytes of plaintext written to w.
+func (a *auditor) writer(w io.Writer) io.Writer {
+	if a == nil {
+		return w
+	}
+
+	return &countingWriter{w: w, n: &a.event.Bytes}
+}
+
+// encrypted records the earliest of the rounds encrypted towards.
+func (a *auditor) encrypted(roundNumbers []uint64) {
+	if a == nil || len(roundNumbers) == 0 {
+		return
+	}
+
+	a.event.Round = roundNumbers[0]
+	for _, roundNumber := range roundNumbers[1:] {
+		a.event.Round = min(a.event.Round, roundNumber)
+	}
+}
+
+// decrypted records the round the identity unlocked the file key with, and the
+// chain it was switched to.
+func (a *auditor) decrypted(identity *Identity) {
+	if a == nil || identity.unlocked == 0 {
+		return
+	}
+
+	a.event.Round = identity.unlocked
+	if identity.network != nil {
+		a.event.ChainHash = identity.network.ChainHash()
+	}
+}
+
+// done reports the operation ending with the error to the hook.
+func (a *auditor) done(err error) {
+	if a == nil {
+		return
+	}
+
+	a.event.Duration = time.Since(a.start)
+	a.event.Err = err
+	a.hook(a.event)
+}
+
+// countingReader counts the bytes read from its reader.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+// Read implements the io.Reader interface.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to its writer.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+// Write implements the io.Writer interface.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
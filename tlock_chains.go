@@ -0,0 +1,161 @@
+package tlock
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock/networks/registry"
+)
+
+// KnownChain describes a chain run by the League of Entropy. Its chain
+// information is pinned by its chain hash, so that it can be trusted without
+// network access.
+type KnownChain struct {
+	// Name is the beacon ID of the chain, e.g. quicknet.
+	Name string
+	// Network is the League of Entropy network running the chain, either
+	// mainnet or testnet.
+	Network string
+	// Host is a relay serving the chain.
+	Host string
+	// Deprecated chains should no longer be encrypted towards.
+	Deprecated bool
+
+	ChainHash   string
+	PublicKey   string
+	GroupHash   string
+	Scheme      string
+	Period      time.Duration
+	GenesisTime int64
+}
+
+// KnownChains lists the chains of the League of Entropy networks supported by
+// tlock, as pinned by the registry embedded in the networks/registry package.
+var KnownChains = knownChains()
+
+// knownChains returns the chains of the embedded registry.
+func knownChains() []KnownChain {
+	var known []KnownChain
+	for _, c := range registry.Chains() {
+		publicKey, err := c.Info.PublicKey.MarshalBinary()
+		if err != nil {
+			panic(fmt.Sprintf("public key of %s: %v", c.Name, err))
+		}
+
+		known = append(known, KnownChain{
+			Name:        c.Name,
+			Network:     c.Network,
+			Host:        c.Host,
+			Deprecated:  c.Deprecated,
+			ChainHash:   c.ChainHash(),
+			PublicKey:   hex.EncodeToString(publicKey),
+			GroupHash:   hex.EncodeToString(c.Info.GenesisSeed),
+			Scheme:      c.Info.Scheme,
+			Period:      c.Info.Period,
+			GenesisTime: c.Info.GenesisTime,
+		})
+	}
+
+	return known
+}
+
+// LookupChain returns the known chain of the chain hash, if any.
+func LookupChain(chainHash string) (KnownChain, bool) {
+	for _, known := range KnownChains {
+		if known.ChainHash == chainHash {
+			return known, true
+		}
+	}
+
+	return KnownChain{}, false
+}
+
+// TimeOf returns the time at which the given round is emitted by the chain.
+func (c KnownChain) TimeOf(roundNumber uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(c.Period, c.GenesisTime, roundNumber), 0)
+}
+
+// Info returns the chain information of the chain, which hashes to its chain
+// hash.
+func (c KnownChain) Info() (*chaininfo.Info, error) {
+	scheme, err := crypto.SchemeFromName(c.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("scheme of %s: %w", c.Name, err)
+	}
+
+	b, err := hex.DecodeString(c.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("public key of %s: %w", c.Name, err)
+	}
+	publicKey := scheme.KeyGroup.Point()
+	if err := publicKey.UnmarshalBinary(b); err != nil {
+		return nil, fmt.Errorf("public key of %s: %w", c.Name, err)
+	}
+
+	groupHash, err := hex.DecodeString(c.GroupHash)
+	if err != nil {
+		return nil, fmt.Errorf("group hash of %s: %w", c.Name, err)
+	}
+
+	return &chaininfo.Info{
+		PublicKey:   publicKey,
+		ID:          c.Name,
+		Period:      c.Period,
+		Scheme:      c.Scheme,
+		GenesisTime: c.GenesisTime,
+		GenesisSeed: groupHash,
+	}, nil
+}
+
+// =============================================================================
+
+// NetworkTarget describes the chain and round a ciphertext targets.
+type NetworkTarget struct {
+	ChainHash string
+	Round     uint64
+
+	// Chain is the known chain of the chain hash, nil if it's unknown.
+	Chain *KnownChain
+	// Unlock is when the round is emitted by the known chain, zero if the
+	// chain is unknown.
+	Unlock time.Time
+}
+
+// IdentifyNetwork reads the header of the source, armored or not, and returns
+// the chain and round of its tlock stanza with the earliest round, matched
+// against the known chains to tell when it unlocks. It never accesses the network nor decrypts
+// the payload.
+func IdentifyNetwork(src io.Reader) (NetworkTarget, error) {
+	header, err := ReadHeader(src)
+	if err != nil {
+		return NetworkTarget{}, err
+	}
+
+	stanza := header.Earliest()
+	target := NetworkTarget{
+		ChainHash: stanza.ChainHash,
+		Round:     stanza.Round,
+	}
+	if known, ok := LookupChain(stanza.ChainHash); ok {
+		target.Chain = &known
+		target.Unlock = known.TimeOf(stanza.Round).UTC()
+	}
+
+	return target, nil
+}
+
+// String describes the target, e.g. "round 1000 of mainnet quicknet, unlocking
+// at ~2023-08-23 15:59 UTC".
+func (t NetworkTarget) String() string {
+	if t.Chain == nil {
+		return fmt.Sprintf("round %d of unknown chain %s", t.Round, t.ChainHash)
+	}
+
+	return fmt.Sprintf("round %d of %s %s, unlocking at ~%s",
+		t.Round, t.Chain.Network, t.Chain.Name, t.Unlock.UTC().Format("2006-01-02 15:04 MST"))
+}
@@ -0,0 +1,71 @@
+package tlock_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownChains(t *testing.T) {
+	for _, known := range tlock.KnownChains {
+		info, err := known.Info()
+		require.NoError(t, err, known.Name)
+		require.Equal(t, known.ChainHash, info.HashString(), known.Name)
+
+		found, ok := tlock.LookupChain(known.ChainHash)
+		require.True(t, ok)
+		require.Equal(t, known, found)
+	}
+
+	_, ok := tlock.LookupChain(testnetUnchainedOnG2)
+	require.False(t, ok)
+}
+
+func TestIdentifyNetwork(t *testing.T) {
+	ciphertext, err := os.ReadFile("testdata/lorem-tle-testnet-quicknet-t-2024-01-17-15-28.tle")
+	require.NoError(t, err)
+
+	target, err := tlock.IdentifyNetwork(bytes.NewReader(ciphertext))
+	require.NoError(t, err)
+	require.Equal(t, testnetQuicknetT, target.ChainHash)
+	require.Equal(t, uint64(5423142), target.Round)
+	require.NotNil(t, target.Chain)
+	require.Equal(t, "quicknet-t", target.Chain.Name)
+	require.Equal(t, time.Unix(1689232296+(5423142-1)*3, 0).UTC(), target.Unlock)
+	require.Equal(t, "round 5423142 of testnet quicknet-t, unlocking at ~2024-01-17 14:28 UTC", target.String())
+
+	ciphertext, err = os.ReadFile("testdata/lorem-tle-testnet-unchained-3s-2024-01-17-15-33.tle")
+	require.NoError(t, err)
+
+	target, err = tlock.IdentifyNetwork(bytes.NewReader(ciphertext))
+	require.NoError(t, err)
+	require.Equal(t, testnetUnchainedOnG2, target.ChainHash)
+	require.Nil(t, target.Chain)
+	require.True(t, target.Unlock.IsZero())
+	require.Equal(t, "round 17941628 of unknown chain "+testnetUnchainedOnG2, target.String())
+
+	// the ciphertext unlocks with its earliest round.
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Pick(random.New()), scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+	var cipherData bytes.Buffer
+	w, err := age.Encrypt(&cipherData, tlock.NewRecipient(network, 5000), tlock.NewRecipient(network, 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	target, err = tlock.IdentifyNetwork(&cipherData)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), target.Round)
+	require.Equal(t, time.Unix(1692803367+(100-1)*3, 0).UTC(), target.Unlock)
+
+	_, err = tlock.IdentifyNetwork(bytes.NewReader(dataFile))
+	require.ErrorIs(t, err, tlock.ErrInvalidHeader)
+}
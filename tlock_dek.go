@@ -0,0 +1,72 @@
+package tlock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+// errExtracted stops the decryption once the encrypted DEK was extracted.
+var errExtracted = errors.New("dek extracted")
+
+// ExtractCipherDEK returns the round, the chain hash and the encrypted DEK of
+// the first tlock stanza of the armored or binary ciphertext, without any
+// network access, so that the DEK can be decrypted on a separate machine. The
+// encrypted DEK is decoded with BytesToCiphertext and decrypted with
+// TimeUnlock, or directly with TimeUnlockBestEffort, into the file key to
+// give to InjectFileKey.
+func ExtractCipherDEK(src io.Reader) (roundNumber uint64, chainHash string, ibeCiphertext []byte, err error) {
+	var extractor dekExtractor
+	err = decryptPayload(src, &extractor, false, func(io.Reader) error { return nil })
+	if !errors.Is(err, errExtracted) {
+		return 0, "", nil, err
+	}
+
+	return extractor.roundNumber, extractor.chainHash, extractor.body, nil
+}
+
+// InjectFileKey decrypts the payload of the armored or binary source to the
+// destination using the file key recovered from its encrypted DEK, such as on
+// a separate machine, see ExtractCipherDEK. The decryption fails if the file
+// key isn't the one of the source.
+func InjectFileKey(dst io.Writer, src io.Reader, fileKey []byte) error {
+	return decrypt(dst, src, fileKeyProvider(fileKey), false, false)
+}
+
+// =============================================================================
+
+// dekExtractor implements the age Identity interface, recording the first
+// tlock stanza instead of decrypting it.
+type dekExtractor struct {
+	roundNumber uint64
+	chainHash   string
+	body        []byte
+}
+
+// Unwrap is called by the age Decrypt API and records the first tlock stanza.
+func (e *dekExtractor) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, stanza := range stanzas {
+		roundNumber, chainHash, body, err := decodeStanza(stanza)
+		if err != nil {
+			continue
+		}
+
+		e.roundNumber, e.chainHash, e.body = roundNumber, chainHash, bytes.Clone(body)
+		return nil, errExtracted
+	}
+
+	return nil, fmt.Errorf("%w: no tlock stanza found", ErrInvalidHeader)
+}
+
+// fileKeyProvider implements the age Identity interface, unwrapping every
+// header to the file key. age authenticates the header with it, rejecting any
+// other key.
+type fileKeyProvider []byte
+
+// Unwrap returns a copy of the file key, which is wiped once used.
+func (k fileKeyProvider) Unwrap([]*age.Stanza) ([]byte, error) {
+	return bytes.Clone(k), nil
+}
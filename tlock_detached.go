@@ -0,0 +1,77 @@
+package tlock
+
+import (
+	"io"
+)
+
+// EncryptDetached encrypts the source like Encrypt, but writes the header of
+// the ciphertext, holding the round and the wrapped file key, to the header
+// writer and the payload, the bulk of the encrypted data, to the payload
+// writer. The small header can then be distributed widely while the payload
+// lives in object storage, see DecryptDetached.
+func (t Tlock) EncryptDetached(header io.Writer, payload io.Writer, src io.Reader, roundNumber uint64) error {
+	return t.Encrypt(NewDetachedWriter(header, payload), src, roundNumber)
+}
+
+// DecryptDetached decrypts the payload of a ciphertext whose header was
+// detached by EncryptDetached or NewDetachedWriter.
+func (t Tlock) DecryptDetached(dst io.Writer, header io.Reader, payload io.Reader) error {
+	return t.Decrypt(dst, io.MultiReader(header, payload))
+}
+
+// NewDetachedWriter returns a writer of binary ciphertexts which writes their
+// header, up to and including the line of its MAC, to the header writer and
+// their payload to the payload writer. Concatenating both gives back the
+// ciphertext.
+func NewDetachedWriter(header io.Writer, payload io.Writer) io.Writer {
+	return &detachedWriter{header: header, payload: payload}
+}
+
+// =============================================================================
+
+// detachedWriter splits the ciphertext written to it at the end of its header.
+type detachedWriter struct {
+	header  io.Writer
+	payload io.Writer
+
+	// prefix holds the first bytes of the current line of the header, enough
+	// to recognize the line of the MAC.
+	prefix []byte
+	done   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *detachedWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return w.payload.Write(p)
+	}
+
+	end := w.scan(p)
+	n, err := w.header.Write(p[:end])
+	if err != nil || end == len(p) {
+		return n, err
+	}
+
+	m, err := w.payload.Write(p[end:])
+	return end + m, err
+}
+
+// scan returns the index following the end of the header in p, or the length
+// of p if the header doesn't end there.
+func (w *detachedWriter) scan(p []byte) int {
+	for i, c := range p {
+		if c == '\n' {
+			if string(w.prefix) == footerPrefix {
+				w.done = true
+				return i + 1
+			}
+			w.prefix = w.prefix[:0]
+			continue
+		}
+		if len(w.prefix) < len(footerPrefix) {
+			w.prefix = append(w.prefix, c)
+		}
+	}
+
+	return len(p)
+}
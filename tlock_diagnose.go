@@ -0,0 +1,413 @@
+package tlock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Part identifies a part of a ciphertext.
+type Part int
+
+// These are the parts of a ciphertext located by Diagnose.
+const (
+	// PartArmor is the PEM encoding of an armored ciphertext.
+	PartArmor Part = iota + 1
+	// PartHeader is the header of the ciphertext, outside of its stanzas,
+	// such as its intro line and its MAC.
+	PartHeader
+	// PartStanza is a stanza of the header.
+	PartStanza
+	// PartPayload is a chunk of the payload following the header.
+	PartPayload
+)
+
+// String implements the fmt.Stringer interface.
+func (p Part) String() string {
+	switch p {
+	case PartArmor:
+		return "armor"
+	case PartHeader:
+		return "header"
+	case PartStanza:
+		return "stanza"
+	case PartPayload:
+		return "body chunk"
+	}
+	return fmt.Sprintf("part %d", int(p))
+}
+
+// Damage locates a damaged part of a ciphertext.
+type Damage struct {
+	Part Part
+
+	// Index is the number of the stanza or body chunk, starting at 1.
+	Index int
+
+	// Line is the line of the armor, or of the header, the damage was found
+	// at, starting at 1, or 0 for the payload.
+	Line int
+
+	Err error
+}
+
+// Error implements the error interface.
+func (d Damage) Error() string {
+	switch {
+	case d.Index != 0 && d.Line != 0:
+		return fmt.Sprintf("%s %d, line %d: %v", d.Part, d.Index, d.Line, d.Err)
+	case d.Index != 0:
+		return fmt.Sprintf("%s %d: %v", d.Part, d.Index, d.Err)
+	case d.Line != 0:
+		return fmt.Sprintf("%s, line %d: %v", d.Part, d.Line, d.Err)
+	}
+	return fmt.Sprintf("%s: %v", d.Part, d.Err)
+}
+
+// Unwrap returns the error of the damage.
+func (d Damage) Unwrap() error {
+	return d.Err
+}
+
+// Diagnosis describes what remains of a possibly damaged ciphertext.
+type Diagnosis struct {
+	Armored bool
+
+	// Stanzas are the intact tlock stanzas, like the ones of ReadHeader.
+	Stanzas []Stanza
+
+	// DEKIntact reports whether a stanza wrapping the file key with timelock
+	// encryption is intact, so that the file key can be unlocked once its
+	// round is reached.
+	DEKIntact bool
+
+	// HeaderIntact reports whether every stanza and the MAC of the header are
+	// intact.
+	HeaderIntact bool
+
+	// Chunks is the number of chunks of the payload which were found
+	// complete. Their content can't be checked without the file key.
+	Chunks int
+
+	// Damages are the damaged parts, in the order they were found. The damage
+	// of the armor is followed by the damage of the part it cuts.
+	Damages []Damage
+
+	stanzas []*age.Stanza
+	mac     string
+}
+
+// These define the format of the age header, whose lines are bounded to be
+// read in memory.
+const (
+	columnsPerLine = 64
+	macSize        = 32
+	maxHeaderLine  = 64 << 10
+)
+
+// Diagnose parses the source, armored or not, without decrypting it, carrying
+// on past the damaged parts to report all of them and salvage the intact
+// stanzas. It only fails if the source can't be read.
+func Diagnose(src io.Reader) (Diagnosis, error) {
+	var d Diagnosis
+
+	rr := bufio.NewReaderSize(src, maxHeaderLine)
+	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
+		d.Armored = true
+
+		decoded, damage, err := dearmor(rr)
+		if err != nil {
+			return Diagnosis{}, err
+		}
+		if damage != nil {
+			d.Damages = append(d.Damages, *damage)
+		}
+		rr = bufio.NewReaderSize(bytes.NewReader(decoded), maxHeaderLine)
+	}
+
+	if err := d.parseHeader(rr); err != nil {
+		return Diagnosis{}, err
+	}
+	if d.mac != "" {
+		if err := d.countChunks(rr); err != nil {
+			return Diagnosis{}, err
+		}
+	}
+
+	return d, nil
+}
+
+// Damaged reports whether any part of the ciphertext is damaged.
+func (d Diagnosis) Damaged() bool {
+	return len(d.Damages) > 0
+}
+
+// WriteHeader writes the binary header holding the intact stanzas of the
+// ciphertext, which ReadHeader parses. If the MAC of the header was lost, or
+// some stanzas were dropped, the header can't be used to decrypt, the MAC of
+// the original header not matching it, but still tells when the ciphertext
+// unlocks. A lost MAC is written as zeros.
+func (d Diagnosis) WriteHeader(dst io.Writer) error {
+	if len(d.stanzas) == 0 {
+		return fmt.Errorf("%w: no intact stanza", ErrInvalidHeader)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(headerIntro + "\n")
+	for _, stanza := range d.stanzas {
+		b.WriteString(stanzaPrefix + " " + strings.Join(append([]string{stanza.Type}, stanza.Args...), " ") + "\n")
+		body := base64.RawStdEncoding.EncodeToString(stanza.Body)
+		for len(body) >= columnsPerLine {
+			b.WriteString(body[:columnsPerLine] + "\n")
+			body = body[columnsPerLine:]
+		}
+		b.WriteString(body + "\n")
+	}
+
+	mac := d.mac
+	if mac == "" {
+		mac = base64.RawStdEncoding.EncodeToString(make([]byte, macSize))
+	}
+	b.WriteString(footerPrefix + " " + mac + "\n")
+
+	_, err := dst.Write(b.Bytes())
+	return err
+}
+
+// =============================================================================
+
+// dearmor decodes the PEM lines of the armored ciphertext up to its end, or
+// up to its first damaged line, returning what could be decoded along with
+// the damage.
+func dearmor(rr *bufio.Reader) ([]byte, *Damage, error) {
+	var (
+		decoded bytes.Buffer
+		short   bool
+	)
+	for n := 1; ; n++ {
+		line, err := rr.ReadString('\n')
+		switch {
+		case errors.Is(err, io.EOF) && line == "":
+			return decoded.Bytes(), &Damage{Part: PartArmor, Line: n, Err: errors.New("truncated before the end line")}, nil
+		case err != nil && !errors.Is(err, io.EOF):
+			return nil, nil, fmt.Errorf("reading ciphertext: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case n == 1:
+			continue
+		case line == armor.Footer:
+			return decoded.Bytes(), nil, nil
+		case short:
+			return decoded.Bytes(), &Damage{Part: PartArmor, Line: n, Err: errors.New("data following the last line")}, nil
+		case len(line) > columnsPerLine:
+			return decoded.Bytes(), &Damage{Part: PartArmor, Line: n, Err: fmt.Errorf("line of %d columns", len(line))}, nil
+		}
+
+		b, err := base64.StdEncoding.Strict().DecodeString(line)
+		if err != nil {
+			return decoded.Bytes(), &Damage{Part: PartArmor, Line: n, Err: err}, nil
+		}
+		decoded.Write(b)
+		short = len(line) < columnsPerLine
+	}
+}
+
+// parseHeader parses the stanzas of the binary header, recording the intact
+// ones and the MAC, and skipping the damaged stanzas up to the next one.
+func (d *Diagnosis) parseHeader(rr *bufio.Reader) error {
+	line, n, err := readHeaderLine(rr, 0)
+	switch {
+	case errors.Is(err, io.EOF):
+		d.Damages = append(d.Damages, Damage{Part: PartHeader, Line: n, Err: errors.New("missing intro")})
+		return nil
+	case err != nil && !errors.Is(err, bufio.ErrBufferFull):
+		return err
+	}
+	if line != headerIntro {
+		d.Damages = append(d.Damages, Damage{Part: PartHeader, Line: n, Err: fmt.Errorf("unexpected intro %q", truncate(line))})
+		return nil
+	}
+
+	var (
+		stanza   *age.Stanza
+		index    int
+		intact   = true
+		skipping bool
+	)
+	damaged := func(line int, err error) {
+		d.Damages = append(d.Damages, Damage{Part: PartStanza, Index: index, Line: line, Err: err})
+		stanza, intact, skipping = nil, false, true
+	}
+
+	for {
+		line, n, err = readHeaderLine(rr, n)
+		switch {
+		case errors.Is(err, io.EOF):
+			if stanza != nil {
+				damaged(n, errors.New("truncated body"))
+			}
+			d.Damages = append(d.Damages, Damage{Part: PartHeader, Line: n, Err: errors.New("truncated before the MAC")})
+			return nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			if stanza == nil && !skipping {
+				index++
+			}
+			if stanza != nil || !skipping {
+				damaged(n, errors.New("line too long"))
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, stanzaPrefix+" ") || line == stanzaPrefix:
+			if stanza != nil {
+				damaged(n, errors.New("body missing its final line"))
+			}
+			index++
+			skipping = false
+			args := strings.Fields(strings.TrimPrefix(line, stanzaPrefix))
+			if len(args) == 0 {
+				damaged(n, errors.New("missing type"))
+				continue
+			}
+			stanza = &age.Stanza{Type: args[0], Args: args[1:]}
+
+		case strings.HasPrefix(line, footerPrefix):
+			if stanza != nil {
+				damaged(n, errors.New("body missing its final line"))
+			}
+			mac, err := base64.RawStdEncoding.Strict().DecodeString(strings.TrimPrefix(line, footerPrefix+" "))
+			if err != nil || len(mac) != macSize {
+				d.Damages = append(d.Damages, Damage{Part: PartHeader, Line: n, Err: errors.New("malformed MAC")})
+				return nil
+			}
+			d.mac = strings.TrimPrefix(line, footerPrefix+" ")
+			d.HeaderIntact = intact
+			return nil
+
+		case stanza == nil:
+			// the lines of a damaged stanza are skipped up to the next one,
+			// while other lines are the damaged opening of a stanza.
+			if !skipping {
+				index++
+				damaged(n, errors.New("malformed opening line"))
+			}
+
+		case len(line) > columnsPerLine:
+			damaged(n, fmt.Errorf("body line of %d columns", len(line)))
+
+		default:
+			// each full line decodes on its own, locating the damaged one.
+			b, err := base64.RawStdEncoding.Strict().DecodeString(line)
+			if err != nil {
+				damaged(n, err)
+				continue
+			}
+			stanza.Body = append(stanza.Body, b...)
+			if len(line) < columnsPerLine {
+				d.addStanza(stanza)
+				stanza = nil
+			}
+		}
+	}
+}
+
+// addStanza records the intact stanza, along with its round if it's a tlock
+// stanza.
+func (d *Diagnosis) addStanza(stanza *age.Stanza) {
+	d.stanzas = append(d.stanzas, stanza)
+
+	var (
+		round     uint64
+		chainHash string
+		condition string
+		err       error
+	)
+	switch stanza.Type {
+	case HiddenStanzaType:
+		_, _, err = decodeHidden(stanza)
+		d.DEKIntact = d.DEKIntact || err == nil
+		return
+	case OracleStanzaType:
+		round, chainHash, condition, _, err = decodeOracle(stanza)
+	default:
+		round, chainHash, _, err = decodeStanza(stanza)
+	}
+	if err != nil {
+		return
+	}
+
+	d.DEKIntact = true
+	d.Stanzas = append(d.Stanzas, Stanza{Type: stanza.Type, Round: round, ChainHash: chainHash, Condition: condition})
+}
+
+// countChunks counts the complete chunks of the payload, recording the
+// damage of a truncated one.
+func (d *Diagnosis) countChunks(rr *bufio.Reader) error {
+	size, err := io.Copy(io.Discard, rr)
+	if err != nil {
+		return fmt.Errorf("reading ciphertext: %w", err)
+	}
+
+	if size < payloadNonceSize {
+		d.Damages = append(d.Damages, Damage{Part: PartPayload, Index: 1, Err: errors.New("truncated nonce")})
+		return nil
+	}
+	size -= payloadNonceSize
+
+	d.Chunks = int(size / encChunkSize)
+	switch last := size % encChunkSize; {
+	case last == 0 && d.Chunks == 0:
+		d.Damages = append(d.Damages, Damage{Part: PartPayload, Index: 1, Err: errors.New("missing")})
+	case last > 0 && last < chacha20poly1305.Overhead:
+		d.Damages = append(d.Damages, Damage{Part: PartPayload, Index: d.Chunks + 1, Err: fmt.Errorf("truncated to %d bytes", last)})
+	case last > 0:
+		d.Chunks++
+	}
+
+	return nil
+}
+
+// readHeaderLine reads the next line of the header, following the nth one,
+// without its newline.
+func readHeaderLine(rr *bufio.Reader, n int) (string, int, error) {
+	n++
+	line, err := rr.ReadSlice('\n')
+	switch {
+	case errors.Is(err, bufio.ErrBufferFull):
+		// the rest of the line is skipped.
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = rr.ReadSlice('\n')
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", n, fmt.Errorf("reading ciphertext: %w", err)
+		}
+		return "", n, bufio.ErrBufferFull
+	case errors.Is(err, io.EOF):
+		return "", n, io.EOF
+	case err != nil:
+		return "", n, fmt.Errorf("reading ciphertext: %w", err)
+	}
+
+	return strings.TrimSuffix(string(line), "\n"), n, nil
+}
+
+// truncate shortens the line to quote it in an error.
+func truncate(line string) string {
+	if len(line) > columnsPerLine {
+		return line[:columnsPerLine] + "..."
+	}
+	return line
+}
@@ -0,0 +1,122 @@
+package tlock_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age/armor"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).EncryptRounds(&cipherData, bytes.NewReader(dataFile), 1234, 5678))
+	ciphertext := cipherData.String()
+	headerSize := strings.Index(ciphertext, "\n---") + len("\n--- ") + 44
+	stanzas := []tlock.Stanza{
+		{Type: tlock.StanzaType, Round: 1234, ChainHash: mainnetQuicknet},
+		{Type: tlock.StanzaType, Round: 5678, ChainHash: mainnetQuicknet},
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		d, err := tlock.Diagnose(strings.NewReader(ciphertext))
+		require.NoError(t, err)
+		require.False(t, d.Damaged())
+		require.True(t, d.HeaderIntact)
+		require.True(t, d.DEKIntact)
+		require.Equal(t, stanzas, d.Stanzas)
+		require.Equal(t, 1, d.Chunks)
+
+		// the header of an intact ciphertext is written back as it was.
+		var header bytes.Buffer
+		require.NoError(t, d.WriteHeader(&header))
+		require.Equal(t, ciphertext[:headerSize], header.String())
+	})
+
+	t.Run("truncated payload", func(t *testing.T) {
+		d, err := tlock.Diagnose(strings.NewReader(ciphertext[:headerSize+16+5]))
+		require.NoError(t, err)
+		require.True(t, d.HeaderIntact)
+		require.Equal(t, 0, d.Chunks)
+		require.Len(t, d.Damages, 1)
+		require.Equal(t, tlock.PartPayload, d.Damages[0].Part)
+		require.Equal(t, 1, d.Damages[0].Index)
+	})
+
+	t.Run("damaged stanza", func(t *testing.T) {
+		lines := strings.Split(ciphertext[:headerSize], "\n")
+		second := 0
+		for i, line := range lines {
+			if strings.HasPrefix(line, "-> tlock 5678") {
+				second = i
+			}
+		}
+		lines[second+1] = "!" + lines[second+1][1:]
+		damaged := strings.Join(lines, "\n") + ciphertext[headerSize:]
+
+		d, err := tlock.Diagnose(strings.NewReader(damaged))
+		require.NoError(t, err)
+		require.False(t, d.HeaderIntact)
+		require.True(t, d.DEKIntact)
+		require.Equal(t, stanzas[:1], d.Stanzas)
+		require.Equal(t, 1, d.Chunks)
+		require.Len(t, d.Damages, 1)
+		require.Equal(t, tlock.PartStanza, d.Damages[0].Part)
+		require.Equal(t, 2, d.Damages[0].Index)
+		require.Equal(t, second+2, d.Damages[0].Line)
+
+		// the salvaged header still tells when the ciphertext unlocks.
+		var header bytes.Buffer
+		require.NoError(t, d.WriteHeader(&header))
+		h, err := tlock.ReadHeader(&header)
+		require.NoError(t, err)
+		require.Equal(t, stanzas[:1], h.Stanzas)
+	})
+
+	t.Run("truncated armor", func(t *testing.T) {
+		var armored bytes.Buffer
+		w := armor.NewWriter(&armored)
+		require.NoError(t, tlock.New(network).Encrypt(w, bytes.NewReader(dataFile), 1234))
+		require.NoError(t, w.Close())
+
+		// the armor is cut within the MAC of the header.
+		var binary bytes.Buffer
+		require.NoError(t, tlock.New(network).Encrypt(&binary, bytes.NewReader(dataFile), 1234))
+		size := strings.Index(binary.String(), "\n---") + 10
+		cut := len(armor.Header) + 1 + (size+47)/48*65
+
+		d, err := tlock.Diagnose(strings.NewReader(armored.String()[:cut]))
+		require.NoError(t, err)
+		require.True(t, d.Armored)
+		require.False(t, d.HeaderIntact)
+		require.True(t, d.DEKIntact)
+		require.Equal(t, stanzas[:1], d.Stanzas)
+		require.GreaterOrEqual(t, len(d.Damages), 2)
+		require.Equal(t, tlock.PartArmor, d.Damages[0].Part)
+		require.Equal(t, tlock.PartHeader, d.Damages[len(d.Damages)-1].Part)
+
+		var header bytes.Buffer
+		require.NoError(t, d.WriteHeader(&header))
+		h, err := tlock.ReadHeader(&header)
+		require.NoError(t, err)
+		require.Equal(t, stanzas[:1], h.Stanzas)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		d, err := tlock.Diagnose(strings.NewReader("not a ciphertext\n"))
+		require.NoError(t, err)
+		require.False(t, d.DEKIntact)
+		require.Len(t, d.Damages, 1)
+		require.Equal(t, tlock.PartHeader, d.Damages[0].Part)
+		require.ErrorIs(t, d.WriteHeader(&bytes.Buffer{}), tlock.ErrInvalidHeader)
+	})
+}
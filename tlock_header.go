@@ -0,0 +1,144 @@
+package tlock
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ErrInvalidHeader represents an error when a ciphertext doesn't start with a
+// well-formed age header.
+var ErrInvalidHeader = errors.New("invalid age header")
+
+// These constants define the markers of the age header format.
+const (
+	headerIntro  = "age-encryption.org/v1"
+	stanzaPrefix = "->"
+	footerPrefix = "---"
+)
+
+// Header describes the timelock information found in the header of a
+// ciphertext, without requiring any network access nor decrypting it.
+type Header struct {
+	Armored bool
+	Stanzas []Stanza
+}
+
+// Stanza describes a tlock stanza: the ciphertext can be decrypted once the
+// round is reached by the network with the chainhash. The type is StanzaType
+// unless other stanza types were registered.
+type Stanza struct {
+	Type      string
+	Round     uint64
+	ChainHash string
+
+	// Condition is the condition of the stanzas of type OracleStanzaType,
+	// which also has to be met for them to be decrypted.
+	Condition string
+}
+
+// Earliest returns the stanza with the lowest round, which is the first one
+// the ciphertext can be decrypted with when its stanzas are of the same chain.
+// The header must have stanzas, as returned by ReadHeader.
+func (h Header) Earliest() Stanza {
+	return slices.MinFunc(h.Stanzas, func(a, b Stanza) int {
+		return cmp.Compare(a.Round, b.Round)
+	})
+}
+
+// ReadHeader parses the age header of the source, armored or not, and returns
+// the tlock stanzas it contains. The payload itself is never decrypted. The
+// stanzas hiding their round are skipped, failing with ErrHiddenRound if there
+// is no other tlock stanza.
+func ReadHeader(src io.Reader) (Header, error) {
+	var header Header
+	hidden, unsupported := false, false
+
+	rr := bufio.NewReader(src)
+	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
+		header.Armored = true
+		rr = bufio.NewReader(armor.NewReader(rr))
+	}
+
+	line, err := rr.ReadString('\n')
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: read intro: %w", ErrInvalidHeader, err)
+	}
+	if strings.TrimSuffix(line, "\n") != headerIntro {
+		return Header{}, fmt.Errorf("%w: unexpected intro %q", ErrInvalidHeader, line)
+	}
+
+	for {
+		line, err := rr.ReadString('\n')
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: read stanza: %w", ErrInvalidHeader, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if strings.HasPrefix(line, footerPrefix) {
+			break
+		}
+
+		// lines which aren't stanza openings are stanza bodies.
+		if !strings.HasPrefix(line, stanzaPrefix) {
+			continue
+		}
+
+		args := strings.Fields(strings.TrimPrefix(line, stanzaPrefix))
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == HiddenStanzaType {
+			hidden = true
+			continue
+		}
+
+		// the bodies being skipped, only the arguments are decoded.
+		var (
+			round     uint64
+			chainHash string
+			condition string
+		)
+		if args[0] == OracleStanzaType {
+			round, chainHash, condition, _, err = decodeOracle(&age.Stanza{Type: args[0], Args: args[1:]})
+		} else {
+			round, chainHash, _, err = decodeStanza(&age.Stanza{Type: args[0], Args: args[1:]})
+		}
+		if errors.Is(err, ErrUnsupportedStanzaVersion) {
+			unsupported = true
+			continue
+		}
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+		}
+
+		header.Stanzas = append(header.Stanzas, Stanza{
+			Type:      args[0],
+			Round:     round,
+			ChainHash: chainHash,
+			Condition: condition,
+		})
+	}
+
+	if len(header.Stanzas) == 0 && unsupported {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, ErrUnsupportedStanzaVersion)
+	}
+	if len(header.Stanzas) == 0 && hidden {
+		return Header{}, fmt.Errorf("%w: %w", ErrInvalidHeader, ErrHiddenRound)
+	}
+	if len(header.Stanzas) == 0 {
+		return Header{}, fmt.Errorf("%w: no tlock stanza found", ErrInvalidHeader)
+	}
+
+	return header, nil
+}
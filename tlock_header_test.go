@@ -0,0 +1,88 @@
+package tlock_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		file      string
+		round     uint64
+		chainHash string
+	}{
+		{
+			file:      "testdata/lorem-tle-testnet-quicknet-t-2024-01-17-15-28.tle",
+			round:     5423142,
+			chainHash: testnetQuicknetT,
+		},
+		{
+			file:      "testdata/lorem-tle-testnet-unchained-3s-2024-01-17-15-33.tle",
+			round:     17941628,
+			chainHash: testnetUnchainedOnG2,
+		},
+		{
+			file:      "testdata/lorem-timevault-mainnet-2024-01-17-16-12.tle",
+			round:     9273041,
+			chainHash: "dbd506d6ef76e5f386f41c651dcb808c5bcbd75471cc4eafa3f4df7ad4e4c493",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			in, err := os.Open(tc.file)
+			require.NoError(t, err)
+			defer in.Close()
+
+			header, err := tlock.ReadHeader(in)
+			require.NoError(t, err)
+			require.True(t, header.Armored)
+			require.Equal(t, []tlock.Stanza{{Type: tlock.StanzaType, Round: tc.round, ChainHash: tc.chainHash}}, header.Stanzas)
+		})
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		scheme := crypto.NewPedersenBLSUnchainedG1()
+		network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+		require.NoError(t, err)
+
+		var cipherData bytes.Buffer
+		err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234)
+		require.NoError(t, err)
+
+		header, err := tlock.ReadHeader(&cipherData)
+		require.NoError(t, err)
+		require.False(t, header.Armored)
+		require.Equal(t, []tlock.Stanza{{Type: tlock.StanzaType, Round: 1234, ChainHash: mainnetQuicknet}}, header.Stanzas)
+	})
+
+	t.Run("several rounds", func(t *testing.T) {
+		scheme := crypto.NewPedersenBLSUnchainedG1()
+		network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+		require.NoError(t, err)
+
+		var cipherData bytes.Buffer
+		w, err := age.Encrypt(&cipherData, tlock.NewRecipient(network, 5678), tlock.NewRecipient(network, 1234), tlock.NewRecipient(network, 9012))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		header, err := tlock.ReadHeader(&cipherData)
+		require.NoError(t, err)
+		require.Len(t, header.Stanzas, 3)
+		require.Equal(t, uint64(1234), header.Earliest().Round)
+	})
+
+	t.Run("not an age file", func(t *testing.T) {
+		_, err := tlock.ReadHeader(strings.NewReader("hello world\n"))
+		require.ErrorIs(t, err, tlock.ErrInvalidHeader)
+	})
+}
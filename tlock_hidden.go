@@ -0,0 +1,108 @@
+package tlock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"filippo.io/age"
+)
+
+// ErrHiddenRound represents an error when the round of a ciphertext is hidden
+// and can't be revealed, either because neither its passphrase nor rounds to
+// guess were given, or because the passphrase doesn't seal it.
+var ErrHiddenRound = errors.New("the round of the ciphertext is hidden")
+
+// HiddenStanzaType is the type of the stanzas hiding their round, see
+// HideRound. Their arguments are the chain hash followed by the salt and work
+// factor of the scrypt stanza sealing the round, which starts their body and
+// is followed by the encrypted DEK as returned by CiphertextToBytes.
+const HiddenStanzaType = "tlock-hidden"
+
+// These are the sizes of the round, padded to the size of an age file key, and
+// of the sealed round starting the body of the hidden stanzas, followed by its
+// poly1305 tag.
+const (
+	roundBlockSize  = 16
+	sealedRoundSize = roundBlockSize + 16
+)
+
+// scryptStanzaType is the type of the age scrypt stanzas sealing the rounds.
+const scryptStanzaType = "scrypt"
+
+// hideRound returns the hidden stanza of the round of the chain, whose round
+// is sealed with the passphrase.
+func hideRound(passphrase string, roundNumber uint64, chainHash string, body []byte) (*age.Stanza, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("passphrase: %w", err)
+	}
+
+	block := make([]byte, roundBlockSize)
+	binary.BigEndian.PutUint64(block, roundNumber)
+	stanzas, err := recipient.Wrap(block)
+	if err != nil {
+		return nil, fmt.Errorf("seal round: %w", err)
+	}
+	sealed := stanzas[0]
+
+	return &age.Stanza{
+		Type: HiddenStanzaType,
+		Args: append([]string{chainHash}, sealed.Args...),
+		Body: append(sealed.Body, body...),
+	}, nil
+}
+
+// decodeHidden returns the chain hash and encrypted DEK of the hidden stanza.
+// Malformed stanzas fail with an error wrapping age.ErrIncorrectIdentity.
+func decodeHidden(stanza *age.Stanza) (string, []byte, error) {
+	if len(stanza.Args) != 3 {
+		return "", nil, fmt.Errorf("unexpected arguments count %d: %w", len(stanza.Args), age.ErrIncorrectIdentity)
+	}
+	if len(stanza.Body) <= sealedRoundSize {
+		return "", nil, fmt.Errorf("unexpected body size %d: %w", len(stanza.Body), age.ErrIncorrectIdentity)
+	}
+
+	return stanza.Args[0], stanza.Body[sealedRoundSize:], nil
+}
+
+// revealRound returns the round of the hidden stanza sealed with the
+// passphrase.
+func revealRound(passphrase string, stanza *age.Stanza) (uint64, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return 0, fmt.Errorf("passphrase: %w", err)
+	}
+
+	block, err := identity.Unwrap([]*age.Stanza{{
+		Type: scryptStanzaType,
+		Args: stanza.Args[1:],
+		Body: stanza.Body[:sealedRoundSize],
+	}})
+	if err != nil {
+		// the error of age isn't wrapped, since age skips the identities
+		// failing with age.ErrIncorrectIdentity.
+		return 0, fmt.Errorf("%w: %v", ErrHiddenRound, err)
+	}
+
+	roundNumber := binary.BigEndian.Uint64(block)
+	if roundNumber == 0 || binary.BigEndian.Uint64(block[8:]) != 0 {
+		return 0, fmt.Errorf("%w: malformed sealed round", ErrHiddenRound)
+	}
+
+	return roundNumber, nil
+}
+
+// hiddenRounds returns the rounds to unlock the hidden stanza with: its round
+// if the identity has its passphrase, or else the rounds it guesses.
+func (t *Identity) hiddenRounds(stanza *age.Stanza) ([]uint64, error) {
+	if t.roundPassphrase != "" {
+		roundNumber, err := revealRound(t.roundPassphrase, stanza)
+		if err != nil {
+			return nil, err
+		}
+		return []uint64{roundNumber}, nil
+	}
+
+	return t.guessedRounds()
+}
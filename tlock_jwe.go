@@ -0,0 +1,179 @@
+package tlock
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JWEAlgorithm is the "alg" of the JWE whose content encryption key is
+// timelocked by WrapKey.
+const JWEAlgorithm = "TLOCK-BLS12381"
+
+// JWEEncryption is the "enc" of the JWE sealed by SealJWE.
+const JWEEncryption = "A256GCM"
+
+// ErrInvalidJWE represents an error when a JWE isn't a valid compact JWE of
+// the tlock algorithm.
+var ErrInvalidJWE = errors.New("invalid tlock jwe")
+
+// JWEHeader is the protected header of a JWE of the tlock algorithm. The
+// round and chain hash of its key allow services using standard JOSE
+// libraries to route the JWE without understanding the algorithm.
+type JWEHeader struct {
+	Alg       string `json:"alg"`
+	Enc       string `json:"enc"`
+	Round     uint64 `json:"tlock_round"`
+	ChainHash string `json:"tlock_chain_hash"`
+}
+
+// JWE is a JWE in compact serialization whose content encryption key is
+// wrapped by WrapKey, as parsed by ParseJWE.
+type JWE struct {
+	Header       JWEHeader
+	EncryptedKey []byte
+	IV           []byte
+	Ciphertext   []byte
+	Tag          []byte
+
+	// protected is the encoded protected header, authenticated by the
+	// content encryption.
+	protected string
+}
+
+// SealJWE encrypts the plaintext with a random content encryption key using
+// AES-256-GCM, and returns the JWE in compact serialization holding the key
+// timelocked towards the round of the chain of the network with WrapKey.
+func SealJWE(network Network, roundNumber uint64, plaintext []byte) (string, error) {
+	cek := make([]byte, 32)
+	if _, err := rand.Read(cek); err != nil {
+		return "", fmt.Errorf("content encryption key: %w", err)
+	}
+	defer clear(cek)
+
+	encryptedKey, err := WrapKey(network, roundNumber, cek)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(JWEHeader{
+		Alg:       JWEAlgorithm,
+		Enc:       JWEEncryption,
+		Round:     roundNumber,
+		ChainHash: network.ChainHash(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("header: %w", err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	aead, err := newJWEAEAD(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("iv: %w", err)
+	}
+
+	// the additional data of the content encryption is the encoded protected
+	// header, as RFC 7516 requires.
+	sealed := aead.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(plaintext)], sealed[len(plaintext):]
+
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// ParseJWE parses the JWE in compact serialization, checking its algorithm
+// and that its header matches its encrypted key, without any network access.
+func ParseJWE(token string) (JWE, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return JWE{}, fmt.Errorf("%w: %d parts instead of 5", ErrInvalidJWE, len(parts))
+	}
+
+	var decoded [5][]byte
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return JWE{}, fmt.Errorf("%w: part %d: %w", ErrInvalidJWE, i+1, err)
+		}
+		decoded[i] = b
+	}
+
+	var header JWEHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return JWE{}, fmt.Errorf("%w: header: %w", ErrInvalidJWE, err)
+	}
+	if header.Alg != JWEAlgorithm || header.Enc != JWEEncryption {
+		return JWE{}, fmt.Errorf("%w: unsupported alg %q or enc %q", ErrInvalidJWE, header.Alg, header.Enc)
+	}
+
+	roundNumber, chainHash, err := WrappedKeyTarget(decoded[1])
+	if err != nil {
+		return JWE{}, fmt.Errorf("%w: %w", ErrInvalidJWE, err)
+	}
+	if roundNumber != header.Round || chainHash != header.ChainHash {
+		return JWE{}, fmt.Errorf("%w: the header doesn't match the round %d of chain %s of the key", ErrInvalidJWE, roundNumber, chainHash)
+	}
+
+	return JWE{
+		Header:       header,
+		EncryptedKey: decoded[1],
+		IV:           decoded[2],
+		Ciphertext:   decoded[3],
+		Tag:          decoded[4],
+		protected:    parts[0],
+	}, nil
+}
+
+// Open decrypts the content of the JWE once the round of its key is reached
+// by the network, failing with ErrTooEarly before.
+func (j JWE) Open(network Network) ([]byte, error) {
+	cek, err := UnwrapKey(network, j.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(cek)
+
+	aead, err := newJWEAEAD(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(j.IV) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: iv of %d bytes", ErrInvalidJWE, len(j.IV))
+	}
+
+	sealed := append(append([]byte(nil), j.Ciphertext...), j.Tag...)
+	plaintext, err := aead.Open(nil, j.IV, sealed, []byte(j.protected))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJWE, err)
+	}
+
+	return plaintext, nil
+}
+
+// newJWEAEAD returns the AES-256-GCM of the content encryption key.
+func newJWEAEAD(cek []byte) (cipher.AEAD, error) {
+	if len(cek) != 32 {
+		return nil, fmt.Errorf("%w: content encryption key of %d bytes", ErrInvalidJWE, len(cek))
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
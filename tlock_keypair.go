@@ -0,0 +1,150 @@
+package tlock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	chain "github.com/drand/drand/v2/common"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// keypairLabel is the HKDF info of the identities derived from signatures.
+const keypairLabel = "tlock x25519 identity"
+
+// DeriveKeypairAtRound fetches and verifies the signature of the round, and
+// derives from it the X25519 age identity of the round, see DeriveKeypair. It
+// fails with ErrTooEarly if the round wasn't reached yet.
+//
+// The recipient of the identity is derived from the signature as well, so it
+// can only be computed once the round is reached. Data meant to be decrypted
+// at the round must be encrypted towards it using Encrypt instead.
+func DeriveKeypairAtRound(network Network, roundNumber uint64) (*age.X25519Identity, error) {
+	signature, err := network.Signature(roundNumber)
+	if err != nil {
+		return nil, signatureError(network, roundNumber, err)
+	}
+
+	beacon := chain.Beacon{
+		Round:     roundNumber,
+		Signature: signature,
+	}
+	scheme := network.Scheme()
+	if err := scheme.VerifyBeacon(&beacon, network.PublicKey()); err != nil {
+		return nil, fmt.Errorf("verify beacon: %w", err)
+	}
+
+	return DeriveKeypair(network.ChainHash(), roundNumber, signature)
+}
+
+// DeriveKeypair derives the X25519 age identity of the round of the chain from
+// its signature using HKDF-SHA-256, so that anyone knowing the signature
+// derives the same identity. The signature isn't verified.
+func DeriveKeypair(chainHash string, roundNumber uint64, signature []byte) (*age.X25519Identity, error) {
+	salt, err := hex.DecodeString(chainHash)
+	if err != nil {
+		return nil, fmt.Errorf("decoding chain hash: %w", err)
+	}
+
+	info := keypairLabel + " " + strconv.FormatUint(roundNumber, 10)
+	secret := make([]byte, curve25519.ScalarSize)
+	defer wipe(secret)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, signature, salt, []byte(info)), secret); err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	return age.ParseX25519Identity(strings.ToUpper(bech32Encode("age-secret-key-", secret)))
+}
+
+// =============================================================================
+
+// bech32Charset is the alphabet of the bech32 encoding.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Encode encodes the data under the human readable part, as age encodes
+// its keys, without the length limit of BIP 173.
+func bech32Encode(hrp string, data []byte) string {
+	values := convertBits(data, 8, 5)
+	checksum := bech32Checksum(hrp, values)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range append(values, checksum...) {
+		sb.WriteByte(bech32Charset[v])
+	}
+
+	return sb.String()
+}
+
+// bech32Checksum computes the checksum of the values under the human readable
+// part.
+func bech32Checksum(hrp string, values []byte) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1+len(values)+6)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	expanded = append(expanded, values...)
+	expanded = append(expanded, 0, 0, 0, 0, 0, 0)
+
+	mod := bech32Polymod(expanded) ^ 1
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte((mod >> uint(5*(5-i))) & 31)
+	}
+
+	return checksum
+}
+
+// bech32Polymod computes the BCH checksum of the values.
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+
+	return chk
+}
+
+// convertBits regroups the bits of the data from groups of frombits to groups
+// of tobits, padding the last group with zeros.
+func convertBits(data []byte, frombits, tobits uint) []byte {
+	var (
+		acc    uint32
+		bits   uint
+		result []byte
+		maxv   = uint32(1)<<tobits - 1
+	)
+
+	for _, value := range data {
+		acc = acc<<frombits | uint32(value)
+		bits += frombits
+		for bits >= tobits {
+			bits -= tobits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+
+	if bits > 0 {
+		result = append(result, byte(acc<<(tobits-bits)&maxv))
+	}
+
+	return result
+}
@@ -0,0 +1,120 @@
+package tlock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooLarge represents an error when the plaintext of an encryption or a
+// decryption exceeds the maximum size given to WithMaxSize.
+var ErrTooLarge = errors.New("plaintext exceeds the maximum size")
+
+// WithMaxSize makes the encryptions and decryptions of the tlock, and of the
+// decrypt sessions it creates, fail with ErrTooLarge as soon as their
+// plaintext exceeds size bytes, so that services exposing tlock to their users
+// bound the data they process whatever the ciphertexts they are given. What
+// was written before the failure must be discarded. Zero, the default, removes
+// the limit.
+func (t Tlock) WithMaxSize(size int64) Tlock {
+	t.maxSize = max(size, 0)
+	return t
+}
+
+// limitReader returns a reader of the plaintext to encrypt failing with
+// ErrTooLarge once more than the maximum size was read.
+func (t Tlock) limitReader(r io.Reader) io.Reader {
+	return limitReader(r, t.maxSize)
+}
+
+// limitWriter returns a writer of the decrypted plaintext failing with
+// ErrTooLarge once more than the maximum size is written.
+func (t Tlock) limitWriter(w io.Writer) io.Writer {
+	return limitWriter(w, t.maxSize)
+}
+
+// checkSize fails with ErrTooLarge if the size of a plaintext exceeds the
+// maximum size.
+func (t Tlock) checkSize(size int64) error {
+	if t.maxSize != 0 && size > t.maxSize {
+		return fmt.Errorf("%w: %d bytes is more than %d", ErrTooLarge, size, t.maxSize)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// limitedReader reads up to max bytes, and then fails with ErrTooLarge if its
+// reader has more.
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	left int64
+}
+
+// limitReader returns r limited to size bytes, or r itself if size is zero.
+func limitReader(r io.Reader, size int64) io.Reader {
+	if size == 0 {
+		return r
+	}
+
+	return &limitedReader{r: r, max: size, left: size}
+}
+
+// Read implements the io.Reader interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if l.left == 0 {
+		// a single byte more tells whether the reader ends at the limit.
+		n, err := l.r.Read(p[:1])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, l.max)
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+
+	return n, err
+}
+
+// limitedWriter writes up to max bytes, and then fails with ErrTooLarge.
+type limitedWriter struct {
+	w    io.Writer
+	max  int64
+	left int64
+}
+
+// limitWriter returns w limited to size bytes, or w itself if size is zero.
+func limitWriter(w io.Writer, size int64) io.Writer {
+	if size == 0 {
+		return w
+	}
+
+	return &limitedWriter{w: w, max: size, left: size}
+}
+
+// Write implements the io.Writer interface.
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= l.left {
+		n, err := l.w.Write(p)
+		l.left -= int64(n)
+		return n, err
+	}
+
+	n, err := l.w.Write(p[:l.left])
+	l.left -= int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	return n, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, l.max)
+}
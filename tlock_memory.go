@@ -0,0 +1,52 @@
+package tlock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// ErrLockMemoryUnsupported represents an error when the memory holding the
+// plaintext can't be locked on this platform.
+var ErrLockMemoryUnsupported = errors.New("locking memory is not supported on this platform")
+
+// copyBufferSize is the size of the buffers the plaintext is copied through.
+const copyBufferSize = 32 * 1024
+
+// wipe overwrites the buffer with zeros once it's no longer needed, so that
+// the file keys and plaintexts it held don't linger in memory.
+func wipe(b []byte) {
+	clear(b)
+	runtime.KeepAlive(b)
+}
+
+// copyPlaintext copies the plaintext read from r to dst through a buffer which
+// is wiped afterwards and, if lockMemory is set, locked in memory so that it's
+// never swapped to disk.
+func copyPlaintext(dst io.Writer, r io.Reader, lockMemory bool) error {
+	var buf []byte
+	if lockMemory {
+		buf = make([]byte, copyBufferSize)
+		if err := lockBuffer(buf); err != nil {
+			return fmt.Errorf("lock memory: %w", err)
+		}
+		defer func() {
+			wipe(buf)
+			_ = unlockBuffer(buf)
+		}()
+	} else {
+		pooled := copyPool.Get().(*[]byte)
+		defer copyPool.Put(pooled)
+		defer wipe(*pooled)
+		buf = *pooled
+	}
+
+	// hiding any ReadFrom method of dst makes the copy go through buf rather
+	// than through a buffer of its own.
+	if _, err := io.CopyBuffer(struct{ io.Writer }{dst}, r, buf); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package tlock
+
+// lockBuffer fails since memory can't be locked on this platform.
+func lockBuffer([]byte) error {
+	return ErrLockMemoryUnsupported
+}
+
+// unlockBuffer does nothing since memory can't be locked on this platform.
+func unlockBuffer([]byte) error {
+	return nil
+}
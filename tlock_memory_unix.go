@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package tlock
+
+import "golang.org/x/sys/unix"
+
+// lockBuffer prevents the pages of the buffer from being swapped to disk.
+func lockBuffer(b []byte) error {
+	return unix.Mlock(b)
+}
+
+// unlockBuffer allows the pages of the buffer to be swapped again.
+func unlockBuffer(b []byte) error {
+	return unix.Munlock(b)
+}
@@ -0,0 +1,128 @@
+package tlock
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"filippo.io/age"
+)
+
+// ErrConditionPending represents an error when the oracle of a conditional
+// ciphertext reports its condition isn't met yet. Decrypt reports it along
+// with ErrTooEarly.
+var ErrConditionPending = errors.New("the condition of the ciphertext isn't met yet")
+
+// ErrOracleRequired represents an error when a ciphertext is conditional but
+// no oracle was given to resolve its condition.
+var ErrOracleRequired = errors.New("an oracle is required to resolve the condition of the ciphertext")
+
+// OracleStanzaType is the type of the stanzas whose release is conditioned by
+// an oracle, see WithCondition. Their arguments are the round and chain hash,
+// like the ones of the tlock stanzas, followed by the condition encoded in
+// unpadded base64url.
+const OracleStanzaType = "tlock-oracle"
+
+// Oracle resolves the conditions of ciphertexts, such as "the first round
+// after block height X", to the round of the chain they are released at.
+type Oracle interface {
+	// Resolve returns the round of the chain from which the condition is met,
+	// failing with an error wrapping ErrConditionPending if it isn't known
+	// yet.
+	Resolve(chainHash string, condition string) (uint64, error)
+}
+
+// WithCondition makes Encrypt and ReEncrypt write stanzas of type
+// OracleStanzaType recording the condition, which Decrypt resolves with its
+// oracle at unlock time, see WithOracle, decrypting the ciphertext once both
+// its round and the round the condition resolves to are reached. The round
+// must still be given when encrypting, since the file key is locked towards
+// it: the condition can only delay the release, and is only enforced by the
+// decrypters resolving it, while anyone can decrypt the ciphertext with the
+// signature of its round. It can't be used along with HideRound.
+func (t Tlock) WithCondition(condition string) Tlock {
+	t.condition = condition
+	return t
+}
+
+// WithOracle makes Decrypt resolve the conditions of the stanzas of type
+// OracleStanzaType with the oracle, failing with ErrOracleRequired if there is
+// none.
+func (t Tlock) WithOracle(oracle Oracle) Tlock {
+	t.oracle = oracle
+	return t
+}
+
+// SetCondition makes Wrap write stanzas of type OracleStanzaType recording the
+// condition, instead of stanzas of its stanza type.
+func (t *Recipient) SetCondition(condition string) {
+	t.condition = condition
+}
+
+// SetOracle makes Unwrap resolve the conditions of the stanzas of type
+// OracleStanzaType with the oracle.
+func (t *Identity) SetOracle(oracle Oracle) {
+	t.oracle = oracle
+}
+
+// =============================================================================
+
+// encodeOracle returns the oracle stanza of the round of the chain recording
+// the condition.
+func encodeOracle(roundNumber uint64, chainHash string, condition string, body []byte) *age.Stanza {
+	return &age.Stanza{
+		Type: OracleStanzaType,
+		Args: []string{
+			strconv.FormatUint(roundNumber, 10),
+			chainHash,
+			base64.RawURLEncoding.EncodeToString([]byte(condition)),
+		},
+		Body: body,
+	}
+}
+
+// decodeOracle returns the round, chain hash, condition and encrypted DEK of
+// the oracle stanza. Malformed stanzas fail with an error wrapping
+// age.ErrIncorrectIdentity.
+func decodeOracle(stanza *age.Stanza) (uint64, string, string, []byte, error) {
+	if len(stanza.Args) != 3 {
+		return 0, "", "", nil, fmt.Errorf("unexpected arguments count %d: %w", len(stanza.Args), age.ErrIncorrectIdentity)
+	}
+
+	roundNumber, err := strconv.ParseUint(stanza.Args[0], 10, 64)
+	if err != nil {
+		return 0, "", "", nil, fmt.Errorf("parse block round: %w", err)
+	}
+
+	condition, err := base64.RawURLEncoding.DecodeString(stanza.Args[2])
+	if err != nil || len(condition) == 0 {
+		return 0, "", "", nil, fmt.Errorf("malformed condition %q: %w", stanza.Args[2], age.ErrIncorrectIdentity)
+	}
+
+	return roundNumber, stanza.Args[1], string(condition), stanza.Body, nil
+}
+
+// resolve checks that the condition of an oracle stanza of the chain resolves
+// to a round reached by the network, failing with an error wrapping
+// ErrTooEarly otherwise.
+func (t *Identity) resolve(chainHash string, condition string) error {
+	if t.oracle == nil {
+		return fmt.Errorf("%w: %q", ErrOracleRequired, condition)
+	}
+
+	roundNumber, err := t.oracle.Resolve(chainHash, condition)
+	if errors.Is(err, ErrConditionPending) {
+		return fmt.Errorf("%w: %w", ErrTooEarly, err)
+	}
+	if err != nil {
+		return fmt.Errorf("resolve condition %q: %w", condition, err)
+	}
+
+	if current := t.network.Current(time.Now()); roundNumber > current {
+		return fmt.Errorf("%w: condition %q resolves to round %d > %d current round", ErrTooEarly, condition, roundNumber, current)
+	}
+
+	return nil
+}
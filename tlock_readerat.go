@@ -0,0 +1,230 @@
+package tlock
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrNotSeekable represents an error when a ciphertext can't be decrypted at
+// random offsets, such as armored ones.
+var ErrNotSeekable = errors.New("ciphertext not seekable")
+
+// These constants define the layout of the age payload, which is split into
+// chunks encrypted independently using the file key and a chunk counter.
+const (
+	payloadNonceSize = 16
+	chunkSize        = 64 * 1024
+	encChunkSize     = chunkSize + chacha20poly1305.Overhead
+	lastChunkFlag    = 0x01
+)
+
+// ReaderAt reads the plaintext of a binary ciphertext at random offsets,
+// decrypting and authenticating only the chunks of the payload covering each
+// read. It is safe for concurrent use, allowing to decrypt a large ciphertext
+// in parallel.
+type ReaderAt struct {
+	src    io.ReaderAt
+	start  int64
+	chunks int64
+	size   int64
+	aead   cipher.AEAD
+}
+
+// OpenReaderAt checks the header and the end of the binary ciphertext of the
+// given size and returns a ReaderAt to its plaintext. Like Decrypt, it fails with
+// ErrTooEarly if the round of the ciphertext wasn't reached yet. Armored
+// ciphertexts aren't seekable and fail with ErrNotSeekable.
+func (t Tlock) OpenReaderAt(src io.ReaderAt, size int64) (_ *ReaderAt, err error) {
+	a := t.audit(OpDecrypt)
+	unlocker := t.identity()
+	defer func() {
+		a.decrypted(unlocker)
+		a.done(err)
+	}()
+
+	headerSize, err := ageHeaderSize(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	start := headerSize + payloadNonceSize
+	if size-start < chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("%w: payload too short", ErrInvalidHeader)
+	}
+
+	head := make([]byte, start)
+	if _, err := src.ReadAt(head, 0); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	// age checks the header MAC using the unwrapped file key.
+	identity := fileKeyIdentity{identity: unlocker}
+	if _, err := age.Decrypt(bytes.NewReader(head), &identity); err != nil {
+		return nil, headerError(err, identity.fileKey != nil)
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	defer wipe(key)
+	h := hkdf.New(sha256.New, identity.fileKey, head[headerSize:], []byte("payload"))
+	_, err = io.ReadFull(h, key)
+	wipe(identity.fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("derive payload key: %w", err)
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("payload cipher: %w", err)
+	}
+
+	payload := size - start
+	chunks := (payload + encChunkSize - 1) / encChunkSize
+	last := payload - (chunks-1)*encChunkSize
+
+	// only the payload of an empty plaintext can end with an empty chunk.
+	if last < chacha20poly1305.Overhead || (chunks > 1 && last == chacha20poly1305.Overhead) {
+		return nil, fmt.Errorf("%w: truncated payload", ErrInvalidHeader)
+	}
+
+	r := ReaderAt{
+		src:    src,
+		start:  start,
+		chunks: chunks,
+		size:   payload - chunks*chacha20poly1305.Overhead,
+		aead:   aead,
+	}
+	if err := t.checkSize(r.size); err != nil {
+		return nil, err
+	}
+
+	// the last chunk authenticates the end of the payload, hence its size.
+	chunk, err := r.chunk(chunks - 1)
+	if err != nil {
+		return nil, err
+	}
+	wipe(chunk)
+
+	return &r, nil
+}
+
+// Size returns the size of the plaintext.
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	var n int
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+
+		index := off / chunkSize
+		chunk, err := r.chunk(index)
+		if err != nil {
+			return n, err
+		}
+
+		copied := copy(p[n:], chunk[off-index*chunkSize:])
+		wipe(chunk)
+		n += copied
+		off += int64(copied)
+	}
+
+	return n, nil
+}
+
+// chunk decrypts and authenticates the chunk of the payload at the index.
+func (r *ReaderAt) chunk(index int64) ([]byte, error) {
+	length := int64(encChunkSize)
+	last := index == r.chunks-1
+	if last {
+		length = r.size - index*chunkSize + chacha20poly1305.Overhead
+	}
+
+	buf := make([]byte, length)
+	if _, err := r.src.ReadAt(buf, r.start+index*encChunkSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read chunk %d: %w", index, err)
+	}
+
+	// the nonce is the chunk counter, flagged for the last chunk.
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.BigEndian.PutUint64(nonce[3:11], uint64(index))
+	if last {
+		nonce[len(nonce)-1] = lastChunkFlag
+	}
+
+	plain, err := r.aead.Open(buf[:0], nonce[:], buf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt chunk %d: %w", index, err)
+	}
+
+	return plain, nil
+}
+
+// =============================================================================
+
+// fileKeyIdentity records the file key unwrapped by the identity.
+type fileKeyIdentity struct {
+	identity age.Identity
+	fileKey  []byte
+}
+
+// Unwrap implements the age.Identity interface.
+func (i *fileKeyIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := i.identity.Unwrap(stanzas)
+	if err != nil {
+		return nil, err
+	}
+	i.fileKey = fileKey
+
+	return fileKey, nil
+}
+
+// ageHeaderSize returns the size of the age header, up to the end of the MAC
+// line, which is the only header line starting with the footer prefix.
+func ageHeaderSize(src io.Reader) (int64, error) {
+	rr := bufio.NewReader(src)
+	if start, _ := rr.Peek(len(armor.Header)); string(start) == armor.Header {
+		return 0, ErrNotSeekable
+	}
+
+	var size int64
+	for {
+		line, err := rr.ReadSlice('\n')
+		size += int64(len(line))
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// only stanza bodies and arguments lines are that long.
+			for errors.Is(err, bufio.ErrBufferFull) {
+				line, err = rr.ReadSlice('\n')
+				size += int64(len(line))
+			}
+			if err != nil {
+				return 0, fmt.Errorf("%w: read header: %w", ErrInvalidHeader, err)
+			}
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: read header: %w", ErrInvalidHeader, err)
+		}
+
+		if bytes.HasPrefix(line, []byte(footerPrefix+" ")) {
+			return size, nil
+		}
+	}
+}
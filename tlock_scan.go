@@ -0,0 +1,63 @@
+package tlock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrInvalidScanRange represents an error when the rounds to scan are empty,
+// start at round 0 or are more than MaxScanRounds.
+var ErrInvalidScanRange = errors.New("invalid range of rounds to scan")
+
+// MaxScanRounds bounds the number of rounds DecryptScan tries, each requiring
+// the signature of its round.
+const MaxScanRounds = 1 << 20
+
+// DecryptScan decrypts the source like Decrypt, but ignores the rounds of its
+// stanzas and tries each of the rounds from fromRound to toRound instead, such
+// as for ciphertexts whose round is hidden or was corrupted. The rounds are
+// tried concurrently from the latest to the earliest, stopping at the first
+// one unlocking the file key, and only up to the next round of the network, as
+// the signatures of later rounds aren't available yet. The signatures are
+// fetched from the network, which may serve them from its cache. The header
+// is authenticated by the file key, so a ciphertext whose rounds were altered
+// fails with an error about its MAC once unlocked, rather than being
+// decrypted.
+func (t Tlock) DecryptScan(dst io.Writer, src io.Reader, fromRound uint64, toRound uint64) (err error) {
+	a := t.audit(OpDecrypt)
+	defer func() { a.done(err) }()
+
+	if fromRound == 0 || fromRound > toRound || toRound-fromRound >= MaxScanRounds {
+		return fmt.Errorf("%w: %d to %d", ErrInvalidScanRange, fromRound, toRound)
+	}
+
+	identity := t.identity()
+	identity.SetGuessedRounds(fromRound, toRound)
+	identity.scan = true
+	defer a.decrypted(identity)
+
+	return decrypt(a.writer(t.limitWriter(dst)), src, identity, t.allowTrailing, t.lockMemory)
+}
+
+// guessedRounds returns the rounds the identity guesses, from the latest to
+// the earliest, beyond which only the next round of the network is tried. It
+// fails with ErrInvalidScanRange if they are more than MaxScanRounds.
+func (t *Identity) guessedRounds() ([]uint64, error) {
+	if t.guessLast-t.guessFirst >= MaxScanRounds {
+		return nil, fmt.Errorf("%w: %d to %d", ErrInvalidScanRange, t.guessFirst, t.guessLast)
+	}
+
+	last := min(t.guessLast, t.network.Current(time.Now())+1)
+	if last < t.guessFirst {
+		return []uint64{t.guessFirst}, nil
+	}
+
+	roundNumbers := make([]uint64, 0, last-t.guessFirst+1)
+	for roundNumber := last; roundNumber >= t.guessFirst; roundNumber-- {
+		roundNumbers = append(roundNumbers, roundNumber)
+	}
+
+	return roundNumbers, nil
+}
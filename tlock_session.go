@@ -0,0 +1,114 @@
+package tlock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age"
+	chain "github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+)
+
+// ErrSessionMismatch represents an error when a ciphertext decrypted with a
+// session wasn't encrypted towards the round and chain of the session.
+var ErrSessionMismatch = errors.New("ciphertext not encrypted towards the round of the session")
+
+// DecryptSession decrypts the ciphertexts encrypted towards a same round,
+// using the signature of the round fetched and verified once, instead of once
+// per ciphertext. It is safe for concurrent use.
+type DecryptSession struct {
+	identity      *sessionIdentity
+	allowTrailing bool
+	lockMemory    bool
+	auditHook     func(Event)
+	maxSize       int64
+}
+
+// NewDecryptSession fetches and verifies the signature of the round, and
+// fails with ErrTooEarly if the round wasn't reached yet, or with the error of
+// the network if it couldn't give the signature of a reached round.
+func (t Tlock) NewDecryptSession(roundNumber uint64) (*DecryptSession, error) {
+	signature, err := t.network.Signature(roundNumber)
+	if err != nil {
+		return nil, signatureError(t.network, roundNumber, err)
+	}
+
+	beacon := chain.Beacon{
+		Round:     roundNumber,
+		Signature: signature,
+	}
+	scheme := t.network.Scheme()
+	if err := scheme.VerifyBeacon(&beacon, t.network.PublicKey()); err != nil {
+		return nil, fmt.Errorf("verify beacon: %w", err)
+	}
+
+	return &DecryptSession{
+		identity: &sessionIdentity{
+			scheme:      scheme,
+			chainHash:   t.network.ChainHash(),
+			roundNumber: roundNumber,
+			signature:   signature,
+		},
+		allowTrailing: t.allowTrailing,
+		lockMemory:    t.lockMemory,
+		auditHook:     t.auditHook,
+		maxSize:       t.maxSize,
+	}, nil
+}
+
+// Round returns the round of the session.
+func (s *DecryptSession) Round() uint64 {
+	return s.identity.roundNumber
+}
+
+// Decrypt decrypts the source to the destination like Tlock.Decrypt, without
+// any network access. It fails with ErrSessionMismatch if the source wasn't
+// encrypted towards the round and chain of the session.
+func (s *DecryptSession) Decrypt(dst io.Writer, src io.Reader) (err error) {
+	var a *auditor
+	if s.auditHook != nil {
+		a = &auditor{hook: s.auditHook, event: Event{Operation: OpDecrypt, ChainHash: s.identity.chainHash}, start: time.Now()}
+		defer func() {
+			if err == nil {
+				a.event.Round = s.identity.roundNumber
+			}
+			a.done(err)
+		}()
+	}
+
+	return decrypt(a.writer(limitWriter(dst, s.maxSize)), src, s.identity, s.allowTrailing, s.lockMemory)
+}
+
+// =============================================================================
+
+// sessionIdentity implements the age Identity interface using the verified
+// signature of a round.
+type sessionIdentity struct {
+	scheme      crypto.Scheme
+	chainHash   string
+	roundNumber uint64
+	signature   []byte
+}
+
+// Unwrap is called by the age Decrypt API and decrypts the DEK of the stanza
+// of the round and chain of the session.
+func (t *sessionIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, stanza := range stanzas {
+		roundNumber, chainHash, body, err := decodeStanza(stanza)
+		if err != nil || roundNumber != t.roundNumber || chainHash != t.chainHash {
+			continue
+		}
+
+		ciphertext, err := BytesToCiphertext(t.scheme, body)
+		if err != nil {
+			return nil, fmt.Errorf("parse cipher dek: %w", err)
+		}
+
+		// the signature was verified when creating the session.
+		return unlock(t.scheme, t.signature, ciphertext)
+	}
+
+	return nil, fmt.Errorf("%w: round %d of chain %s", ErrSessionMismatch, t.roundNumber, t.chainHash)
+}
@@ -0,0 +1,176 @@
+package tlock
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrSizeMismatch represents an error when the source of a sized encryption
+// doesn't hold the given number of bytes.
+var ErrSizeMismatch = errors.New("the source doesn't hold the given size")
+
+// ErrTruncated represents an error when a sized ciphertext ends before its
+// footer, such as an interrupted copy or upload.
+var ErrTruncated = errors.New("ciphertext truncated")
+
+// ErrCorrupted represents an error when a sized ciphertext fails to be
+// authenticated, or its plaintext doesn't match the size or digest of its
+// footer.
+var ErrCorrupted = errors.New("ciphertext corrupted")
+
+// footerSize is the size of the footer following the plaintext of sized
+// ciphertexts: the big endian length of the plaintext and its BLAKE2b-256
+// digest. Being part of the age payload, the footer is authenticated.
+const footerSize = 8 + blake2b.Size256
+
+// EncryptSized will encrypt the size bytes of the source like Encrypt, followed
+// by a footer holding their length and digest, for DecryptSized to verify the
+// plaintext. The source must hold exactly size bytes, otherwise it fails with
+// ErrSizeMismatch.
+func (t Tlock) EncryptSized(dst io.Writer, src io.Reader, size int64, roundNumber uint64) (err error) {
+	a := t.audit(OpEncrypt)
+	a.encrypted([]uint64{roundNumber})
+	defer func() { a.done(err) }()
+	src = a.reader(src)
+
+	recipients, err := t.ageRecipients([]uint64{roundNumber})
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("%w: negative size %d", ErrSizeMismatch, size)
+	}
+	if err := t.checkSize(size); err != nil {
+		return err
+	}
+
+	w, err := age.Encrypt(dst, recipients...)
+	if err != nil {
+		return fmt.Errorf("hybrid encrypt: %w", err)
+	}
+
+	digest, _ := blake2b.New256(nil)
+	n, err := io.CopyN(io.MultiWriter(w, digest), src, size)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: read %d of %d bytes", ErrSizeMismatch, n, size)
+	}
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if extra, _ := src.Read(make([]byte, 1)); extra != 0 {
+		return fmt.Errorf("%w: more than %d bytes", ErrSizeMismatch, size)
+	}
+
+	footer := binary.BigEndian.AppendUint64(make([]byte, 0, footerSize), uint64(size))
+	if _, err := w.Write(digest.Sum(footer)); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	return nil
+}
+
+// DecryptSized will decrypt a ciphertext of EncryptSized like Decrypt, and
+// verify the length and digest of the plaintext written to the destination.
+// It fails with ErrTruncated if the ciphertext ends early, and ErrCorrupted if
+// it was altered, in which case what was written must be discarded.
+func (t Tlock) DecryptSized(dst io.Writer, src io.Reader) (err error) {
+	a := t.audit(OpDecrypt)
+	source := &errReader{r: src}
+	identity := t.identity()
+	defer func() {
+		a.decrypted(identity)
+		a.done(err)
+	}()
+	dst = a.writer(t.limitWriter(dst))
+
+	return decryptPayload(source, identity, t.allowTrailing, func(r io.Reader) error {
+		digest, _ := blake2b.New256(nil)
+		fw := &footerWriter{dst: dst, digest: digest}
+		defer func() { wipe(fw.tail) }()
+
+		err := copyPlaintext(fw, r, t.lockMemory)
+		switch {
+		case err == nil:
+		case fw.err != nil || source.err != nil:
+			return err
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return fmt.Errorf("%w: %w", ErrTruncated, err)
+		default:
+			return fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+
+		return fw.verify()
+	})
+}
+
+// =============================================================================
+
+// footerWriter writes all but the last footerSize bytes to the destination,
+// keeping the footer to be verified against what was written.
+type footerWriter struct {
+	dst    io.Writer
+	digest hash.Hash
+	tail   []byte
+	size   uint64
+	err    error
+}
+
+// Write implements the io.Writer interface.
+func (w *footerWriter) Write(p []byte) (int, error) {
+	w.tail = append(w.tail, p...)
+	if n := len(w.tail) - footerSize; n > 0 {
+		if _, err := w.dst.Write(w.tail[:n]); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.digest.Write(w.tail[:n])
+		w.size += uint64(n)
+		w.tail = append(w.tail[:0], w.tail[n:]...)
+	}
+
+	return len(p), nil
+}
+
+// verify checks the footer against the length and digest of what was written.
+func (w *footerWriter) verify() error {
+	if len(w.tail) < footerSize {
+		return fmt.Errorf("%w: missing footer", ErrTruncated)
+	}
+
+	size := binary.BigEndian.Uint64(w.tail[:8])
+	if size != w.size {
+		return fmt.Errorf("%w: %d bytes instead of %d", ErrCorrupted, w.size, size)
+	}
+	if subtle.ConstantTimeCompare(w.digest.Sum(nil), w.tail[8:]) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrCorrupted)
+	}
+
+	return nil
+}
+
+// errReader records the error returned by the reader, other than io.EOF.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read implements the io.Reader interface.
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,214 @@
+package tlock
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// ErrUnknownStanzaType represents an error when no codec was registered for
+// a stanza type.
+var ErrUnknownStanzaType = errors.New("unknown stanza type")
+
+// ErrUnsupportedStanzaVersion represents an error when a tlock stanza has a
+// version, or a critical extension, introduced by a later version of tlock.
+var ErrUnsupportedStanzaVersion = errors.New("unsupported tlock stanza version")
+
+// StanzaType is the type of the stanzas written by default, decoded by the
+// codec registered by this package.
+const StanzaType = "tlock"
+
+// StanzaVersion is the latest version of the tlock stanzas this package
+// decodes. The arguments of the stanzas of version 1 are the round and the
+// chain hash, while the later versions start with their version, such as
+// "v2", followed by the round, the chain hash and extensions:
+//
+//	-> tlock v2 <round> <chainhash> [<extension>...]
+//
+// The extensions unknown to a decrypter are ignored, unless they start with
+// "!", marking them critical, so that later additions don't prevent older
+// decrypters from decrypting, or make them fail with ErrUnsupportedStanzaVersion
+// rather than skip the stanza.
+const StanzaVersion = 2
+
+// StanzaCodec encodes and decodes the stanzas of a type, allowing other
+// packages to extend the wire format. The body of a stanza is the encrypted
+// DEK as returned by CiphertextToBytes.
+type StanzaCodec interface {
+	// Encode returns the stanza holding the body for the round of the chain.
+	Encode(roundNumber uint64, chainHash string, body []byte) (*age.Stanza, error)
+
+	// Decode returns the round, chain and body of the stanza. Stanzas which
+	// must be skipped, such as ones with unexpected arguments, fail with an
+	// error wrapping age.ErrIncorrectIdentity.
+	Decode(stanza *age.Stanza) (roundNumber uint64, chainHash string, body []byte, err error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]StanzaCodec{StanzaType: tlockCodec{}}
+)
+
+// RegisterStanzaCodec makes the codec available for the stanzas of the type,
+// which are then decrypted like tlock stanzas, and can be written by setting
+// the stanza type of a Recipient. It panics if a codec was already registered
+// for the type, or if the codec is nil.
+func RegisterStanzaCodec(stanzaType string, codec StanzaCodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if codec == nil {
+		panic("tlock: RegisterStanzaCodec codec is nil")
+	}
+	if _, dup := codecs[stanzaType]; dup {
+		panic("tlock: RegisterStanzaCodec called twice for stanza type " + stanzaType)
+	}
+	codecs[stanzaType] = codec
+}
+
+// stanzaCodec returns the codec registered for the stanza type.
+func stanzaCodec(stanzaType string) (StanzaCodec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[stanzaType]
+	return codec, ok
+}
+
+// ParseStanza returns the type, round, chain hash and condition of the tlock
+// stanza, of any version, without decrypting it. The stanzas hiding their
+// round fail with ErrHiddenRound, and the ones of other types with an error
+// wrapping age.ErrIncorrectIdentity.
+func ParseStanza(stanza *age.Stanza) (Stanza, error) {
+	switch stanza.Type {
+	case HiddenStanzaType:
+		return Stanza{}, ErrHiddenRound
+	case OracleStanzaType:
+		roundNumber, chainHash, condition, _, err := decodeOracle(stanza)
+		if err != nil {
+			return Stanza{}, err
+		}
+		return Stanza{Type: stanza.Type, Round: roundNumber, ChainHash: chainHash, Condition: condition}, nil
+	}
+
+	roundNumber, chainHash, _, err := decodeStanza(stanza)
+	if err != nil {
+		return Stanza{}, err
+	}
+
+	return Stanza{Type: stanza.Type, Round: roundNumber, ChainHash: chainHash}, nil
+}
+
+// decodeStanza decodes the stanza using the codec of its type. The stanzas to
+// skip fail with an error wrapping age.ErrIncorrectIdentity.
+func decodeStanza(stanza *age.Stanza) (uint64, string, []byte, error) {
+	codec, ok := stanzaCodec(stanza.Type)
+	if !ok {
+		return 0, "", nil, fmt.Errorf("%w %q: %w", ErrUnknownStanzaType, stanza.Type, age.ErrIncorrectIdentity)
+	}
+
+	return codec.Decode(stanza)
+}
+
+// =============================================================================
+
+// tlockCodec encodes the round and chain hash as the arguments of the stanza,
+// and decodes the stanzas of every version up to StanzaVersion.
+type tlockCodec struct{}
+
+// Encode implements the StanzaCodec interface.
+func (tlockCodec) Encode(roundNumber uint64, chainHash string, body []byte) (*age.Stanza, error) {
+	return &age.Stanza{
+		Type: StanzaType,
+		Args: []string{strconv.FormatUint(roundNumber, 10), chainHash},
+		Body: body,
+	}, nil
+}
+
+// Decode implements the StanzaCodec interface.
+func (tlockCodec) Decode(stanza *age.Stanza) (uint64, string, []byte, error) {
+	if len(stanza.Args) > 0 && isVersion(stanza.Args[0]) {
+		return decodeVersioned(stanza)
+	}
+
+	if len(stanza.Args) != 2 {
+		return 0, "", nil, fmt.Errorf("unexpected arguments count %d: %w", len(stanza.Args), age.ErrIncorrectIdentity)
+	}
+
+	roundNumber, err := strconv.ParseUint(stanza.Args[0], 10, 64)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("parse block round: %w", err)
+	}
+
+	return roundNumber, stanza.Args[1], stanza.Body, nil
+}
+
+// encodeVersioned returns the tlock stanza of the version, later than 1, for
+// the round of the chain.
+func encodeVersioned(version int, roundNumber uint64, chainHash string, body []byte) (*age.Stanza, error) {
+	if version < 2 || version > StanzaVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedStanzaVersion, version)
+	}
+
+	return &age.Stanza{
+		Type: StanzaType,
+		Args: []string{"v" + strconv.Itoa(version), strconv.FormatUint(roundNumber, 10), chainHash},
+		Body: body,
+	}, nil
+}
+
+// decodeVersioned decodes the tlock stanza starting with its version. The
+// stanzas of later versions than StanzaVersion, or with unknown critical
+// extensions, fail with a versionError.
+func decodeVersioned(stanza *age.Stanza) (uint64, string, []byte, error) {
+	version, err := strconv.Atoi(stanza.Args[0][1:])
+	switch {
+	case err != nil || version < 2:
+		return 0, "", nil, fmt.Errorf("malformed version %q: %w", stanza.Args[0], age.ErrIncorrectIdentity)
+	case version > StanzaVersion:
+		return 0, "", nil, &versionError{reason: fmt.Sprintf("stanza version %s is later than v%d", stanza.Args[0], StanzaVersion)}
+	case len(stanza.Args) < 3:
+		return 0, "", nil, fmt.Errorf("unexpected arguments count %d: %w", len(stanza.Args), age.ErrIncorrectIdentity)
+	}
+
+	for _, extension := range stanza.Args[3:] {
+		if strings.HasPrefix(extension, "!") {
+			return 0, "", nil, &versionError{reason: fmt.Sprintf("unknown critical extension %q", extension)}
+		}
+	}
+
+	roundNumber, err := strconv.ParseUint(stanza.Args[1], 10, 64)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("parse block round: %w", err)
+	}
+
+	return roundNumber, stanza.Args[2], stanza.Body, nil
+}
+
+// isVersion reports whether the argument is the version of a stanza, a "v"
+// followed by digits, which never starts the arguments of version 1.
+func isVersion(arg string) bool {
+	return len(arg) > 1 && arg[0] == 'v' && strings.Trim(arg[1:], "0123456789") == ""
+}
+
+// versionError reports a stanza requiring a later version of tlock. Such
+// stanzas are skipped like the ones of other types, while the decryption
+// reports the error if no other stanza can be used.
+type versionError struct {
+	reason string
+}
+
+// Error implements the error interface.
+func (e *versionError) Error() string {
+	return ErrUnsupportedStanzaVersion.Error() + ": " + e.reason
+}
+
+// Is makes the error match ErrUnsupportedStanzaVersion, and
+// age.ErrIncorrectIdentity for the stanza to be skipped.
+func (e *versionError) Is(target error) bool {
+	return target == ErrUnsupportedStanzaVersion || target == age.ErrIncorrectIdentity
+}
@@ -2,19 +2,36 @@ package tlock_test
 
 import (
 	"bytes"
+	"crypto/rand"
 	_ "embed" // Calls init function.
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"filippo.io/age"
+	"filippo.io/age/armor"
 	chain "github.com/drand/drand/v2/common"
 	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
 	bls "github.com/drand/kyber-bls12381"
+	"github.com/drand/kyber/encrypt/ibe"
+	"github.com/drand/kyber/util/random"
 	"github.com/drand/tlock"
+	"github.com/drand/tlock/networks/fixed"
 	"github.com/drand/tlock/networks/http"
+	"github.com/drand/tlock/testsupport"
 
 	"github.com/stretchr/testify/require"
 )
@@ -101,6 +118,134 @@ func TestEarlyDecryptionWithRound(t *testing.T) {
 	require.ErrorIs(t, err, tlock.ErrTooEarly)
 }
 
+func TestDecryptRelayErrors(t *testing.T) {
+	beacon, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(beacon)
+	defer relay.Close()
+
+	network, err := http.NewNetwork(relay.URL, beacon.ChainHash())
+	require.NoError(t, err)
+
+	var early, reached bytes.Buffer
+	err = tlock.New(network).Encrypt(&early, bytes.NewBufferString("very nice"), network.Current(time.Now())+10)
+	require.NoError(t, err)
+	err = tlock.New(network).Encrypt(&reached, bytes.NewBufferString("very nice"), 1)
+	require.NoError(t, err)
+
+	err = tlock.New(network).Decrypt(io.Discard, bytes.NewReader(early.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+	require.ErrorIs(t, err, http.ErrRoundNotYetAvailable)
+
+	// nor is a relay rolling back below a round seen before.
+	store, err := http.NewFileRoundStore(filepath.Join(t.TempDir(), "rounds.json"))
+	require.NoError(t, err)
+	require.NoError(t, store.ObserveRound(beacon.ChainHash(), network.Current(time.Now())+100))
+	network.SetRoundStore(store)
+	err = tlock.New(network).Decrypt(io.Discard, bytes.NewReader(early.Bytes()))
+	require.ErrorIs(t, err, http.ErrRollback)
+	require.NotErrorIs(t, err, tlock.ErrTooEarly)
+	network.SetRoundStore(nil)
+
+	// a relay going down isn't mistaken for a round not reached yet.
+	relay.Close()
+	err = tlock.New(network).Decrypt(io.Discard, &reached)
+	require.ErrorIs(t, err, http.ErrRelayUnavailable)
+	require.NotErrorIs(t, err, tlock.ErrTooEarly)
+}
+
+func TestDecryptWithResult(t *testing.T) {
+	quicknet, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	unchained, err := testsupport.NewBeacon(crypto.NewPedersenBLSUnchained(), testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(quicknet, unchained)
+	defer relay.Close()
+
+	network, err := http.NewNetwork(relay.URL, quicknet.ChainHash())
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(unchained).Encrypt(&cipherData, bytes.NewBufferString("very nice"), 1)
+	require.NoError(t, err)
+
+	switcher := func(chainHash string) (tlock.Network, error) {
+		clone := network.Clone()
+		if err := clone.SwitchChainHash(chainHash); err != nil {
+			return nil, err
+		}
+		return clone, nil
+	}
+
+	var plainData bytes.Buffer
+	result, err := tlock.New(network).WithChainSwitcher(switcher).DecryptWithResult(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+	require.Equal(t, tlock.DecryptResult{ChainHash: unchained.ChainHash(), Round: 1, Switched: true}, result)
+
+	// the network of the tlock was left untouched.
+	require.Equal(t, quicknet.ChainHash(), network.ChainHash())
+
+	// a strict tlock doesn't switch, even with a switcher.
+	_, err = tlock.New(network).WithChainSwitcher(switcher).Strict().DecryptWithResult(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+
+	// without a switcher, the network itself is switched.
+	result, err = tlock.New(network).DecryptWithResult(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.True(t, result.Switched)
+	require.Equal(t, unchained.ChainHash(), network.ChainHash())
+
+	result, err = tlock.New(network).DecryptWithResult(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, tlock.DecryptResult{ChainHash: unchained.ChainHash(), Round: 1}, result)
+}
+
+func TestTrustChains(t *testing.T) {
+	quicknet, err := testsupport.NewBeacon(nil, testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	unchained, err := testsupport.NewBeacon(crypto.NewPedersenBLSUnchained(), testsupport.DefaultPeriod)
+	require.NoError(t, err)
+	relay := testsupport.NewRelay(quicknet, unchained)
+	defer relay.Close()
+
+	var cipherData bytes.Buffer
+	err = tlock.New(unchained).Encrypt(&cipherData, bytes.NewBufferString("very nice"), 1)
+	require.NoError(t, err)
+
+	network, err := http.NewNetwork(relay.URL, quicknet.ChainHash())
+	require.NoError(t, err)
+
+	err = tlock.New(network).TrustChains("beef").Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+	require.ErrorContains(t, err, "isn't one of the trusted chains")
+	require.Equal(t, quicknet.ChainHash(), network.ChainHash())
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).TrustChains("beef", strings.ToUpper(unchained.ChainHash())).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "very nice", plainData.String())
+	require.Equal(t, unchained.ChainHash(), network.ChainHash())
+
+	require.True(t, tlock.New(network).Trusts(unchained.ChainHash()))
+	require.False(t, tlock.New(network).Strict().Trusts(unchained.ChainHash()))
+	require.False(t, tlock.New(network).TrustChains("beef").Trusts(unchained.ChainHash()))
+	require.False(t, tlock.New(network).TrustChains().Trusts(unchained.ChainHash()))
+
+	// an empty list of trusted chains refuses every switch.
+	network, err = http.NewNetwork(relay.URL, quicknet.ChainHash())
+	require.NoError(t, err)
+	err = tlock.New(network).TrustChains().Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+	err = tlock.New(network).TrustChains([]string{}...).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+	require.Equal(t, quicknet.ChainHash(), network.ChainHash())
+
+	// strict decryptions don't switch to the trusted chains.
+	err = tlock.New(quicknet).TrustChains(unchained.ChainHash()).Strict().Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+}
+
 func TestEncryptionWithDuration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping live testing in short mode")
@@ -270,6 +415,183 @@ func TestTimeLockUnlock(t *testing.T) {
 	}
 }
 
+func TestTimeLockUnlockNamed(t *testing.T) {
+	schemes := []*crypto.Scheme{
+		crypto.NewPedersenBLSUnchained(),
+		crypto.NewPedersenBLSUnchainedSwapped(),
+		crypto.NewPedersenBLSUnchainedG1(),
+	}
+
+	for _, scheme := range schemes {
+		t.Run(scheme.Name, func(t *testing.T) {
+			secret := scheme.KeyGroup.Scalar().Pick(random.New())
+			publicKey, err := scheme.KeyGroup.Point().Mul(secret, nil).MarshalBinary()
+			require.NoError(t, err)
+
+			roundNumber := uint64(1234)
+			signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+			require.NoError(t, err)
+
+			data := []byte(`anything`)
+
+			cipherText, err := tlock.TimeLockNamed(scheme.Name, publicKey, roundNumber, data)
+			require.NoError(t, err)
+
+			b, err := tlock.TimeUnlockNamed(scheme.Name, publicKey, roundNumber, signature, cipherText)
+			require.NoError(t, err)
+			require.Equal(t, data, b)
+
+			_, err = tlock.TimeUnlockNamed(scheme.Name, publicKey, roundNumber+1, signature, cipherText)
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("unknown scheme", func(t *testing.T) {
+		_, err := tlock.TimeLockNamed("not-a-scheme", make([]byte, 48), 1, []byte("deadbeef"))
+		require.Error(t, err)
+	})
+
+	t.Run("wrong key length", func(t *testing.T) {
+		_, err := tlock.TimeLockNamed(crypto.SigsOnG1ID, make([]byte, 48), 1, []byte("deadbeef"))
+		require.Error(t, err)
+	})
+}
+
+func TestDecryptBestEffort(t *testing.T) {
+	schemes := []*crypto.Scheme{
+		crypto.NewPedersenBLSUnchained(),
+		crypto.NewPedersenBLSUnchainedSwapped(),
+		crypto.NewPedersenBLSUnchainedG1(),
+	}
+
+	for _, scheme := range schemes {
+		t.Run(scheme.Name, func(t *testing.T) {
+			secret := scheme.KeyGroup.Scalar().Pick(random.New())
+			publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+			roundNumber := uint64(1234)
+			signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+			require.NoError(t, err)
+
+			network, err := fixed.NewNetwork(testnetUnchainedOnG2, publicKey, scheme, 3*time.Second, 0, nil)
+			require.NoError(t, err)
+
+			var cipherData bytes.Buffer
+			err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), roundNumber)
+			require.NoError(t, err)
+			encrypted := cipherData.Bytes()
+
+			var plainData bytes.Buffer
+			err = tlock.DecryptBestEffort(&plainData, bytes.NewReader(encrypted), signature)
+			require.NoError(t, err)
+			require.Equal(t, dataFile, plainData.Bytes())
+
+			other, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber + 1}))
+			require.NoError(t, err)
+
+			err = tlock.DecryptBestEffort(&plainData, bytes.NewReader(encrypted), other)
+			require.ErrorIs(t, err, tlock.ErrNoCompatibleScheme)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+
+	var metadata bytes.Buffer
+	err = tlock.New(network).Metadata(&metadata)
+	require.NoError(t, err)
+
+	require.Contains(t, metadata.String(), "period: 3s\n")
+	require.Contains(t, metadata.String(), "genesis_time: 1692803367\n")
+	require.Contains(t, metadata.String(), "scheme: "+crypto.SigsOnG1ID+"\n")
+}
+
+func TestEncryptRoundZero(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Pick(random.New()), scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	err = tlock.New(network).Encrypt(io.Discard, bytes.NewReader(dataFile), 0)
+	require.ErrorIs(t, err, tlock.ErrInvalidRound)
+
+	err = tlock.New(network).ReEncrypt(io.Discard, bytes.NewReader(nil), 0)
+	require.ErrorIs(t, err, tlock.ErrInvalidRound)
+}
+
+func TestRoundMetadata(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	network, err := fixed.NewNetwork(mainnetQuicknet, scheme.KeyGroup.Point().Base(), scheme, 3*time.Second, 1692803367, nil)
+	require.NoError(t, err)
+
+	var metadata bytes.Buffer
+	err = tlock.New(network).RoundMetadata(&metadata, 1)
+	require.NoError(t, err)
+
+	require.Contains(t, metadata.String(), "genesis_time: 1692803367\n")
+	require.Contains(t, metadata.String(), "round:\n    number: 1\n    unlock_time: 2023-08-23T15:09:27Z\n    remaining: 0s\n    passed: true\n")
+
+	future := network.Current(time.Now()) + 1200
+	metadata.Reset()
+	err = tlock.New(network).RoundMetadata(&metadata, future)
+	require.NoError(t, err)
+
+	require.Contains(t, metadata.String(), "passed: false\n")
+	require.Regexp(t, `remaining: (59m[0-9]+|1h0m0)s\n`, metadata.String())
+}
+
+func TestTrailingData(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	w := armor.NewWriter(&cipherData)
+	err = tlock.New(network).Encrypt(w, bytes.NewReader(dataFile), roundNumber)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	armored := cipherData.Bytes()
+
+	concatenated := append(append([]byte{}, armored...), armored...)
+
+	t.Run("whitespace is accepted", func(t *testing.T) {
+		var plainData bytes.Buffer
+		src := append(append([]byte{}, armored...), "\n\n  \n"...)
+		err := tlock.New(network).Decrypt(&plainData, bytes.NewReader(src))
+		require.NoError(t, err)
+		require.Equal(t, dataFile, plainData.Bytes())
+	})
+
+	t.Run("trailing data is rejected", func(t *testing.T) {
+		var plainData bytes.Buffer
+		err := tlock.New(network).Decrypt(&plainData, bytes.NewReader(concatenated))
+		require.ErrorIs(t, err, tlock.ErrTrailingData)
+	})
+
+	t.Run("trailing data is allowed", func(t *testing.T) {
+		var plainData bytes.Buffer
+		err := tlock.New(network).AllowTrailing().Decrypt(&plainData, bytes.NewReader(concatenated))
+		require.NoError(t, err)
+		require.Equal(t, dataFile, plainData.Bytes())
+	})
+
+	t.Run("truncated file is rejected", func(t *testing.T) {
+		var plainData bytes.Buffer
+		truncated := bytes.TrimSuffix(bytes.TrimSpace(armored), []byte(armor.Footer))
+		err := tlock.New(network).AllowTrailing().Decrypt(&plainData, bytes.NewReader(truncated))
+		require.Error(t, err)
+	})
+}
+
 func TestCannotEncryptWithPointAtInfinity(t *testing.T) {
 	suite := bls.NewBLS12381Suite()
 	t.Run("on G2", func(t *testing.T) {
@@ -410,3 +732,1209 @@ VDNsVkpZT3F2Mk14NWRIU3IzbnhuUUsyaTdsS0ptclNoNk9lOAqkjk0Ypkj6JxKk
 	})
 
 }
+
+func TestDecryptConcurrently(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	ciphertexts := make([][]byte, 8)
+	for i := range ciphertexts {
+		var cipherData bytes.Buffer
+		w := armor.NewWriter(&cipherData)
+		err = tlock.New(network).Encrypt(w, bytes.NewReader(bytes.Repeat(dataFile, i+1)), roundNumber)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		ciphertexts[i] = cipherData.Bytes()
+	}
+
+	// the pooled buffers must never be shared by concurrent decryptions.
+	var wg sync.WaitGroup
+	errs := make([]error, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				var plainData bytes.Buffer
+				if err := tlock.New(network).Decrypt(&plainData, bytes.NewReader(ciphertext)); err != nil {
+					errs[i] = err
+					return
+				}
+				if !bytes.Equal(bytes.Repeat(dataFile, i+1), plainData.Bytes()) {
+					errs[i] = errors.New("unexpected plaintext")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(b, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(b, err)
+
+	var binary bytes.Buffer
+	err = tlock.New(network).Encrypt(&binary, bytes.NewReader(dataFile), roundNumber)
+	require.NoError(b, err)
+
+	var armored bytes.Buffer
+	w := armor.NewWriter(&armored)
+	_, err = w.Write(binary.Bytes())
+	require.NoError(b, err)
+	require.NoError(b, w.Close())
+
+	for name, ciphertext := range map[string][]byte{"binary": binary.Bytes(), "armored": armored.Bytes()} {
+		b.Run(name, func(b *testing.B) {
+			tl := tlock.New(network)
+			b.ReportAllocs()
+			for range b.N {
+				if err := tl.Decrypt(io.Discard, bytes.NewReader(ciphertext)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenReaderAt(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 100, 64 * 1024, 3*64*1024 + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		var cipherData bytes.Buffer
+		err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(plaintext), roundNumber)
+		require.NoError(t, err)
+		ciphertext := cipherData.Bytes()
+
+		r, err := tlock.New(network).OpenReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)))
+		require.NoError(t, err)
+		require.Equal(t, int64(size), r.Size())
+
+		got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+
+		// reads across chunks boundaries, in parallel.
+		var wg sync.WaitGroup
+		errs := make([]error, 16)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				off := int64(i * size / len(errs))
+				buf := make([]byte, 64*1024/3)
+				n, err := r.ReadAt(buf, off)
+				if err != nil && !errors.Is(err, io.EOF) {
+					errs[i] = err
+					return
+				}
+				if !bytes.Equal(plaintext[off:off+int64(n)], buf[:n]) {
+					errs[i] = errors.New("unexpected plaintext")
+				}
+			}()
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		_, err = r.ReadAt(make([]byte, 1), int64(size))
+		require.ErrorIs(t, err, io.EOF)
+
+		// truncated ciphertexts are detected before any read.
+		_, err = tlock.New(network).OpenReaderAt(bytes.NewReader(ciphertext), int64(len(ciphertext)-1))
+		require.Error(t, err)
+
+		if size == 0 {
+			continue
+		}
+
+		// tampered chunks fail to authenticate.
+		tampered := bytes.Clone(ciphertext)
+		tampered[len(tampered)-size-1] ^= 1
+		r, err = tlock.New(network).OpenReaderAt(bytes.NewReader(tampered), int64(len(tampered)))
+		if err == nil {
+			_, err = r.ReadAt(make([]byte, 1), 0)
+		}
+		require.Error(t, err)
+	}
+
+	var armored bytes.Buffer
+	w := armor.NewWriter(&armored)
+	err = tlock.New(network).Encrypt(w, bytes.NewReader(dataFile), roundNumber)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, err = tlock.New(network).OpenReaderAt(bytes.NewReader(armored.Bytes()), int64(armored.Len()))
+	require.ErrorIs(t, err, tlock.ErrNotSeekable)
+}
+
+func BenchmarkReadAtParallel(b *testing.B) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(b, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(b, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(make([]byte, 16<<20)), roundNumber)
+	require.NoError(b, err)
+
+	r, err := tlock.New(network).OpenReaderAt(bytes.NewReader(cipherData.Bytes()), int64(cipherData.Len()))
+	require.NoError(b, err)
+
+	b.SetBytes(64 * 1024)
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, 64*1024)
+		var off int64
+		for pb.Next() {
+			if _, err := r.ReadAt(buf, off); err != nil {
+				b.Fatal(err)
+			}
+			off = (off + int64(len(buf))) % r.Size()
+		}
+	})
+}
+
+func TestDecryptMultipleStanzas(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var recipients []age.Recipient
+	for round := range uint64(8) {
+		recipients = append(recipients, tlock.NewRecipient(network, round+1))
+	}
+
+	var cipherData bytes.Buffer
+	w, err := age.Encrypt(&cipherData, recipients...)
+	require.NoError(t, err)
+	_, err = w.Write(dataFile)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the error of the first stanza is reported when none can be unlocked.
+	err = tlock.New(network).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+	require.ErrorContains(t, err, "expected round 1 >")
+
+	// a wrong signature fails to unlock the other stanzas.
+	for _, round := range []uint64{5, 7} {
+		sig, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: round}))
+		require.NoError(t, err)
+		network.AddSignature(round-2, sig)
+		network.AddSignature(round, sig)
+	}
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+}
+
+func TestDecryptSession(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	_, err = tlock.New(network).NewDecryptSession(roundNumber)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	// a signature of another round doesn't verify.
+	network.AddSignature(roundNumber+1, signature)
+	_, err = tlock.New(network).NewDecryptSession(roundNumber + 1)
+	require.Error(t, err)
+
+	network.AddSignature(roundNumber, signature)
+	session, err := tlock.New(network).NewDecryptSession(roundNumber)
+	require.NoError(t, err)
+	require.Equal(t, roundNumber, session.Round())
+
+	for i := range 3 {
+		var cipherData bytes.Buffer
+		err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(bytes.Repeat(dataFile, i+1)), roundNumber)
+		require.NoError(t, err)
+
+		var plainData bytes.Buffer
+		err = session.Decrypt(&plainData, &cipherData)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat(dataFile, i+1), plainData.Bytes())
+	}
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), roundNumber+1)
+	require.NoError(t, err)
+
+	err = session.Decrypt(io.Discard, &cipherData)
+	require.ErrorIs(t, err, tlock.ErrSessionMismatch)
+}
+
+func TestDeriveKeypairAtRound(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	_, err = tlock.DeriveKeypairAtRound(network, roundNumber)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	// a signature of another round doesn't verify.
+	network.AddSignature(roundNumber+1, signature)
+	_, err = tlock.DeriveKeypairAtRound(network, roundNumber+1)
+	require.Error(t, err)
+
+	network.AddSignature(roundNumber, signature)
+	identity, err := tlock.DeriveKeypairAtRound(network, roundNumber)
+	require.NoError(t, err)
+
+	derived, err := tlock.DeriveKeypair(mainnetQuicknet, roundNumber, signature)
+	require.NoError(t, err)
+	require.Equal(t, identity.String(), derived.String())
+
+	other, err := tlock.DeriveKeypair(mainnetQuicknet, roundNumber+1, signature)
+	require.NoError(t, err)
+	require.NotEqual(t, identity.String(), other.String())
+
+	var cipherData bytes.Buffer
+	w, err := age.Encrypt(&cipherData, identity.Recipient())
+	require.NoError(t, err)
+	_, err = w.Write(dataFile)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := age.Decrypt(&cipherData, derived)
+	require.NoError(t, err)
+	plainData, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData)
+}
+
+func TestExtractInjectFileKey(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	w := armor.NewWriter(&cipherData)
+	require.NoError(t, tlock.New(network).Encrypt(w, bytes.NewReader(dataFile), roundNumber))
+	require.NoError(t, w.Close())
+
+	gotRound, gotChainHash, body, err := tlock.ExtractCipherDEK(bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, roundNumber, gotRound)
+	require.Equal(t, mainnetQuicknet, gotChainHash)
+
+	// the file key is recovered without the ciphertext, as on another machine.
+	ciphertext, err := tlock.BytesToCiphertext(*scheme, body)
+	require.NoError(t, err)
+	fileKey, err := tlock.TimeUnlock(*scheme, publicKey, chain.Beacon{Round: roundNumber, Signature: signature}, ciphertext)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	require.NoError(t, tlock.InjectFileKey(&plainData, bytes.NewReader(cipherData.Bytes()), fileKey))
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	// the file key is left untouched.
+	require.NoError(t, tlock.InjectFileKey(io.Discard, bytes.NewReader(cipherData.Bytes()), fileKey))
+
+	wrongKey := bytes.Clone(fileKey)
+	wrongKey[0] ^= 1
+	require.Error(t, tlock.InjectFileKey(io.Discard, bytes.NewReader(cipherData.Bytes()), wrongKey))
+
+	_, _, _, err = tlock.ExtractCipherDEK(strings.NewReader("not a ciphertext"))
+	require.Error(t, err)
+}
+
+func TestTimeUnlockBatch(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	beacon := chain.Beacon{Round: 1234}
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&beacon))
+	require.NoError(t, err)
+	beacon.Signature = signature
+
+	var keys [][]byte
+	var ciphertexts []*ibe.Ciphertext
+	for i := range 4 {
+		key := bytes.Repeat([]byte{byte(i)}, 16)
+		ciphertext, err := tlock.TimeLock(*scheme, publicKey, beacon.Round, key)
+		require.NoError(t, err)
+		keys = append(keys, key)
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+
+	data, err := tlock.TimeUnlockBatch(*scheme, publicKey, beacon, ciphertexts)
+	require.NoError(t, err)
+	require.Equal(t, keys, data)
+
+	// a ciphertext towards another round fails the whole batch.
+	other, err := tlock.TimeLock(*scheme, publicKey, beacon.Round+1, keys[0])
+	require.NoError(t, err)
+	_, err = tlock.TimeUnlockBatch(*scheme, publicKey, beacon, append(ciphertexts, other))
+	require.ErrorContains(t, err, "ciphertext 4")
+
+	beacon.Round++
+	_, err = tlock.TimeUnlockBatch(*scheme, publicKey, beacon, ciphertexts)
+	require.ErrorContains(t, err, "verify beacon")
+}
+
+// swappedRuns makes the stanza type registered by TestRegisterStanzaCodec
+// unique to each of its runs, the registry being global.
+var swappedRuns atomic.Int64
+
+// swappedCodec writes the chain hash before the round, as a third party
+// stanza type would.
+type swappedCodec struct {
+	stanzaType string
+}
+
+func (c swappedCodec) Encode(roundNumber uint64, chainHash string, body []byte) (*age.Stanza, error) {
+	return &age.Stanza{Type: c.stanzaType, Args: []string{chainHash, strconv.FormatUint(roundNumber, 10)}, Body: body}, nil
+}
+
+func (swappedCodec) Decode(stanza *age.Stanza) (uint64, string, []byte, error) {
+	if len(stanza.Args) != 2 {
+		return 0, "", nil, age.ErrIncorrectIdentity
+	}
+	roundNumber, err := strconv.ParseUint(stanza.Args[1], 10, 64)
+	return roundNumber, stanza.Args[0], stanza.Body, err
+}
+
+func TestRegisterStanzaCodec(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	roundNumber := uint64(1234)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: roundNumber}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	stanzaType := fmt.Sprintf("tlock-swapped-%d", swappedRuns.Add(1))
+	recipient := tlock.NewRecipient(network, roundNumber)
+	recipient.SetStanzaType(stanzaType)
+	_, err = recipient.Wrap(make([]byte, 16))
+	require.ErrorIs(t, err, tlock.ErrUnknownStanzaType)
+
+	codec := swappedCodec{stanzaType: stanzaType}
+	tlock.RegisterStanzaCodec(stanzaType, codec)
+	require.Panics(t, func() { tlock.RegisterStanzaCodec(stanzaType, codec) })
+	require.Panics(t, func() { tlock.RegisterStanzaCodec(tlock.StanzaType, codec) })
+
+	var cipherData bytes.Buffer
+	w, err := age.Encrypt(&cipherData, recipient)
+	require.NoError(t, err)
+	_, err = w.Write(dataFile)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	header, err := tlock.ReadHeader(bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []tlock.Stanza{{Type: stanzaType, Round: roundNumber, ChainHash: mainnetQuicknet}}, header.Stanzas)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	plainData.Reset()
+	err = tlock.DecryptBestEffort(&plainData, bytes.NewReader(cipherData.Bytes()), signature)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+}
+
+func TestReEncrypt(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	var reencrypted bytes.Buffer
+	err = tlock.New(network).ReEncrypt(&reencrypted, bytes.NewReader(cipherData.Bytes()), 5678)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	for _, round := range []uint64{1234, 5678} {
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: round}))
+		require.NoError(t, err)
+		network.AddSignature(round, signature)
+	}
+
+	reencrypted.Reset()
+	err = tlock.New(network).ReEncrypt(&reencrypted, bytes.NewReader(cipherData.Bytes()), 5678)
+	require.NoError(t, err)
+
+	header, err := tlock.ReadHeader(bytes.NewReader(reencrypted.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(5678), header.Stanzas[0].Round)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, &reencrypted)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+}
+
+func TestEncryptRounds(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	err = tlock.New(network).EncryptRounds(io.Discard, bytes.NewReader(dataFile))
+	require.ErrorIs(t, err, tlock.ErrInvalidRound)
+	err = tlock.New(network).EncryptRounds(io.Discard, bytes.NewReader(dataFile), 10, 0)
+	require.ErrorIs(t, err, tlock.ErrInvalidRound)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).EncryptRounds(&cipherData, bytes.NewReader(dataFile), 30, 10, 20, 10)
+	require.NoError(t, err)
+
+	// the stanzas are sorted from the earliest round, without duplicates.
+	header, err := tlock.ReadHeader(bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	var rounds []uint64
+	for _, stanza := range header.Stanzas {
+		rounds = append(rounds, stanza.Round)
+	}
+	require.Equal(t, []uint64{10, 20, 30}, rounds)
+
+	err = tlock.New(network).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	// the earliest round is reported, whatever the order of the stanzas.
+	var unsorted bytes.Buffer
+	w, err := age.Encrypt(&unsorted, tlock.NewRecipient(network, 5000), tlock.NewRecipient(network, 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	err = tlock.New(network).Decrypt(io.Discard, &unsorted)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+	require.ErrorContains(t, err, "expected round 100 ")
+
+	// any of the rounds decrypts the ciphertext.
+	for _, round := range []uint64{30, 10} {
+		network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+		require.NoError(t, err)
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: round}))
+		require.NoError(t, err)
+		network.AddSignature(round, signature)
+
+		var plainData bytes.Buffer
+		result, err := tlock.New(network).DecryptWithResult(&plainData, bytes.NewReader(cipherData.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, dataFile, plainData.Bytes())
+		require.Equal(t, round, result.Round)
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	kek := bytes.Repeat([]byte{0x42}, 32)
+	blob, err := tlock.WrapKey(network, 1234, kek)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), blob[0])
+
+	round, chainHash, err := tlock.WrappedKeyTarget(blob)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), round)
+	require.Equal(t, mainnetQuicknet, chainHash)
+
+	_, err = tlock.UnwrapKey(network, blob)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	key, err := tlock.UnwrapKey(network, blob)
+	require.NoError(t, err)
+	require.Equal(t, kek, key)
+
+	// the key is authenticated by the IBE.
+	tampered := bytes.Clone(blob)
+	tampered[len(tampered)-1] ^= 1
+	_, err = tlock.UnwrapKey(network, tampered)
+	require.Error(t, err)
+
+	other, err := fixed.NewNetwork(testnetQuicknetT, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+	_, err = tlock.UnwrapKey(other, blob)
+	require.ErrorIs(t, err, tlock.ErrWrongChainhash)
+
+	_, err = tlock.WrapKey(network, 1234, make([]byte, 33))
+	require.Error(t, err)
+	_, err = tlock.WrapKey(network, 0, kek)
+	require.ErrorIs(t, err, tlock.ErrInvalidRound)
+
+	_, err = tlock.UnwrapKey(network, blob[:41])
+	require.ErrorIs(t, err, tlock.ErrInvalidWrappedKey)
+	_, err = tlock.UnwrapKey(network, append([]byte{2}, blob[1:]...))
+	require.ErrorIs(t, err, tlock.ErrInvalidWrappedKey)
+}
+
+func TestJWE(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	token, err := tlock.SealJWE(network, 1234, dataFile)
+	require.NoError(t, err)
+	require.Len(t, strings.Split(token, "."), 5)
+
+	// the header is readable by any JOSE library.
+	header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"alg":"TLOCK-BLS12381","enc":"A256GCM","tlock_round":1234,"tlock_chain_hash":"`+mainnetQuicknet+`"}`, string(header))
+
+	jwe, err := tlock.ParseJWE(token)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), jwe.Header.Round)
+	require.Equal(t, mainnetQuicknet, jwe.Header.ChainHash)
+
+	_, err = jwe.Open(network)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	plaintext, err := jwe.Open(network)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plaintext)
+
+	// the protected header is authenticated.
+	jwe.Header.Round = 1
+	forged, err := json.Marshal(jwe.Header)
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString(forged)
+	_, err = tlock.ParseJWE(strings.Join(parts, "."))
+	require.ErrorIs(t, err, tlock.ErrInvalidJWE)
+
+	parts = strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString(append(header[:len(header)-1], []byte(`,"kid":"other"}`)...))
+	jwe, err = tlock.ParseJWE(strings.Join(parts, "."))
+	require.NoError(t, err)
+	_, err = jwe.Open(network)
+	require.ErrorIs(t, err, tlock.ErrInvalidJWE)
+
+	_, err = tlock.ParseJWE(strings.Join(parts[:4], "."))
+	require.ErrorIs(t, err, tlock.ErrInvalidJWE)
+}
+
+func TestEncryptDetached(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var header, payload bytes.Buffer
+	err = tlock.New(network).EncryptDetached(&header, &payload, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	// the header holds the stanza and ends with its MAC.
+	parsed, err := tlock.ReadHeader(bytes.NewReader(header.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), parsed.Stanzas[0].Round)
+	lines := strings.Split(strings.TrimSuffix(header.String(), "\n"), "\n")
+	require.True(t, strings.HasPrefix(lines[len(lines)-1], "--- "))
+	require.Greater(t, payload.Len(), len(dataFile))
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).DecryptDetached(&plainData, bytes.NewReader(header.Bytes()), bytes.NewReader(payload.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	// the writer splits ciphertexts written byte by byte too.
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+	header.Reset()
+	payload.Reset()
+	w := tlock.NewDetachedWriter(&header, &payload)
+	for _, c := range cipherData.Bytes() {
+		_, err := w.Write([]byte{c})
+		require.NoError(t, err)
+	}
+	require.Equal(t, cipherData.Bytes(), append(header.Bytes(), payload.Bytes()...))
+	_, err = tlock.ReadHeader(bytes.NewReader(header.Bytes()))
+	require.NoError(t, err)
+}
+
+func TestHideRound(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).HideRound("very secret").Encrypt(&cipherData, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	// the header only discloses the chain.
+	header, _, _ := strings.Cut(cipherData.String(), "\n---")
+	require.Contains(t, header, "-> "+tlock.HiddenStanzaType+" "+mainnetQuicknet+" ")
+	require.NotContains(t, header, "1234")
+	_, err = tlock.ReadHeader(bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrHiddenRound)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrHiddenRound)
+	err = tlock.New(network).HideRound("very secret").Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	err = tlock.New(network).HideRound("wrong").Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrHiddenRound)
+
+	result, err := tlock.New(network).HideRound("very secret").DecryptWithResult(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), result.Round)
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	// the round can be guessed once reached, without the passphrase.
+	plainData.Reset()
+	result, err = tlock.New(network).GuessRounds(1200, 1300).DecryptWithResult(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), result.Round)
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	err = tlock.New(network).GuessRounds(1235, 1300).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.Error(t, err)
+
+	err = tlock.New(network).GuessRounds(1, math.MaxUint64).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrInvalidScanRange)
+}
+
+func TestDecryptScan(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var hidden bytes.Buffer
+	err = tlock.New(network).HideRound("very secret").Encrypt(&hidden, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).DecryptScan(&plainData, bytes.NewReader(hidden.Bytes()), 1200, 1300)
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	err = tlock.New(network).DecryptScan(&plainData, bytes.NewReader(hidden.Bytes()), 1200, 1300)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	err = tlock.New(network).DecryptScan(&plainData, bytes.NewReader(hidden.Bytes()), 1235, 1300)
+	require.Error(t, err)
+
+	// the altered rounds of a stanza are detected by the MAC of the header.
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+	tampered := bytes.Replace(cipherData.Bytes(), []byte("tlock 1234 "), []byte("tlock 1299 "), 1)
+	err = tlock.New(network).DecryptScan(&plainData, bytes.NewReader(tampered), 1200, 1300)
+	require.ErrorContains(t, err, "MAC")
+
+	for _, r := range [][2]uint64{{0, 10}, {10, 5}, {1, tlock.MaxScanRounds + 1}} {
+		err = tlock.New(network).DecryptScan(&plainData, bytes.NewReader(cipherData.Bytes()), r[0], r[1])
+		require.ErrorIs(t, err, tlock.ErrInvalidScanRange)
+	}
+}
+
+func TestTamperedHeader(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	sign := func(secret kyber.Scalar, round uint64) []byte {
+		signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: round}))
+		require.NoError(t, err)
+		return signature
+	}
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+	network.AddSignature(1234, sign(secret, 1234))
+	network.AddSignature(1299, sign(secret, 1299))
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+	ciphertext := cipherData.Bytes()
+
+	// switchTo returns a switcher to a network of another chain, with the key
+	// of the secret.
+	switchTo := func(secret kyber.Scalar) tlock.ChainSwitcher {
+		return func(chainHash string) (tlock.Network, error) {
+			other, err := fixed.NewNetwork(chainHash, scheme.KeyGroup.Point().Mul(secret, nil), scheme, 3*time.Second, 0, nil)
+			if err != nil {
+				return nil, err
+			}
+			other.AddSignature(1234, sign(secret, 1234))
+			return other, nil
+		}
+	}
+
+	// the last line of the body of the stanza, preceding the MAC, holds the
+	// end of V and W.
+	lines := strings.Split(string(ciphertext), "\n")
+	last := slices.IndexFunc(lines, func(line string) bool { return strings.HasPrefix(line, "---") }) - 1
+	body, err := base64.RawStdEncoding.Strict().DecodeString(lines[last])
+	require.NoError(t, err)
+	body[len(body)/2] ^= 0x01
+	lines[last] = base64.RawStdEncoding.EncodeToString(body)
+	flipped := strings.Join(lines, "\n")
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		switcher   tlock.ChainSwitcher
+		err        error
+	}{
+		{
+			name:       "round",
+			ciphertext: strings.Replace(string(ciphertext), "tlock 1234 ", "tlock 1299 ", 1),
+			err:        tlock.ErrStanzaMismatch,
+		},
+		{
+			name:       "chain hash of another key",
+			ciphertext: strings.Replace(string(ciphertext), mainnetQuicknet, testnetQuicknetT, 1),
+			switcher:   switchTo(scheme.KeyGroup.Scalar().Pick(random.New())),
+			err:        tlock.ErrStanzaMismatch,
+		},
+		{
+			name:       "chain hash of the same key",
+			ciphertext: strings.Replace(string(ciphertext), mainnetQuicknet, testnetQuicknetT, 1),
+			switcher:   switchTo(secret),
+			err:        tlock.ErrAlteredHeader,
+		},
+		{
+			name:       "body",
+			ciphertext: flipped,
+			err:        tlock.ErrStanzaMismatch,
+		},
+		{
+			name:       "added stanza",
+			ciphertext: strings.Replace(string(ciphertext), "\n-> tlock", "\n-> grease\n\n-> tlock", 1),
+			err:        tlock.ErrAlteredHeader,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tl := tlock.New(network)
+			if test.switcher != nil {
+				tl = tl.WithChainSwitcher(test.switcher)
+			}
+
+			var plainData bytes.Buffer
+			err := tl.Decrypt(&plainData, strings.NewReader(test.ciphertext))
+			require.ErrorIs(t, err, test.err)
+
+			_, err = tl.OpenReaderAt(strings.NewReader(test.ciphertext), int64(len(test.ciphertext)))
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestWithRecipients(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	auditor, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).WithRecipients(auditor.Recipient()).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	// the tlock stanza comes first, followed by the one of the auditor.
+	lines := strings.Split(cipherData.String(), "\n")
+	require.True(t, strings.HasPrefix(lines[1], "-> "+tlock.StanzaType+" 1234 "))
+	var stanzas []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "-> ") {
+			stanzas = append(stanzas, strings.Fields(line)[1])
+		}
+		if strings.HasPrefix(line, "---") {
+			break
+		}
+	}
+	require.Equal(t, []string{tlock.StanzaType, "X25519"}, stanzas)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	r, err := age.Decrypt(bytes.NewReader(cipherData.Bytes()), auditor)
+	require.NoError(t, err)
+	plaintext, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plaintext)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	plainData.Reset()
+	err = tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+}
+
+func TestEncryptSized(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	// the plaintext and its footer span two chunks of the payload.
+	plaintext := bytes.Repeat(loremBytes, 100*1024/len(loremBytes)+1)[:100*1024]
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).EncryptSized(&cipherData, bytes.NewReader(plaintext), int64(len(plaintext)), 1234)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).DecryptSized(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, plaintext, plainData.Bytes())
+
+	// dropping the last chunk truncates the ciphertext.
+	lastChunk := len(plaintext) + 8 + 32 - 64*1024 + 16
+	truncated := cipherData.Bytes()[:cipherData.Len()-lastChunk]
+	err = tlock.New(network).DecryptSized(io.Discard, bytes.NewReader(truncated))
+	require.ErrorIs(t, err, tlock.ErrTruncated)
+
+	corrupted := bytes.Clone(cipherData.Bytes())
+	corrupted[len(corrupted)-100] ^= 1
+	err = tlock.New(network).DecryptSized(io.Discard, bytes.NewReader(corrupted))
+	require.ErrorIs(t, err, tlock.ErrCorrupted)
+
+	// a ciphertext without footer is too short to be verified.
+	cipherData.Reset()
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewBufferString("short"), 1234)
+	require.NoError(t, err)
+	err = tlock.New(network).DecryptSized(io.Discard, &cipherData)
+	require.ErrorIs(t, err, tlock.ErrTruncated)
+
+	err = tlock.New(network).EncryptSized(io.Discard, bytes.NewReader(plaintext), int64(len(plaintext))+1, 1234)
+	require.ErrorIs(t, err, tlock.ErrSizeMismatch)
+	err = tlock.New(network).EncryptSized(io.Discard, bytes.NewReader(plaintext), int64(len(plaintext))-1, 1234)
+	require.ErrorIs(t, err, tlock.ErrSizeMismatch)
+}
+
+func TestLockMemory(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	err = tlock.New(network).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234)
+	require.NoError(t, err)
+
+	var plainData bytes.Buffer
+	err = tlock.New(network).LockMemory().Decrypt(&plainData, &cipherData)
+	if errors.Is(err, tlock.ErrLockMemoryUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.Equal(t, dataFile, plainData.Bytes())
+}
+
+func TestAuditHook(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, nil)
+	require.NoError(t, err)
+
+	var events []tlock.Event
+	tl := tlock.New(network).WithAuditHook(func(e tlock.Event) {
+		events = append(events, e)
+	})
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tl.EncryptRounds(&cipherData, bytes.NewReader(dataFile), 1300, 1234))
+
+	var plainData bytes.Buffer
+	err = tl.Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+	network.AddSignature(1234, signature)
+
+	require.NoError(t, tl.Decrypt(&plainData, bytes.NewReader(cipherData.Bytes())))
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	session, err := tl.NewDecryptSession(1234)
+	require.NoError(t, err)
+	require.NoError(t, session.Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes())))
+
+	require.Len(t, events, 4)
+	size := int64(len(dataFile))
+	for i, want := range []tlock.Event{
+		{Operation: tlock.OpEncrypt, Round: 1234, ChainHash: mainnetQuicknet, Bytes: size},
+		{Operation: tlock.OpDecrypt, Round: 0, ChainHash: mainnetQuicknet, Bytes: 0},
+		{Operation: tlock.OpDecrypt, Round: 1234, ChainHash: mainnetQuicknet, Bytes: size},
+		{Operation: tlock.OpDecrypt, Round: 1234, ChainHash: mainnetQuicknet, Bytes: size},
+	} {
+		got := events[i]
+		require.Positive(t, got.Duration)
+		if i == 1 {
+			require.ErrorIs(t, got.Err, tlock.ErrTooEarly)
+		} else {
+			require.NoError(t, got.Err)
+		}
+		got.Duration, got.Err = 0, nil
+		require.Equal(t, want, got)
+	}
+
+	// the tlocks without a hook report nothing.
+	require.NoError(t, tlock.New(network).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes())))
+	require.Len(t, events, 4)
+}
+
+func TestMaxSize(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+	size := int64(len(dataFile))
+
+	err = tlock.New(network).WithMaxSize(size-1).Encrypt(io.Discard, bytes.NewReader(dataFile), 1234)
+	require.ErrorIs(t, err, tlock.ErrTooLarge)
+	err = tlock.New(network).WithMaxSize(size-1).EncryptSized(io.Discard, bytes.NewReader(dataFile), size, 1234)
+	require.ErrorIs(t, err, tlock.ErrTooLarge)
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).WithMaxSize(size).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+
+	var plainData bytes.Buffer
+	require.NoError(t, tlock.New(network).WithMaxSize(size).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes())))
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	plainData.Reset()
+	err = tlock.New(network).WithMaxSize(size-1).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooLarge)
+	require.Equal(t, size-1, int64(plainData.Len()))
+
+	_, err = tlock.New(network).WithMaxSize(size-1).OpenReaderAt(bytes.NewReader(cipherData.Bytes()), int64(cipherData.Len()))
+	require.ErrorIs(t, err, tlock.ErrTooLarge)
+
+	session, err := tlock.New(network).WithMaxSize(size - 1).NewDecryptSession(1234)
+	require.NoError(t, err)
+	err = session.Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooLarge)
+
+	// a negative size removes the limit like zero.
+	require.NoError(t, tlock.New(network).WithMaxSize(-1).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes())))
+}
+
+// oracleFunc resolves the conditions with the function.
+type oracleFunc func(chainHash string, condition string) (uint64, error)
+
+func (f oracleFunc) Resolve(chainHash string, condition string) (uint64, error) {
+	return f(chainHash, condition)
+}
+
+func TestOracle(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	const condition = "btc:height 850000"
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).WithCondition(condition).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+
+	header, err := tlock.ReadHeader(bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []tlock.Stanza{{Type: tlock.OracleStanzaType, Round: 1234, ChainHash: mainnetQuicknet, Condition: condition}}, header.Stanzas)
+
+	err = tlock.New(network).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrOracleRequired)
+
+	var resolved uint64
+	oracle := oracleFunc(func(chainHash string, c string) (uint64, error) {
+		require.Equal(t, mainnetQuicknet, chainHash)
+		require.Equal(t, condition, c)
+		if resolved == 0 {
+			return 0, tlock.ErrConditionPending
+		}
+		return resolved, nil
+	})
+
+	err = tlock.New(network).WithOracle(oracle).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+	require.ErrorIs(t, err, tlock.ErrConditionPending)
+
+	resolved = network.Current(time.Now()) + 1
+	err = tlock.New(network).WithOracle(oracle).Decrypt(io.Discard, bytes.NewReader(cipherData.Bytes()))
+	require.ErrorIs(t, err, tlock.ErrTooEarly)
+
+	resolved = network.Current(time.Now())
+	var plainData bytes.Buffer
+	require.NoError(t, tlock.New(network).WithOracle(oracle).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes())))
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	err = tlock.New(network).WithCondition(condition).HideRound("passphrase").Encrypt(io.Discard, bytes.NewReader(dataFile), 1234)
+	require.Error(t, err)
+}
+
+func TestStanzaVersion(t *testing.T) {
+	scheme := crypto.NewPedersenBLSUnchainedG1()
+	secret := scheme.KeyGroup.Scalar().Pick(random.New())
+	publicKey := scheme.KeyGroup.Point().Mul(secret, nil)
+	signature, err := scheme.AuthScheme.Sign(secret, scheme.DigestBeacon(&chain.Beacon{Round: 1234}))
+	require.NoError(t, err)
+
+	network, err := fixed.NewNetwork(mainnetQuicknet, publicKey, scheme, 3*time.Second, 0, signature)
+	require.NoError(t, err)
+
+	var cipherData bytes.Buffer
+	require.NoError(t, tlock.New(network).WithStanzaVersion(tlock.StanzaVersion).Encrypt(&cipherData, bytes.NewReader(dataFile), 1234))
+	require.Contains(t, cipherData.String(), "\n-> tlock v2 1234 "+mainnetQuicknet+"\n")
+
+	header, err := tlock.ReadHeader(bytes.NewReader(cipherData.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []tlock.Stanza{{Type: tlock.StanzaType, Round: 1234, ChainHash: mainnetQuicknet}}, header.Stanzas)
+
+	var plainData bytes.Buffer
+	require.NoError(t, tlock.New(network).Decrypt(&plainData, bytes.NewReader(cipherData.Bytes())))
+	require.Equal(t, dataFile, plainData.Bytes())
+
+	// the stanzas of later versions are reported rather than skipped.
+	later := strings.Replace(cipherData.String(), "-> tlock v2 ", "-> tlock v3 ", 1)
+	err = tlock.New(network).Decrypt(io.Discard, strings.NewReader(later))
+	require.ErrorIs(t, err, tlock.ErrUnsupportedStanzaVersion)
+	require.NotErrorIs(t, err, age.ErrIncorrectIdentity)
+	_, err = tlock.ReadHeader(strings.NewReader(later))
+	require.ErrorIs(t, err, tlock.ErrUnsupportedStanzaVersion)
+
+	stanza, err := tlock.ParseStanza(&age.Stanza{Type: tlock.StanzaType, Args: []string{"v2", "1234", mainnetQuicknet, "multisig=3"}})
+	require.NoError(t, err)
+	require.Equal(t, tlock.Stanza{Type: tlock.StanzaType, Round: 1234, ChainHash: mainnetQuicknet}, stanza)
+	_, err = tlock.ParseStanza(&age.Stanza{Type: tlock.StanzaType, Args: []string{"v2", "1234", mainnetQuicknet, "!bn254"}})
+	require.ErrorIs(t, err, tlock.ErrUnsupportedStanzaVersion)
+
+	err = tlock.New(network).WithStanzaVersion(tlock.StanzaVersion+1).Encrypt(io.Discard, bytes.NewReader(dataFile), 1234)
+	require.ErrorIs(t, err, tlock.ErrUnsupportedStanzaVersion)
+}
@@ -0,0 +1,124 @@
+package tlock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/drand/kyber/encrypt/ibe"
+)
+
+// ErrInvalidWrappedKey represents an error when a wrapped key can't be parsed.
+var ErrInvalidWrappedKey = errors.New("invalid wrapped key")
+
+// wrappedKeyVersion is the version of the format of the wrapped keys, its
+// first byte.
+const wrappedKeyVersion = 1
+
+// maxKeySize is the size of the largest key the IBE can encrypt.
+const maxKeySize = 32
+
+// chainHashSize is the size of the chain hashes of drand, sha256 digests.
+const chainHashSize = 32
+
+// wrappedKeyHeaderSize is the size of the version, the round and the chain
+// hash preceding the IBE ciphertext of a wrapped key.
+const wrappedKeyHeaderSize = 1 + 8 + chainHashSize
+
+// WrapKey timelock encrypts the key, such as the key encryption key of an
+// envelope encryption, towards the round of the chain of the network. The key
+// can be at most 32 bytes long, e.g. an AES-256 key. Unlike Encrypt, it
+// returns a compact blob rather than an age file: a version byte, the round as
+// a big endian uint64, the raw 32 bytes chain hash and the IBE ciphertext, U
+// followed by V and W, both as long as the key.
+func WrapKey(network Network, roundNumber uint64, key []byte) ([]byte, error) {
+	if roundNumber == 0 {
+		return nil, ErrInvalidRound
+	}
+	if len(key) == 0 || len(key) > maxKeySize {
+		return nil, fmt.Errorf("the key must be 1 to %d bytes long", maxKeySize)
+	}
+
+	chainHash, err := hex.DecodeString(network.ChainHash())
+	if err != nil || len(chainHash) != chainHashSize {
+		return nil, fmt.Errorf("%w: %s", ErrWrongChainhash, network.ChainHash())
+	}
+
+	ciphertext, err := TimeLock(network.Scheme(), network.PublicKey(), roundNumber, key)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	u, err := ciphertext.U.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("marshal kyber point: %w", err)
+	}
+
+	// unlike the file keys of the stanzas, the keys aren't all 16 bytes long:
+	// V and W are as long as the key.
+	blob := make([]byte, 0, wrappedKeyHeaderSize+len(u)+2*len(key))
+	blob = append(blob, wrappedKeyVersion)
+	blob = binary.BigEndian.AppendUint64(blob, roundNumber)
+	blob = append(blob, chainHash...)
+	blob = append(blob, u...)
+	blob = append(blob, ciphertext.V...)
+	return append(blob, ciphertext.W...), nil
+}
+
+// UnwrapKey decrypts the key wrapped by WrapKey once its round is reached by
+// the network, which must be of its chain, failing with ErrTooEarly before.
+func UnwrapKey(network Network, blob []byte) ([]byte, error) {
+	roundNumber, chainHash, body, err := parseWrappedKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	if chainHash != network.ChainHash() {
+		return nil, fmt.Errorf("%w: current network uses %s != %s the wrapped key requires", ErrWrongChainhash, network.ChainHash(), chainHash)
+	}
+
+	scheme := network.Scheme()
+	pointLen := scheme.KeyGroup.PointLen()
+	keySize := (len(body) - pointLen) / 2
+	if keySize < 1 || keySize > maxKeySize || pointLen+2*keySize != len(body) {
+		return nil, fmt.Errorf("%w: %d bytes of ciphertext", ErrInvalidWrappedKey, len(body))
+	}
+
+	u := scheme.KeyGroup.Point()
+	if err := u.UnmarshalBinary(body[:pointLen]); err != nil {
+		return nil, fmt.Errorf("%w: unmarshal kyber point: %w", ErrInvalidWrappedKey, err)
+	}
+	ciphertext := ibe.Ciphertext{
+		U: u,
+		V: bytes.Clone(body[pointLen : pointLen+keySize]),
+		W: bytes.Clone(body[pointLen+keySize:]),
+	}
+
+	return NewIdentity(network, false).unlock(candidate{roundNumber: roundNumber, ciphertext: &ciphertext})
+}
+
+// WrappedKeyTarget returns the round and the chain hash of the key wrapped by
+// WrapKey, without decrypting it.
+func WrappedKeyTarget(blob []byte) (roundNumber uint64, chainHash string, err error) {
+	roundNumber, chainHash, _, err = parseWrappedKey(blob)
+	return roundNumber, chainHash, err
+}
+
+// parseWrappedKey returns the round, the chain hash and the IBE ciphertext of
+// the wrapped key.
+func parseWrappedKey(blob []byte) (uint64, string, []byte, error) {
+	if len(blob) <= wrappedKeyHeaderSize {
+		return 0, "", nil, fmt.Errorf("%w: %d bytes", ErrInvalidWrappedKey, len(blob))
+	}
+	if blob[0] != wrappedKeyVersion {
+		return 0, "", nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidWrappedKey, blob[0])
+	}
+
+	roundNumber := binary.BigEndian.Uint64(blob[1:9])
+	if roundNumber == 0 {
+		return 0, "", nil, fmt.Errorf("%w: %w", ErrInvalidWrappedKey, ErrInvalidRound)
+	}
+	chainHash := hex.EncodeToString(blob[9:wrappedKeyHeaderSize])
+
+	return roundNumber, chainHash, blob[wrappedKeyHeaderSize:], nil
+}